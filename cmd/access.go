@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	classifyAccess bool
+	accessLookback string
+)
+
+func init() {
+	rootCmd.Flags().BoolVar(&classifyAccess, "classify-access", false, "classify volumes as hot, warm or cold from their CloudWatch IO and recommend cheaper storage")
+	rootCmd.Flags().StringVar(&accessLookback, "access-lookback", "14d", "window volume IO is summed over with --classify-access")
+}
+
+// printAccessClasses prints the per-class totals and the storage the
+// recommendations cover.
+func printAccessClasses(w io.Writer, report *collector.Report) {
+	fmt.Fprintln(w, "Volumes by access class:")
+	for _, total := range report.AccessClasses {
+		fmt.Fprintf(w, "Class: %s, Volumes: %d, Storage Used: %s\n",
+			total.Class, total.Volumes, formatBytes(total.StorageUsed))
+	}
+
+	byRecommendation := map[string]int64{}
+	var recommendations []string
+	for _, entity := range report.Entities {
+		if entity.Recommendation == "" {
+			continue
+		}
+		if _, ok := byRecommendation[entity.Recommendation]; !ok {
+			recommendations = append(recommendations, entity.Recommendation)
+		}
+		byRecommendation[entity.Recommendation] += entity.StorageUsed
+	}
+	for _, recommendation := range recommendations {
+		fmt.Fprintf(w, "Recommendation: %s, Storage Used: %s\n", recommendation, formatBytes(byRecommendation[recommendation]))
+	}
+}
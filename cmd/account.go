@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// addAccountFlag adds the --account interlock to a mutating command. The
+// value lands in account and is checked with requireAccount.
+func addAccountFlag(cmd *cobra.Command, account *string) {
+	cmd.Flags().StringVar(account, "account", "", "AWS account ID the credentials must belong to (required)")
+}
+
+// requireAccount refuses to continue unless account is the account of the
+// caller's credentials, so destructive actions never hit the wrong account.
+func requireAccount(ctx context.Context, account string) error {
+	if account == "" {
+		return errors.New("refusing to run without --account: pass the ID of the account you intend to modify")
+	}
+	if !accountIDPattern.MatchString(account) {
+		return fmt.Errorf("invalid --account %q: expected a 12 digit account ID", account)
+	}
+
+	caller, err := callerAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	if caller != account {
+		return fmt.Errorf("refusing to run: credentials belong to account %s, not --account %s", caller, account)
+	}
+
+	return nil
+}
+
+// callerAccount returns the ID of the account the credentials belong to.
+func callerAccount(ctx context.Context) (string, error) {
+	cfg, err := loadAwsConfig(bootstrapRegion())
+	if err != nil {
+		return "", err
+	}
+
+	return configAccount(ctx, cfg)
+}
+
+// callerIdentity returns the identity the default credentials belong to.
+// There is none with --fixtures.
+func callerIdentity(ctx context.Context) (*collector.CallerIdentity, error) {
+	if fixturesDir != "" {
+		return nil, nil
+	}
+	cfg, err := loadAwsConfig(bootstrapRegion())
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	return &collector.CallerIdentity{
+		Account: aws.ToString(identity.Account),
+		ARN:     aws.ToString(identity.Arn),
+		UserID:  aws.ToString(identity.UserId),
+	}, nil
+}
+
+// configAccount returns the ID of the account the credentials of cfg belong
+// to.
+func configAccount(ctx context.Context, cfg aws.Config) (string, error) {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	return aws.ToString(identity.Account), nil
+}
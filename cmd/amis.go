@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var storageAMIsCmd = &cobra.Command{
+	Use:   "amis",
+	Short: "Report the snapshot storage behind every self-owned AMI",
+	Long: `Lists the self-owned AMIs of every region with the size of the
+snapshots backing them, largest first. Snapshots shared by several AMIs
+count towards each of them; UNIQUE is the storage only that AMI uses, which
+deregistering it and deleting its snapshots would reclaim.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		report := collector.New(collectorOptions(regions)).Images(context.Background())
+		writeImages(os.Stdout, report, time.Now())
+
+		return nil
+	},
+}
+
+func init() {
+	storageCmd.AddCommand(storageAMIsCmd)
+}
+
+func writeImages(w io.Writer, report collector.ImageReport, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tREGION\tAGE (DAYS)\tSNAPSHOTS\tSIZE\tUNIQUE")
+	for _, image := range report.Images {
+		age := "-"
+		if !image.CreationDate.IsZero() {
+			age = fmt.Sprintf("%.0f", now.Sub(image.CreationDate).Hours()/24)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			image.ID, image.Name, image.Region, age, len(image.Snapshots),
+			formatBytes(image.StorageUsed), formatBytes(image.UniqueStorageUsed))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "AMIs: %d, Snapshots: %d, Storage Used: %s\n",
+		len(report.Images), report.Snapshots, formatBytes(report.StorageUsed))
+}
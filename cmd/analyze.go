@@ -0,0 +1,619 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var analyzeOptions = struct {
+	MaxSnapshots int
+	Retention    collector.RetentionPolicy
+
+	Lookback string
+	PlanFile string
+
+	IdleLookback string
+
+	TieringLookback string
+	TieringPlanFile string
+
+	ArchiveOlderThan string
+	ArchivePlanFile  string
+}{}
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze the scanned storage for savings",
+}
+
+var analyzeSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Show the snapshot chains of every volume and what a retention policy would prune",
+	Long: `Groups the snapshots by source volume and lists each chain oldest first,
+flags volumes with more than --max-snapshots snapshots and estimates the
+storage and monthly cost pruning to the retention policy would save. The
+policy keeps the newest snapshot of each of the last --keep-daily days,
+--keep-weekly weeks and --keep-monthly months. Pending snapshots and
+snapshots backing an AMI are always kept.
+
+Snapshots are incremental, so without --accurate-snapshot-size the savings
+count the full size of every pruned snapshot and are an upper bound.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceSnapshots}
+		opts.EstimateCost = true
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		chains := collector.SnapshotChains(report.Entities, analyzeOptions.Retention, c.AMISnapshotIDs(context.Background()))
+		writeSnapshotChains(os.Stdout, chains, analyzeOptions.MaxSnapshots)
+
+		return nil
+	},
+}
+
+var analyzeGP2Cmd = &cobra.Command{
+	Use:   "gp2",
+	Short: "Estimate the savings of migrating gp2 volumes to gp3",
+	Long: `Sizes a gp3 equivalent of every gp2 volume to the busiest five minutes
+of IOPS and throughput CloudWatch recorded over --lookback, prices both and
+prints the monthly savings together with the ModifyVolume command of each
+volume that would save money. gp3 includes 3000 IOPS and 125 MiB/s; more is
+priced at the us-east-1 list price.
+
+With --plan-file the migrations that would save money are written as a JSON
+plan, which apply --plan modifies the volumes with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lookback, err := parseAge(analyzeOptions.Lookback)
+		if err != nil {
+			return fmt.Errorf("invalid --lookback: %w", err)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS}
+		opts.AccessLookback = lookback
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		migrations, err := c.GP3Migrations(context.Background(), report.Entities)
+		if err != nil {
+			return err
+		}
+		migrations, ignored := ignoreFindings(migrations, func(migration collector.GP3Migration) collector.EntityUsage { return migration.Volume })
+		writeGP3Migrations(os.Stdout, migrations)
+		printIgnored(os.Stdout, ignored)
+
+		if analyzeOptions.PlanFile != "" {
+			return writePlan(analyzeOptions.PlanFile, gp3Plan(migrations, time.Now()))
+		}
+		return nil
+	},
+}
+
+var analyzeIdleCmd = &cobra.Command{
+	Use:   "idle",
+	Short: "Find attached volumes without any IO",
+	Long: `Sums VolumeReadOps and VolumeWriteOps in CloudWatch over --lookback and
+flags attached volumes without a single operation, together with the storage
+and estimated monthly cost they hold. Volumes younger than --lookback are not
+considered.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lookback, err := parseAge(analyzeOptions.IdleLookback)
+		if err != nil {
+			return fmt.Errorf("invalid --lookback: %w", err)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS}
+		opts.EstimateCost = true
+		opts.AccessLookback = lookback
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		idle, ignored := ignoreFindings(c.IdleVolumes(context.Background(), report.Entities), func(volume collector.EntityUsage) collector.EntityUsage { return volume })
+		writeIdleVolumes(os.Stdout, idle, report.Entities)
+		printIgnored(os.Stdout, ignored)
+		return nil
+	},
+}
+
+var analyzeTieringCmd = &cobra.Command{
+	Use:   "tiering",
+	Short: "Recommend moving volumes between SSD and HDD types",
+	Long: `Reads the IOPS, throughput and VolumeIdleTime CloudWatch recorded over
+--lookback for every attached gp2, gp3, st1 and sc1 volume and recommends
+moving volumes whose IO fits st1 or sc1 to the cheaper HDD type, and hot
+st1 and sc1 volumes whose mean throughput drains their burst bucket, that
+near their IOPS limit or that serve small random IO to st1 or gp3.
+
+An HDD type fits when the peak IOPS and throughput stay within its limits
+and the mean throughput within its baseline, which scale with the size of
+the volume; st1 and sc1 volumes are at least 125 GiB. The risk of each move
+grows as the average IO gets smaller and more random: idle volumes and
+large sequential IO are low risk, IO under 64 KiB is high risk. Volumes
+younger than --lookback are not considered.
+
+Recommendations are ranked by monthly savings, then risk, and printed with
+the ModifyVolume command of each. With --plan-file they are written as a
+JSON plan, which apply --plan modifies the volumes with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lookback, err := parseAge(analyzeOptions.TieringLookback)
+		if err != nil {
+			return fmt.Errorf("invalid --lookback: %w", err)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS}
+		opts.AccessLookback = lookback
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		changes, err := c.TierChanges(context.Background(), report.Entities)
+		if err != nil {
+			return err
+		}
+		changes, ignored := ignoreFindings(changes, func(change collector.TierChange) collector.EntityUsage { return change.Volume })
+		writeTierChanges(os.Stdout, changes)
+		printIgnored(os.Stdout, ignored)
+
+		if analyzeOptions.TieringPlanFile != "" {
+			return writePlan(analyzeOptions.TieringPlanFile, tierChangePlan(changes, time.Now()))
+		}
+		return nil
+	},
+}
+
+var analyzeArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Estimate the savings of moving old snapshots to Snapshot Archive",
+	Long: `Prices moving every completed standard tier snapshot older than
+--older-than to the EBS Snapshot Archive tier and prints the monthly savings
+of each. Snapshots backing an AMI are left out.
+
+Archived snapshots are billed for at least 90 days, even when restored or
+deleted sooner, and every restore is charged per GB retrieved and takes up
+to 72 hours. An archived snapshot is a full copy rather than an increment,
+so snapshots sharing most of their blocks with newer ones may cost more
+archived than they save; the estimate prices the size the scan reports.
+
+With --plan-file the snapshots that would save money are written as a JSON
+plan, which apply --plan moves to the archive tier with ModifySnapshotTier.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		olderThan, err := parseAge(analyzeOptions.ArchiveOlderThan)
+		if err != nil {
+			return fmt.Errorf("invalid --older-than: %w", err)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceSnapshots}
+		opts.SnapshotFilter.StorageTier = string(types.StorageTierStandard)
+
+		ctx := context.Background()
+		c := collector.New(opts)
+		report, err := c.Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		candidates, err := c.ArchiveCandidates(ctx, report.Entities, c.AMISnapshotIDs(ctx), time.Now(), olderThan)
+		if err != nil {
+			return err
+		}
+		candidates, ignored := ignoreFindings(candidates, func(candidate collector.ArchiveCandidate) collector.EntityUsage { return candidate.Snapshot })
+		writeArchiveCandidates(os.Stdout, candidates)
+		printIgnored(os.Stdout, ignored)
+
+		if analyzeOptions.ArchivePlanFile != "" {
+			return writePlan(analyzeOptions.ArchivePlanFile, archivePlan(candidates, time.Now()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+	analyzeCmd.AddCommand(analyzeSnapshotsCmd)
+	analyzeCmd.AddCommand(analyzeGP2Cmd)
+	analyzeCmd.AddCommand(analyzeIdleCmd)
+	analyzeCmd.AddCommand(analyzeArchiveCmd)
+	analyzeCmd.AddCommand(analyzeTieringCmd)
+
+	tieringFlags := analyzeTieringCmd.Flags()
+	tieringFlags.StringVar(&analyzeOptions.TieringLookback, "lookback", "14d", "window the volume IO and idle time are read from")
+	tieringFlags.StringVar(&analyzeOptions.TieringPlanFile, "plan-file", "", "write the tier changes as a JSON plan for apply --plan")
+
+	archiveFlags := analyzeArchiveCmd.Flags()
+	archiveFlags.StringVar(&analyzeOptions.ArchiveOlderThan, "older-than", "90d", "only consider snapshots older than this age")
+	archiveFlags.StringVar(&analyzeOptions.ArchivePlanFile, "plan-file", "", "write the snapshots that would save money as a JSON plan for apply --plan")
+
+	analyzeIdleCmd.Flags().StringVar(&analyzeOptions.IdleLookback, "lookback", "30d", "window the volume IO is summed over")
+
+	gp2Flags := analyzeGP2Cmd.Flags()
+	gp2Flags.StringVar(&analyzeOptions.Lookback, "lookback", "14d", "window the peak IOPS and throughput are read from")
+	gp2Flags.StringVar(&analyzeOptions.PlanFile, "plan-file", "", "write the migrations that would save money as a JSON plan for apply --plan")
+
+	flags := analyzeSnapshotsCmd.Flags()
+	flags.IntVar(&analyzeOptions.MaxSnapshots, "max-snapshots", 30, "flag volumes with more snapshots than this")
+	flags.IntVar(&analyzeOptions.Retention.Daily, "keep-daily", 7, "keep the newest snapshot of each of this many days")
+	flags.IntVar(&analyzeOptions.Retention.Weekly, "keep-weekly", 4, "keep the newest snapshot of each of this many weeks")
+	flags.IntVar(&analyzeOptions.Retention.Monthly, "keep-monthly", 0, "keep the newest snapshot of each of this many months")
+}
+
+func writeSnapshotChains(w io.Writer, chains []collector.SnapshotChain, maxSnapshots int) {
+	var flagged, prunable int
+	var bytes int64
+	var cost float64
+
+	for _, chain := range chains {
+		pruned := chain.Prunable()
+		var chainBytes int64
+		var chainCost float64
+		for _, snapshot := range pruned {
+			chainBytes += snapshot.StorageUsed
+			chainCost += snapshot.MonthlyCostUSD
+		}
+		prunable += len(pruned)
+		bytes += chainBytes
+		cost += chainCost
+
+		note := ""
+		if len(chain.Snapshots) > maxSnapshots {
+			flagged++
+			note = fmt.Sprintf(", more than %d snapshots", maxSnapshots)
+		}
+		fmt.Fprintf(w, "Volume: %s, Region: %s, Snapshots: %d, Prunable: %d, Reclaimable Storage: %s, Reclaimable Monthly Cost: $%.2f%s\n",
+			chain.Volume, chain.Region, len(chain.Snapshots), len(pruned), formatBytes(chainBytes), chainCost, note)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  STARTED\tSNAPSHOT\tSIZE\tMONTHLY COST\tACTION")
+		for _, snapshot := range chain.Snapshots {
+			action := "prune"
+			if chain.Keep[snapshot.ID] {
+				action = "keep"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t$%.2f\t%s\n",
+				snapshot.StartTime.UTC().Format("2006-01-02 15:04"), snapshot.ID, formatBytes(snapshot.StorageUsed),
+				snapshot.MonthlyCostUSD, action)
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintf(w, "Volumes: %d, Over Limit: %d, Prunable Snapshots: %d, Reclaimable Storage: %s, Reclaimable Monthly Cost: $%.2f\n",
+		len(chains), flagged, prunable, formatBytes(bytes), cost)
+}
+
+// modifyVolumeCommand is the AWS CLI command migrating a volume to gp3.
+func modifyVolumeCommand(m collector.GP3Migration) string {
+	return fmt.Sprintf("aws ec2 modify-volume --region %s --volume-id %s --volume-type gp3 --iops %d --throughput %d",
+		m.Volume.Region, m.Volume.ID, m.IOPS, m.Throughput)
+}
+
+func writeGP3Migrations(w io.Writer, migrations []collector.GP3Migration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VOLUME\tREGION\tSIZE\tPEAK IOPS\tPEAK MIB/S\tGP3 IOPS\tGP3 MIB/S\tGP2 COST\tGP3 COST\tSAVINGS")
+
+	var savings float64
+	var migrate []collector.GP3Migration
+	for _, m := range migrations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.0f\t%.1f\t%d\t%d\t$%.2f\t$%.2f\t$%.2f\n",
+			m.Volume.ID, m.Volume.Region, formatBytes(m.Volume.StorageUsed), m.PeakIOPS, m.PeakThroughput,
+			m.IOPS, m.Throughput, m.GP2MonthlyCostUSD, m.GP3MonthlyCostUSD, m.MonthlySavingsUSD())
+		if m.MonthlySavingsUSD() > 0 {
+			savings += m.MonthlySavingsUSD()
+			migrate = append(migrate, m)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "gp2 Volumes: %d, Worth Migrating: %d, Potential Monthly Savings: $%.2f\n",
+		len(migrations), len(migrate), savings)
+	for _, m := range migrate {
+		fmt.Fprintln(w, modifyVolumeCommand(m))
+	}
+}
+
+// gp3Plan returns the migrations that would save money as a plan.
+func gp3Plan(migrations []collector.GP3Migration, now time.Time) actionPlan {
+	plan := newPlan("analyze gp2", now)
+	for _, m := range migrations {
+		if m.MonthlySavingsUSD() <= 0 {
+			continue
+		}
+		plan.Actions = append(plan.Actions, planAction{
+			Action:            ActionModifyVolume,
+			ResourceID:        m.Volume.ID,
+			Type:              m.Volume.Type,
+			Region:            m.Volume.Region,
+			StorageUsed:       m.Volume.StorageUsed,
+			MonthlyCostUSD:    m.GP2MonthlyCostUSD,
+			Tags:              m.Volume.Tags,
+			VolumeType:        string(types.VolumeTypeGp3),
+			IOPS:              m.IOPS,
+			Throughput:        m.Throughput,
+			MonthlySavingsUSD: m.MonthlySavingsUSD(),
+		})
+	}
+	return plan
+}
+
+// volumeModification is a ModifyVolume call an analysis recommends.
+type volumeModification struct {
+	Volume      collector.EntityUsage
+	Description string
+	Input       *ec2.ModifyVolumeInput
+}
+
+// modifyVolumes makes the modifications and prints the result of each. A dry
+// run only prints the modifications.
+func modifyVolumes(ctx context.Context, w io.Writer, modifications []volumeModification) error {
+	clients := map[string]*ec2.Client{}
+
+	var modified, failures int
+	for _, m := range modifications {
+		if skipDryRun("modify %s in %s %s", m.Volume.ID, m.Volume.Region, m.Description) {
+			continue
+		}
+
+		client, ok := clients[m.Volume.Region]
+		if !ok {
+			var err error
+			client, err = getEc2Client(m.Volume.Region)
+			if err != nil {
+				return fmt.Errorf("failed to create EC2 client for region %s: %w", m.Volume.Region, err)
+			}
+			clients[m.Volume.Region] = client
+		}
+
+		_, err := client.ModifyVolume(ctx, m.Input)
+		result := "modified"
+		if err != nil {
+			result = "failed: " + err.Error()
+			failures++
+		} else {
+			modified++
+		}
+		fmt.Fprintf(w, "Volume: %s, Region: %s, Result: %s\n", m.Volume.ID, m.Volume.Region, result)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d modifications failed", failures, modified+failures)
+	}
+	return nil
+}
+
+func writeArchiveCandidates(w io.Writer, candidates []collector.ArchiveCandidate) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SNAPSHOT\tREGION\tVOLUME\tSIZE\tAGE (DAYS)\tSTANDARD COST\tARCHIVE COST\tSAVINGS\t90-DAY MINIMUM\tRESTORE COST")
+
+	var bytes int64
+	var savings, restore float64
+	var archive int
+	for _, a := range candidates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.0f\t$%.2f\t$%.2f\t$%.2f\t$%.2f\t$%.2f\n",
+			a.Snapshot.ID, a.Snapshot.Region, a.Snapshot.SourceVolume, formatBytes(a.Snapshot.StorageUsed),
+			a.Age.Hours()/24, a.StandardMonthlyCostUSD, a.ArchiveMonthlyCostUSD, a.MonthlySavingsUSD(),
+			a.MinimumCostUSD, a.RestoreCostUSD)
+		if a.MonthlySavingsUSD() > 0 {
+			archive++
+			bytes += a.Snapshot.StorageUsed
+			savings += a.MonthlySavingsUSD()
+			restore += a.RestoreCostUSD
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Snapshots: %d, Worth Archiving: %d, Archived Storage: %s, Potential Monthly Savings: $%.2f, Cost To Restore All: $%.2f\n",
+		len(candidates), archive, formatBytes(bytes), savings, restore)
+	fmt.Fprintf(w, "Archived snapshots are billed for at least %d days and restores take up to 72 hours\n", collector.ArchiveMinimumDays)
+}
+
+// archivePlan returns the snapshots that would save money as a plan.
+func archivePlan(candidates []collector.ArchiveCandidate, now time.Time) actionPlan {
+	plan := newPlan("analyze archive", now)
+	for _, a := range candidates {
+		if a.MonthlySavingsUSD() <= 0 {
+			continue
+		}
+		snapshot := a.Snapshot
+		plan.Actions = append(plan.Actions, planAction{
+			Action:            ActionArchiveSnapshot,
+			ResourceID:        snapshot.ID,
+			Type:              snapshot.Type,
+			Region:            snapshot.Region,
+			SourceVolume:      snapshot.SourceVolume,
+			StartTime:         snapshot.StartTime.UTC(),
+			StorageUsed:       snapshot.StorageUsed,
+			MonthlyCostUSD:    a.StandardMonthlyCostUSD,
+			Tags:              snapshot.Tags,
+			MonthlySavingsUSD: a.MonthlySavingsUSD(),
+		})
+	}
+	return plan
+}
+
+// archiveSnapshots moves the snapshots to the archive tier and prints the
+// result of each. A dry run only prints the moves.
+func archiveSnapshots(ctx context.Context, w io.Writer, snapshots []collector.EntityUsage) error {
+	clients := map[string]*ec2.Client{}
+
+	var archived, failures int
+	for _, snapshot := range snapshots {
+		if skipDryRun("archive %s in %s", snapshot.ID, snapshot.Region) {
+			continue
+		}
+
+		client, ok := clients[snapshot.Region]
+		if !ok {
+			var err error
+			client, err = getEc2Client(snapshot.Region)
+			if err != nil {
+				return fmt.Errorf("failed to create EC2 client for region %s: %w", snapshot.Region, err)
+			}
+			clients[snapshot.Region] = client
+		}
+
+		_, err := client.ModifySnapshotTier(ctx, &ec2.ModifySnapshotTierInput{
+			SnapshotId:  aws.String(snapshot.ID),
+			StorageTier: types.TargetStorageTierArchive,
+		})
+		result := "archiving"
+		if err != nil {
+			result = "failed: " + err.Error()
+			failures++
+		} else {
+			archived++
+		}
+		fmt.Fprintf(w, "Snapshot: %s, Region: %s, Result: %s\n", snapshot.ID, snapshot.Region, result)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d snapshot archivals failed", failures, archived+failures)
+	}
+	return nil
+}
+
+// writeIdleVolumes prints the idle volumes and how much of the attached
+// volume storage they hold.
+func writeIdleVolumes(w io.Writer, idle, entities []collector.EntityUsage) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VOLUME\tREGION\tTYPE\tINSTANCE\tSIZE\tAGE (DAYS)\tMONTHLY COST")
+
+	var bytes int64
+	var cost float64
+	for _, volume := range idle {
+		bytes += volume.StorageUsed
+		cost += volume.MonthlyCostUSD
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.0f\t$%.2f\n",
+			volume.ID, volume.Region, volume.VolumeType, volume.AttachedInstance, formatBytes(volume.StorageUsed),
+			time.Since(volume.CreateTime).Hours()/24, volume.MonthlyCostUSD)
+	}
+	tw.Flush()
+
+	var attached int64
+	for _, entity := range entities {
+		if entity.Type == collector.EntityTypeVolume && entity.AttachedInstance != "" {
+			attached += entity.StorageUsed
+		}
+	}
+	share := 0.0
+	if attached > 0 {
+		share = float64(bytes) / float64(attached) * 100
+	}
+
+	fmt.Fprintf(w, "Idle Volumes: %d, Idle Storage: %s (%.1f%% of attached), Monthly Cost: $%.2f\n",
+		len(idle), formatBytes(bytes), share, cost)
+}
+
+// tierChangeCommand is the AWS CLI command making a tier change.
+func tierChangeCommand(t collector.TierChange) string {
+	command := fmt.Sprintf("aws ec2 modify-volume --region %s --volume-id %s --volume-type %s",
+		t.Volume.Region, t.Volume.ID, t.TargetType)
+	if t.TargetType == "gp3" {
+		command += fmt.Sprintf(" --iops %d --throughput %d", t.IOPS, t.Throughput)
+	}
+	return command
+}
+
+func writeTierChanges(w io.Writer, changes []collector.TierChange) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VOLUME\tREGION\tSIZE\tTYPE\tTARGET\tPEAK IOPS\tPEAK MIB/S\tMEAN MIB/S\tAVG IO KIB\tIDLE\tRISK\tCURRENT COST\tTARGET COST\tSAVINGS\tREASON")
+
+	var savings float64
+	var toHDD, toSSD int
+	risks := map[string]int{}
+	for _, t := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.0f\t%.1f\t%.1f\t%.0f\t%.0f%%\t%s\t$%.2f\t$%.2f\t$%.2f\t%s\n",
+			t.Volume.ID, t.Volume.Region, formatBytes(t.Volume.StorageUsed), t.Volume.VolumeType, t.TargetType,
+			t.PeakIOPS, t.PeakThroughput, t.AverageThroughput, t.AverageIOSizeKiB, t.IdleShare*100, t.Risk,
+			t.CurrentMonthlyCostUSD, t.TargetMonthlyCostUSD, t.MonthlySavingsUSD(), t.Reason)
+		if t.TargetType == "st1" || t.TargetType == "sc1" {
+			toHDD++
+		} else {
+			toSSD++
+		}
+		savings += t.MonthlySavingsUSD()
+		risks[t.Risk]++
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Recommendations: %d, To HDD: %d, To SSD: %d, Low Risk: %d, Medium Risk: %d, High Risk: %d, Net Monthly Savings: $%.2f\n",
+		len(changes), toHDD, toSSD, risks[collector.RiskLow], risks[collector.RiskMedium], risks[collector.RiskHigh], savings)
+	for _, t := range changes {
+		fmt.Fprintln(w, tierChangeCommand(t))
+	}
+}
+
+// tierChangePlan returns the tier changes as a plan.
+func tierChangePlan(changes []collector.TierChange, now time.Time) actionPlan {
+	plan := newPlan("analyze tiering", now)
+	for _, t := range changes {
+		action := planAction{
+			Action:            ActionModifyVolume,
+			ResourceID:        t.Volume.ID,
+			Type:              t.Volume.Type,
+			Region:            t.Volume.Region,
+			StorageUsed:       t.Volume.StorageUsed,
+			MonthlyCostUSD:    t.CurrentMonthlyCostUSD,
+			Tags:              t.Volume.Tags,
+			VolumeType:        t.TargetType,
+			Reason:            fmt.Sprintf("%s, %s risk", t.Reason, t.Risk),
+			MonthlySavingsUSD: t.MonthlySavingsUSD(),
+		}
+		if t.TargetType == "gp3" {
+			action.IOPS, action.Throughput = t.IOPS, t.Throughput
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+	return plan
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+// Paths of the query API.
+const (
+	apiEntitiesPath = "/api/v1/entities"
+	apiSummaryPath  = "/api/v1/summary"
+)
+
+// apiEntitiesResponse is the /api/v1/entities response.
+type apiEntitiesResponse struct {
+	GeneratedAt         time.Time    `json:"generated_at"`
+	InventoryAgeSeconds float64      `json:"inventory_age_seconds"`
+	Count               int          `json:"count"`
+	StorageUsed         int64        `json:"storage_used"`
+	Entities            []output.Row `json:"entities"`
+}
+
+// apiTotal is the storage of the entities sharing a region or type.
+type apiTotal struct {
+	Entities    int   `json:"entities"`
+	StorageUsed int64 `json:"storage_used"`
+}
+
+// apiSummaryResponse is the /api/v1/summary response.
+type apiSummaryResponse struct {
+	GeneratedAt         time.Time           `json:"generated_at"`
+	InventoryAgeSeconds float64             `json:"inventory_age_seconds"`
+	Entities            int                 `json:"entities"`
+	TotalStorageUsed    int64               `json:"total_storage_used"`
+	MonthlyCostUSD      *float64            `json:"monthly_cost_usd,omitempty"`
+	ByRegion            map[string]apiTotal `json:"by_region"`
+	ByType              map[string]apiTotal `json:"by_type"`
+	FailedRegions       []failedRegion      `json:"failed_regions,omitempty"`
+}
+
+// entityQuery selects the entities of an /api/v1/entities request. Every
+// parameter but min_size may be repeated to match any of its values.
+type entityQuery struct {
+	regions  []string
+	types    []string
+	accounts []string
+	minSize  int64
+}
+
+func parseEntityQuery(values url.Values) (entityQuery, error) {
+	query := entityQuery{
+		regions:  values["region"],
+		types:    values["type"],
+		accounts: values["account_id"],
+	}
+	if minSize := values.Get("min_size"); minSize != "" {
+		size, err := parseSize(minSize)
+		if err != nil {
+			return query, fmt.Errorf("invalid min_size: %w", err)
+		}
+		query.minSize = size
+	}
+	return query, nil
+}
+
+func (q entityQuery) matches(entity collector.EntityUsage) bool {
+	switch {
+	case len(q.regions) > 0 && !slices.Contains(q.regions, entity.Region):
+		return false
+	case len(q.types) > 0 && !slices.Contains(q.types, entity.Type):
+		return false
+	case len(q.accounts) > 0 && !slices.Contains(q.accounts, entity.AccountID):
+		return false
+	}
+	return entity.StorageUsed >= q.minSize
+}
+
+// apiReport returns the finished report as the request's API key may see
+// it, writing an error response and returning nil when there is none yet or
+// the method is not GET.
+func (s *scanStatus) apiReport(w http.ResponseWriter, r *http.Request) *collector.Report {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	s.mu.Lock()
+	report := s.report
+	s.mu.Unlock()
+
+	if report == nil {
+		http.Error(w, "scan in progress", http.StatusServiceUnavailable)
+		return nil
+	}
+	if key := requestKey(r); key != nil {
+		report = key.scope(report)
+	}
+	return report
+}
+
+// serveEntities serves the entities of the latest scan matching the
+// region, type, account_id and min_size query parameters, largest first.
+func (s *scanStatus) serveEntities(w http.ResponseWriter, r *http.Request) {
+	report := s.apiReport(w, r)
+	if report == nil {
+		return
+	}
+
+	query, err := parseEntityQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matched := *report
+	matched.Entities = nil
+	for _, entity := range report.Entities {
+		if query.matches(entity) {
+			matched.Entities = append(matched.Entities, entity)
+		}
+	}
+
+	response := apiEntitiesResponse{
+		GeneratedAt:         report.GeneratedAt,
+		InventoryAgeSeconds: time.Since(report.GeneratedAt).Seconds(),
+		Count:               len(matched.Entities),
+	}
+	for _, entity := range matched.Entities {
+		response.StorageUsed += entity.StorageUsed
+	}
+	if streamOutput {
+		sortReportEntities(matched.Entities)
+		streamJSONResponse(w, struct {
+			apiEntitiesResponse
+			Entities *[]output.Row `json:"entities,omitempty"`
+		}{apiEntitiesResponse: response}, &matched)
+		return
+	}
+	response.Entities = reportRows(&matched)
+
+	writeAPIResponse(w, response)
+}
+
+// serveSummary serves the totals of the latest scan by region and type.
+func (s *scanStatus) serveSummary(w http.ResponseWriter, r *http.Request) {
+	report := s.apiReport(w, r)
+	if report == nil {
+		return
+	}
+
+	response := apiSummaryResponse{
+		GeneratedAt:         report.GeneratedAt,
+		InventoryAgeSeconds: time.Since(report.GeneratedAt).Seconds(),
+		Entities:            len(report.Entities),
+		TotalStorageUsed:    report.TotalStorageUsed,
+		ByRegion:            map[string]apiTotal{},
+		ByType:              map[string]apiTotal{},
+		FailedRegions:       failedRegions(report),
+	}
+
+	var cost float64
+	for _, entity := range report.Entities {
+		region := response.ByRegion[entity.Region]
+		region.Entities++
+		region.StorageUsed += entity.StorageUsed
+		response.ByRegion[entity.Region] = region
+
+		kind := response.ByType[entity.Type]
+		kind.Entities++
+		kind.StorageUsed += entity.StorageUsed
+		response.ByType[entity.Type] = kind
+
+		cost += entity.MonthlyCostUSD
+	}
+	if report.CostEstimated {
+		response.MonthlyCostUSD = &cost
+	}
+
+	writeAPIResponse(w, response)
+}
+
+func writeAPIResponse(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"go.yaml.in/yaml/v3"
+)
+
+// apiKey is one entry of --api-keys-file. A key without accounts and tags
+// sees everything; otherwise it only sees the entities of its accounts that
+// carry all of its tags.
+type apiKey struct {
+	Name     string            `yaml:"name"`
+	Key      string            `yaml:"key"`
+	Accounts []string          `yaml:"accounts"`
+	Tags     map[string]string `yaml:"tags"`
+
+	// registry serves the metrics of a scoped key's entities.
+	registry *prometheus.Registry
+	metrics  *collector.Metrics
+}
+
+// apiKeys authenticates the requests of the multi-tenant serve mode.
+type apiKeys struct {
+	keys     []*apiKey
+	requests *prometheus.CounterVec
+}
+
+type apiKeyContextKey struct{}
+
+// loadAPIKeys reads --api-keys-file, a YAML document such as
+//
+//	keys:
+//	  - name: team-a
+//	    key: 0b7c...
+//	    accounts: ["123456789012"]
+//	    tags: {Team: a}
+//
+// It returns nil when path is empty.
+func loadAPIKeys(path string) (*apiKeys, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var file struct {
+		Keys []*apiKey `yaml:"keys"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid API keys file %s: %w", path, err)
+	}
+	if len(file.Keys) == 0 {
+		return nil, fmt.Errorf("invalid API keys file %s: no keys", path)
+	}
+
+	names := map[string]bool{}
+	for i, key := range file.Keys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("invalid API keys file %s: key %d needs a name and a key", path, i+1)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("invalid API keys file %s: duplicate name %s", path, key.Name)
+		}
+		names[key.Name] = true
+
+		if key.scoped() {
+			key.registry = prometheus.NewRegistry()
+			key.metrics = newMetrics()
+			if err := key.metrics.Register(key.registry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	keys := &apiKeys{
+		keys: file.Keys,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crankymosquitos_http_requests_total",
+			Help: "HTTP requests served, by API key, path and status code",
+		}, []string{"key", "path", "code"}),
+	}
+	if err := prometheus.DefaultRegisterer.Register(keys.requests); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (k *apiKey) scoped() bool {
+	return len(k.Accounts) > 0 || len(k.Tags) > 0
+}
+
+// allows reports whether the key may see the entity.
+func (k *apiKey) allows(entity collector.EntityUsage) bool {
+	if len(k.Accounts) > 0 {
+		found := false
+		for _, account := range k.Accounts {
+			if account == entity.AccountID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for tag, value := range k.Tags {
+		if entity.Tags[tag] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// scope returns a copy of the report holding only the entities the key may
+// see, and the findings and growth of them, with the totals recomputed.
+// Sections about the whole scan, such as quotas, API calls and failed
+// regions, are left out, as is the forecast: the history it is fitted to
+// holds totals of every tenant.
+func (k *apiKey) scope(report *collector.Report) *collector.Report {
+	scoped := *report
+	scoped.Entities = nil
+	scoped.Regions = nil
+	scoped.Groups = nil
+	scoped.Stacks = nil
+	scoped.Owners = nil
+	scoped.Accounts = nil
+	scoped.Findings = nil
+	scoped.Forecast = nil
+	scoped.Quotas = nil
+	scoped.APIThrottles = nil
+	scoped.RegionThrottles = nil
+	scoped.APICalls = nil
+	scoped.RegionErrors = nil
+	scoped.FailedRegions = nil
+	scoped.TotalStorageUsed = 0
+
+	for _, entity := range report.Entities {
+		if k.allows(entity) {
+			scoped.Entities = append(scoped.Entities, entity)
+			scoped.TotalStorageUsed += entity.StorageUsed
+		}
+	}
+	if scoped.GroupByTag != "" {
+		scoped.Groups = collector.GroupByTag(scoped.Entities, scoped.GroupByTag)
+	}
+	scoped.Stacks = collector.GroupByStack(scoped.Entities)
+	if report.Owners != nil {
+		scoped.Owners = collector.GroupByOwner(scoped.Entities)
+	}
+	if scoped.AccessClasses != nil {
+		scoped.AccessClasses = collector.AccessClassTotals(scoped.Entities)
+	}
+	if report.Accounts != nil {
+		scoped.Accounts = collector.AccountTotals(scoped.Entities)
+	}
+	if report.Growth != nil {
+		growth := report.Growth.Scope(scoped.Entities)
+		scoped.Growth = &growth
+	}
+	for _, finding := range report.Findings {
+		if finding.Entity != nil && k.allows(*finding.Entity) {
+			scoped.Findings = append(scoped.Findings, finding)
+		}
+	}
+
+	// Keep the regions scanned, with the totals of the key's entities
+	index := map[string]int{}
+	for _, summary := range report.Regions {
+		if _, ok := index[summary.Region]; !ok {
+			index[summary.Region] = len(scoped.Regions)
+			scoped.Regions = append(scoped.Regions, collector.RegionSummary{Region: summary.Region, Duration: summary.Duration})
+		}
+	}
+	for _, entity := range scoped.Entities {
+		if i, ok := index[entity.Region]; ok {
+			scoped.Regions[i].Entities++
+			scoped.Regions[i].StorageUsed += entity.StorageUsed
+		}
+	}
+	return &scoped
+}
+
+// scopesAccounts reports whether any key is limited to accounts, which
+// needs every entity labeled with its account.
+func (k *apiKeys) scopesAccounts() bool {
+	if k == nil {
+		return false
+	}
+	for _, key := range k.keys {
+		if len(key.Accounts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// observe sets the metrics of every scoped key from its part of the report.
+func (k *apiKeys) observe(report *collector.Report) {
+	if k == nil {
+		return
+	}
+	for _, key := range k.keys {
+		if key.scoped() {
+			key.metrics.Observe(key.scope(report))
+		}
+	}
+}
+
+// lookup returns the key a request carries as "Authorization: Bearer <key>"
+// or "X-API-Key: <key>", or nil.
+func (k *apiKeys) lookup(r *http.Request) *apiKey {
+	presented := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		presented = bearer
+	}
+	if presented == "" {
+		return nil
+	}
+
+	var match *apiKey
+	for _, key := range k.keys {
+		// Compare against every key so the time taken reveals nothing.
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(key.Key)) == 1 {
+			match = key
+		}
+	}
+	return match
+}
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// authenticate rejects requests without a valid key, makes the key
+// available to the handlers and counts the requests per key.
+func (k *apiKeys) authenticate(next http.Handler, paths []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := "other"
+		for _, p := range paths {
+			if r.URL.Path == p {
+				path = p
+			}
+		}
+
+		key := k.lookup(r)
+		if key == nil {
+			k.requests.WithLabelValues("", path, strconv.Itoa(http.StatusUnauthorized)).Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="crankymosquitos"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		k.requests.WithLabelValues(key.Name, path, strconv.Itoa(recorder.code)).Inc()
+	})
+}
+
+// requestKey returns the scoped API key of a request, nil when the request
+// may see everything.
+func requestKey(r *http.Request) *apiKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*apiKey)
+	if key == nil || !key.scoped() {
+		return nil
+	}
+	return key
+}
+
+// scopedMetrics serves a scoped key the metrics of its own entities and
+// everyone else the full metrics.
+func scopedMetrics(full http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := requestKey(r); key != nil {
+			promhttp.HandlerFor(key.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+			return
+		}
+		full.ServeHTTP(w, r)
+	})
+}
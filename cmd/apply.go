@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var applyOptions = struct {
+	Plan    string
+	Yes     bool
+	Account string
+}{}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Execute the volume modifications and snapshot archivals of a plan",
+	Long: `Executes a plan written with --plan-file by analyze gp2, analyze
+rightsizing, analyze tiering or analyze archive: volumes are modified with
+ModifyVolume and snapshots moved to the archive tier with ModifySnapshotTier.
+Nothing is scanned, and nothing is changed without --yes; --dry-run only
+lists the actions.
+
+The plan must be unchanged since it was written, signed with the
+--plan-key-file if one is given, and made for the --account the credentials
+belong to. Deletion plans are executed by cleanup --plan.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := applyOptions
+		if opts.Plan == "" {
+			return errors.New("nothing to do: pass the plan to execute with --plan")
+		}
+		if !dryRun && !opts.Yes {
+			return errors.New("refusing to change resources without --yes (use --dry-run to preview)")
+		}
+
+		ctx := context.Background()
+		plan, err := readPlan(opts.Plan, "apply", ActionModifyVolume, ActionArchiveSnapshot)
+		if err != nil {
+			return err
+		}
+
+		if err := requireAccount(ctx, opts.Account); err != nil {
+			return err
+		}
+		if err := checkPlanAccount(opts.Plan, plan, opts.Account); err != nil {
+			return err
+		}
+
+		return errors.Join(
+			modifyVolumes(ctx, os.Stdout, plan.volumeModifications()),
+			archiveSnapshots(ctx, os.Stdout, plan.archivals()),
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	flags := applyCmd.Flags()
+	flags.StringVar(&applyOptions.Plan, "plan", "", "plan written by an analysis with --plan-file")
+	flags.BoolVar(&applyOptions.Yes, "yes", false, "confirm that resources should really be changed")
+	addAccountFlag(applyCmd, &applyOptions.Account)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	backupSLATag   string
+	backupSLA      map[string]string
+	maxSnapshotAge string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&backupSLATag, "backup-sla-tag", "Criticality", "volume tag whose value selects a backup SLA")
+	rootCmd.Flags().StringToStringVar(&backupSLA, "backup-sla", map[string]string{"critical": "24h"}, "maximum snapshot age per backup SLA tag value")
+	rootCmd.Flags().StringVar(&maxSnapshotAge, "max-snapshot-age", "7d", "flag in-use volumes whose latest snapshot is older than this (e.g. 7d), 0 to skip the check")
+}
+
+// backupSLAMaxAges parses the --backup-sla values.
+func backupSLAMaxAges() (map[string]time.Duration, error) {
+	maxAges := make(map[string]time.Duration, len(backupSLA))
+	for value, age := range backupSLA {
+		d, err := time.ParseDuration(age)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup SLA for %s=%s: %w", value, age, err)
+		}
+		maxAges[value] = d
+	}
+	return maxAges, nil
+}
+
+func backupAgeString(hours float64) string {
+	if math.IsInf(hours, 1) {
+		return "never"
+	}
+	return fmt.Sprintf("%.1f", hours)
+}
+
+// printBackupSLAViolations prints the volumes whose latest snapshot is older
+// than their SLA allows, oldest first.
+func printBackupSLAViolations(w io.Writer, entities []collector.EntityUsage) {
+	var violations []collector.EntityUsage
+	for _, entity := range entities {
+		if entity.BackupSLAViolated() {
+			violations = append(violations, entity)
+		}
+	}
+
+	if len(violations) == 0 {
+		return
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return *violations[i].BackupAgeHours > *violations[j].BackupAgeHours
+	})
+
+	fmt.Fprintf(w, "Backup SLA violations (%d):\n", len(violations))
+	for _, entity := range violations {
+		fmt.Fprintf(w, "Volume ID: %s, Region: %s, %s: %s, Last Snapshot Age (hours): %s, Max Age: %s\n",
+			entity.ID, entity.Region, backupSLATag, entity.Tags[backupSLATag],
+			backupAgeString(*entity.BackupAgeHours), entity.BackupSLAMaxAge)
+	}
+}
+
+func snapshotAgeString(seconds float64) string {
+	if math.IsInf(seconds, 1) {
+		return "never"
+	}
+	return fmt.Sprintf("%.0f", seconds)
+}
+
+// printSnapshotCoverageGaps prints the in-use volumes whose latest snapshot
+// is older than --max-snapshot-age or that have none, oldest first.
+func printSnapshotCoverageGaps(w io.Writer, entities []collector.EntityUsage) {
+	var gaps []collector.EntityUsage
+	for _, entity := range entities {
+		if entity.SnapshotGap {
+			gaps = append(gaps, entity)
+		}
+	}
+
+	if len(gaps) == 0 {
+		return
+	}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return *gaps[i].SnapshotAge > *gaps[j].SnapshotAge
+	})
+
+	fmt.Fprintf(w, "Snapshot coverage gaps (%d):\n", len(gaps))
+	for _, entity := range gaps {
+		age := "never"
+		if !math.IsInf(*entity.SnapshotAge, 1) {
+			age = fmt.Sprintf("%.1f", *entity.SnapshotAge/(24*60*60))
+		}
+		fmt.Fprintf(w, "Volume ID: %s, Region: %s, Instance: %s, Last Snapshot Age (days): %s, Max Age: %s\n",
+			entity.ID, entity.Region, entity.AttachedInstance, age, maxSnapshotAge)
+	}
+}
+
+// printBackupStorage prints the AWS Backup recovery point storage by vault,
+// resource type and region.
+func printBackupStorage(w io.Writer, summary collector.BackupSummary) {
+	if len(summary.ByRegion) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Backup storage by vault (%d):\n", len(summary.ByVault))
+	for _, usage := range summary.ByVault {
+		fmt.Fprintf(w, "Vault: %s, Region: %s, Recovery Points: %d, Storage Used: %s\n",
+			usage.Value, usage.Region, usage.RecoveryPoints, formatBytes(usage.StorageUsed))
+	}
+
+	fmt.Fprintf(w, "Backup storage by resource type (%d):\n", len(summary.ByResourceType))
+	for _, usage := range summary.ByResourceType {
+		fmt.Fprintf(w, "Resource Type: %s, Region: %s, Recovery Points: %d, Storage Used: %s\n",
+			usage.Value, usage.Region, usage.RecoveryPoints, formatBytes(usage.StorageUsed))
+	}
+
+	fmt.Fprintf(w, "Backup storage by region (%d):\n", len(summary.ByRegion))
+	for _, usage := range summary.ByRegion {
+		fmt.Fprintf(w, "Region: %s, Recovery Points: %d, Storage Used: %s\n",
+			usage.Value, usage.RecoveryPoints, formatBytes(usage.StorageUsed))
+	}
+}
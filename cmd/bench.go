@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector/collectortest"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+var benchOptions = struct {
+	Entities int
+	Seed     int64
+	Formats  []string
+}{}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the report pipeline on synthetic entities",
+	Long: `Generates --entities fake entities and times each stage of the pipeline a
+scan report goes through: sorting, tag and stack aggregation, building the
+report rows, rendering them in each of --formats and publishing them as
+Prometheus metrics. No AWS API is called. For every stage it reports the
+duration, the throughput and the memory allocated, so that performance
+regressions can be compared between builds with the same --seed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if benchOptions.Entities <= 0 {
+			return fmt.Errorf("invalid --entities %d: must be positive", benchOptions.Entities)
+		}
+		formatters := map[string]output.Formatter{}
+		for _, name := range benchOptions.Formats {
+			formatter, err := output.Get(name)
+			if err != nil {
+				return err
+			}
+			formatters[name] = formatter
+		}
+
+		return runBench(os.Stdout, benchOptions.Entities, benchOptions.Seed, benchOptions.Formats, formatters)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().IntVar(&benchOptions.Entities, "entities", 1_000_000, "number of entities to synthesize")
+	benchCmd.Flags().Int64Var(&benchOptions.Seed, "seed", 1, "seed of the entity generator")
+	benchCmd.Flags().StringSliceVar(&benchOptions.Formats, "formats", []string{"table", "json"}, "output formats to render")
+}
+
+// benchStage is the measurement of one pipeline stage.
+type benchStage struct {
+	Name      string
+	Duration  time.Duration
+	Allocated uint64 // Bytes allocated during the stage
+	Heap      uint64 // Bytes of live heap after the stage
+}
+
+// measure runs fn and records its duration and allocations.
+func measure(stages []benchStage, name string, fn func() error) ([]benchStage, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	started := time.Now()
+	err := fn()
+	duration := time.Since(started)
+
+	runtime.ReadMemStats(&after)
+	return append(stages, benchStage{
+		Name:      name,
+		Duration:  duration,
+		Allocated: after.TotalAlloc - before.TotalAlloc,
+		Heap:      after.HeapAlloc,
+	}), err
+}
+
+func runBench(w io.Writer, n int, seed int64, formats []string, formatters map[string]output.Formatter) error {
+	var stages []benchStage
+	var report *collector.Report
+	var rows []output.Row
+	var err error
+
+	step := func(name string, fn func() error) {
+		if err == nil {
+			stages, err = measure(stages, name, fn)
+		}
+	}
+
+	step("generate", func() error {
+		report = collectortest.GenerateReport(n, seed)
+		return nil
+	})
+	step("sort", func() error {
+		sortEntities(report.Entities)
+		return nil
+	})
+	step("group by tag", func() error {
+		report.GroupByTag = "Team"
+		report.Groups = collector.GroupByTag(report.Entities, report.GroupByTag)
+		return nil
+	})
+	step("group by stack", func() error {
+		report.Stacks = collector.GroupByStack(report.Entities)
+		return nil
+	})
+	step("rows", func() error {
+		rows = reportRows(report)
+		return nil
+	})
+	for _, name := range formats {
+		formatter := formatters[name]
+		step("render "+name, func() error {
+			return formatter.Format(io.Discard, reportColumns, rows)
+		})
+	}
+	step("metrics", func() error {
+		registry := prometheus.NewRegistry()
+		metrics := newMetrics()
+		if err := metrics.Register(registry); err != nil {
+			return err
+		}
+		metrics.Observe(report)
+		_, err := registry.Gather()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("bench stage %s failed: %w", stages[len(stages)-1].Name, err)
+	}
+
+	writeBench(w, n, stages)
+	return nil
+}
+
+func writeBench(w io.Writer, n int, stages []benchStage) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tDURATION\tENTITIES/S\tALLOCATED\tHEAP")
+
+	var total time.Duration
+	var allocated, peak uint64
+	for _, stage := range stages {
+		total += stage.Duration
+		allocated += stage.Allocated
+		peak = max(peak, stage.Heap)
+
+		fmt.Fprintf(tw, "%s\t%s\t%.0f\t%s\t%s\n", stage.Name, stage.Duration.Round(time.Millisecond),
+			float64(n)/stage.Duration.Seconds(), formatFileSize(int64(stage.Allocated)), formatFileSize(int64(stage.Heap)))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Entities: %d, Duration: %s, Allocated: %s, Peak Heap: %s\n",
+		n, total.Round(time.Millisecond), formatFileSize(int64(allocated)), formatFileSize(int64(peak)))
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// budgetExitCode is the exit status of a scan that exceeds a budget, set
+// apart from the status 1 of a failed scan.
+const budgetExitCode = 2
+
+var budgetOptions = struct {
+	TotalOver      string
+	UnattachedOver string
+}{}
+
+func init() {
+	addBudgetFlags(rootCmd)
+	addBudgetFlags(storageS3Cmd)
+}
+
+func addBudgetFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&budgetOptions.TotalOver, "fail-if-total-over", "", "scan once and exit with status 2 when the total storage exceeds this size (e.g. 50TB)")
+	flags.StringVar(&budgetOptions.UnattachedOver, "fail-if-unattached-over", "", "scan once and exit with status 2 when unattached volumes exceed this size (e.g. 1TB)")
+}
+
+// budgetsEnabled reports whether a budget flag is set, which turns the
+// command into a single scan without a metrics server.
+func budgetsEnabled() bool {
+	return budgetOptions.TotalOver != "" || budgetOptions.UnattachedOver != ""
+}
+
+// validateBudgets checks the budget flags before the scan starts.
+func validateBudgets() error {
+	if budgetOptions.TotalOver != "" {
+		if _, err := parseSize(budgetOptions.TotalOver); err != nil {
+			return fmt.Errorf("invalid --fail-if-total-over: %w", err)
+		}
+	}
+	if budgetOptions.UnattachedOver != "" {
+		if _, err := parseSize(budgetOptions.UnattachedOver); err != nil {
+			return fmt.Errorf("invalid --fail-if-unattached-over: %w", err)
+		}
+	}
+	return nil
+}
+
+// budgetViolation is a budget the report exceeds.
+type budgetViolation struct {
+	Budget string // Flag of the budget, without the fail-if- prefix
+	Label  string
+	Used   int64
+	Limit  int64
+}
+
+func (v budgetViolation) String() string {
+	return fmt.Sprintf("%s: %s, Limit: %s", v.Label, formatBytes(v.Used), formatBytes(v.Limit))
+}
+
+// budgetViolations returns every budget the report exceeds.
+func budgetViolations(report *collector.Report) []budgetViolation {
+	var violations []budgetViolation
+
+	if budgetOptions.TotalOver != "" {
+		limit, _ := parseSize(budgetOptions.TotalOver)
+		if report.TotalStorageUsed > limit {
+			violations = append(violations, budgetViolation{"total-over", "Total Storage Used", report.TotalStorageUsed, limit})
+		}
+	}
+
+	if budgetOptions.UnattachedOver != "" {
+		limit, _ := parseSize(budgetOptions.UnattachedOver)
+		var unattached int64
+		for _, entity := range report.Entities {
+			if entity.Type == collector.EntityTypeVolume && entity.AttachedInstance == "" {
+				unattached += entity.StorageUsed
+			}
+		}
+		if unattached > limit {
+			violations = append(violations, budgetViolation{"unattached-over", "Unattached Volumes", unattached, limit})
+		}
+	}
+
+	return violations
+}
+
+// enforceBudgets exits with budgetExitCode when the report exceeds a
+// budget.
+func enforceBudgets(report *collector.Report) {
+	violations := budgetViolations(report)
+	for _, violation := range violations {
+		fmt.Fprintf(os.Stderr, "Budget exceeded: %s\n", violation)
+	}
+	if len(violations) > 0 {
+		os.Exit(budgetExitCode)
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// cacheFiles returns the caches and per-run artifacts, by default all in
+// --state-dir.
+func cacheFiles() []string {
+	return []string{
+		regionsCacheFile,
+		pricingCacheFile,
+		snapshotSizeCacheFile,
+		nameCacheFile,
+		groupsOutputFile,
+	}
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the caches and per-run artifacts",
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the regions, pricing, snapshot size and name caches and the tag groups file",
+	Long: `Removes the caches and per-run artifacts, including --regions-cache-file,
+and reports their size before and after. The caches are rebuilt by the next
+scan. The --history-db and audit logs are not touched; use history prune to
+shrink the history database.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cleanCaches(os.Stdout, cacheFiles())
+	},
+}
+
+var (
+	nameCacheTTL          string
+	nameLookupConcurrency int
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&nameCacheTTL, "name-cache-ttl", "1d", "reuse the instance and volume names looked up by earlier scans for this long (0 to look them up every scan)")
+	rootCmd.PersistentFlags().IntVar(&nameLookupConcurrency, "name-lookup-concurrency", collector.DefaultNameLookupConcurrency, "concurrent batches of instance and volume name lookups across the regions of a scan")
+
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+}
+
+// fileSize returns the size of a file, 0 when it does not exist.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// cleanCaches removes the files, along with leftovers of interrupted atomic
+// writes, and prints what was removed.
+func cleanCaches(w io.Writer, files []string) error {
+	var before, after int64
+
+	for _, file := range files {
+		for _, path := range []string{file, file + ".tmp"} {
+			info, err := os.Stat(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			size := info.Size()
+			before += size
+
+			if skipDryRun("remove %s (%s)", path, formatFileSize(size)) {
+				after += size
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				after += size
+				fmt.Fprintf(w, "Failed to remove %s: %v\n", path, err)
+				continue
+			}
+			fmt.Fprintf(w, "Removed %s (%s)\n", path, formatFileSize(size))
+		}
+	}
+
+	fmt.Fprintf(w, "Cache Size: %s -> %s\n", formatFileSize(before), formatFileSize(after))
+	return nil
+}
+
+// formatFileSize formats a file size with binary prefixes. Unlike
+// formatBytes it keeps precision for the small sizes of cache files.
+func formatFileSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Cleanup actions recorded in the audit log.
+const (
+	ActionDeleteVolume   = "DeleteVolume"
+	ActionDeleteSnapshot = "DeleteSnapshot"
+)
+
+var cleanupOptions = struct {
+	DeleteUnattachedVolumes bool
+	DeleteOrphanSnapshots   bool
+	OlderThan               string
+	Yes                     bool
+	ProtectTags             []string
+	AuditLog                string
+	Account                 string
+	SnapshotBeforeDelete    bool
+	FinalSnapshotRetention  string
+	NotifyOwners            map[string]string
+	Plan                    string
+	PlanFile                string
+}{}
+
+// cleanupAction is a single planned mutation.
+type cleanupAction struct {
+	Action      string
+	Entity      collector.EntityUsage
+	Owner       string
+	OwnerSource string
+}
+
+// auditRecord is one line of the cleanup audit log.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	ResourceID  string    `json:"resource_id"`
+	Type        string    `json:"type"`
+	Region      string    `json:"region"`
+	Owner       string    `json:"owner,omitempty"`
+	StorageUsed int64     `json:"storage_used"`
+	DryRun      bool      `json:"dry_run"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+
+	FinalSnapshotID string `json:"final_snapshot_id,omitempty"`
+}
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete orphaned volumes and snapshots",
+	Long: `Deletes the resources the orphans report flags. Nothing is deleted
+without --yes; --dry-run only lists what would be deleted and writes no audit
+log. Resources carrying a --protect-tag are never touched, and every action
+is appended to the audit log. --account must name the account the
+credentials belong to.
+
+With --snapshot-before-delete every volume is snapshotted before it is
+deleted. The final snapshot is tagged with its source volume and a
+retain-until date, and later cleanups leave it alone until that date.
+
+Every resource is assigned an owner from its --owner-tags, the CloudTrail
+identity that created it (--owner-from-cloudtrail) or its account's
+--account-owner, and the report is grouped by owner. With --notify-owner
+each owner's resources are posted as JSON to the owner's webhook.
+
+Resources are only ever deleted through a plan. --plan-file writes the
+deletions the flags select as a JSON plan, checksummed and, with
+--plan-key-file, signed; review it, then delete its resources with
+cleanup --plan FILE --yes, which scans nothing. Plans written by simulate
+retention --plan-file are executed the same way. The plan must be unchanged
+since it was written and made for the --account being cleaned up. Its
+resources are described again first: those now attached, being snapshotted
+or modified, or otherwise changed are skipped, and the protect tags apply to
+their current tags.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := cleanupOptions
+		if opts.Plan != "" {
+			if opts.DeleteUnattachedVolumes || opts.DeleteOrphanSnapshots || opts.PlanFile != "" {
+				return errors.New("--plan executes the deletions of the plan only: drop --delete-unattached-volumes, --delete-orphan-snapshots and --plan-file")
+			}
+			return executeCleanupPlan()
+		}
+
+		if !opts.DeleteUnattachedVolumes && !opts.DeleteOrphanSnapshots {
+			return errors.New("nothing to do: pass --delete-unattached-volumes and/or --delete-orphan-snapshots")
+		}
+		if opts.PlanFile == "" && !dryRun {
+			return errors.New("cleanup only deletes the resources of a plan: write one with --plan-file, review it, then run cleanup --plan FILE --yes (use --dry-run to preview)")
+		}
+
+		olderThan, err := parseAge(opts.OlderThan)
+		if err != nil {
+			return err
+		}
+
+		protect, err := parseProtectTags(opts.ProtectTags)
+		if err != nil {
+			return err
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		scanOpts := collectorOptions(regions)
+		scanOpts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+
+		c := collector.New(scanOpts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		amiSnapshots := map[string]bool{}
+		if opts.DeleteOrphanSnapshots {
+			amiSnapshots = c.AMISnapshotIDs(context.Background())
+		}
+
+		now := time.Now()
+		orphans := collector.FindOrphans(report.Entities, amiSnapshots, now, olderThan)
+		orphans, ignored := ignoreFindings(orphans, func(orphan collector.Orphan) collector.EntityUsage { return orphan.Entity })
+		printIgnored(os.Stdout, ignored)
+		assignOwners(context.Background(), orphans)
+		actions := planCleanup(orphans, protect, now)
+
+		if opts.PlanFile == "" {
+			return runCleanup(context.Background(), actions, true, opts.AuditLog, time.Time{})
+		}
+		for _, action := range actions {
+			fmt.Printf("%s %s ID: %s, Region: %s, Owner: %s, Storage Used: %s\n",
+				action.Action, action.Entity.Type, action.Entity.ID, action.Entity.Region, ownerLabel(action.Owner), formatBytes(action.Entity.StorageUsed))
+		}
+		return writePlan(opts.PlanFile, cleanupPlan(actions, now))
+	},
+}
+
+// executeCleanupPlan deletes the resources of the --plan, leaving out those
+// that changed since it was written and those the protect tags or the
+// retention of final snapshots now forbid, see recheckPlan.
+func executeCleanupPlan() error {
+	opts := cleanupOptions
+	if !dryRun && !opts.Yes {
+		return errors.New("refusing to delete without --yes (use --dry-run to preview)")
+	}
+
+	retention, err := parseAge(opts.FinalSnapshotRetention)
+	if err != nil {
+		return err
+	}
+
+	protect, err := parseProtectTags(opts.ProtectTags)
+	if err != nil {
+		return err
+	}
+
+	plan, err := readPlan(opts.Plan, "cleanup", ActionDeleteVolume, ActionDeleteSnapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAccount(context.Background(), opts.Account); err != nil {
+		return err
+	}
+	if err := checkPlanAccount(opts.Plan, plan, opts.Account); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var retainUntil time.Time
+	if opts.SnapshotBeforeDelete {
+		retainUntil = now.Add(retention)
+	}
+
+	actions, err := recheckPlan(context.Background(), plan.cleanupActions())
+	if err != nil {
+		return err
+	}
+	actions = filterPlan(actions, protect, now)
+	return runCleanup(context.Background(), actions, dryRun, opts.AuditLog, retainUntil)
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	flags := cleanupCmd.Flags()
+	flags.BoolVar(&cleanupOptions.DeleteUnattachedVolumes, "delete-unattached-volumes", false, "delete volumes not attached to any instance")
+	flags.BoolVar(&cleanupOptions.DeleteOrphanSnapshots, "delete-orphan-snapshots", false, "delete snapshots whose source volume is gone and that back no AMI")
+	flags.StringVar(&cleanupOptions.OlderThan, "older-than", "0d", "only delete resources older than this age (e.g. 180d)")
+	flags.BoolVar(&cleanupOptions.Yes, "yes", false, "confirm that resources should really be deleted")
+	flags.StringArrayVar(&cleanupOptions.ProtectTags, "protect-tag", nil, "never delete resources with this tag (key=value, repeatable)")
+	flags.StringVar(&cleanupOptions.AuditLog, "audit-log", "", "file every cleanup action is appended to (default: cleanup-audit.jsonl in --state-dir)")
+	flags.BoolVar(&cleanupOptions.SnapshotBeforeDelete, "snapshot-before-delete", false, "snapshot every volume before deleting it")
+	flags.StringVar(&cleanupOptions.FinalSnapshotRetention, "final-snapshot-retention", "30d", "how long final snapshots are kept from cleanup (e.g. 90d)")
+	flags.StringToStringVar(&cleanupOptions.NotifyOwners, "notify-owner", nil, "webhook each owner's resources are posted to (owner=url, * for owners without one)")
+	flags.StringVar(&cleanupOptions.Plan, "plan", "", "delete the resources of a plan written by cleanup or simulate retention with --plan-file")
+	flags.StringVar(&cleanupOptions.PlanFile, "plan-file", "", "write the deletions as a JSON plan for cleanup --plan instead of deleting anything")
+	addAccountFlag(cleanupCmd, &cleanupOptions.Account)
+}
+
+func parseProtectTags(values []string) (map[string]string, error) {
+	protect := map[string]string{}
+	for _, value := range values {
+		key, tagValue, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid --protect-tag %q: expected key=value", value)
+		}
+		protect[key] = tagValue
+	}
+	return protect, nil
+}
+
+func isProtected(entity collector.EntityUsage, protect map[string]string) bool {
+	for key, value := range protect {
+		if v, ok := entity.Tags[key]; ok && v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPlan drops the actions of a delete plan that the protect tags or the
+// retention of final snapshots forbid.
+func filterPlan(actions []cleanupAction, protect map[string]string, now time.Time) []cleanupAction {
+	var kept []cleanupAction
+	for _, action := range actions {
+		entity := action.Entity
+		if isProtected(entity, protect) {
+			slog.Info("skipping protected entity", "type", entity.Type, "id", entity.ID)
+			continue
+		}
+		if entity.Type == collector.EntityTypeSnapshot && isRetainedFinalSnapshot(entity, now) {
+			slog.Info("skipping retained final snapshot", "id", entity.ID)
+			continue
+		}
+		kept = append(kept, action)
+	}
+	return kept
+}
+
+// planCleanup turns orphans into delete actions, honoring the enabled
+// deletions, the protect tags and the retention of final snapshots.
+// Snapshots still being taken and volumes being modified are left alone.
+func planCleanup(orphans []collector.Orphan, protect map[string]string, now time.Time) []cleanupAction {
+	var actions []cleanupAction
+
+	for _, orphan := range orphans {
+		entity := orphan.Entity
+		if isProtected(entity, protect) {
+			slog.Info("skipping protected entity", "type", entity.Type, "id", entity.ID)
+			continue
+		}
+		if entity.Type == collector.EntityTypeSnapshot && isRetainedFinalSnapshot(entity, now) {
+			slog.Info("skipping retained final snapshot", "id", entity.ID)
+			continue
+		}
+		if operation := entity.PendingOperation(); operation != "" {
+			slog.Info("skipping entity with an operation in flight", "type", entity.Type, "id", entity.ID, "operation", operation)
+			continue
+		}
+
+		switch {
+		case entity.Type == collector.EntityTypeVolume && cleanupOptions.DeleteUnattachedVolumes:
+			actions = append(actions, cleanupAction{Action: ActionDeleteVolume, Entity: entity, Owner: orphan.Owner, OwnerSource: orphan.OwnerSource})
+		case entity.Type == collector.EntityTypeSnapshot && cleanupOptions.DeleteOrphanSnapshots &&
+			hasReason(orphan, collector.OrphanSourceDeleted) && hasReason(orphan, collector.OrphanNotInAMI):
+			actions = append(actions, cleanupAction{Action: ActionDeleteSnapshot, Entity: entity, Owner: orphan.Owner, OwnerSource: orphan.OwnerSource})
+		}
+	}
+
+	return actions
+}
+
+// cleanupPlan returns the delete actions as a plan for cleanup --plan.
+func cleanupPlan(actions []cleanupAction, now time.Time) actionPlan {
+	plan := newPlan("cleanup", now)
+	for _, action := range actions {
+		entity := action.Entity
+		plan.Actions = append(plan.Actions, planAction{
+			Action:         action.Action,
+			ResourceID:     entity.ID,
+			Type:           entity.Type,
+			Region:         entity.Region,
+			SourceVolume:   entity.SourceVolume,
+			StartTime:      entity.StartTime.UTC(),
+			CreateTime:     entity.CreateTime.UTC(),
+			StorageUsed:    entity.StorageUsed,
+			MonthlyCostUSD: entity.MonthlyCostUSD,
+			Tags:           entity.Tags,
+			Owner:          action.Owner,
+			OwnerSource:    action.OwnerSource,
+		})
+	}
+	return plan
+}
+
+func hasReason(orphan collector.Orphan, reason string) bool {
+	for _, r := range orphan.Reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// runCleanup executes the actions, grouped by owner, and records each in the
+// audit log. A non-zero retainUntil takes a final snapshot of every volume
+// first. A dry run only prints the actions. Owners are notified through
+// --notify-owner once all actions ran.
+func runCleanup(ctx context.Context, actions []cleanupAction, dryRun bool, auditLog string, retainUntil time.Time) error {
+	var encoder *json.Encoder
+	if !dryRun {
+		if err := createParentDir(auditLog); err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		audit, err := os.OpenFile(auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		defer audit.Close()
+
+		encoder = json.NewEncoder(audit)
+	}
+	clients := map[string]*ec2.Client{}
+
+	sort.SliceStable(actions, func(i, j int) bool { return ownerLabel(actions[i].Owner) < ownerLabel(actions[j].Owner) })
+	ownerItems := map[string][]ownerWasteRow{}
+
+	var reclaimed int64
+	failures := 0
+	for i, action := range actions {
+		entity := action.Entity
+		if i == 0 || action.Owner != actions[i-1].Owner {
+			fmt.Printf("Owner: %s\n", ownerLabel(action.Owner))
+		}
+		finalSnapshot := !retainUntil.IsZero() && action.Action == ActionDeleteVolume
+		record := auditRecord{
+			Time:        time.Now().UTC(),
+			Action:      action.Action,
+			ResourceID:  entity.ID,
+			Type:        entity.Type,
+			Region:      entity.Region,
+			Owner:       action.Owner,
+			StorageUsed: entity.StorageUsed,
+			DryRun:      dryRun,
+			Result:      "would delete",
+		}
+		if finalSnapshot {
+			record.Result = "would snapshot and delete"
+		}
+
+		if !dryRun {
+			client, ok := clients[entity.Region]
+			if !ok {
+				var err error
+				client, err = getEc2Client(entity.Region)
+				if err != nil {
+					return fmt.Errorf("failed to create EC2 client for region %s: %w", entity.Region, err)
+				}
+				clients[entity.Region] = client
+			}
+
+			record.Result = "deleted"
+			var actionErr error
+			if finalSnapshot {
+				record.FinalSnapshotID, actionErr = createFinalSnapshot(ctx, client, entity, record.Time, retainUntil)
+			}
+			if actionErr == nil {
+				actionErr = executeCleanupAction(ctx, client, action)
+			}
+			if actionErr != nil {
+				record.Result = "failed"
+				record.Error = actionErr.Error()
+				failures++
+			}
+		}
+
+		if record.Result != "failed" {
+			reclaimed += entity.StorageUsed
+		}
+
+		fmt.Printf("%s %s ID: %s, Region: %s, Storage Used: %s, Result: %s\n",
+			action.Action, entity.Type, entity.ID, entity.Region, formatBytes(entity.StorageUsed), record.Result)
+		ownerItems[action.Owner] = append(ownerItems[action.Owner], ownerWasteRow{
+			Action:      action.Action,
+			ResourceID:  entity.ID,
+			Type:        entity.Type,
+			Region:      entity.Region,
+			StorageUsed: entity.StorageUsed,
+			Result:      record.Result,
+			OwnerSource: action.OwnerSource,
+		})
+
+		if encoder != nil {
+			if err := encoder.Encode(record); err != nil {
+				return fmt.Errorf("failed to write audit log: %w", err)
+			}
+		}
+	}
+
+	verb := "Reclaimed"
+	if dryRun {
+		verb = "Would reclaim"
+	}
+	fmt.Printf("%s %s from %d resources\n", verb, formatBytes(reclaimed), len(actions)-failures)
+	printOwnerTotals(ownerItems)
+
+	if len(cleanupOptions.NotifyOwners) > 0 {
+		notifyOwners(ctx, cleanupOptions.NotifyOwners, ownerItems)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d deletions failed, see %s", failures, len(actions), auditLog)
+	}
+
+	return nil
+}
+
+func executeCleanupAction(ctx context.Context, client *ec2.Client, action cleanupAction) error {
+	switch action.Action {
+	case ActionDeleteVolume:
+		_, err := client.DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: aws.String(action.Entity.ID)})
+		return err
+	case ActionDeleteSnapshot:
+		_, err := client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(action.Entity.ID)})
+		return err
+	}
+
+	return fmt.Errorf("unknown cleanup action %s", action.Action)
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// recheckBatchSize is the most resources looked up by one Describe call.
+const recheckBatchSize = 200
+
+// recheckPlan describes the resources of a plan's actions again, region by
+// region, and returns the actions with the entities' current tags, so the
+// protect tags and the retention of final snapshots apply to the resources
+// as they are now. Resources that are gone, attached again, have a snapshot
+// or modification in flight, or changed since the plan was written are left
+// out.
+func recheckPlan(ctx context.Context, actions []cleanupAction) ([]cleanupAction, error) {
+	type resourceKey struct{ region, id string }
+	volumes := map[resourceKey]types.Volume{}
+	snapshots := map[resourceKey]types.Snapshot{}
+	modifying := map[resourceKey]bool{}
+
+	byRegion := map[string][]cleanupAction{}
+	for _, action := range actions {
+		byRegion[action.Entity.Region] = append(byRegion[action.Entity.Region], action)
+	}
+	for region, regionActions := range byRegion {
+		client, err := getEc2Client(region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create EC2 client for region %s: %w", region, err)
+		}
+
+		var volumeIDs, snapshotIDs []string
+		for _, action := range regionActions {
+			switch action.Action {
+			case ActionDeleteVolume:
+				volumeIDs = append(volumeIDs, action.Entity.ID)
+			case ActionDeleteSnapshot:
+				snapshotIDs = append(snapshotIDs, action.Entity.ID)
+			}
+		}
+
+		for batch := range slices.Chunk(volumeIDs, recheckBatchSize) {
+			found, err := describePlannedVolumes(ctx, client, batch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe the planned volumes in %s: %w", region, err)
+			}
+			for _, volume := range found {
+				volumes[resourceKey{region, aws.ToString(volume.VolumeId)}] = volume
+			}
+
+			inFlight, err := describeVolumesModifying(ctx, client, batch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe the modifications of the planned volumes in %s: %w", region, err)
+			}
+			for _, id := range inFlight {
+				modifying[resourceKey{region, id}] = true
+			}
+		}
+		for batch := range slices.Chunk(snapshotIDs, recheckBatchSize) {
+			found, err := describePlannedSnapshots(ctx, client, batch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe the planned snapshots in %s: %w", region, err)
+			}
+			for _, snapshot := range found {
+				snapshots[resourceKey{region, aws.ToString(snapshot.SnapshotId)}] = snapshot
+			}
+		}
+	}
+
+	var kept []cleanupAction
+	for _, action := range actions {
+		entity := action.Entity
+		key := resourceKey{entity.Region, entity.ID}
+
+		var reason string
+		switch action.Action {
+		case ActionDeleteVolume:
+			volume, ok := volumes[key]
+			if !ok {
+				reason = "the volume is gone"
+				break
+			}
+			reason = volumeChange(entity, volume, modifying[key])
+			entity.Tags = currentTags(volume.Tags)
+		case ActionDeleteSnapshot:
+			snapshot, ok := snapshots[key]
+			if !ok {
+				reason = "the snapshot is gone"
+				break
+			}
+			reason = snapshotChange(entity, snapshot)
+			entity.Tags = currentTags(snapshot.Tags)
+		}
+		if reason != "" {
+			slog.Info("skipping entity changed since the plan", "type", entity.Type, "id", entity.ID, "region", entity.Region, "reason", reason)
+			continue
+		}
+
+		action.Entity = entity
+		kept = append(kept, action)
+	}
+	return kept, nil
+}
+
+// volumeChange returns why a planned volume may no longer be deleted, or ""
+// when it is as planned.
+func volumeChange(entity collector.EntityUsage, volume types.Volume, modifying bool) string {
+	switch {
+	case len(volume.Attachments) > 0 || volume.State != types.VolumeStateAvailable:
+		return fmt.Sprintf("the volume is %s", volume.State)
+	case modifying:
+		return "the volume is being modified"
+	case int64(aws.ToInt32(volume.Size))*1024*1024*1024 != entity.StorageUsed:
+		return "the volume was resized"
+	case changedTime(entity.CreateTime, aws.ToTime(volume.CreateTime)):
+		return "the volume was replaced"
+	}
+	return ""
+}
+
+// snapshotChange returns why a planned snapshot may no longer be deleted, or
+// "" when it is as planned.
+func snapshotChange(entity collector.EntityUsage, snapshot types.Snapshot) string {
+	switch {
+	case snapshot.State == types.SnapshotStatePending:
+		return "the snapshot is being taken"
+	case snapshot.State != types.SnapshotStateCompleted:
+		return fmt.Sprintf("the snapshot is %s", snapshot.State)
+	case entity.SourceVolume != "" && aws.ToString(snapshot.VolumeId) != entity.SourceVolume:
+		return "the snapshot was replaced"
+	case changedTime(entity.StartTime, aws.ToTime(snapshot.StartTime)):
+		return "the snapshot was replaced"
+	}
+	return ""
+}
+
+// changedTime reports whether a resource was created at another time than
+// planned, the create time of a volume or start time of a snapshot. Plans
+// without the time match any.
+func changedTime(planned, current time.Time) bool {
+	return !planned.IsZero() && !planned.Equal(current)
+}
+
+func currentTags(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+func describePlannedVolumes(ctx context.Context, client *ec2.Client, volumeIDs []string) ([]types.Volume, error) {
+	var volumes []types.Volume
+	paginator := ec2.NewDescribeVolumesPaginator(client, &ec2.DescribeVolumesInput{
+		Filters: []types.Filter{{Name: aws.String("volume-id"), Values: volumeIDs}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, page.Volumes...)
+	}
+	return volumes, nil
+}
+
+// describeVolumesModifying returns the volumes of the IDs with a
+// modification in progress.
+func describeVolumesModifying(ctx context.Context, client *ec2.Client, volumeIDs []string) ([]string, error) {
+	var modifying []string
+	paginator := ec2.NewDescribeVolumesModificationsPaginator(client, &ec2.DescribeVolumesModificationsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("volume-id"), Values: volumeIDs},
+			{
+				Name:   aws.String("modification-state"),
+				Values: []string{string(types.VolumeModificationStateModifying), string(types.VolumeModificationStateOptimizing)},
+			},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, modification := range page.VolumesModifications {
+			modifying = append(modifying, aws.ToString(modification.VolumeId))
+		}
+	}
+	return modifying, nil
+}
+
+func describePlannedSnapshots(ctx context.Context, client *ec2.Client, snapshotIDs []string) ([]types.Snapshot, error) {
+	var snapshots []types.Snapshot
+	paginator := ec2.NewDescribeSnapshotsPaginator(client, &ec2.DescribeSnapshotsInput{
+		Filters: []types.Filter{{Name: aws.String("snapshot-id"), Values: snapshotIDs}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, page.Snapshots...)
+	}
+	return snapshots, nil
+}
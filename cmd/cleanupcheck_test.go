@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+func TestVolumeChange(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	planned := collector.EntityUsage{
+		ID:          "vol-1",
+		Type:        collector.EntityTypeVolume,
+		Region:      "us-east-1",
+		StorageUsed: 10 << 30,
+		CreateTime:  created,
+	}
+	current := func(edit func(*types.Volume)) types.Volume {
+		volume := types.Volume{
+			VolumeId:   aws.String("vol-1"),
+			Size:       aws.Int32(10),
+			State:      types.VolumeStateAvailable,
+			CreateTime: aws.Time(created),
+		}
+		if edit != nil {
+			edit(&volume)
+		}
+		return volume
+	}
+
+	tests := []struct {
+		name      string
+		entity    collector.EntityUsage
+		volume    types.Volume
+		modifying bool
+		want      string
+	}{
+		{"as planned", planned, current(nil), false, ""},
+		{"attached", planned, current(func(v *types.Volume) {
+			v.State = types.VolumeStateInUse
+			v.Attachments = []types.VolumeAttachment{{InstanceId: aws.String("i-1")}}
+		}), false, "the volume is in-use"},
+		{"modifying", planned, current(nil), true, "the volume is being modified"},
+		{"resized", planned, current(func(v *types.Volume) { v.Size = aws.Int32(20) }), false, "the volume was resized"},
+		{"recreated", planned, current(func(v *types.Volume) { v.CreateTime = aws.Time(created.Add(time.Hour)) }), false, "the volume was replaced"},
+		{"plan without a create time", func() collector.EntityUsage {
+			entity := planned
+			entity.CreateTime = time.Time{}
+			return entity
+		}(), current(func(v *types.Volume) { v.CreateTime = aws.Time(created.Add(time.Hour)) }), false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := volumeChange(tt.entity, tt.volume, tt.modifying); got != tt.want {
+				t.Errorf("volumeChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCleanupPlanTimes writes a cleanup plan and reads it back, as cleanup
+// --plan does, and checks that the times the recheck compares survive.
+func TestCleanupPlanTimes(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	started := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	plan := cleanupPlan([]cleanupAction{
+		{Action: ActionDeleteVolume, Entity: collector.EntityUsage{ID: "vol-1", Type: collector.EntityTypeVolume, CreateTime: created}},
+		{Action: ActionDeleteSnapshot, Entity: collector.EntityUsage{ID: "snap-1", Type: collector.EntityTypeSnapshot, StartTime: started}},
+	}, created)
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read actionPlan
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := read.cleanupActions()
+	if got := actions[0].Entity.CreateTime; !got.Equal(created) {
+		t.Errorf("volume CreateTime = %s, want %s", got, created)
+	}
+	if got := actions[1].Entity.StartTime; !got.Equal(started) {
+		t.Errorf("snapshot StartTime = %s, want %s", got, started)
+	}
+
+	volume := types.Volume{
+		Size:       aws.Int32(0),
+		State:      types.VolumeStateAvailable,
+		CreateTime: aws.Time(created.Add(time.Minute)),
+	}
+	if got := volumeChange(actions[0].Entity, volume, false); got != "the volume was replaced" {
+		t.Errorf("volumeChange() of a recreated volume = %q, want it replaced", got)
+	}
+}
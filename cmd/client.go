@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// awsConfigLoader is shared by every command and the collector so the
+// shared configuration is loaded and the credentials resolved only once,
+// whatever the number of regions. It uses the first of --profiles, if any,
+// and --endpoint-url.
+var awsConfigLoader = collector.NewSharedConfigLoader(firstProfile, customEndpoint)
+
+// newEC2Client creates the EC2 clients the regions lookup and the collector
+// read through, so both can be pointed at a fake.
+var newEC2Client collector.EC2ClientFactory = collector.NewEC2Client
+
+// Actions of --api-budget-action.
+const (
+	apiBudgetAbort   = "abort"
+	apiBudgetDegrade = "degrade"
+)
+
+var (
+	maxAPIRetries   int
+	apiRateLimit    float64
+	maxAPICalls     int64
+	apiBudgetAction string
+)
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&maxAPIRetries, "max-api-retries", collector.DefaultMaxAPIRetries, "maximum retries of a throttled or failed AWS API call, with jittered exponential backoff")
+	rootCmd.PersistentFlags().Float64Var(&apiRateLimit, "api-rate-limit", 0, "maximum EC2 API calls per second in each region, leaving quota to other automation (0 for no limit)")
+	rootCmd.PersistentFlags().Int64Var(&maxAPICalls, "max-api-calls", 0, "maximum AWS API calls of a scan of each account, retries not counted (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&apiBudgetAction, "api-budget-action", apiBudgetAbort, "what a scan reaching --max-api-calls does: abort, or degrade to skip the name, instance, snapshot size, access and AMI lookups")
+}
+
+// loadAwsConfig returns the shared AWS configuration for the given region,
+// retrying throttled calls up to --max-api-retries times.
+func loadAwsConfig(region string) (aws.Config, error) {
+	cfg, err := awsConfigLoader(context.Background(), region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	cfg.Retryer = collector.NewRetryer(maxAPIRetries, nil)
+	return cfg, nil
+}
+
+func getEc2Client(region string) (*ec2.Client, error) {
+	cfg, err := loadAwsConfig(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2.NewFromConfig(cfg), nil
+}
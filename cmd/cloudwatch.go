@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var cloudWatchOptions = struct {
+	Publish   bool
+	Namespace string
+	Region    string
+}{}
+
+func init() {
+	addCloudWatchFlags(rootCmd)
+	addCloudWatchFlags(storageS3Cmd)
+}
+
+func addCloudWatchFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.BoolVar(&cloudWatchOptions.Publish, "publish-cloudwatch", false, "also publish volume, snapshot and total storage to CloudWatch after the scan")
+	flags.StringVar(&cloudWatchOptions.Namespace, "cw-namespace", collector.DefaultCloudWatchNamespace, "CloudWatch namespace of the published metrics")
+	flags.StringVar(&cloudWatchOptions.Region, "cw-region", "", "region the CloudWatch metrics are published in (default: the --partition bootstrap region)")
+}
+
+// publishCloudWatch writes the report to CloudWatch when --publish-cloudwatch
+// is set.
+func publishCloudWatch(report *collector.Report) error {
+	if !cloudWatchOptions.Publish {
+		return nil
+	}
+
+	region := cloudWatchOptions.Region
+	if region == "" {
+		region = bootstrapRegion()
+	}
+
+	if skipDryRun("publish metrics to CloudWatch namespace %s in %s", cloudWatchOptions.Namespace, region) {
+		return nil
+	}
+
+	cfg, err := loadAwsConfig(region)
+	if err != nil {
+		return fmt.Errorf("failed to create CloudWatch client: %w", err)
+	}
+
+	if err := collector.PublishCloudWatch(context.Background(), cloudwatch.NewFromConfig(cfg), cloudWatchOptions.Namespace, report); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summaryOut, "Published metrics to CloudWatch namespace %s in %s\n", cloudWatchOptions.Namespace, region)
+	return nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	concurrency      int
+	jobTimeoutArg    string
+	regionTimeoutArg string
+
+	jobTimeout    time.Duration
+	regionTimeout time.Duration
+)
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", collector.DefaultConcurrency, "maximum concurrent AWS API workers")
+	rootCmd.PersistentFlags().StringVar(&jobTimeoutArg, "job-timeout", "10m", "give up on a service in a region after this long, e.g. 5m (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&regionTimeoutArg, "per-region-timeout", "0", "give up on a region after this long, leaving it out of the report, e.g. 2m (0 for no limit)")
+}
+
+// initConcurrency validates the worker pool and rate limit flags.
+func initConcurrency() error {
+	if concurrency < 1 {
+		return fmt.Errorf("invalid --concurrency %d: must be at least 1", concurrency)
+	}
+	if nameLookupConcurrency < 1 {
+		return fmt.Errorf("invalid --name-lookup-concurrency %d: must be at least 1", nameLookupConcurrency)
+	}
+	if apiRateLimit < 0 {
+		return fmt.Errorf("invalid --api-rate-limit %g: must not be negative", apiRateLimit)
+	}
+	if maxAPICalls < 0 {
+		return fmt.Errorf("invalid --max-api-calls %d: must not be negative", maxAPICalls)
+	}
+	if apiBudgetAction != apiBudgetAbort && apiBudgetAction != apiBudgetDegrade {
+		return fmt.Errorf("invalid --api-budget-action %q: expected %s or %s", apiBudgetAction, apiBudgetAbort, apiBudgetDegrade)
+	}
+
+	timeout, err := parseAge(jobTimeoutArg)
+	if err != nil {
+		return fmt.Errorf("invalid --job-timeout: %w", err)
+	}
+	if timeout == 0 {
+		timeout = -1 // --job-timeout 0 disables the limit
+	}
+	jobTimeout = timeout
+
+	if regionTimeout, err = parseAge(regionTimeoutArg); err != nil {
+		return fmt.Errorf("invalid --per-region-timeout: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// envPrefix prefixes the environment variables that set options, e.g.
+// CRANKY_REGIONS or CRANKY_CLEANUP_OLDER_THAN.
+const envPrefix = "CRANKY"
+
+// configKeys returns the config keys that can set a flag, most specific
+// first: the flag under its command path (e.g. "cleanup.older-than") and the
+// bare flag name.
+func configKeys(cmd *cobra.Command, flag *pflag.Flag) []string {
+	var path []string
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		path = append([]string{c.Name()}, path...)
+	}
+
+	if len(path) == 0 {
+		return []string{flag.Name}
+	}
+	return []string{strings.Join(path, ".") + "." + flag.Name, flag.Name}
+}
+
+// applyConfig sets every flag not given on the command line from the config
+// file or environment. Command line flags win over environment variables,
+// which win over the config file.
+func applyConfig(cmd *cobra.Command) error {
+	var err error
+
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "config" || flag.Name == "help" {
+			return
+		}
+
+		for _, key := range configKeys(cmd, flag) {
+			if !viper.IsSet(key) {
+				continue
+			}
+			if setErr := setFlagFromConfig(flag, key); setErr != nil {
+				err = fmt.Errorf("invalid config value for %s: %w", key, setErr)
+			}
+			return
+		}
+	})
+
+	return err
+}
+
+func setFlagFromConfig(flag *pflag.Flag, key string) error {
+	switch value := flag.Value.(type) {
+	case pflag.SliceValue:
+		return value.Replace(viper.GetStringSlice(key))
+	}
+
+	if flag.Value.Type() == "stringToString" {
+		values := viper.GetStringMapString(key)
+		pairs := make([]string, 0, len(values))
+		for k, v := range values {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return flag.Value.Set(strings.Join(pairs, ","))
+	}
+
+	return flag.Value.Set(viper.GetString(key))
+}
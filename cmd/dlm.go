@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var analyzeDLMCmd = &cobra.Command{
+	Use:   "dlm",
+	Short: "Report volumes no lifecycle policy snapshots and snapshots taken outside any policy",
+	Long: `Reads the enabled Data Lifecycle Manager snapshot policies of every
+region and lists the volumes that no policy targets, neither through the
+volume's tags nor through the tags of the instance it is attached to, and
+the snapshots that neither DLM nor AWS Backup created. Default policies cover
+every volume or instance of their region.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+		opts.EstimateCost = true
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		writeDLMCoverage(os.Stdout, c.DLMCoverage(context.Background(), report.Entities), time.Now())
+		return nil
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeDLMCmd)
+}
+
+// policyTargets describes what a lifecycle policy snapshots.
+func policyTargets(policy collector.LifecyclePolicy) string {
+	if policy.Default {
+		return "every " + strings.ToLower(strings.Join(policy.ResourceTypes, ", "))
+	}
+	tags := make([]string, 0, len(policy.TargetTags))
+	for key, value := range policy.TargetTags {
+		tags = append(tags, key+"="+value)
+	}
+	sort.Strings(tags)
+	return strings.ToLower(strings.Join(policy.ResourceTypes, ", ")) + " tagged " + strings.Join(tags, " or ")
+}
+
+func writeDLMCoverage(w io.Writer, coverage collector.DLMCoverage, now time.Time) {
+	fmt.Fprintf(w, "Lifecycle policies (%d):\n", len(coverage.Policies))
+	for _, policy := range coverage.Policies {
+		fmt.Fprintf(w, "Policy: %s, Region: %s, Description: %s, Targets: %s\n",
+			policy.ID, policy.Region, policy.Description, policyTargets(policy))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tREGION\tNAME\tSIZE\tAGE (DAYS)\tMONTHLY COST\tFINDING")
+	var cost float64
+	row := func(entity collector.EntityUsage, finding string) int64 {
+		cost += entity.MonthlyCostUSD
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.0f\t$%.2f\t%s\n",
+			entity.Type, entity.ID, entity.Region, entity.AttachedInstance, formatBytes(entity.StorageUsed),
+			collector.EntityAge(entity, now).Hours()/24, entity.MonthlyCostUSD, finding)
+		return entity.StorageUsed
+	}
+	var uncoveredBytes, unmanagedBytes int64
+	for _, volume := range coverage.Uncovered {
+		uncoveredBytes += row(volume, "no lifecycle policy")
+	}
+	for _, snapshot := range coverage.Unmanaged {
+		unmanagedBytes += row(snapshot, "created outside any policy")
+	}
+	tw.Flush()
+
+	if len(coverage.FailedRegions) > 0 {
+		fmt.Fprintf(w, "Unchecked regions: %s\n", strings.Join(coverage.FailedRegions, ", "))
+	}
+	fmt.Fprintf(w, "Uncovered Volumes: %d (%s), Unmanaged Snapshots: %d (%s), Monthly Cost: $%.2f\n",
+		len(coverage.Uncovered), formatBytes(uncoveredBytes), len(coverage.Unmanaged), formatBytes(unmanagedBytes), cost)
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import "fmt"
+
+var dryRun bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print what would be written, uploaded, tagged or deleted without doing it")
+}
+
+// skipDryRun reports whether --dry-run is set, printing the action that is
+// skipped because of it. Every sink and mutation checks it first.
+func skipDryRun(format string, args ...interface{}) bool {
+	if !dryRun {
+		return false
+	}
+	fmt.Fprintf(summaryOut, "Dry run: would "+format+"\n", args...)
+	return true
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var encryptionOptions = struct {
+	KeyFile string
+	KMSKey  string
+}{}
+
+var (
+	sealerOnce sync.Once
+	sealer     atrest.Sealer
+	sealerErr  error
+)
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&encryptionOptions.KeyFile, "encryption-key-file", "", "encrypt the caches and --history-db with the 32-byte key in this file (e.g. from openssl rand -hex 32)")
+	flags.StringVar(&encryptionOptions.KMSKey, "encryption-kms-key", "", "encrypt the caches and --history-db with data keys of this KMS key ID, ARN or alias")
+}
+
+// atRestSealer returns the sealer of --encryption-key-file or
+// --encryption-kms-key, or nil when the local files are not encrypted.
+func atRestSealer() (atrest.Sealer, error) {
+	sealerOnce.Do(func() {
+		opts := encryptionOptions
+		switch {
+		case opts.KeyFile != "" && opts.KMSKey != "":
+			sealerErr = errors.New("--encryption-key-file and --encryption-kms-key cannot be used together")
+		case opts.KeyFile != "":
+			sealer, sealerErr = atrest.NewKeyFileSealer(opts.KeyFile)
+		case opts.KMSKey != "":
+			var client *kms.Client
+			client, sealerErr = kmsClient(context.Background(), opts.KMSKey)
+			if sealerErr == nil {
+				sealer = atrest.NewKMSSealer(client, opts.KMSKey)
+			}
+		}
+	})
+	return sealer, sealerErr
+}
+
+// kmsClient returns a KMS client in the region of a key ARN, or in the
+// region of the AWS configuration for key IDs and aliases.
+func kmsClient(ctx context.Context, keyID string) (*kms.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, firstProfile, customEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration for KMS: %w", err)
+	}
+	if parsed, err := arn.Parse(keyID); err == nil {
+		cfg.Region = parsed.Region
+	}
+	cfg.Retryer = collector.NewRetryer(maxAPIRetries, nil)
+	return kms.NewFromConfig(cfg), nil
+}
+
+// readCacheFile reads a cache written by writeCacheFile.
+func readCacheFile(path string) ([]byte, error) {
+	s, err := atRestSealer()
+	if err != nil {
+		return nil, err
+	}
+	return atrest.ReadFile(s, path)
+}
+
+// writeCacheFile replaces a cache, encrypted when encryption at rest is on.
+func writeCacheFile(path string, data []byte) error {
+	s, err := atRestSealer()
+	if err != nil {
+		return err
+	}
+	return atrest.WriteFile(s, path, data, 0o644)
+}
+
+// openHistory opens --history-db. With encryption at rest the database stays
+// encrypted on disk and is decrypted into a private temporary directory
+// while open; the returned close function encrypts it back if it changed.
+// The returned file is the one SQLite works on.
+func openHistory(path string) (*sql.DB, string, func() error, error) {
+	s, err := atRestSealer()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if s == nil {
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return db, path, db.Close, nil
+	}
+
+	plaintext, err := atrest.ReadFile(s, path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "crankymosquitos-history-")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	file := filepath.Join(dir, filepath.Base(path))
+	if plaintext != nil {
+		if err := os.WriteFile(file, plaintext, 0o600); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", nil, err
+	}
+
+	closeHistory := func() error {
+		defer os.RemoveAll(dir)
+		if err := db.Close(); err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(data, plaintext) {
+			return nil
+		}
+		return atrest.WriteFile(s, path, data, 0o600)
+	}
+
+	return db, file, closeHistory, nil
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Lifecycle event names.
+const (
+	EventCreated = "created"
+	EventDeleted = "deleted"
+	EventGrew    = "grew"
+)
+
+// snsBatchSize is the most messages one SNS PublishBatch call accepts.
+const snsBatchSize = 10
+
+var eventOptions = struct {
+	WebhookURLs []string
+	SNSTopicARN string
+}{}
+
+// eventBaseline is the previous scan of this process, the scan lifecycle
+// events are found against.
+var eventBaseline *historyScan
+
+func init() {
+	addEventFlags(rootCmd)
+	addEventFlags(storageS3Cmd)
+}
+
+func addEventFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringArrayVar(&eventOptions.WebhookURLs, "event-webhook-url", nil, "while serving, post every entity created, deleted or grown by --growth-threshold since the previous scan to this URL (repeatable)")
+	flags.StringVar(&eventOptions.SNSTopicARN, "event-sns-topic", "", "while serving, publish the entity lifecycle events to this SNS topic ARN")
+}
+
+// lifecycleEvent is one entity that appeared, disappeared or grew between
+// consecutive scans. It is the body posted to --event-webhook-url and the
+// message published to --event-sns-topic.
+type lifecycleEvent struct {
+	Event         string    `json:"event"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Type          string    `json:"type"`
+	ID            string    `json:"id"`
+	Region        string    `json:"region"`
+	StorageUsed   int64     `json:"storage_used"`
+	Before        *int64    `json:"before,omitempty"`
+	GrowthPercent *float64  `json:"growth_percent,omitempty"`
+}
+
+// validateEventOptions checks the event flags before the scan starts.
+func validateEventOptions() error {
+	if eventOptions.SNSTopicARN == "" {
+		return nil
+	}
+	parsed, err := arn.Parse(eventOptions.SNSTopicARN)
+	if err != nil || parsed.Service != "sns" {
+		return fmt.Errorf("invalid --event-sns-topic %q: expected an SNS topic ARN", eventOptions.SNSTopicARN)
+	}
+	return nil
+}
+
+// emitLifecycleEvents sends the events of a scan against the previous scan
+// of this process to the configured webhooks and SNS topic. The first scan
+// only sets the baseline.
+func emitLifecycleEvents(report *collector.Report) {
+	if len(eventOptions.WebhookURLs) == 0 && eventOptions.SNSTopicARN == "" {
+		return
+	}
+
+	baseline := eventBaseline
+	current := reportHistoryScan(report)
+	eventBaseline = current
+	if baseline == nil {
+		return
+	}
+
+	events := lifecycleEvents(baseline, current, report.GeneratedAt)
+	if len(events) == 0 {
+		return
+	}
+	fmt.Fprintf(summaryOut, "Lifecycle events: %d\n", len(events))
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, url := range eventOptions.WebhookURLs {
+		if skipDryRun("post %d lifecycle events to %s", len(events), url) {
+			continue
+		}
+		for _, event := range events {
+			if err := postJSON(ctx, client, url, event); err != nil {
+				slog.Error("failed to post lifecycle event", "event", event.Event, "id", event.ID, "url", url, "error", err)
+			}
+		}
+	}
+	if topic := eventOptions.SNSTopicARN; topic != "" && !skipDryRun("publish %d lifecycle events to %s", len(events), topic) {
+		if err := publishEvents(ctx, topic, events); err != nil {
+			slog.Error("failed to publish lifecycle events", "topic", topic, "error", err)
+		}
+	}
+}
+
+// lifecycleEvents returns the entities created, deleted, or grown by at
+// least --growth-threshold between two scans, largest change first.
+func lifecycleEvents(before, after *historyScan, occurredAt time.Time) []lifecycleEvent {
+	var events []lifecycleEvent
+	for _, change := range diffScans(before, after) {
+		event := lifecycleEvent{
+			OccurredAt: occurredAt,
+			Type:       change.Entity.Type,
+			ID:         change.Entity.ID,
+			Region:     change.Entity.Region,
+		}
+
+		switch change.Change {
+		case ChangeAppeared:
+			event.Event = EventCreated
+			event.StorageUsed = change.After
+		case ChangeDisappeared:
+			event.Event = EventDeleted
+			event.StorageUsed = change.Before
+		case ChangeGrew:
+			growth := float64(change.After-change.Before) / float64(change.Before) * 100
+			if change.Before > 0 && growth < notifyOptions.GrowthThreshold {
+				continue
+			}
+			before := change.Before
+			event.Event = EventGrew
+			event.StorageUsed = change.After
+			event.Before = &before
+			if change.Before > 0 {
+				event.GrowthPercent = &growth
+			}
+		default:
+			continue
+		}
+
+		events = append(events, event)
+	}
+	return events
+}
+
+// publishEvents publishes the events to an SNS topic in batches. Each
+// message carries its event name in the "event" attribute so subscriptions
+// can filter on it.
+func publishEvents(ctx context.Context, topic string, events []lifecycleEvent) error {
+	parsed, err := arn.Parse(topic)
+	if err != nil {
+		return err
+	}
+	cfg, err := awsConfigLoader(ctx, parsed.Region)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration for SNS: %w", err)
+	}
+	client := sns.NewFromConfig(cfg)
+
+	var errs []error
+	for start := 0; start < len(events); start += snsBatchSize {
+		batch := events[start:min(start+snsBatchSize, len(events))]
+
+		var entries []snstypes.PublishBatchRequestEntry
+		for i, event := range batch {
+			message, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, snstypes.PublishBatchRequestEntry{
+				Id:      aws.String(strconv.Itoa(i)),
+				Message: aws.String(string(message)),
+				MessageAttributes: map[string]snstypes.MessageAttributeValue{
+					"event": {DataType: aws.String("String"), StringValue: aws.String(event.Event)},
+				},
+			})
+		}
+
+		resp, err := client.PublishBatch(ctx, &sns.PublishBatchInput{
+			TopicArn:                   aws.String(topic),
+			PublishBatchRequestEntries: entries,
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, failed := range resp.Failed {
+			errs = append(errs, fmt.Errorf("message %s: %s", aws.ToString(failed.Id), aws.ToString(failed.Message)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Formats of the export subcommand.
+const (
+	exportTerraform = "terraform"
+	exportJSON      = "json"
+)
+
+var exportOptions = struct {
+	Format     string
+	OlderThan  string
+	OutputFile string
+}{}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export unattached volumes and orphan snapshots for IaC import",
+	Long: `Finds the same unattached volumes and orphan snapshots as orphans and
+writes them as Terraform import blocks, to bring them under management with
+terraform plan -generate-config-out, or as a JSON inventory keyed by ARN, to
+drive their deletion.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportOptions.Format != exportTerraform && exportOptions.Format != exportJSON {
+			return fmt.Errorf("invalid --format %q: expected %s or %s", exportOptions.Format, exportTerraform, exportJSON)
+		}
+
+		olderThan, err := parseAge(exportOptions.OlderThan)
+		if err != nil {
+			return err
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+		opts.EstimateCost = true
+
+		ctx := context.Background()
+		c := collector.New(opts)
+		report, err := c.Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		orphans := collector.FindOrphans(report.Entities, c.AMISnapshotIDs(ctx), time.Now(), olderThan)
+		orphans, ignored := ignoreFindings(orphans, func(orphan collector.Orphan) collector.EntityUsage { return orphan.Entity })
+		printIgnored(os.Stderr, ignored) // Keeps the export parseable
+
+		var w io.Writer = os.Stdout
+		if exportOptions.OutputFile != "" {
+			if skipDryRun("write %s", exportOptions.OutputFile) {
+				return nil
+			}
+			f, err := os.Create(exportOptions.OutputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", exportOptions.OutputFile, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if exportOptions.Format == exportJSON {
+			account, err := callerAccount(ctx)
+			if err != nil {
+				slog.Warn("exporting volume ARNs without an account ID", "error", err)
+			}
+			return writeExportJSON(w, orphans, account)
+		}
+		writeImportBlocks(w, orphans)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	flags := exportCmd.Flags()
+	flags.StringVar(&exportOptions.Format, "format", exportTerraform, "export format: terraform import blocks or a json inventory keyed by ARN")
+	flags.StringVar(&exportOptions.OlderThan, "older-than", "0d", "only export resources older than this age (e.g. 90d)")
+	flags.StringVar(&exportOptions.OutputFile, "output-file", "", "write the export to this file instead of stdout")
+}
+
+// terraformResources maps entity types to the Terraform resource type they
+// are imported as.
+var terraformResources = map[string]string{
+	collector.EntityTypeVolume:   "aws_ebs_volume",
+	collector.EntityTypeSnapshot: "aws_ebs_snapshot",
+}
+
+// terraformName turns a resource ID into a Terraform resource name, which
+// may only hold letters, digits, underscores and dashes and must not start
+// with a digit.
+func terraformName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// writeImportBlocks writes a Terraform import block for every orphan.
+func writeImportBlocks(w io.Writer, orphans []collector.Orphan) {
+	for i, orphan := range orphans {
+		entity := orphan.Entity
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s, %s, %.0f days old: %s\n", entity.Region, formatBytes(entity.StorageUsed),
+			orphan.Age.Hours()/24, strings.Join(orphan.Reasons, ", "))
+		if entity.PendingOperation() != "" {
+			fmt.Fprintf(w, "# %s in flight, the size is not final\n", pendingLabel(entity))
+		}
+		fmt.Fprintln(w, "import {")
+		fmt.Fprintf(w, "  to = %s.%s\n", terraformResources[entity.Type], terraformName(entity.ID))
+		fmt.Fprintf(w, "  id = %q\n", entity.ID)
+		fmt.Fprintln(w, "}")
+	}
+}
+
+// exportEntry is an orphan of the JSON export.
+type exportEntry struct {
+	Type           string            `json:"type"`
+	ID             string            `json:"id"`
+	Region         string            `json:"region"`
+	StorageUsed    int64             `json:"storage_used"`
+	AgeDays        float64           `json:"age_days"`
+	Reasons        []string          `json:"reasons"`
+	SourceVolume   string            `json:"source_volume,omitempty"`
+	TerraformType  string            `json:"terraform_type"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	MonthlyCostUSD float64           `json:"monthly_cost_usd,omitempty"`
+}
+
+// writeExportJSON writes the orphans as a JSON object keyed by ARN.
+func writeExportJSON(w io.Writer, orphans []collector.Orphan, account string) error {
+	inventory := make(map[string]exportEntry, len(orphans))
+	for _, orphan := range orphans {
+		entity := orphan.Entity
+
+		arn := awsres.SnapshotARN(entity.Region, entity.ID)
+		if entity.Type == collector.EntityTypeVolume {
+			arn = awsres.VolumeARN(entity.Region, account, entity.ID)
+		}
+
+		inventory[arn] = exportEntry{
+			Type:           entity.Type,
+			ID:             entity.ID,
+			Region:         entity.Region,
+			StorageUsed:    entity.StorageUsed,
+			AgeDays:        orphan.Age.Hours() / 24,
+			Reasons:        orphan.Reasons,
+			SourceVolume:   entity.SourceVolume,
+			TerraformType:  terraformResources[entity.Type],
+			Tags:           entity.Tags,
+			MonthlyCostUSD: entity.MonthlyCostUSD,
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inventory)
+}
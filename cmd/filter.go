@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var filterOptions = struct {
+	Top     int
+	MinSize string
+	Types   []string
+	Sort    string
+	Order   string
+}{}
+
+// sortKeys compare entities by each --sort key, ascending.
+var sortKeys = map[string]func(a, b collector.EntityUsage) int{
+	"size":   func(a, b collector.EntityUsage) int { return cmp.Compare(a.StorageUsed, b.StorageUsed) },
+	"region": func(a, b collector.EntityUsage) int { return cmp.Compare(a.Region, b.Region) },
+	"type":   func(a, b collector.EntityUsage) int { return cmp.Compare(a.Type, b.Type) },
+	"id":     func(a, b collector.EntityUsage) int { return cmp.Compare(a.ID, b.ID) },
+	"cost":   func(a, b collector.EntityUsage) int { return cmp.Compare(a.MonthlyCostUSD, b.MonthlyCostUSD) },
+	"age":    compareAge,
+}
+
+// compareAge compares entities by how long ago a volume was created or a
+// snapshot started. Entities without that time are the youngest.
+func compareAge(a, b collector.EntityUsage) int {
+	ta, tb := entityTime(a), entityTime(b)
+	switch {
+	case ta.IsZero() && tb.IsZero():
+		return 0
+	case ta.IsZero():
+		return -1
+	case tb.IsZero():
+		return 1
+	}
+	return tb.Compare(ta)
+}
+
+// entityTime returns the time a volume was created or a snapshot started,
+// the zero time for other entities.
+func entityTime(entity collector.EntityUsage) time.Time {
+	switch entity.Type {
+	case collector.EntityTypeVolume:
+		return entity.CreateTime
+	case collector.EntityTypeSnapshot, collector.EntityTypeSharedSnapshot:
+		return entity.StartTime
+	}
+	return time.Time{}
+}
+
+func init() {
+	addFilterFlags(rootCmd)
+	addFilterFlags(storageS3Cmd)
+}
+
+func addFilterFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.IntVar(&filterOptions.Top, "top", 0, "only output the first N entities in --sort order (0 for all)")
+	flags.StringVar(&filterOptions.MinSize, "min-size", "", "only output entities using at least this much storage (e.g. 100GB)")
+	flags.StringSliceVar(&filterOptions.Types, "type", nil, "only output entities of these types (e.g. volume,snapshot)")
+	flags.StringVar(&filterOptions.Sort, "sort", "size", "sort the entities by size, region, type, id, cost or age")
+	flags.StringVar(&filterOptions.Order, "order", "", "sort order, asc or desc (default desc for size, cost and age, asc otherwise)")
+}
+
+// validateFilters checks the filter flags before the scan starts.
+func validateFilters() error {
+	if filterOptions.Top < 0 {
+		return fmt.Errorf("invalid --top %d: must not be negative", filterOptions.Top)
+	}
+	if filterOptions.MinSize != "" {
+		if _, err := parseSize(filterOptions.MinSize); err != nil {
+			return fmt.Errorf("invalid --min-size: %w", err)
+		}
+	}
+	if _, ok := sortKeys[filterOptions.Sort]; !ok {
+		return fmt.Errorf("invalid --sort %q: expected size, region, type, id, cost or age", filterOptions.Sort)
+	}
+	switch filterOptions.Order {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("invalid --order %q: expected asc or desc", filterOptions.Order)
+	}
+	_, err := filterTypes()
+	return err
+}
+
+// orderEntities sorts the entities by the key, then by ID and region so
+// that the order is the same on every run. The sort is stable.
+func orderEntities(entities []collector.EntityUsage, key string, descending bool) {
+	compare := sortKeys[key]
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := entities[i], entities[j]
+		if c := compare(a, b); c != 0 {
+			return c < 0 != descending
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Region < b.Region
+	})
+}
+
+// sortReportEntities sorts the entities as --sort and --order ask.
+func sortReportEntities(entities []collector.EntityUsage) {
+	key := filterOptions.Sort
+	if _, ok := sortKeys[key]; !ok {
+		key = "size"
+	}
+	descending := filterOptions.Order == "desc"
+	if filterOptions.Order == "" {
+		descending = key == "size" || key == "cost" || key == "age"
+	}
+	orderEntities(entities, key, descending)
+}
+
+// filterTypes returns the entity types selected with --type, nil for all.
+func filterTypes() (map[string]bool, error) {
+	if len(filterOptions.Types) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]string{}
+	for _, entityType := range []string{
+		collector.EntityTypeVolume, collector.EntityTypeSnapshot, collector.EntityTypeBucket,
+		collector.EntityTypeDBInstance, collector.EntityTypeDBCluster,
+		collector.EntityTypeEFS, collector.EntityTypeFSx, collector.EntityTypeRecoveryPoint, collector.EntityTypeSharedSnapshot,
+		collector.EntityTypeDynamoDBTable, collector.EntityTypeRedshiftCluster, collector.EntityTypeElastiCacheSnapshot,
+	} {
+		known[strings.ToLower(entityType)] = entityType
+	}
+
+	types := map[string]bool{}
+	for _, name := range filterOptions.Types {
+		entityType, ok := known[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown --type %q", name)
+		}
+		types[entityType] = true
+	}
+	return types, nil
+}
+
+// filterReport returns a copy of the report holding only the entities the
+// filter flags select, in --sort order. Totals and summaries keep using the
+// full report.
+func filterReport(report *collector.Report) *collector.Report {
+	types, _ := filterTypes()
+	minSize, _ := parseSize(filterOptions.MinSize)
+
+	entities := make([]collector.EntityUsage, 0, len(report.Entities))
+	for _, entity := range report.Entities {
+		if types != nil && !types[entity.Type] {
+			continue
+		}
+		if entity.StorageUsed < minSize {
+			continue
+		}
+		entities = append(entities, entity)
+	}
+
+	sortReportEntities(entities)
+	if filterOptions.Top > 0 && len(entities) > filterOptions.Top {
+		entities = entities[:filterOptions.Top]
+	}
+
+	shown := *report
+	shown.Entities = entities
+	return &shown
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Tags recorded on the final snapshot taken before a volume is deleted.
+const (
+	finalSnapshotSourceVolumeTag = "crankymosquitos:source-volume"
+	finalSnapshotSourceNameTag   = "crankymosquitos:source-volume-name"
+	finalSnapshotDeletedAtTag    = "crankymosquitos:deleted-at"
+	finalSnapshotRetainUntilTag  = "crankymosquitos:retain-until"
+)
+
+// finalSnapshotTimeout bounds the wait for a final snapshot to complete
+// before its volume is deleted.
+const finalSnapshotTimeout = time.Hour
+
+// createFinalSnapshot snapshots a volume before it is deleted and waits for
+// the snapshot to complete. The snapshot is tagged with where it came from
+// and until when it should be kept.
+func createFinalSnapshot(ctx context.Context, client *ec2.Client, volume collector.EntityUsage, now, retainUntil time.Time) (string, error) {
+	tags := []types.Tag{
+		{Key: aws.String(finalSnapshotSourceVolumeTag), Value: aws.String(volume.ID)},
+		{Key: aws.String(finalSnapshotDeletedAtTag), Value: aws.String(now.UTC().Format(time.RFC3339))},
+		{Key: aws.String(finalSnapshotRetainUntilTag), Value: aws.String(retainUntil.UTC().Format(time.RFC3339))},
+	}
+	if name := volume.Tags["Name"]; name != "" {
+		tags = append(tags,
+			types.Tag{Key: aws.String(finalSnapshotSourceNameTag), Value: aws.String(name)},
+			types.Tag{Key: aws.String("Name"), Value: aws.String(name)},
+		)
+	}
+
+	resp, err := client.CreateSnapshot(ctx, &ec2.CreateSnapshotInput{
+		VolumeId:    aws.String(volume.ID),
+		Description: aws.String(fmt.Sprintf("Final snapshot of %s before cleanup", volume.ID)),
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeSnapshot, Tags: tags},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create final snapshot: %w", err)
+	}
+	snapshotID := aws.ToString(resp.SnapshotId)
+
+	waiter := ec2.NewSnapshotCompletedWaiter(client)
+	err = waiter.Wait(ctx, &ec2.DescribeSnapshotsInput{SnapshotIds: []string{snapshotID}}, finalSnapshotTimeout)
+	if err != nil {
+		return snapshotID, fmt.Errorf("final snapshot %s did not complete: %w", snapshotID, err)
+	}
+
+	return snapshotID, nil
+}
+
+// isRetainedFinalSnapshot reports whether a snapshot is a final snapshot
+// still inside its retention period. Cleanup never deletes those.
+func isRetainedFinalSnapshot(entity collector.EntityUsage, now time.Time) bool {
+	value, ok := entity.Tags[finalSnapshotRetainUntilTag]
+	if !ok {
+		return false
+	}
+
+	retainUntil, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// Keep snapshots whose retention cannot be read.
+		return true
+	}
+
+	return now.Before(retainUntil)
+}
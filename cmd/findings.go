@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	findingsEnabled  bool
+	staleSnapshotAge string
+)
+
+func init() {
+	rootCmd.Flags().BoolVar(&findingsEnabled, "findings", false, "rank unencrypted resources, unattached and idle volumes, orphan and stale snapshots and budget breaches by severity, as a findings section of the JSON report and aws_storage_findings_total")
+	rootCmd.Flags().StringVar(&staleSnapshotAge, "stale-snapshot-age", "365d", "with --findings, flag the snapshots no AMI uses older than this")
+}
+
+// addFindings finds the problems of a replayed report, adds the budget
+// breaches to the findings and leaves out those of the --ignore-file.
+func addFindings(report *collector.Report, replayed bool) {
+	if !findingsEnabled {
+		return
+	}
+	if replayed {
+		// The rows of a report carry no creation times, and those of earlier
+		// reports no encryption, so only the attachments are looked at.
+		for _, finding := range collector.FindFindings(report.Entities, nil, report.GeneratedAt, 0) {
+			if finding.Type == collector.FindingUnattachedVolume || finding.Type == collector.FindingIdleVolume {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+	}
+
+	for _, violation := range budgetViolations(report) {
+		report.Findings = append(report.Findings, collector.Finding{
+			ID:          collector.FindingID(collector.FindingBudgetBreach, violation.Budget),
+			Type:        collector.FindingBudgetBreach,
+			Severity:    collector.SeverityCritical,
+			Summary:     violation.String(),
+			Remediation: "reclaim the storage of the findings below, or raise --fail-if-" + violation.Budget,
+		})
+	}
+	collector.SortFindings(report.Findings)
+
+	findings, ignored := ignoreFindings(report.Findings, func(finding collector.Finding) collector.EntityUsage {
+		if finding.Entity == nil {
+			return collector.EntityUsage{}
+		}
+		return *finding.Entity
+	})
+	report.Findings = findings
+	printIgnored(summaryOut, ignored)
+}
+
+// findingsOptions sets the findings options of a scan from the flags.
+func findingsOptions(opts *collector.Options) error {
+	if err := validateTicketOptions(); err != nil {
+		return err
+	}
+	if !findingsEnabled {
+		return nil
+	}
+	age, err := parseAge(staleSnapshotAge)
+	if err != nil {
+		return fmt.Errorf("invalid --stale-snapshot-age: %w", err)
+	}
+	opts.Findings = true
+	opts.StaleSnapshotAge = age
+	return nil
+}
+
+// reportFinding is a finding of the JSON report.
+type reportFinding struct {
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	Severity       string `json:"severity"`
+	Summary        string `json:"summary"`
+	Remediation    string `json:"remediation"`
+	Region         string `json:"region,omitempty"`
+	ResourceType   string `json:"resource_type,omitempty"`
+	ResourceID     string `json:"resource_id,omitempty"`
+	AccountID      string `json:"account_id,omitempty"`
+	StorageUsed    string `json:"storage_used,omitempty"`
+	MonthlyCostUSD string `json:"monthly_cost_usd,omitempty"`
+}
+
+// reportFindings converts the findings of a report for the JSON report.
+func reportFindings(report *collector.Report) []reportFinding {
+	var findings []reportFinding
+	for _, finding := range report.Findings {
+		converted := reportFinding{
+			ID:          finding.ID,
+			Type:        finding.Type,
+			Severity:    finding.Severity,
+			Summary:     finding.Summary,
+			Remediation: finding.Remediation,
+			Region:      finding.Region,
+		}
+		if entity := finding.Entity; entity != nil {
+			converted.ResourceType = entity.Type
+			converted.ResourceID = entity.ID
+			converted.AccountID = entity.AccountID
+			converted.StorageUsed = sizeValue(entity.StorageUsed)
+			if report.CostEstimated {
+				converted.MonthlyCostUSD = fmt.Sprintf("%.2f", entity.MonthlyCostUSD)
+			}
+		}
+		findings = append(findings, converted)
+	}
+	return findings
+}
+
+// printFindings prints the findings, most severe first.
+func printFindings(w io.Writer, findings []collector.Finding) {
+	counts := map[string]int{}
+	for _, finding := range findings {
+		counts[finding.Severity]++
+	}
+
+	fmt.Fprintf(w, "Findings (%d):", len(findings))
+	for i, severity := range collector.Severities {
+		separator := ","
+		if i == 0 {
+			separator = ""
+		}
+		fmt.Fprintf(w, "%s %s: %d", separator, severity, counts[severity])
+	}
+	fmt.Fprintln(w)
+
+	for _, finding := range findings {
+		fmt.Fprintf(w, "Severity: %s, ID: %s, Summary: %s, Remediation: %s\n",
+			finding.Severity, finding.ID, finding.Summary, finding.Remediation)
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+var finopsOptions = struct {
+	GroupBy    string
+	Output     string
+	OutputFile string
+}{}
+
+// focusServices are the FOCUS ServiceName and ServiceCategory of the
+// entity types, named as in the AWS FOCUS export. Shared snapshots are
+// billed to their owner and left out.
+var focusServices = map[string]struct{ name, category string }{
+	collector.EntityTypeVolume:              {"Amazon Elastic Compute Cloud", "Storage"},
+	collector.EntityTypeSnapshot:            {"Amazon Elastic Compute Cloud", "Storage"},
+	collector.EntityTypeBucket:              {"Amazon Simple Storage Service", "Storage"},
+	collector.EntityTypeDBInstance:          {"Amazon Relational Database Service", "Databases"},
+	collector.EntityTypeDBCluster:           {"Amazon Relational Database Service", "Databases"},
+	collector.EntityTypeEFS:                 {"Amazon Elastic File System", "Storage"},
+	collector.EntityTypeFSx:                 {"Amazon FSx", "Storage"},
+	collector.EntityTypeRecoveryPoint:       {"AWS Backup", "Storage"},
+	collector.EntityTypeDynamoDBTable:       {"Amazon DynamoDB", "Databases"},
+	collector.EntityTypeRedshiftCluster:     {"Amazon Redshift", "Databases"},
+	collector.EntityTypeElastiCacheSnapshot: {"Amazon ElastiCache", "Databases"},
+}
+
+var exportFinopsCmd = &cobra.Command{
+	Use:   "finops",
+	Short: "Export storage and estimated cost allocated by a tag in FOCUS columns",
+	Long: `Scans every default service and writes one row per account, region,
+service and value of the --group-by tag with the bytes stored and their
+estimated monthly cost. Columns follow the FinOps Open Cost and Usage
+Specification (FOCUS) naming, with the tag value in an x_ custom column, so
+FinOps pipelines can ingest the file directly. Only volumes and snapshots are
+priced; other services report a cost of 0.`,
+	Example: `  crankymosquitos export finops --group-by tag:CostCenter --output csv --output-file allocation.csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tagKey, err := parseGroupBy(finopsOptions.GroupBy)
+		if err != nil {
+			return err
+		}
+		if tagKey == "" {
+			return fmt.Errorf("invalid --group-by %q: expected tag:KEY", finopsOptions.GroupBy)
+		}
+		formatter, err := output.Get(finopsOptions.Output)
+		if err != nil {
+			return err
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.EstimateCost = true
+
+		ctx := context.Background()
+		if err := discoverOrgAccounts(ctx); err != nil {
+			return fmt.Errorf("failed to discover organization accounts: %w", err)
+		}
+		var report *collector.Report
+		if multiAccount() {
+			report, err = scanAccounts(ctx, opts)
+		} else {
+			report, err = collector.New(opts).Scan(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		account := ""
+		if !multiAccount() {
+			if account, err = callerAccount(ctx); err != nil {
+				slog.Warn("exporting the allocation without an account ID", "error", err)
+			}
+		}
+
+		var w io.Writer = os.Stdout
+		if finopsOptions.OutputFile != "" {
+			if skipDryRun("write %s", finopsOptions.OutputFile) {
+				return nil
+			}
+			f, err := os.Create(finopsOptions.OutputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", finopsOptions.OutputFile, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		columns, rows := finopsRows(report, tagKey, account)
+		return formatter.Format(w, columns, rows)
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportFinopsCmd)
+
+	flags := exportFinopsCmd.Flags()
+	flags.StringVar(&finopsOptions.GroupBy, "group-by", "tag:CostCenter", "tag to allocate the storage by, e.g. tag:CostCenter")
+	flags.StringVarP(&finopsOptions.Output, "output", "o", "csv", "allocation format ("+strings.Join(output.Names(), ", ")+")")
+	flags.StringVar(&finopsOptions.OutputFile, "output-file", "", "write the allocation to this file instead of stdout")
+}
+
+// finopsAllocation is one row of the allocation before formatting.
+type finopsAllocation struct {
+	account, region, service, category, value string
+	entities                                  int
+	bytes                                     int64
+	cost                                      float64
+}
+
+// finopsRows allocates the storage and cost of the report by account,
+// region, service and tag value, in that order. account labels the
+// entities scanned without one.
+func finopsRows(report *collector.Report, tagKey, account string) ([]string, []output.Row) {
+	tagColumn := "x_" + tagKey
+	columns := []string{
+		"ProviderName", "SubAccountId", "RegionId", "ServiceName", "ServiceCategory",
+		"ChargeCategory", "ChargePeriodStart", "ChargePeriodEnd", "ConsumedQuantity", "ConsumedUnit",
+		"EffectiveCost", "BillingCurrency", "Tags", tagColumn, "x_ResourceCount",
+	}
+
+	type key struct{ account, region, service, value string }
+	allocations := map[key]*finopsAllocation{}
+	for _, entity := range report.Entities {
+		service, ok := focusServices[entity.Type]
+		if !ok {
+			continue
+		}
+		entityAccount := entity.AccountID
+		if entityAccount == "" {
+			entityAccount = account
+		}
+		k := key{entityAccount, entity.Region, service.name, entity.Tags[tagKey]}
+		allocation, ok := allocations[k]
+		if !ok {
+			allocation = &finopsAllocation{account: k.account, region: k.region, service: k.service, category: service.category, value: k.value}
+			allocations[k] = allocation
+		}
+		allocation.entities++
+		allocation.bytes += entity.StorageUsed
+		allocation.cost += entity.MonthlyCostUSD
+	}
+
+	sorted := make([]*finopsAllocation, 0, len(allocations))
+	for _, allocation := range allocations {
+		sorted = append(sorted, allocation)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.account != b.account {
+			return a.account < b.account
+		}
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		return a.value < b.value
+	})
+
+	// The cost is a monthly estimate, so it is charged over the calendar
+	// month of the scan
+	generated := report.GeneratedAt.UTC()
+	periodStart := time.Date(generated.Year(), generated.Month(), 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	rows := []output.Row{}
+	for _, allocation := range sorted {
+		tags := "{}"
+		if allocation.value != "" {
+			data, _ := json.Marshal(map[string]string{tagKey: allocation.value})
+			tags = string(data)
+		}
+		rows = append(rows, output.Row{
+			"ProviderName":      "AWS",
+			"SubAccountId":      allocation.account,
+			"RegionId":          allocation.region,
+			"ServiceName":       allocation.service,
+			"ServiceCategory":   allocation.category,
+			"ChargeCategory":    "Usage",
+			"ChargePeriodStart": periodStart.Format(time.RFC3339),
+			"ChargePeriodEnd":   periodEnd.Format(time.RFC3339),
+			"ConsumedQuantity":  allocation.bytes,
+			"ConsumedUnit":      "Bytes",
+			"EffectiveCost":     fmt.Sprintf("%.2f", allocation.cost),
+			"BillingCurrency":   "USD",
+			"Tags":              tags,
+			tagColumn:           allocation.value,
+			"x_ResourceCount":   allocation.entities,
+		})
+	}
+
+	return columns, rows
+}
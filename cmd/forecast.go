@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var forecastOptions = struct {
+	Horizon        string
+	Since          string
+	GroupBy        string
+	Model          string
+	Budgets        []string
+	CostPerGBMonth float64
+
+	ScanHorizon string
+}{}
+
+var forecastCmd = &cobra.Command{
+	Use:   "forecast",
+	Short: "Predict the storage of every region or tag group from --history-db",
+	Long: `Fits a linear or exponential model to the storage of every region, or with
+--group-by of every tag value in every region, over the scans recorded in
+--history-db since --since, and prints the storage predicted --horizon from
+now. --model auto keeps whichever of the two fits the scans closest.
+
+--budget KEY=LIMIT sets the budget of the series whose tag value, region or
+VALUE/REGION is KEY, * for every other series. A LIMIT is a size, e.g.
+10TB, or a monthly cost in USD, e.g. $500, priced at --cost-per-gb-month.
+The forecast shows when each series is predicted to cross its budget.
+
+While scanning with --history-db and --forecast-horizon the predictions are
+published as the aws_storage_forecast_bytes gauges.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if historyDB == "" {
+			return errors.New("forecast requires --history-db")
+		}
+
+		horizon, err := parseAge(forecastOptions.Horizon)
+		if err != nil {
+			return fmt.Errorf("invalid --horizon: %w", err)
+		}
+		since := horizon
+		if forecastOptions.Since != "" {
+			if since, err = parseAge(forecastOptions.Since); err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+		}
+		groupBy, err := parseGroupBy(forecastOptions.GroupBy)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(collector.ForecastModels, forecastOptions.Model) {
+			return fmt.Errorf("invalid --model %q: must be one of %s", forecastOptions.Model, strings.Join(collector.ForecastModels, ", "))
+		}
+		budgets, err := parseForecastBudgets(forecastOptions.Budgets, forecastOptions.CostPerGBMonth)
+		if err != nil {
+			return err
+		}
+
+		db, _, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		now := time.Now()
+		series, err := loadForecastSeries(db, groupBy, now.Add(-since))
+		if err != nil {
+			return err
+		}
+		if len(series) == 0 {
+			return errors.New("no scans recorded in the history database")
+		}
+
+		forecast := collector.ComputeForecast(series, groupBy, forecastOptions.Model, now.Add(horizon))
+		writeForecast(os.Stdout, forecast, budgets, now, forecastOptions.Horizon)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forecastCmd)
+
+	flags := forecastCmd.Flags()
+	flags.StringVar(&forecastOptions.Horizon, "horizon", "90d", "predict the storage this far from now")
+	flags.StringVar(&forecastOptions.Since, "since", "", "fit the scans recorded since this long ago (default: --horizon)")
+	flags.StringVar(&forecastOptions.GroupBy, "group-by", "", "forecast every tag value in every region, e.g. tag:Team")
+	flags.StringVar(&forecastOptions.Model, "model", collector.ForecastAuto, "model fitted to the scans: "+strings.Join(collector.ForecastModels, ", "))
+	flags.StringArrayVar(&forecastOptions.Budgets, "budget", nil, "budget of a tag value, region, VALUE/REGION or * as KEY=SIZE or KEY=$USD per month (repeatable)")
+	flags.Float64Var(&forecastOptions.CostPerGBMonth, "cost-per-gb-month", 0, "USD per GB-month the monthly cost budgets and predictions are priced at")
+
+	rootCmd.PersistentFlags().StringVar(&forecastOptions.ScanHorizon, "forecast-horizon", "", "with --history-db, publish the storage predicted this far from now, fitted to the scans of as long ago, as aws_storage_forecast_bytes")
+}
+
+// forecastBudget is the limit of a --budget, in bytes or in USD per month.
+type forecastBudget struct {
+	Bytes   int64
+	CostUSD float64
+}
+
+// forecastBudgets are the --budget limits by key.
+type forecastBudgets map[string]forecastBudget
+
+func parseForecastBudgets(values []string, costPerGBMonth float64) (forecastBudgets, error) {
+	budgets := forecastBudgets{}
+	for _, value := range values {
+		key, limit, found := strings.Cut(value, "=")
+		if !found || key == "" || limit == "" {
+			return nil, fmt.Errorf("invalid --budget %q: expected KEY=SIZE or KEY=$USD", value)
+		}
+
+		var budget forecastBudget
+		if cost, ok := strings.CutPrefix(limit, "$"); ok {
+			if costPerGBMonth <= 0 {
+				return nil, fmt.Errorf("invalid --budget %q: cost budgets require --cost-per-gb-month", value)
+			}
+			usd, err := strconv.ParseFloat(cost, 64)
+			if err != nil || usd <= 0 {
+				return nil, fmt.Errorf("invalid --budget %q: expected a positive cost", value)
+			}
+			budget.CostUSD = usd
+		} else {
+			size, err := parseSize(limit)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --budget %q: %w", value, err)
+			}
+			budget.Bytes = size
+		}
+		budgets[key] = budget
+	}
+	return budgets, nil
+}
+
+// limit returns the budget of a series in bytes, looking it up by
+// VALUE/REGION, tag value, region and * in turn.
+func (b forecastBudgets) limit(series collector.StorageForecast, costPerGBMonth float64) (float64, bool) {
+	keys := []string{series.Region, "*"}
+	if series.Group != "" {
+		keys = append([]string{series.Group + "/" + series.Region, series.Group}, keys...)
+	}
+	for _, key := range keys {
+		budget, ok := b[key]
+		if !ok {
+			continue
+		}
+		if budget.CostUSD > 0 {
+			return budget.CostUSD / costPerGBMonth * gib, true
+		}
+		return float64(budget.Bytes), true
+	}
+	return 0, false
+}
+
+// gib is the GB of the Pricing API's GB-month prices.
+const gib = 1 << 30
+
+// loadForecastSeries sums the storage of every region, or with groupBy of
+// every value of the tag in every region, in each scan recorded since. Like
+// the tag groups of a scan, grouped series only count volumes and
+// snapshots. Scans without entities in a series are left out of it.
+func loadForecastSeries(db *sql.DB, groupBy string, since time.Time) ([]collector.ForecastSeries, error) {
+	if _, err := db.Exec(historySchema); err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	query := `SELECT s.scanned_at, e.region, '', SUM(e.storage_used)
+		FROM scans s JOIN entity_sizes e ON e.scan_id = s.id
+		WHERE s.scanned_at >= ?
+		GROUP BY s.id, e.region
+		ORDER BY s.scanned_at, s.id`
+	args := []any{historyTime(since)}
+	if groupBy != "" {
+		query = `SELECT s.scanned_at, e.region, COALESCE(t.value, ''), SUM(e.storage_used)
+			FROM scans s JOIN entity_sizes e ON e.scan_id = s.id
+			LEFT JOIN entity_tags t ON t.scan_id = e.scan_id AND t.id = e.id AND t.region = e.region AND t.key = ?
+			WHERE s.scanned_at >= ? AND e.type IN (?, ?)
+			GROUP BY s.id, e.region, COALESCE(t.value, '')
+			ORDER BY s.scanned_at, s.id`
+		args = []any{groupBy, historyTime(since), collector.EntityTypeVolume, collector.EntityTypeSnapshot}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scans: %w", err)
+	}
+	defer rows.Close()
+
+	var series []collector.ForecastSeries
+	index := map[[2]string]int{}
+	for rows.Next() {
+		var scannedAt, region, group string
+		var size int64
+		if err := rows.Scan(&scannedAt, &region, &group, &size); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, scannedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan time %q: %w", scannedAt, err)
+		}
+
+		key := [2]string{group, region}
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, collector.ForecastSeries{Group: group, Region: region})
+		}
+		series[i].Samples = append(series[i].Samples, collector.ForecastSample{Time: t, StorageUsed: size})
+	}
+	return series, rows.Err()
+}
+
+// appendForecastSamples adds the storage of a report's entities to the
+// series as their latest samples, summed like loadForecastSeries.
+func appendForecastSamples(series []collector.ForecastSeries, report *collector.Report, groupBy string) []collector.ForecastSeries {
+	sizes := map[[2]string]int64{}
+	for _, entity := range report.Entities {
+		if groupBy == "" {
+			sizes[[2]string{"", entity.Region}] += entity.StorageUsed
+		} else if entity.Type == collector.EntityTypeVolume || entity.Type == collector.EntityTypeSnapshot {
+			sizes[[2]string{entity.Tags[groupBy], entity.Region}] += entity.StorageUsed
+		}
+	}
+
+	for i := range series {
+		key := [2]string{series[i].Group, series[i].Region}
+		if size, ok := sizes[key]; ok {
+			series[i].Samples = append(series[i].Samples, collector.ForecastSample{Time: report.GeneratedAt, StorageUsed: size})
+			delete(sizes, key)
+		}
+	}
+	for key, size := range sizes {
+		series = append(series, collector.ForecastSeries{
+			Group:   key[0],
+			Region:  key[1],
+			Samples: []collector.ForecastSample{{Time: report.GeneratedAt, StorageUsed: size}},
+		})
+	}
+	return series
+}
+
+// reportForecast fits the scans in --history-db of the last
+// --forecast-horizon, followed by the report, and predicts the storage
+// --forecast-horizon after it, grouped like the report.
+func reportForecast(report *collector.Report) (forecast *collector.Forecast, err error) {
+	horizon, err := parseAge(forecastOptions.ScanHorizon)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --forecast-horizon: %w", err)
+	}
+
+	series := appendForecastSamples(nil, report, report.GroupByTag)
+	if _, err := os.Stat(historyDB); err == nil {
+		db, _, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		recorded, err := loadForecastSeries(db, report.GroupByTag, report.GeneratedAt.Add(-horizon))
+		if err != nil {
+			return nil, err
+		}
+		series = appendForecastSamples(recorded, report, report.GroupByTag)
+	}
+
+	computed := collector.ComputeForecast(series, report.GroupByTag, collector.ForecastAuto, report.GeneratedAt.Add(horizon))
+	return &computed, nil
+}
+
+// forecastCrossing describes when a series is predicted to cross its
+// budget.
+func forecastCrossing(series collector.StorageForecast, limit float64, now, until time.Time) string {
+	crossing, ok := series.Model.Crossing(limit, now)
+	switch {
+	case !ok || crossing.After(until):
+		return "beyond horizon"
+	case !crossing.After(now):
+		return "exceeded"
+	}
+	return crossing.UTC().Format(time.DateOnly)
+}
+
+// writeForecast prints the prediction of every series and when it crosses
+// its budget.
+func writeForecast(w io.Writer, forecast collector.Forecast, budgets forecastBudgets, now time.Time, horizon string) {
+	fmt.Fprintf(w, "Forecasting storage on %s\n", historyTime(forecast.Until))
+
+	costs := forecastOptions.CostPerGBMonth > 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	heading := "REGION\tMODEL\tSCANS\tCURRENT\tPREDICTED\tGROWTH"
+	if forecast.GroupBy != "" {
+		heading = "VALUE\t" + heading
+	}
+	if costs {
+		heading += "\tPREDICTED COST"
+	}
+	fmt.Fprintln(tw, heading+"\tBUDGET\tCROSSES BUDGET")
+
+	var crossing int
+	var current, predicted int64
+	for _, series := range forecast.Series {
+		current += series.Current
+		predicted += series.Predicted
+
+		row := fmt.Sprintf("%s\t%s\t%d\t%s\t%s\t%s", series.Region, series.Model.Kind, series.Samples,
+			formatBytes(series.Current), formatBytes(series.Predicted), formatDelta(series.Predicted-series.Current))
+		if forecast.GroupBy != "" {
+			row = groupLabel(series.Group) + "\t" + row
+		}
+		if costs {
+			row += fmt.Sprintf("\t$%.2f", float64(series.Predicted)/gib*forecastOptions.CostPerGBMonth)
+		}
+
+		budget, crosses := "-", "-"
+		if limit, ok := budgets.limit(series, forecastOptions.CostPerGBMonth); ok {
+			budget = formatBytes(int64(math.Min(limit, math.MaxInt64)))
+			crosses = forecastCrossing(series, limit, now, forecast.Until)
+			if crosses != "beyond horizon" {
+				crossing++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", row, budget, crosses)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Series: %d, Crossing Budget Within %s: %d, Total Storage Used: %s -> %s (%s)\n",
+		len(forecast.Series), horizon, crossing, formatBytes(current), formatBytes(predicted), formatDelta(predicted-current))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var groupsOutputFile string
+
+var (
+	groupBy   string
+	stackTags []string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&groupBy, "group-by", "", "aggregate volume and snapshot storage by a tag, e.g. tag:Team")
+	rootCmd.PersistentFlags().StringSliceVar(&stackTags, "stack-tags", collector.DefaultStackTags, "tags naming the CloudFormation stack or Terraform workspace of a resource, first match wins")
+}
+
+// parseGroupBy returns the tag key of a --group-by value.
+func parseGroupBy(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	key, found := strings.CutPrefix(value, "tag:")
+	if !found || key == "" {
+		return "", fmt.Errorf("invalid --group-by %q: expected tag:KEY", value)
+	}
+
+	return key, nil
+}
+
+func groupLabel(value string) string {
+	if value == "" {
+		return "(untagged)"
+	}
+	return value
+}
+
+// writeGroups prints the tag groups and writes them to --groups-file.
+func writeGroups(w io.Writer, report *collector.Report) error {
+	fmt.Fprintf(w, "Storage by tag %s:\n", report.GroupByTag)
+
+	output := []map[string]interface{}{}
+	for _, group := range report.Groups {
+		line := fmt.Sprintf("%s: %s, Entities: %d, Storage Used: %s",
+			report.GroupByTag, groupLabel(group.Value), group.Entities, formatBytes(group.StorageUsed))
+		if report.CostEstimated {
+			line += fmt.Sprintf(", Monthly Cost: $%.2f", group.MonthlyCostUSD)
+		}
+		fmt.Fprintln(w, line)
+
+		row := map[string]interface{}{
+			"Tag":         report.GroupByTag,
+			"Value":       group.Value,
+			"Entities":    group.Entities,
+			"StorageUsed": sizeValue(group.StorageUsed),
+		}
+		if report.CostEstimated {
+			row["MonthlyCostUSD"] = fmt.Sprintf("%.2f", group.MonthlyCostUSD)
+		}
+		output = append(output, row)
+	}
+
+	jsonOutput, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if skipDryRun("write %s", groupsOutputFile) {
+		return nil
+	}
+
+	if err := createParentDir(groupsOutputFile); err != nil {
+		return err
+	}
+	return os.WriteFile(groupsOutputFile, jsonOutput, 0o644)
+}
+
+// printStacks prints the storage of every stack found in the stack tags.
+func printStacks(w io.Writer, report *collector.Report) {
+	fmt.Fprintf(w, "Storage by stack (%d):\n", len(report.Stacks))
+	for _, stack := range report.Stacks {
+		line := fmt.Sprintf("Stack: %s, Entities: %d, Storage Used: %s", stack.Value, stack.Entities, formatBytes(stack.StorageUsed))
+		if report.CostEstimated {
+			line += fmt.Sprintf(", Monthly Cost: $%.2f", stack.MonthlyCostUSD)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
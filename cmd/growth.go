@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var growthOptions = struct {
+	Since     string
+	Threshold float64
+	GroupBy   string
+
+	Window string
+}{}
+
+var analyzeGrowthCmd = &cobra.Command{
+	Use:   "growth",
+	Short: "Show how fast storage grows between scans recorded in --history-db",
+	Long: `Compares the latest scan recorded in --history-db with the last scan
+at least --since old (the oldest scan when there is none) and prints the
+growth of every region and, with --group-by, of every tag value, followed by
+the entities growing faster than --threshold percent.
+
+While scanning with --history-db the same comparison over --growth-window is
+published as the aws_storage_growth_rate gauges.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if historyDB == "" {
+			return errors.New("analyze growth requires --history-db")
+		}
+
+		since, err := parseAge(growthOptions.Since)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		groupBy, err := parseGroupBy(growthOptions.GroupBy)
+		if err != nil {
+			return err
+		}
+
+		db, _, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		baseID, latestID, err := historyScanIDs(db, time.Now().Add(-since))
+		if err != nil {
+			return err
+		}
+		before, err := loadGrowthScan(db, baseID)
+		if err != nil {
+			return err
+		}
+		after, err := loadGrowthScan(db, latestID)
+		if err != nil {
+			return err
+		}
+
+		growth := collector.ComputeGrowth(historyEntities(before), historyEntities(after), groupBy)
+		growth.Since, _ = time.Parse(time.RFC3339, before.ScannedAt)
+		growth.Until, _ = time.Parse(time.RFC3339, after.ScannedAt)
+		writeGrowth(os.Stdout, growth, growthOptions.Threshold)
+		return nil
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeGrowthCmd)
+
+	flags := analyzeGrowthCmd.Flags()
+	flags.StringVar(&growthOptions.Since, "since", "7d", "compare against the last scan at least this old")
+	flags.Float64Var(&growthOptions.Threshold, "threshold", 20, "flag entities growing faster than this percentage")
+	flags.StringVar(&growthOptions.GroupBy, "group-by", "", "also show the growth by a tag, e.g. tag:Team")
+
+	rootCmd.PersistentFlags().StringVar(&growthOptions.Window, "growth-window", "7d", "with --history-db, publish the growth since the last scan at least this old as aws_storage_growth_rate")
+}
+
+// loadGrowthScan loads a scan together with its tags.
+func loadGrowthScan(db *sql.DB, id int64) (*historyScan, error) {
+	scan, err := loadHistoryScan(db, id)
+	if err != nil {
+		return nil, err
+	}
+	return scan, loadHistoryTags(db, scan)
+}
+
+func historyEntities(scan *historyScan) []collector.EntityUsage {
+	entities := make([]collector.EntityUsage, 0, len(scan.Entities))
+	for _, entity := range scan.Entities {
+		entities = append(entities, collector.EntityUsage{
+			ID:          entity.ID,
+			Region:      entity.Region,
+			Type:        entity.Type,
+			StorageUsed: entity.StorageUsed,
+			Tags:        entity.Tags,
+		})
+	}
+	return entities
+}
+
+// reportGrowth compares a fresh report with the last scan in --history-db at
+// least --growth-window older. It returns nil when no scan is old enough,
+// so the gauges never show the growth of a shorter window.
+func reportGrowth(report *collector.Report) (growth *collector.Growth, err error) {
+	window, err := parseAge(growthOptions.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --growth-window: %w", err)
+	}
+	if _, err := os.Stat(historyDB); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	db, _, closeHistory, err := openHistory(historyDB)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := closeHistory(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'scans'`).Scan(&tables); err != nil {
+		return nil, fmt.Errorf("failed to read tables: %w", err)
+	}
+	if tables == 0 {
+		return nil, nil
+	}
+
+	baseline := report.GeneratedAt.Add(-window)
+	var baseID int64
+	err = db.QueryRow(`SELECT id FROM scans WHERE scanned_at <= ? ORDER BY scanned_at DESC, id DESC LIMIT 1`,
+		historyTime(baseline)).Scan(&baseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scans: %w", err)
+	}
+
+	before, err := loadGrowthScan(db, baseID)
+	if err != nil {
+		return nil, err
+	}
+
+	computed := collector.ComputeGrowth(historyEntities(before), report.Entities, report.GroupByTag)
+	computed.Since, _ = time.Parse(time.RFC3339, before.ScannedAt)
+	computed.Until = report.GeneratedAt
+	return &computed, nil
+}
+
+// compareHistory sets the growth of the report with --history-db, and its
+// forecast with --forecast-horizon.
+func compareHistory(report *collector.Report) {
+	if historyDB == "" {
+		return
+	}
+	growth, err := reportGrowth(report)
+	if err != nil {
+		slog.Error("failed to compare with history", "file", historyDB, "error", err)
+		return
+	}
+	report.Growth = growth
+
+	if forecastOptions.ScanHorizon == "" {
+		return
+	}
+	if report.Forecast, err = reportForecast(report); err != nil {
+		slog.Error("failed to forecast from history", "file", historyDB, "error", err)
+	}
+}
+
+// formatRate formats a growth rate as a signed percentage.
+func formatRate(rate float64) string {
+	if math.IsInf(rate, 1) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", rate*100)
+}
+
+func writeGrowthTable(w io.Writer, heading string, growth []collector.StorageGrowth) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tBEFORE\tAFTER\tDELTA\tGROWTH\n", heading)
+	for _, g := range growth {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			groupLabel(g.Key), formatBytes(g.Before), formatBytes(g.After), formatDelta(g.After-g.Before), formatRate(g.Rate()))
+	}
+	tw.Flush()
+}
+
+// writeGrowth prints the growth by region and tag value and the entities
+// growing faster than threshold percent.
+func writeGrowth(w io.Writer, growth collector.Growth, threshold float64) {
+	fmt.Fprintf(w, "Comparing scan %s with scan %s\n", historyTime(growth.Since), historyTime(growth.Until))
+
+	fmt.Fprintln(w, "Growth by region:")
+	writeGrowthTable(w, "REGION", growth.Regions)
+	if growth.GroupBy != "" {
+		fmt.Fprintf(w, "Growth by tag %s:\n", growth.GroupBy)
+		writeGrowthTable(w, "VALUE", growth.Groups)
+	}
+
+	fast := growth.Exceeding(threshold / 100)
+	fmt.Fprintf(w, "Entities growing faster than %g%%:\n", threshold)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tREGION\tBEFORE\tAFTER\tDELTA\tGROWTH")
+	for _, g := range fast {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			g.Type, g.Key, g.Region, formatBytes(g.Before), formatBytes(g.After), formatDelta(g.After-g.Before), formatRate(g.Rate()))
+	}
+	tw.Flush()
+
+	var before, after int64
+	for _, region := range growth.Regions {
+		before += region.Before
+		after += region.After
+	}
+	total := collector.StorageGrowth{Before: before, After: after}
+	fmt.Fprintf(w, "Entities Compared: %d, Growing Faster Than %g%%: %d, Total Storage Used: %s -> %s (%s)\n",
+		len(growth.Entities), threshold, len(fast), formatBytes(before), formatBytes(after), formatRate(total.Rate()))
+}
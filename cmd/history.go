@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	scanned_at         TEXT    NOT NULL,
+	total_storage_used INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scans_scanned_at ON scans (scanned_at);
+
+CREATE TABLE IF NOT EXISTS entity_sizes (
+	scan_id      INTEGER NOT NULL REFERENCES scans (id),
+	id           TEXT    NOT NULL,
+	region       TEXT    NOT NULL,
+	type         TEXT    NOT NULL,
+	storage_used INTEGER NOT NULL,
+	PRIMARY KEY (scan_id, id, region)
+);
+
+CREATE TABLE IF NOT EXISTS entity_tags (
+	scan_id INTEGER NOT NULL REFERENCES scans (id),
+	id      TEXT    NOT NULL,
+	region  TEXT    NOT NULL,
+	key     TEXT    NOT NULL,
+	value   TEXT    NOT NULL,
+	PRIMARY KEY (scan_id, id, region, key)
+);
+
+CREATE TABLE IF NOT EXISTS backup_checks (
+	scan_id INTEGER NOT NULL REFERENCES scans (id),
+	id      TEXT    NOT NULL,
+	region  TEXT    NOT NULL,
+	sla     TEXT    NOT NULL,
+	team    TEXT    NOT NULL,
+	met     INTEGER NOT NULL,
+	PRIMARY KEY (scan_id, id, region)
+);
+`
+
+// Changes reported by diff.
+const (
+	ChangeGrew        = "grew"
+	ChangeShrank      = "shrank"
+	ChangeAppeared    = "appeared"
+	ChangeDisappeared = "disappeared"
+)
+
+var (
+	historyDB   string
+	diffSince   string
+	historyKeep string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how storage changed between scans recorded in --history-db",
+	Long: `Compares the latest scan recorded in --history-db with the last scan
+at least --since old (the oldest scan when there is none) and lists the
+entities that grew, shrank, appeared or disappeared.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if historyDB == "" {
+			return errors.New("diff requires --history-db")
+		}
+
+		since, err := parseAge(diffSince)
+		if err != nil {
+			return err
+		}
+
+		db, _, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		return diffHistory(os.Stdout, db, time.Now().Add(-since))
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage the scans recorded in --history-db",
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the scans older than --keep from --history-db",
+	Long: `Deletes the scans recorded in --history-db that are older than --keep,
+along with their entity sizes, tags and backup checks, and compacts the
+database.
+The latest scan is always kept so diff has something to compare against.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if historyDB == "" {
+			return errors.New("history prune requires --history-db")
+		}
+
+		keep, err := parseAge(historyKeep)
+		if err != nil {
+			return err
+		}
+
+		db, file, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		return pruneHistory(os.Stdout, db, file, time.Now().Add(-keep))
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&historyDB, "history-db", "", "SQLite database every scan appends its per-entity sizes to")
+
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffSince, "since", "7d", "compare against the last scan at least this old")
+
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyPruneCmd)
+	historyPruneCmd.Flags().StringVar(&historyKeep, "keep", "90d", "keep the scans younger than this")
+}
+
+// historyTime formats scan times so that they sort as text.
+func historyTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// appendHistory records the sizes and tags of every entity of a scan, and
+// whether the volumes under a backup SLA met it, in --history-db.
+func appendHistory(path string, report *collector.Report) (err error) {
+	if skipDryRun("append %d entities to %s", len(report.Entities), path) {
+		return nil
+	}
+
+	db, _, closeHistory, err := openHistory(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeHistory(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(historySchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO scans (scanned_at, total_storage_used) VALUES (?, ?)`,
+		historyTime(report.GeneratedAt), report.TotalStorageUsed)
+	if err != nil {
+		return fmt.Errorf("failed to insert scan: %w", err)
+	}
+	scanID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range report.Entities {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO entity_sizes VALUES (?, ?, ?, ?, ?)`,
+			scanID, entity.ID, entity.Region, entity.Type, entity.StorageUsed)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s %s: %w", entity.Type, entity.ID, err)
+		}
+		for key, value := range entity.Tags {
+			_, err := tx.Exec(`INSERT OR REPLACE INTO entity_tags VALUES (?, ?, ?, ?, ?)`,
+				scanID, entity.ID, entity.Region, key, value)
+			if err != nil {
+				return fmt.Errorf("failed to insert tags of %s %s: %w", entity.Type, entity.ID, err)
+			}
+		}
+
+		if entity.BackupAgeHours == nil {
+			continue
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO backup_checks VALUES (?, ?, ?, ?, ?, ?)`,
+			scanID, entity.ID, entity.Region, entity.Tags[backupSLATag], entity.Tags[teamTag],
+			!entity.BackupSLAViolated())
+		if err != nil {
+			return fmt.Errorf("failed to insert backup check of %s: %w", entity.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// historyScan is a scan recorded in the history database.
+type historyScan struct {
+	ID        int64
+	ScannedAt string
+	Entities  map[string]historyEntity // By region and ID
+}
+
+type historyEntity struct {
+	ID          string
+	Region      string
+	Type        string
+	StorageUsed int64
+	Tags        map[string]string // Only set by loadHistoryTags
+}
+
+// entityChange is an entity whose size differs between two scans.
+type entityChange struct {
+	Change string
+	Entity historyEntity
+	Before int64
+	After  int64
+}
+
+// diffHistory prints the changes between the latest scan and the last scan
+// at or before baseline.
+func diffHistory(w io.Writer, db *sql.DB, baseline time.Time) error {
+	baseID, latestID, err := historyScanIDs(db, baseline)
+	if err != nil {
+		return err
+	}
+
+	before, err := loadHistoryScan(db, baseID)
+	if err != nil {
+		return err
+	}
+	after, err := loadHistoryScan(db, latestID)
+	if err != nil {
+		return err
+	}
+
+	writeChanges(w, before, after, diffScans(before, after))
+	return nil
+}
+
+// historyScanIDs returns the latest scan and the last scan at or before
+// baseline, the oldest scan when there is none.
+func historyScanIDs(db *sql.DB, baseline time.Time) (baseID, latestID int64, err error) {
+	err = db.QueryRow(`SELECT id FROM scans ORDER BY scanned_at DESC, id DESC LIMIT 1`).Scan(&latestID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, errors.New("no scans recorded in the history database")
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read scans: %w", err)
+	}
+
+	err = db.QueryRow(`SELECT id FROM scans WHERE scanned_at <= ? ORDER BY scanned_at DESC, id DESC LIMIT 1`,
+		historyTime(baseline)).Scan(&baseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = db.QueryRow(`SELECT id FROM scans ORDER BY scanned_at, id LIMIT 1`).Scan(&baseID)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read scans: %w", err)
+	}
+
+	return baseID, latestID, nil
+}
+
+func loadHistoryScan(db *sql.DB, id int64) (*historyScan, error) {
+	scan := &historyScan{ID: id, Entities: map[string]historyEntity{}}
+	if err := db.QueryRow(`SELECT scanned_at FROM scans WHERE id = ?`, id).Scan(&scan.ScannedAt); err != nil {
+		return nil, fmt.Errorf("failed to read scan %d: %w", id, err)
+	}
+
+	rows, err := db.Query(`SELECT id, region, type, storage_used FROM entity_sizes WHERE scan_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entities of scan %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entity historyEntity
+		if err := rows.Scan(&entity.ID, &entity.Region, &entity.Type, &entity.StorageUsed); err != nil {
+			return nil, err
+		}
+		scan.Entities[entity.Region+"/"+entity.ID] = entity
+	}
+
+	return scan, rows.Err()
+}
+
+// loadHistoryTags adds the recorded tags to the entities of a scan. Scans
+// recorded before tags were kept have none.
+func loadHistoryTags(db *sql.DB, scan *historyScan) error {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'entity_tags'`).Scan(&tables); err != nil {
+		return fmt.Errorf("failed to read tables: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	rows, err := db.Query(`SELECT id, region, key, value FROM entity_tags WHERE scan_id = ?`, scan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read tags of scan %d: %w", scan.ID, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, region, key, value string
+		if err := rows.Scan(&id, &region, &key, &value); err != nil {
+			return err
+		}
+		entity, ok := scan.Entities[region+"/"+id]
+		if !ok {
+			continue
+		}
+		if entity.Tags == nil {
+			entity.Tags = map[string]string{}
+		}
+		entity.Tags[key] = value
+		scan.Entities[region+"/"+id] = entity
+	}
+
+	return rows.Err()
+}
+
+// diffScans returns the entities that changed between two scans, largest
+// change first.
+func diffScans(before, after *historyScan) []entityChange {
+	var changes []entityChange
+
+	for key, entity := range after.Entities {
+		previous, ok := before.Entities[key]
+		switch {
+		case !ok:
+			changes = append(changes, entityChange{Change: ChangeAppeared, Entity: entity, After: entity.StorageUsed})
+		case entity.StorageUsed > previous.StorageUsed:
+			changes = append(changes, entityChange{Change: ChangeGrew, Entity: entity, Before: previous.StorageUsed, After: entity.StorageUsed})
+		case entity.StorageUsed < previous.StorageUsed:
+			changes = append(changes, entityChange{Change: ChangeShrank, Entity: entity, Before: previous.StorageUsed, After: entity.StorageUsed})
+		}
+	}
+	for key, entity := range before.Entities {
+		if _, ok := after.Entities[key]; !ok {
+			changes = append(changes, entityChange{Change: ChangeDisappeared, Entity: entity, Before: entity.StorageUsed})
+		}
+	}
+
+	delta := func(change entityChange) int64 {
+		d := change.After - change.Before
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if delta(changes[i]) != delta(changes[j]) {
+			return delta(changes[i]) > delta(changes[j])
+		}
+		return changes[i].Entity.ID < changes[j].Entity.ID
+	})
+
+	return changes
+}
+
+func writeChanges(w io.Writer, before, after *historyScan, changes []entityChange) {
+	fmt.Fprintf(w, "Comparing scan %s with scan %s\n", before.ScannedAt, after.ScannedAt)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANGE\tTYPE\tID\tREGION\tBEFORE\tAFTER\tDELTA")
+
+	counts := map[string]int{}
+	deltas := map[string]int64{}
+	for _, change := range changes {
+		counts[change.Change]++
+		deltas[change.Change] += change.After - change.Before
+
+		before, after := formatBytes(change.Before), formatBytes(change.After)
+		switch change.Change {
+		case ChangeAppeared:
+			before = "-"
+		case ChangeDisappeared:
+			after = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			change.Change, change.Entity.Type, change.Entity.ID, change.Entity.Region,
+			before, after, formatDelta(change.After-change.Before))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Grew: %d (%s), Shrank: %d (%s), Appeared: %d (%s), Disappeared: %d (%s)\n",
+		counts[ChangeGrew], formatDelta(deltas[ChangeGrew]),
+		counts[ChangeShrank], formatDelta(deltas[ChangeShrank]),
+		counts[ChangeAppeared], formatDelta(deltas[ChangeAppeared]),
+		counts[ChangeDisappeared], formatDelta(deltas[ChangeDisappeared]))
+
+	var totalBefore, totalAfter int64
+	for _, entity := range before.Entities {
+		totalBefore += entity.StorageUsed
+	}
+	for _, entity := range after.Entities {
+		totalAfter += entity.StorageUsed
+	}
+	fmt.Fprintf(w, "Total Storage Used: %s -> %s (%s)\n",
+		formatBytes(totalBefore), formatBytes(totalAfter), formatDelta(totalAfter-totalBefore))
+}
+
+func formatDelta(bytes int64) string {
+	if bytes < 0 {
+		return "-" + formatBytes(-bytes)
+	}
+	return "+" + formatBytes(bytes)
+}
+
+// pruneHistory deletes the scans before cutoff, except the latest one, and
+// prints the database size before and after.
+func pruneHistory(w io.Writer, db *sql.DB, path string, cutoff time.Time) error {
+	if _, err := db.Exec(historySchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	const pruned = `FROM scans WHERE scanned_at < ? AND id <> (SELECT id FROM scans ORDER BY scanned_at DESC, id DESC LIMIT 1)`
+
+	var scans int
+	if err := db.QueryRow(`SELECT COUNT(*) `+pruned, historyTime(cutoff)).Scan(&scans); err != nil {
+		return fmt.Errorf("failed to read scans: %w", err)
+	}
+
+	before, err := fileSize(path)
+	if err != nil {
+		return err
+	}
+
+	if scans == 0 {
+		fmt.Fprintf(w, "No scans older than %s\n", historyTime(cutoff))
+		return nil
+	}
+	if skipDryRun("delete %d scans older than %s from %s", scans, historyTime(cutoff), path) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var entities int64
+	for _, table := range []string{"entity_sizes", "entity_tags", "backup_checks"} {
+		result, err := tx.Exec(`DELETE FROM `+table+` WHERE scan_id IN (SELECT id `+pruned+`)`, historyTime(cutoff))
+		if err != nil {
+			return fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+		if table == "entity_sizes" {
+			entities, _ = result.RowsAffected()
+		}
+	}
+	if _, err := tx.Exec(`DELETE `+pruned, historyTime(cutoff)); err != nil {
+		return fmt.Errorf("failed to prune scans: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Deleted rows only become free pages; VACUUM returns them to the disk.
+	if _, err := db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to compact %s: %w", path, err)
+	}
+
+	after, err := fileSize(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Deleted Scans: %d, Entity Sizes: %d, Database Size: %s -> %s\n",
+		scans, entities, formatFileSize(before), formatFileSize(after))
+	return nil
+}
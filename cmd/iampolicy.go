@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var iamPolicyCmd = &cobra.Command{
+	Use:   "iam-policy [COMMAND] [FLAGS]",
+	Short: "Print the least-privilege IAM policy a command line needs",
+	Long: `Prints the IAM policy JSON allowing exactly the AWS calls that the
+given command and flags make, read from the same config file. Without a
+command the policy covers the default scan:
+
+  crankymosquitos iam-policy --estimate-cost --publish-cloudwatch
+  crankymosquitos iam-policy cleanup --plan plan.json --snapshot-before-delete
+
+Uploads, SNS topics and KMS keys are scoped to the resources the flags name;
+Describe and List calls cannot be scoped and allow every resource.`,
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, flagArgs, err := rootCmd.Find(args)
+		if err != nil {
+			return err
+		}
+		if target == cmd {
+			return cmd.Help()
+		}
+		if err := target.ParseFlags(flagArgs); err != nil {
+			if errors.Is(err, pflag.ErrHelp) {
+				return cmd.Help()
+			}
+			return err
+		}
+		if err := applyConfig(target); err != nil {
+			return err
+		}
+
+		policy, err := requiredPolicy(target)
+		if err != nil {
+			return err
+		}
+		return writePolicy(os.Stdout, policy)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(iamPolicyCmd)
+}
+
+// policyDocument is an IAM policy.
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid       string                       `json:"Sid"`
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// policyBuilder collects the actions of a policy into one statement per
+// Sid, in the order the statements were first added.
+type policyBuilder struct {
+	statements []*policyStatement
+}
+
+// allow adds actions on resources to the statement with the given Sid.
+func (b *policyBuilder) allow(sid string, resources []string, actions ...string) *policyStatement {
+	for _, statement := range b.statements {
+		if statement.Sid == sid {
+			statement.Action = append(statement.Action, actions...)
+			return statement
+		}
+	}
+
+	statement := &policyStatement{Sid: sid, Effect: "Allow", Action: actions, Resource: resources}
+	b.statements = append(b.statements, statement)
+	return statement
+}
+
+// read adds read-only actions, which cannot be scoped to resources.
+func (b *policyBuilder) read(actions ...string) {
+	b.allow("ReadStorageInventory", []string{"*"}, actions...)
+}
+
+func (b *policyBuilder) document() policyDocument {
+	doc := policyDocument{Version: "2012-10-17"}
+	for _, statement := range b.statements {
+		actions := map[string]bool{}
+		for _, action := range statement.Action {
+			actions[action] = true
+		}
+		statement.Action = statement.Action[:0]
+		for action := range actions {
+			statement.Action = append(statement.Action, action)
+		}
+		sort.Strings(statement.Action)
+		doc.Statement = append(doc.Statement, *statement)
+	}
+	return doc
+}
+
+// serviceActions are the read actions of scanning each collector service.
+var serviceActions = map[string][]string{
+	collector.ServiceEBS:       {"ec2:DescribeVolumes", "ec2:DescribeVolumesModifications", "ec2:DescribeInstances"},
+	collector.ServiceSnapshots: {"ec2:DescribeSnapshots", "ec2:DescribeVolumes"},
+	collector.ServiceRDS:       {"rds:DescribeDBInstances", "rds:DescribeDBClusters", "cloudwatch:GetMetricStatistics"},
+	collector.ServiceEFS:       {"elasticfilesystem:DescribeFileSystems"},
+	collector.ServiceFSx:       {"fsx:DescribeFileSystems"},
+	collector.ServiceBackup:    {"backup:ListBackupVaults", "backup:ListRecoveryPointsByBackupVault"},
+	collector.ServiceS3:        {"s3:ListAllMyBuckets", "s3:GetBucketLocation", "cloudwatch:ListMetrics", "cloudwatch:GetMetricStatistics"},
+
+	collector.ServiceDynamoDB:    {"dynamodb:ListTables", "dynamodb:DescribeTable"},
+	collector.ServiceRedshift:    {"redshift:DescribeClusters", "cloudwatch:GetMetricStatistics"},
+	collector.ServiceElastiCache: {"elasticache:DescribeSnapshots"},
+}
+
+// requiredPolicy returns the policy the command needs with the parsed flags.
+func requiredPolicy(target *cobra.Command) (policyDocument, error) {
+	b := &policyBuilder{}
+
+	var services []string
+	estimate, images := false, false
+	name := strings.TrimPrefix(target.CommandPath(), rootCmd.Name()+" ")
+
+	switch name {
+	case rootCmd.Name(), "scan", "serve", "watch":
+		services = scanServices
+		estimate = estimateCost
+		if classifyAccess {
+			b.read("cloudwatch:GetMetricData")
+		}
+	case "storage s3":
+		services = []string{collector.ServiceS3}
+		if s3ListFallback {
+			b.read("s3:ListBucket")
+		}
+	case "storage amis":
+		images = true
+	case "storage instances":
+		b.read("ec2:DescribeInstances", "ec2:DescribeVolumes", "ec2:DescribeInstanceTypes")
+	case "export finops":
+		services = collector.DefaultServices
+		estimate = true
+	case "orphans", "export":
+		services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+		estimate, images = true, true
+	case "tags", "analyze encryption":
+		services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+	case "analyze snapshots", "simulate retention":
+		services = []string{collector.ServiceSnapshots}
+		estimate, images = true, true
+	case "analyze gp2":
+		services = []string{collector.ServiceEBS}
+		estimate = true
+		b.read("cloudwatch:GetMetricData")
+	case "analyze tiering":
+		services = []string{collector.ServiceEBS}
+		estimate = true
+		b.read("cloudwatch:GetMetricData")
+	case "analyze rightsizing":
+		services = []string{collector.ServiceEBS}
+		b.read("cloudwatch:GetMetricData")
+	case "analyze dlm":
+		services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+		estimate = true
+		b.read("dlm:GetLifecyclePolicies", "dlm:GetLifecyclePolicy", "ec2:DescribeInstances")
+	case "analyze archive":
+		services = []string{collector.ServiceSnapshots}
+		estimate, images = true, true
+	case "analyze idle":
+		services = []string{collector.ServiceEBS}
+		estimate = true
+		b.read("cloudwatch:GetMetricData")
+	case "cleanup":
+		if cleanupOptions.Plan == "" {
+			services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+			images = cleanupOptions.DeleteOrphanSnapshots
+			break
+		}
+		b.read("ec2:DescribeVolumes", "ec2:DescribeVolumesModifications", "ec2:DescribeSnapshots")
+		b.allow("DeletePlanned", []string{"*"}, "ec2:DeleteVolume", "ec2:DeleteSnapshot")
+		if cleanupOptions.SnapshotBeforeDelete {
+			b.allow("FinalSnapshots", []string{"*"}, "ec2:CreateSnapshot", "ec2:CreateTags")
+		}
+	case "apply":
+		modify, archive := true, true
+		if applyOptions.Plan != "" {
+			plan, err := readPlan(applyOptions.Plan, "apply", ActionModifyVolume, ActionArchiveSnapshot)
+			if err != nil {
+				return policyDocument{}, err
+			}
+			modify, archive = plan.has(ActionModifyVolume), plan.has(ActionArchiveSnapshot)
+		}
+		if modify {
+			b.allow("ApplyPlanned", []string{"*"}, "ec2:ModifyVolume")
+		}
+		if archive {
+			b.allow("ApplyPlanned", []string{"*"}, "ec2:ModifySnapshotTier")
+		}
+	case "regions list":
+		if resourceGroup != "" {
+			b.read("resource-groups:ListGroupResources")
+		}
+	case "org check":
+		b.read("organizations:ListAccounts")
+		b.allow("AssumeMemberRole", []string{arn.ARN{
+			Partition: partition, Service: "iam", AccountID: "*", Resource: "role/" + orgRoleName,
+		}.String()}, "sts:AssumeRole")
+	default:
+		return policyDocument{}, fmt.Errorf("%s makes no AWS calls", name)
+	}
+
+	if name != "org check" {
+		b.read("ec2:DescribeRegions")
+	}
+	for _, service := range services {
+		b.read(serviceActions[service]...)
+	}
+	if images {
+		b.read("ec2:DescribeImages")
+	}
+	if estimate && pricingFromAPI() {
+		b.read("pricing:GetProducts")
+	}
+	if len(services) > 0 {
+		addScanFeatures(b)
+	}
+	if encryptionOptions.KMSKey != "" {
+		b.allow("EncryptAtRest", []string{kmsKeyResource(encryptionOptions.KMSKey)}, "kms:GenerateDataKey", "kms:Decrypt")
+	}
+
+	return b.document(), nil
+}
+
+// addScanFeatures adds the actions of the optional scan features the flags
+// enable.
+func addScanFeatures(b *policyBuilder) {
+	if accurateSnapshotSize {
+		b.read("ebs:ListSnapshotBlocks", "ebs:ListChangedBlocks")
+	}
+	if resourceGroup != "" {
+		b.read("resource-groups:ListGroupResources")
+	}
+	if ownerOptions.CloudTrail {
+		b.read("cloudtrail:LookupEvents")
+	}
+	if quotas {
+		b.read("servicequotas:ListServiceQuotas", "servicequotas:ListAWSDefaultServiceQuotas")
+	}
+	if cloudWatchOptions.Publish {
+		statement := b.allow("PublishCloudWatchMetrics", []string{"*"}, "cloudwatch:PutMetricData")
+		statement.Condition = map[string]map[string]string{
+			"StringEquals": {"cloudwatch:namespace": cloudWatchOptions.Namespace},
+		}
+	}
+	if uploadS3 != "" {
+		if bucket, prefix, err := parseS3URL(uploadS3); err == nil {
+			if prefix != "" {
+				prefix += "/"
+			}
+			resource := arn.ARN{Partition: partition, Service: "s3", Resource: bucket + "/" + prefix + "*"}.String()
+			b.allow("UploadReports", []string{resource}, "s3:PutObject", "s3:GetObject")
+		}
+	}
+	if strings.HasPrefix(reportDest, "s3://") {
+		if bucket, key, err := parseS3URL(reportDest); err == nil {
+			resource := arn.ARN{Partition: partition, Service: "s3", Resource: bucket + "/" + key}.String()
+			b.allow("WriteReport", []string{resource}, "s3:PutObject")
+		}
+	}
+	if eventOptions.SNSTopicARN != "" {
+		b.allow("PublishEvents", []string{eventOptions.SNSTopicARN}, "sns:Publish")
+	}
+	if len(assumeRoles) > 0 {
+		b.allow("AssumeScanRoles", assumeRoles, "sts:AssumeRole")
+	}
+	if orgRole != "" {
+		b.read("organizations:ListAccounts")
+		b.allow("AssumeOrgRoles", []string{arn.ARN{
+			Partition: partition, Service: "iam", AccountID: "*", Resource: "role/" + orgRole,
+		}.String()}, "sts:AssumeRole")
+	}
+}
+
+// kmsKeyResource returns the policy resource of an --encryption-kms-key
+// value. Key IDs and aliases do not name the key ARN, so any key is allowed.
+func kmsKeyResource(key string) string {
+	if parsed, err := arn.Parse(key); err == nil && strings.HasPrefix(parsed.Resource, "key/") {
+		return key
+	}
+	return "*"
+}
+
+func writePolicy(w io.Writer, policy policyDocument) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(policy)
+}
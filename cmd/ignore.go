@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	ignoreFile  string
+	showIgnored bool
+
+	ignoreList *collector.IgnoreList
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&ignoreFile, "ignore-file", "", "YAML file of accepted resources, by id, arn pattern or tags, left out of the orphan, idle and cost findings but still counted in the totals")
+	rootCmd.PersistentFlags().BoolVar(&showIgnored, "show-ignored", false, "list the findings --ignore-file left out")
+}
+
+// ignoreFileContent is the layout of an --ignore-file:
+//
+//	ignore:
+//	  - id: vol-0123456789abcdef0
+//	    reason: DR copy of the database volume
+//	  - arn: "arn:aws:ec2:eu-west-1:*:volume/*"
+//	  - tags: {Purpose: disaster-recovery}
+type ignoreFileContent struct {
+	Ignore []collector.IgnoreRule `yaml:"ignore"`
+}
+
+// initIgnoreList reads the --ignore-file.
+func initIgnoreList() error {
+	if ignoreFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(ignoreFile)
+	if err != nil {
+		return fmt.Errorf("failed to read --ignore-file: %w", err)
+	}
+
+	var content ignoreFileContent
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&content); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to decode --ignore-file %s: %w", ignoreFile, err)
+	}
+
+	list, err := collector.NewIgnoreList(content.Ignore)
+	if err != nil {
+		return fmt.Errorf("invalid --ignore-file %s: %w", ignoreFile, err)
+	}
+	ignoreList = list
+	return nil
+}
+
+// ignoredFinding is a finding about a resource of the --ignore-file.
+type ignoredFinding struct {
+	Entity collector.EntityUsage
+	Rule   collector.IgnoreRule
+}
+
+// ignoreFindings splits the findings into those to report and those about
+// resources of the --ignore-file.
+func ignoreFindings[T any](findings []T, entity func(T) collector.EntityUsage) ([]T, []ignoredFinding) {
+	if ignoreList.Len() == 0 {
+		return findings, nil
+	}
+
+	var kept []T
+	var ignored []ignoredFinding
+	for _, finding := range findings {
+		e := entity(finding)
+		if rule, ok := ignoreList.Match(e); ok {
+			ignored = append(ignored, ignoredFinding{Entity: e, Rule: rule})
+			continue
+		}
+		kept = append(kept, finding)
+	}
+	return kept, ignored
+}
+
+// printIgnored prints how many findings the --ignore-file left out, and
+// lists them with --show-ignored.
+func printIgnored(w io.Writer, ignored []ignoredFinding) {
+	if len(ignored) == 0 {
+		return
+	}
+	if !showIgnored {
+		fmt.Fprintf(w, "Ignored findings: %d (list them with --show-ignored)\n", len(ignored))
+		return
+	}
+
+	fmt.Fprintf(w, "Ignored findings (%d):\n", len(ignored))
+	for _, finding := range ignored {
+		reason := finding.Rule.Reason
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Fprintf(w, "Type: %s, ID: %s, Region: %s, Storage Used: %s, Reason: %s\n",
+			finding.Entity.Type, finding.Entity.ID, finding.Entity.Region,
+			formatBytes(finding.Entity.StorageUsed), reason)
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	instancesTop    int
+	instanceDetails bool
+)
+
+var storageInstancesCmd = &cobra.Command{
+	Use:   "instances",
+	Short: "Report the block storage of every EC2 instance",
+	Long: `Lists the instances of every region with the size of their EBS root
+and data volumes and the instance store capacity of their instance type,
+most storage first. Instance store is part of the instance type and billed
+with the instance; it is shown for capacity, not cost.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if instancesTop < 0 {
+			return fmt.Errorf("invalid --top %d: must not be negative", instancesTop)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		instances := collector.New(collectorOptions(regions)).Instances(context.Background())
+		writeInstances(os.Stdout, instances, instancesTop)
+
+		return nil
+	},
+}
+
+func init() {
+	storageCmd.AddCommand(storageInstancesCmd)
+
+	storageInstancesCmd.Flags().IntVar(&instancesTop, "top", 20, "list only this many instances, 0 for all")
+
+	rootCmd.Flags().BoolVar(&instanceDetails, "instance-details", true, "look up the type, state and Auto Scaling group of the instances volumes are attached to on every scan; instance names then bypass --name-cache-ttl")
+}
+
+// printStoppedInstanceStorage prints the storage of the volumes attached to
+// stopped instances.
+func printStoppedInstanceStorage(w io.Writer, entities []collector.EntityUsage) {
+	var volumes int
+	var storage int64
+	for _, entity := range entities {
+		if collector.AttachedToStoppedInstance(entity) {
+			volumes++
+			storage += entity.StorageUsed
+		}
+	}
+
+	if volumes == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Attached To Stopped Instances: %s, Volumes: %d\n", formatBytes(storage), volumes)
+}
+
+func writeInstances(w io.Writer, instances []collector.InstanceStorage, top int) {
+	listed := instances
+	if top > 0 && len(listed) > top {
+		listed = listed[:top]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tREGION\tTYPE\tSTATE\tVOLUMES\tROOT\tDATA\tINSTANCE STORE\tTOTAL")
+	for _, instance := range listed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			instance.ID, instance.Name, instance.Region, instance.InstanceType, instance.State, instance.Volumes,
+			formatBytes(instance.RootStorage), formatBytes(instance.DataStorage),
+			formatBytes(instance.InstanceStoreSize), formatBytes(instance.TotalStorage()))
+	}
+	tw.Flush()
+
+	var ebs, instanceStore int64
+	for _, instance := range instances {
+		ebs += instance.EBSStorage()
+		instanceStore += instance.InstanceStoreSize
+	}
+	fmt.Fprintf(w, "Instances: %d, EBS Storage: %s, Instance Store: %s\n",
+		len(instances), formatBytes(ebs), formatBytes(instanceStore))
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/kube"
+)
+
+var (
+	kubeconfig   string
+	kubeContexts []string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "annotate the volumes backing Kubernetes PersistentVolumes with their namespace, claim and pods, read through this kubeconfig")
+	rootCmd.Flags().StringSliceVar(&kubeContexts, "kube-contexts", nil, "contexts of --kubeconfig whose clusters are read (default: the current context)")
+}
+
+// correlateKubernetes annotates the volumes of the report with the
+// PersistentVolumes of the --kube-contexts clusters they back. Clusters
+// that cannot be read are logged and skipped.
+func correlateKubernetes(report *collector.Report) {
+	if kubeconfig == "" {
+		return
+	}
+
+	contexts := kubeContexts
+	if len(contexts) == 0 {
+		contexts = []string{""} // The current context
+	}
+
+	volumes := map[string]*collector.EntityUsage{}
+	for i := range report.Entities {
+		if entity := &report.Entities[i]; entity.Type == collector.EntityTypeVolume {
+			volumes[entity.ID] = entity
+		}
+	}
+
+	ctx := context.Background()
+	for _, name := range contexts {
+		client, err := kube.NewClient(kubeconfig, name)
+		if err != nil {
+			slog.Error("failed to read kubeconfig", "file", kubeconfig, "context", name, "error", err)
+			continue
+		}
+		claims, err := client.VolumeClaims(ctx)
+		if err != nil {
+			slog.Error("failed to list the persistent volumes of the cluster", "context", client.Context, "error", err)
+			continue
+		}
+
+		var correlated int
+		for _, claim := range claims {
+			entity, ok := volumes[claim.VolumeID]
+			if !ok {
+				continue
+			}
+			entity.KubeCluster = client.Context
+			entity.KubeNamespace = claim.Namespace
+			entity.KubePVC = claim.Claim
+			entity.KubePods = claim.Pods
+			correlated++
+		}
+		slog.Info("correlated persistent volumes", "context", client.Context, "persistent_volumes", len(claims), "volumes", correlated)
+	}
+}
+
+// printKubernetesStorage prints the volumes and storage of every
+// namespace whose claims are backed by scanned volumes.
+func printKubernetesStorage(w io.Writer, entities []collector.EntityUsage) {
+	type namespace struct {
+		cluster, name string
+	}
+	volumes := map[namespace]int{}
+	storage := map[namespace]int64{}
+	for _, entity := range entities {
+		if entity.KubeCluster == "" {
+			continue
+		}
+		key := namespace{entity.KubeCluster, entity.KubeNamespace}
+		volumes[key]++
+		storage[key] += entity.StorageUsed
+	}
+	if len(volumes) == 0 {
+		return
+	}
+
+	namespaces := make([]namespace, 0, len(volumes))
+	for key := range volumes {
+		namespaces = append(namespaces, key)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if storage[namespaces[i]] != storage[namespaces[j]] {
+			return storage[namespaces[i]] > storage[namespaces[j]]
+		}
+		if namespaces[i].cluster != namespaces[j].cluster {
+			return namespaces[i].cluster < namespaces[j].cluster
+		}
+		return namespaces[i].name < namespaces[j].name
+	})
+
+	for _, key := range namespaces {
+		name := key.name
+		if name == "" {
+			name = "(unclaimed)"
+		}
+		fmt.Fprintf(w, "Kubernetes Cluster: %s, Namespace: %s, Volumes: %d, Storage Used: %s\n",
+			key.cluster, name, volumes[key], formatBytes(storage[key]))
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	metricsDocsFormat string
+	metricDetail      string
+	extraLabels       []string
+
+	// metricsOptions holds the parsed --metric-detail and --extra-label.
+	metricsOptions collector.MetricsOptions
+
+	metricsHooks []func(*collector.Metrics)
+)
+
+// AddMetrics registers a hook that adds custom metrics, typically with
+// Metrics.DeriveGaugeVec, to the metrics of every scan. Programs embedding
+// the command call it before Execute.
+func AddMetrics(hook func(*collector.Metrics)) {
+	metricsHooks = append(metricsHooks, hook)
+}
+
+// newMetrics creates the built-in metrics plus those of the AddMetrics
+// hooks.
+func newMetrics() *collector.Metrics {
+	metrics := collector.NewMetricsWithOptions(metricsOptions)
+	for _, hook := range metricsHooks {
+		hook(metrics)
+	}
+	return metrics
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Information about the exported Prometheus metrics",
+}
+
+var metricsDocsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Print a reference of every metric the exporter can produce",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch metricsDocsFormat {
+		case "markdown":
+			return writeMetricDocsMarkdown(os.Stdout, newMetrics().Docs())
+		case "html":
+			return writeMetricDocsHTML(os.Stdout, newMetrics().Docs())
+		}
+		return fmt.Errorf("unknown format %q: must be markdown or html", metricsDocsFormat)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+	metricsCmd.AddCommand(metricsDocsCmd)
+
+	metricsDocsCmd.Flags().StringVar(&metricsDocsFormat, "format", "markdown", "output format (markdown or html)")
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&metricDetail, "metric-detail", collector.MetricDetailEntity, "metric families to register: "+strings.Join(collector.MetricDetails, ", ")+", from per-entity series down to totals only")
+	flags.StringArrayVar(&extraLabels, "extra-label", nil, "also label the per-entity and per-region metrics with the value of a tag, e.g. tag:Team (repeatable)")
+}
+
+// initMetrics validates --metric-detail and --extra-label, and labels the
+// metrics of a --shard with it.
+func initMetrics() error {
+	if !slices.Contains(collector.MetricDetails, metricDetail) {
+		return fmt.Errorf("invalid --metric-detail %q: must be one of %s", metricDetail, strings.Join(collector.MetricDetails, ", "))
+	}
+
+	opts := collector.MetricsOptions{Detail: metricDetail}
+	labels := map[string]string{}
+	for _, value := range extraLabels {
+		key, found := strings.CutPrefix(value, "tag:")
+		if !found || key == "" {
+			return fmt.Errorf("invalid --extra-label %q: expected tag:KEY", value)
+		}
+		label := collector.TagLabel(key)
+		if other, ok := labels[label]; ok {
+			return fmt.Errorf("--extra-label tag:%s and tag:%s would both be exported as %s", other, key, label)
+		}
+		labels[label] = key
+		opts.ExtraTags = append(opts.ExtraTags, key)
+	}
+
+	if shard.Count > 0 {
+		opts.ConstLabels = map[string]string{"shard": shard.String()}
+	}
+
+	metricsOptions = opts
+	return nil
+}
+
+func writeMetricDocsMarkdown(w io.Writer, docs []*collector.MetricDoc) error {
+	fmt.Fprintln(w, "# Metrics")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Name | Type | Labels | Cardinality | Detail | Help |")
+	fmt.Fprintln(w, "|------|------|--------|-------------|--------|------|")
+	for _, doc := range docs {
+		labels := "-"
+		if len(doc.Labels) > 0 {
+			labels = "`" + strings.Join(doc.Labels, "`, `") + "`"
+		}
+		_, err := fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s | %s |\n", doc.Name, doc.Type, labels, doc.Cardinality, doc.Detail, doc.Help)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var metricDocsTemplate = template.Must(template.New("metrics").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>crankymosquitos metrics</title></head>
+<body>
+<h1>Metrics</h1>
+<table>
+<tr><th>Name</th><th>Type</th><th>Labels</th><th>Cardinality</th><th>Detail</th><th>Help</th></tr>
+{{- range . }}
+<tr><td><code>{{ .Name }}</code></td><td>{{ .Type }}</td><td>{{ range $i, $l := .Labels }}{{ if $i }}, {{ end }}<code>{{ $l }}</code>{{ end }}</td><td>{{ .Cardinality }}</td><td>{{ .Detail }}</td><td>{{ .Help }}</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+func writeMetricDocsHTML(w io.Writer, docs []*collector.MetricDoc) error {
+	return metricDocsTemplate.Execute(w, docs)
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// topConsumers is the number of entities listed in a scan summary.
+const topConsumers = 5
+
+var notifyOptions = struct {
+	SlackWebhookURL string
+	WebhookURL      string
+	GrowthThreshold float64
+}{}
+
+// notifyBaseline is the previous scan of this process, the baseline of the
+// next summary's deltas.
+var notifyBaseline *historyScan
+
+func init() {
+	addNotifyFlags(rootCmd)
+	addNotifyFlags(storageS3Cmd)
+}
+
+func addNotifyFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&notifyOptions.SlackWebhookURL, "slack-webhook-url", "", "post a summary of every scan to this Slack incoming webhook")
+	flags.StringVar(&notifyOptions.WebhookURL, "webhook-url", "", "post a JSON summary of every scan to this URL")
+	flags.Float64Var(&notifyOptions.GrowthThreshold, "growth-threshold", 20, "flag entities that grew by at least this percentage since the previous scan")
+}
+
+// scanSummary is the body posted to --webhook-url.
+type scanSummary struct {
+	Text             string           `json:"text"`
+	GeneratedAt      time.Time        `json:"generated_at"`
+	Entities         int              `json:"entities"`
+	TotalStorageUsed int64            `json:"total_storage_used"`
+	PreviousScanAt   string           `json:"previous_scan_at,omitempty"`
+	PreviousTotal    *int64           `json:"previous_total_storage_used,omitempty"`
+	TopConsumers     []summaryEntity  `json:"top_consumers"`
+	Anomalies        []summaryAnomaly `json:"anomalies"`
+}
+
+type summaryEntity struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Region      string `json:"region"`
+	StorageUsed int64  `json:"storage_used"`
+}
+
+// summaryAnomaly is an entity that grew by at least --growth-threshold.
+type summaryAnomaly struct {
+	summaryEntity
+	Before        int64   `json:"before"`
+	GrowthPercent float64 `json:"growth_percent"`
+}
+
+// slackMessage is the body posted to --slack-webhook-url.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// notifyScan posts the summary of a scan to the configured webhooks. The
+// deltas are against the previous scan of this process, or the latest scan
+// in --history-db, so it has to run before the scan is appended there.
+func notifyScan(report *collector.Report) {
+	if notifyOptions.SlackWebhookURL == "" && notifyOptions.WebhookURL == "" {
+		return
+	}
+
+	baseline := notifyBaseline
+	if baseline == nil && historyDB != "" {
+		var err error
+		if baseline, err = latestHistoryScan(historyDB); err != nil {
+			slog.Warn("skipping deltas of the scan summary", "error", err)
+		}
+	}
+	current := reportHistoryScan(report)
+	notifyBaseline = current
+
+	summary := summarizeScan(report, baseline, current)
+
+	ctx := context.Background()
+	client := &http.Client{Timeout: 30 * time.Second}
+	if url := notifyOptions.SlackWebhookURL; url != "" && !skipDryRun("post the scan summary to Slack") {
+		if err := postJSON(ctx, client, url, slackMessage{Text: summary.Text}); err != nil {
+			slog.Error("failed to post the scan summary to Slack", "error", err)
+		}
+	}
+	if url := notifyOptions.WebhookURL; url != "" && !skipDryRun("post the scan summary to %s", url) {
+		if err := postJSON(ctx, client, url, summary); err != nil {
+			slog.Error("failed to post the scan summary", "url", url, "error", err)
+		}
+	}
+}
+
+// summarizeScan builds the summary of a scan. baseline is nil for the first
+// scan, whose summary has no deltas.
+func summarizeScan(report *collector.Report, baseline, current *historyScan) scanSummary {
+	summary := scanSummary{
+		GeneratedAt:      report.GeneratedAt,
+		Entities:         len(report.Entities),
+		TotalStorageUsed: report.TotalStorageUsed,
+		TopConsumers:     []summaryEntity{},
+		Anomalies:        []summaryAnomaly{},
+	}
+
+	entities := append([]collector.EntityUsage(nil), report.Entities...)
+	sortEntities(entities)
+	for i := 0; i < len(entities) && i < topConsumers; i++ {
+		summary.TopConsumers = append(summary.TopConsumers, summaryEntity{
+			Type:        entities[i].Type,
+			ID:          entities[i].ID,
+			Region:      entities[i].Region,
+			StorageUsed: entities[i].StorageUsed,
+		})
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Scan complete: %s across %d entities", formatBytes(report.TotalStorageUsed), len(report.Entities))
+
+	if baseline != nil {
+		var previous int64
+		for _, entity := range baseline.Entities {
+			previous += entity.StorageUsed
+		}
+		summary.PreviousScanAt = baseline.ScannedAt
+		summary.PreviousTotal = &previous
+		fmt.Fprintf(&text, " (%s since %s)", formatBytesDelta(report.TotalStorageUsed-previous), baseline.ScannedAt)
+
+		for _, change := range diffScans(baseline, current) {
+			if change.Change != ChangeGrew {
+				continue
+			}
+			growth := float64(change.After-change.Before) / float64(change.Before) * 100
+			if growth < notifyOptions.GrowthThreshold {
+				continue
+			}
+			summary.Anomalies = append(summary.Anomalies, summaryAnomaly{
+				summaryEntity: summaryEntity{
+					Type:        change.Entity.Type,
+					ID:          change.Entity.ID,
+					Region:      change.Entity.Region,
+					StorageUsed: change.After,
+				},
+				Before:        change.Before,
+				GrowthPercent: growth,
+			})
+		}
+	}
+	text.WriteString("\n")
+
+	if len(summary.TopConsumers) > 0 {
+		text.WriteString("Top consumers:\n")
+		for i, entity := range summary.TopConsumers {
+			fmt.Fprintf(&text, "%d. %s %s (%s): %s\n", i+1, entity.Type, entity.ID, entity.Region, formatBytes(entity.StorageUsed))
+		}
+	}
+	if len(summary.Anomalies) > 0 {
+		fmt.Fprintf(&text, "Grew by %.0f%% or more:\n", notifyOptions.GrowthThreshold)
+		for _, anomaly := range summary.Anomalies {
+			fmt.Fprintf(&text, "- %s %s (%s): %s -> %s (+%.0f%%)\n", anomaly.Type, anomaly.ID, anomaly.Region,
+				formatBytes(anomaly.Before), formatBytes(anomaly.StorageUsed), anomaly.GrowthPercent)
+		}
+	}
+	summary.Text = strings.TrimSuffix(text.String(), "\n")
+
+	return summary
+}
+
+// reportHistoryScan converts a report into the form scans are recorded in,
+// so it can be diffed like one.
+func reportHistoryScan(report *collector.Report) *historyScan {
+	scan := &historyScan{ScannedAt: historyTime(report.GeneratedAt), Entities: map[string]historyEntity{}}
+	for _, entity := range report.Entities {
+		scan.Entities[entity.Region+"/"+entity.ID] = historyEntity{
+			ID:          entity.ID,
+			Region:      entity.Region,
+			Type:        entity.Type,
+			StorageUsed: entity.StorageUsed,
+		}
+	}
+	return scan
+}
+
+// latestHistoryScan returns the latest scan recorded in the history
+// database, or nil when the database holds none yet.
+func latestHistoryScan(path string) (*historyScan, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	db, _, closeHistory, err := openHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeHistory()
+
+	if _, err := db.Exec(historySchema); err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM scans ORDER BY scanned_at DESC, id DESC LIMIT 1`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scans: %w", err)
+	}
+
+	return loadHistoryScan(db, id)
+}
+
+func formatBytesDelta(bytes int64) string {
+	if bytes < 0 {
+		return "-" + formatBytes(-bytes)
+	}
+	return "+" + formatBytes(bytes)
+}
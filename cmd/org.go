@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+var (
+	orgRoleName    string
+	orgCheckRegion string
+	orgFailOnGaps  bool
+
+	// orgRole is the role of --org-role; orgTargets holds the accounts
+	// discoverOrgAccounts found for the current scan.
+	orgRole    string
+	orgTargets []scanTarget
+)
+
+// AccountCheck is the onboarding state of a single organization account.
+type AccountCheck struct {
+	AccountID          string
+	Name               string
+	Status             string
+	RoleArn            string
+	Assumable          bool
+	MissingPermissions []string
+	Error              string
+}
+
+// Ready reports whether the account can be scanned without gaps.
+func (a AccountCheck) Ready() bool {
+	return a.Assumable && len(a.MissingPermissions) == 0 && a.Error == ""
+}
+
+// permissionProbe is a read-only call used to verify that an assumed role has
+// a permission needed by the scan.
+type permissionProbe struct {
+	Action string
+	Call   func(ctx context.Context, client *ec2.Client) error
+}
+
+var orgPermissionProbes = []permissionProbe{
+	{
+		Action: "ec2:DescribeRegions",
+		Call: func(ctx context.Context, client *ec2.Client) error {
+			_, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+			return err
+		},
+	},
+	{
+		Action: "ec2:DescribeVolumes",
+		Call: func(ctx context.Context, client *ec2.Client) error {
+			_, err := client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{MaxResults: aws.Int32(5)})
+			return err
+		},
+	},
+	{
+		Action: "ec2:DescribeSnapshots",
+		Call: func(ctx context.Context, client *ec2.Client) error {
+			_, err := client.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+				OwnerIds:   []string{"self"},
+				MaxResults: aws.Int32(5),
+			})
+			return err
+		},
+	},
+	{
+		Action: "ec2:DescribeInstances",
+		Call: func(ctx context.Context, client *ec2.Client) error {
+			_, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{MaxResults: aws.Int32(5)})
+			return err
+		},
+	},
+}
+
+var orgCmd = &cobra.Command{
+	Use:   "org",
+	Short: "Work with the accounts of an AWS Organization",
+}
+
+var orgCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Verify every organization account is ready to be scanned",
+	Long: `Lists the accounts of the organization from the management account,
+assumes the cross-account role in each one and probes the permissions the
+scan needs, printing an onboarding gap report.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		region := orgCheckRegion
+		if region == "" {
+			region = bootstrapRegion()
+		}
+		checks, err := checkOrgAccounts(context.Background(), orgRoleName, region)
+		if err != nil {
+			return err
+		}
+
+		gaps := writeAccountChecks(os.Stdout, checks)
+		if orgFailOnGaps && gaps > 0 {
+			return fmt.Errorf("%d of %d accounts are not ready for scanning", gaps, len(checks))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(orgCmd)
+	orgCmd.AddCommand(orgCheckCmd)
+
+	orgCheckCmd.Flags().StringVar(&orgRoleName, "role-name", "OrganizationAccountAccessRole", "cross-account role assumed in each member account")
+	orgCheckCmd.Flags().StringVar(&orgCheckRegion, "region", "", "region used for the permission probes (default: the --partition bootstrap region)")
+	orgCheckCmd.Flags().BoolVar(&orgFailOnGaps, "fail-on-gaps", false, "exit non-zero when any account is not ready")
+
+	rootCmd.PersistentFlags().StringVar(&orgRole, "org-role", "", "scan every active account of the organization, assuming this role (e.g. OrganizationAccountAccessRole) from the management account, and merge the reports")
+}
+
+// discoverOrgAccounts lists the active accounts of the organization with
+// the default credentials of the management account and makes them the
+// --org-role scan targets. The management account itself is scanned with
+// the default credentials.
+func discoverOrgAccounts(ctx context.Context) error {
+	if orgRole == "" {
+		return nil
+	}
+
+	cfg, err := loadAwsConfig(bootstrapRegion())
+	if err != nil {
+		return err
+	}
+	managementAccount, err := configAccount(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := listOrgAccounts(ctx, organizations.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to list organization accounts: %w", err)
+	}
+
+	var targets []scanTarget
+	for _, account := range accounts {
+		id := aws.ToString(account.Id)
+		if account.State != orgtypes.AccountStateActive {
+			slog.Debug("skipping inactive account", "account", id, "state", account.State)
+			continue
+		}
+
+		target := scanTarget{AccountID: id}
+		if id != managementAccount {
+			target.RoleARN = awsres.RoleARN(partition, id, orgRole)
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].AccountID < targets[j].AccountID })
+
+	slog.Info("discovered organization accounts", "accounts", len(targets), "skipped", len(accounts)-len(targets))
+	orgTargets = targets
+	return nil
+}
+
+func listOrgAccounts(ctx context.Context, client *organizations.Client) ([]orgtypes.Account, error) {
+	var accounts []orgtypes.Account
+
+	paginator := organizations.NewListAccountsPaginator(client, &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, page.Accounts...)
+	}
+
+	return accounts, nil
+}
+
+func checkOrgAccounts(ctx context.Context, roleName, region string) ([]AccountCheck, error) {
+	cfg, err := loadAwsConfig(region)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	callerAccount := aws.ToString(identity.Account)
+
+	accounts, err := listOrgAccounts(ctx, organizations.NewFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization accounts: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	checks := make([]AccountCheck, len(accounts))
+
+	for i, account := range accounts {
+		wg.Add(1)
+
+		go func(i int, account orgtypes.Account) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			checks[i] = checkAccount(ctx, cfg, account, roleName, callerAccount)
+			<-semaphore // Release the semaphore slot
+		}(i, account)
+	}
+
+	wg.Wait()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].AccountID < checks[j].AccountID })
+
+	return checks, nil
+}
+
+func checkAccount(ctx context.Context, cfg aws.Config, account orgtypes.Account, roleName, callerAccount string) AccountCheck {
+	check := AccountCheck{
+		AccountID: aws.ToString(account.Id),
+		Name:      aws.ToString(account.Name),
+		Status:    string(account.State),
+	}
+
+	if account.State != orgtypes.AccountStateActive {
+		check.Error = "account is not active"
+		return check
+	}
+
+	accountCfg := cfg.Copy()
+
+	// The management account is scanned with the caller's own credentials.
+	if check.AccountID != callerAccount {
+		check.RoleArn = awsres.RoleARN(awsres.Partition(cfg.Region), check.AccountID, roleName)
+
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), check.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "crankymosquitos-org-check"
+		})
+		accountCfg.Credentials = aws.NewCredentialsCache(provider)
+
+		if _, err := accountCfg.Credentials.Retrieve(ctx); err != nil {
+			slog.Error("failed to assume role", "role", check.RoleArn, "error", err)
+			check.Error = "role missing or not assumable"
+			return check
+		}
+	}
+	check.Assumable = true
+
+	client := ec2.NewFromConfig(accountCfg)
+	for _, probe := range orgPermissionProbes {
+		err := probe.Call(ctx, client)
+		if err == nil {
+			continue
+		}
+
+		if isAccessDenied(err) {
+			check.MissingPermissions = append(check.MissingPermissions, probe.Action)
+			continue
+		}
+
+		slog.Warn("probe failed", "action", probe.Action, "account", check.AccountID, "error", err)
+		check.Error = fmt.Sprintf("%s: %v", probe.Action, err)
+	}
+
+	return check
+}
+
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	}
+
+	return false
+}
+
+// writeAccountChecks prints the onboarding report and returns the number of
+// accounts with gaps.
+func writeAccountChecks(w io.Writer, checks []AccountCheck) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tNAME\tSTATUS\tASSUMABLE\tMISSING PERMISSIONS\tERROR")
+
+	gaps := 0
+	for _, check := range checks {
+		if !check.Ready() {
+			gaps++
+		}
+
+		missing := strings.Join(check.MissingPermissions, ",")
+		if missing == "" {
+			missing = "-"
+		}
+		errMsg := check.Error
+		if errMsg == "" {
+			errMsg = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n",
+			check.AccountID, check.Name, check.Status, check.Assumable, missing, errMsg)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "%d of %d accounts ready for scanning\n", len(checks)-gaps, len(checks))
+
+	return gaps
+}
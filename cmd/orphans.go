@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var orphansOlderThan string
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "Report unattached volumes and snapshots nothing depends on",
+	Long: `Flags unattached volumes, snapshots whose source volume no longer
+exists and snapshots not referenced by any AMI, together with their owner
+and the storage and estimated monthly cost that cleaning them up would
+reclaim. Snapshots still being taken and volumes being modified are marked
+IN FLIGHT: their sizes are not final, and cleanup leaves them alone.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		olderThan, err := parseAge(orphansOlderThan)
+		if err != nil {
+			return err
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+		opts.EstimateCost = true
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		orphans := collector.FindOrphans(report.Entities, c.AMISnapshotIDs(context.Background()), time.Now(), olderThan)
+		orphans, ignored := ignoreFindings(orphans, func(orphan collector.Orphan) collector.EntityUsage { return orphan.Entity })
+		assignOwners(context.Background(), orphans)
+		writeOrphans(os.Stdout, orphans)
+		printIgnored(os.Stdout, ignored)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(orphansCmd)
+
+	orphansCmd.Flags().StringVar(&orphansOlderThan, "older-than", "0d", "only report resources older than this age (e.g. 90d)")
+}
+
+func writeOrphans(w io.Writer, orphans []collector.Orphan) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tREGION\tOWNER\tSIZE\tAGE (DAYS)\tMONTHLY COST\tIN FLIGHT\tREASONS")
+
+	var bytes int64
+	var cost float64
+	for _, orphan := range orphans {
+		entity := orphan.Entity
+		bytes += entity.StorageUsed
+		cost += entity.MonthlyCostUSD
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.0f\t$%.2f\t%s\t%s\n",
+			entity.Type, entity.ID, entity.Region, ownerLabel(orphan.Owner), formatBytes(entity.StorageUsed),
+			orphan.Age.Hours()/24, entity.MonthlyCostUSD, pendingLabel(entity), strings.Join(orphan.Reasons, ", "))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Orphaned resources: %d, Reclaimable Storage: %s, Reclaimable Monthly Cost: $%.2f\n",
+		len(orphans), formatBytes(bytes), cost)
+}
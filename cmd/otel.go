@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var otelEndpoint string
+
+func init() {
+	addOTelFlags(rootCmd)
+	addOTelFlags(storageS3Cmd)
+}
+
+func addOTelFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&otelEndpoint, "otel-endpoint", "", "also export the storage gauges to this OTLP/HTTP endpoint after the scan (e.g. http://localhost:4318)")
+}
+
+// exportOTel exports the report to --otel-endpoint when it is set.
+func exportOTel(report *collector.Report) error {
+	if otelEndpoint == "" {
+		return nil
+	}
+
+	if skipDryRun("export metrics to %s", otelEndpoint) {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	account, err := callerAccount(ctx)
+	if err != nil {
+		slog.Warn("exporting without cloud.account.id", "error", err)
+	}
+
+	opts := collector.OTLPOptions{Endpoint: otelEndpoint, AccountID: account}
+	if err := collector.ExportOTLP(ctx, opts, report); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summaryOut, "Exported metrics to %s\n", otelEndpoint)
+	return nil
+}
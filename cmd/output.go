@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+	"github.com/taylormonacelli/crankymosquitos/pkg/sink"
+	"github.com/taylormonacelli/crankymosquitos/schema"
+)
+
+var (
+	outputFormat string
+	outputFile   string
+	reportDest   string
+	reportSchema string
+
+	// reportSink is where writeRows writes the report, set by initOutput.
+	reportSink sink.ReportSink = sink.Stdout
+
+	// summaryOut receives progress and summary lines. They go to stderr
+	// when a machine-readable report is written to stdout.
+	summaryOut io.Writer = os.Stdout
+)
+
+// reportColumns is the display order of the report columns.
+var reportColumns = []string{
+	"Profile", "AccountID", "Type", "ID", "StorageUsed", "Region", "AttachedInstance",
+	"InstanceType", "InstanceState", "AutoScalingGroup", "VolumeType", "IOPS", "Throughput", "Encrypted", "MultiAttach",
+	"PendingOperation", "PendingProgress",
+	"KubeCluster", "KubeNamespace", "KubePVC", "KubePods",
+	"ObjectCount", "Engine", "FileSystemType", "AllocatedStorage", "BackupVault", "ResourceType", "SnapshotOwner", "Public",
+	"SourceVolume", "VolumeExists", "StartTime", "Description", "MonthlyCostUSD",
+	"BackupAgeHours", "BackupSLAViolated", "SnapshotAgeSeconds", "SnapshotCoverageGap", "AccessClass", "Recommendation",
+	"Link", "InstanceLink",
+}
+
+func init() {
+	addOutputFlags(rootCmd)
+	addOutputFlags(storageS3Cmd)
+}
+
+func addOutputFlags(cmd *cobra.Command) {
+	formats := append(output.Names(), sqliteFormat)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "report format ("+strings.Join(formats, ", ")+")")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "write the report to this file instead of stdout")
+	cmd.Flags().StringVar(&reportDest, "report-dest", "", "write the report to this destination instead of stdout: a file path, or a file://, s3:// or gs:// URL such as s3://bucket/report.json")
+	cmd.Flags().BoolVar(&streamOutput, "stream", false, "write csv, json and jsonl reports one row at a time instead of formatting them in memory, and stream the /report and entities API responses of serve")
+	cmd.Flags().StringVar(&reportSchema, "schema", "v"+schema.LatestVersion, "JSON report schema: v2 wraps the entities in an envelope with the run metadata, v1 writes a bare array")
+}
+
+// initOutput validates the output flags, opens the report destination and
+// picks where summaries go. The formatter is nil for the sqlite format,
+// which writeReport handles itself.
+func initOutput() (output.Formatter, error) {
+	if err := validateUploadFormats(); err != nil {
+		return nil, err
+	}
+	if err := initReportSink(); err != nil {
+		return nil, err
+	}
+	if outputFormat == sqliteFormat {
+		if outputFile == "" {
+			return nil, errors.New("--output sqlite requires --output-file or a file --report-dest")
+		}
+		return nil, nil
+	}
+
+	formatter, err := output.Get(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	if reportSchema != "v1" && reportSchema != "v2" {
+		return nil, fmt.Errorf("invalid --schema %q: must be v1 or v2", reportSchema)
+	}
+	if err := validateStream(); err != nil {
+		return nil, err
+	}
+
+	if reportSink == sink.Stdout && outputFormat != "table" {
+		summaryOut = os.Stderr
+	}
+
+	return formatter, nil
+}
+
+// initReportSink opens --report-dest, or --output-file, which is the same as
+// a --report-dest file path. A local file destination also sets outputFile,
+// which the sqlite format and --upload-s3 read.
+func initReportSink() error {
+	dest := reportDest
+	switch {
+	case dest != "" && outputFile != "":
+		return errors.New("--output-file and --report-dest cannot be used together")
+	case dest == "":
+		dest = outputFile
+	}
+
+	s, err := sink.Open(dest)
+	if err != nil {
+		return fmt.Errorf("invalid --report-dest: %w", err)
+	}
+	if file, ok := s.(sink.File); ok {
+		outputFile = string(file)
+	}
+	reportSink = s
+	return nil
+}
+
+// writeRows writes the report rows with the formatter to the report sink.
+// Stdout is written as the rows are formatted, other sinks once the whole
+// report is.
+func writeRows(formatter output.Formatter, rows []output.Row) error {
+	if reportSink == sink.Stdout {
+		return formatter.Format(os.Stdout, reportColumns, rows)
+	}
+	if skipDryRun("write %d rows to %s", len(rows), reportSink) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, reportColumns, rows); err != nil {
+		return err
+	}
+	if err := reportSink.Write(context.Background(), buf.Bytes()); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summaryOut, "Output written to %s\n", reportSink)
+	return nil
+}
+
+// reportEnvelope is the version 2 JSON report.
+type reportEnvelope struct {
+	SchemaVersion string          `json:"schema_version"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+	Units         string          `json:"units,omitempty"`
+	AccountIDs    []string        `json:"account_ids"`
+	Totals        reportTotals    `json:"totals"`
+	FailedRegions []failedRegion  `json:"failed_regions,omitempty"`
+	Run           *reportRun      `json:"run,omitempty"`
+	Findings      []reportFinding `json:"findings,omitempty"`
+	Quotas        []reportQuota   `json:"quotas,omitempty"`
+	Owners        []reportOwner   `json:"owners,omitempty"`
+	Entities      []output.Row    `json:"entities"`
+}
+
+// reportRun is the run metadata of a JSON report, recording what the scan
+// covered and who ran it.
+type reportRun struct {
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Caller          *reportCaller    `json:"caller,omitempty"`
+	RegionsScanned  []string         `json:"regions_scanned"`
+	APICalls        map[string]int64 `json:"api_calls"`
+	OperationCalls  map[string]int64 `json:"api_calls_by_operation,omitempty"`
+	APIBudget       bool             `json:"api_budget_reached,omitempty"`
+	RegionErrors    map[string]int64 `json:"region_errors,omitempty"`
+}
+
+type reportCaller struct {
+	AccountID string `json:"account_id"`
+	ARN       string `json:"arn"`
+	UserID    string `json:"user_id"`
+}
+
+// runMetadata returns the run metadata of a scanned report, or nil for
+// replayed reports, which do not record when they were started.
+func runMetadata(report *collector.Report) *reportRun {
+	if report.StartedAt.IsZero() {
+		return nil
+	}
+
+	run := &reportRun{
+		StartedAt:       report.StartedAt.UTC().Truncate(time.Second),
+		FinishedAt:      report.GeneratedAt.UTC().Truncate(time.Second),
+		DurationSeconds: report.GeneratedAt.Sub(report.StartedAt).Seconds(),
+		RegionsScanned:  report.RegionsScanned(),
+		APICalls:        report.TotalAPICalls(),
+		OperationCalls:  report.OperationAPICalls(),
+		APIBudget:       report.APIBudgetReached,
+		RegionErrors:    report.RegionErrors,
+	}
+	if run.RegionsScanned == nil {
+		run.RegionsScanned = []string{}
+	}
+	if caller := report.Caller; caller != nil {
+		run.Caller = &reportCaller{AccountID: caller.Account, ARN: caller.ARN, UserID: caller.UserID}
+	}
+	return run
+}
+
+type reportTotals struct {
+	Entities       int    `json:"entities"`
+	StorageUsed    int64  `json:"storage_used"`
+	MonthlyCostUSD string `json:"monthly_cost_usd,omitempty"`
+}
+
+// envelopeFormatter wraps the rows of the json format in a version 2
+// envelope carrying the metadata and totals of the full report, unless
+// --schema v1 asks for the bare array. Other formats are returned as is.
+func envelopeFormatter(format string, formatter output.Formatter, report *collector.Report) output.Formatter {
+	if format != "json" || reportSchema == "v1" {
+		return formatter
+	}
+
+	return output.FormatterFunc(func(w io.Writer, columns []string, rows []output.Row) error {
+		envelope := newReportEnvelope(report)
+		envelope.Entities = rows
+		if envelope.Entities == nil {
+			envelope.Entities = []output.Row{}
+		}
+
+		data, err := json.MarshalIndent(envelope, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	})
+}
+
+// newReportEnvelope returns the version 2 JSON report of a report, without
+// its entities.
+func newReportEnvelope(report *collector.Report) reportEnvelope {
+	envelope := reportEnvelope{
+		SchemaVersion: schema.LatestVersion,
+		GeneratedAt:   report.GeneratedAt.UTC().Truncate(time.Second),
+		AccountIDs:    reportAccountIDs(report),
+		Totals: reportTotals{
+			Entities:    len(report.Entities),
+			StorageUsed: report.TotalStorageUsed,
+		},
+		FailedRegions: failedRegions(report),
+		Run:           runMetadata(report),
+		Findings:      reportFindings(report),
+		Quotas:        reportQuotas(report),
+		Owners:        reportOwners(report),
+	}
+	if units != humanize.GB {
+		envelope.Units = string(units)
+	}
+	envelope.Totals.MonthlyCostUSD, _ = reportCost(report)
+	return envelope
+}
+
+// reportCost returns the estimated monthly cost of every entity of the
+// report, and false when costs were not estimated.
+func reportCost(report *collector.Report) (string, bool) {
+	if !report.CostEstimated {
+		return "", false
+	}
+	var cost float64
+	for _, entity := range report.Entities {
+		cost += entity.MonthlyCostUSD
+	}
+	return fmt.Sprintf("%.2f", cost), true
+}
+
+// defaultAccount is the account of the default credentials, looked up once.
+var defaultAccount = sync.OnceValues(func() (string, error) {
+	return callerAccount(context.Background())
+})
+
+// reportAccountIDs returns the accounts of the report's entities, or the
+// account of the credentials when the entities are not labeled with one.
+func reportAccountIDs(report *collector.Report) []string {
+	ids := []string{}
+	for _, entity := range report.Entities {
+		if entity.AccountID != "" && !slices.Contains(ids, entity.AccountID) {
+			ids = append(ids, entity.AccountID)
+		}
+	}
+	for _, account := range report.Accounts {
+		if account.AccountID != "" && !slices.Contains(ids, account.AccountID) {
+			ids = append(ids, account.AccountID)
+		}
+	}
+	if len(ids) > 0 || len(replayFiles) > 0 || fixturesDir != "" {
+		slices.Sort(ids)
+		return ids
+	}
+
+	id, err := defaultAccount()
+	if err != nil {
+		slog.Warn("leaving the report's account IDs empty", "error", err)
+		return ids
+	}
+	return []string{id}
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// unownedLabel stands in for the owner of items no resolver could assign.
+const unownedLabel = "(unowned)"
+
+var ownerOptions = struct {
+	Resolve       bool
+	Tags          []string
+	CloudTrail    bool
+	AccountOwners map[string]string
+}{}
+
+func init() {
+	addOwnerFlags(orphansCmd)
+	addOwnerFlags(cleanupCmd)
+
+	rootCmd.Flags().BoolVar(&ownerOptions.Resolve, "owners", false, "resolve the owner of every resource from --owner-tags, --owner-from-cloudtrail and --account-owner, and summarize the storage of every owner, \"unknown\" for the unresolved")
+	addOwnerFlags(rootCmd)
+}
+
+func addOwnerFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringSliceVar(&ownerOptions.Tags, "owner-tags", []string{"Owner", "Team"}, "tags naming the owner of a resource, first match wins")
+	flags.BoolVar(&ownerOptions.CloudTrail, "owner-from-cloudtrail", false, "fall back to the CloudTrail identity that created a resource (last 90 days only)")
+	flags.StringToStringVar(&ownerOptions.AccountOwners, "account-owner", nil, "owner of the untagged resources of an account (account=owner, * for any account)")
+}
+
+// ownerChain builds the resolvers in the order tags, CloudTrail creator,
+// account default. The returned function releases them.
+func ownerChain(ctx context.Context) (collector.OwnerChain, func()) {
+	chain := collector.OwnerChain{collector.TagOwnerResolver{Keys: ownerOptions.Tags}}
+	release := func() {}
+
+	if ownerOptions.CloudTrail {
+		resolver := collector.NewCloudTrailOwnerResolver(awsConfigLoader)
+		chain = append(chain, resolver)
+		release = resolver.Close
+	}
+
+	if len(ownerOptions.AccountOwners) > 0 {
+		resolver := collector.AccountOwnerResolver{Owners: ownerOptions.AccountOwners}
+		if !multiAccount() {
+			account, err := callerAccount(ctx)
+			if err != nil {
+				slog.Error("failed to determine the account for --account-owner", "error", err)
+			}
+			resolver.Account = account
+		}
+		chain = append(chain, resolver)
+	}
+
+	return chain, release
+}
+
+// assignOwners resolves the owners of the orphans.
+func assignOwners(ctx context.Context, orphans []collector.Orphan) {
+	chain, release := ownerChain(ctx)
+	defer release()
+
+	chain.AssignOwners(ctx, orphans)
+}
+
+func ownerLabel(owner string) string {
+	if owner == "" {
+		return unownedLabel
+	}
+	return owner
+}
+
+// ownerNotification is the JSON posted to an owner's webhook. Text makes it
+// readable as a Slack or Teams incoming webhook message.
+type ownerNotification struct {
+	Text        string          `json:"text"`
+	Owner       string          `json:"owner"`
+	StorageUsed int64           `json:"storage_used"`
+	Items       []ownerWasteRow `json:"items"`
+}
+
+type ownerWasteRow struct {
+	Action      string `json:"action"`
+	ResourceID  string `json:"resource_id"`
+	Type        string `json:"type"`
+	Region      string `json:"region"`
+	StorageUsed int64  `json:"storage_used"`
+	Result      string `json:"result"`
+	OwnerSource string `json:"owner_source,omitempty"`
+}
+
+// ownerRoute returns the webhook of an owner, the "*" route when the owner
+// has none of its own.
+func ownerRoute(routes map[string]string, owner string) string {
+	if url, ok := routes[ownerLabel(owner)]; ok {
+		return url
+	}
+	return routes["*"]
+}
+
+// notifyOwners posts every owner's items to the owner's route. Owners
+// without a route are not notified.
+func notifyOwners(ctx context.Context, routes map[string]string, items map[string][]ownerWasteRow) {
+	owners := make([]string, 0, len(items))
+	for owner := range items {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, owner := range owners {
+		url := ownerRoute(routes, owner)
+		if url == "" {
+			continue
+		}
+
+		notification := ownerNotification{Owner: ownerLabel(owner), Items: items[owner]}
+		for _, item := range notification.Items {
+			notification.StorageUsed += item.StorageUsed
+		}
+		notification.Text = fmt.Sprintf("Cleaned up %d resources owned by %s, %s", len(notification.Items),
+			notification.Owner, formatBytes(notification.StorageUsed))
+
+		if skipDryRun("notify %s of %d resources", notification.Owner, len(notification.Items)) {
+			continue
+		}
+
+		if err := postJSON(ctx, client, url, notification); err != nil {
+			slog.Error("failed to notify owner", "owner", notification.Owner, "error", err)
+			continue
+		}
+		fmt.Printf("Notified %s (%d resources)\n", notification.Owner, len(notification.Items))
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// reportOwner is the storage of an owner in the JSON report.
+type reportOwner struct {
+	Owner          string `json:"owner"`
+	Entities       int    `json:"entities"`
+	StorageUsed    int64  `json:"storage_used"`
+	MonthlyCostUSD string `json:"monthly_cost_usd,omitempty"`
+}
+
+// reportOwners converts the owners of a report for the JSON report.
+func reportOwners(report *collector.Report) []reportOwner {
+	var owners []reportOwner
+	for _, group := range report.Owners {
+		owner := reportOwner{Owner: group.Value, Entities: group.Entities, StorageUsed: group.StorageUsed}
+		if report.CostEstimated {
+			owner.MonthlyCostUSD = fmt.Sprintf("%.2f", group.MonthlyCostUSD)
+		}
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// printOwners prints the storage of every owner resolved by --owners.
+func printOwners(w io.Writer, report *collector.Report) {
+	fmt.Fprintf(w, "Storage by owner (%d):\n", len(report.Owners))
+	for _, owner := range report.Owners {
+		line := fmt.Sprintf("Owner: %s, Entities: %d, Storage Used: %s", owner.Value, owner.Entities, formatBytes(owner.StorageUsed))
+		if report.CostEstimated {
+			line += fmt.Sprintf(", Monthly Cost: $%.2f", owner.MonthlyCostUSD)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// printOwnerTotals prints the resources and storage of every owner.
+func printOwnerTotals(items map[string][]ownerWasteRow) {
+	owners := make([]string, 0, len(items))
+	for owner := range items {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return ownerLabel(owners[i]) < ownerLabel(owners[j]) })
+
+	for _, owner := range owners {
+		var storageUsed int64
+		for _, item := range items[owner] {
+			storageUsed += item.StorageUsed
+		}
+		fmt.Printf("Owner: %s, Resources: %d, Storage Used: %s\n", ownerLabel(owner), len(items[owner]), formatBytes(storageUsed))
+	}
+}
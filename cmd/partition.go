@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+var (
+	partition   string
+	endpointURL string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&partition, "partition", awsres.PartitionAWS, "AWS partition to scan: aws, aws-us-gov or aws-cn")
+	rootCmd.PersistentFlags().StringVar(&endpointURL, "endpoint-url", "", "send every AWS API call to this endpoint, e.g. http://localhost:4566 for LocalStack")
+}
+
+// validatePartition checks --partition before any AWS call.
+func validatePartition() error {
+	if !awsres.ValidPartition(partition) {
+		return fmt.Errorf("invalid --partition %q: must be aws, aws-us-gov or aws-cn", partition)
+	}
+	return nil
+}
+
+// bootstrapRegion is the region of --partition that the enabled regions and
+// the account are looked up in.
+func bootstrapRegion() string {
+	return awsres.BootstrapRegion(partition)
+}
+
+// customEndpoint points the shared configuration at --endpoint-url, if any.
+func customEndpoint(o *config.LoadOptions) error {
+	if endpointURL != "" {
+		o.BaseEndpoint = endpointURL
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Plan actions besides the cleanup deletions, executed by apply --plan.
+const (
+	ActionModifyVolume    = "ModifyVolume"
+	ActionArchiveSnapshot = "ArchiveSnapshot"
+)
+
+// Prefixes of the checksum and signature of a plan.
+const (
+	planChecksumPrefix  = "sha256:"
+	planSignaturePrefix = "hmac-sha256:"
+)
+
+// planKeyFile holds the key plans are signed and verified with.
+var planKeyFile string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&planKeyFile, "plan-key-file", "", "file holding the key plans are signed with by --plan-file and verified with by cleanup --plan and apply --plan (HMAC-SHA256)")
+}
+
+// actionPlan is a JSON plan of resource changes written by an analysis with
+// --plan-file. Nothing is deleted or modified but through a plan: cleanup
+// --plan executes the deletions, apply --plan the modifications. The
+// checksum covers the rest of the plan, so edits after it was written are
+// refused; with --plan-key-file the signature proves who wrote it.
+type actionPlan struct {
+	CreatedAt time.Time        `json:"created_at"`
+	Command   string           `json:"command"`
+	AccountID string           `json:"account_id,omitempty"`
+	Policy    *retentionPolicy `json:"policy,omitempty"`
+	Actions   []planAction     `json:"actions"`
+	Checksum  string           `json:"checksum"`
+	Signature string           `json:"signature,omitempty"`
+}
+
+type planAction struct {
+	Action         string            `json:"action"`
+	ResourceID     string            `json:"resource_id"`
+	Type           string            `json:"type"`
+	Region         string            `json:"region"`
+	SourceVolume   string            `json:"source_volume,omitempty"`
+	StartTime      time.Time         `json:"start_time,omitzero"`  // Of snapshots
+	CreateTime     time.Time         `json:"create_time,omitzero"` // Of volumes
+	StorageUsed    int64             `json:"storage_used"`
+	MonthlyCostUSD float64           `json:"monthly_cost_usd"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Owner          string            `json:"owner,omitempty"`
+	OwnerSource    string            `json:"owner_source,omitempty"`
+
+	// VolumeType, IOPS and Throughput (MiB/s) a ModifyVolume action sets;
+	// the unset ones are left as they are.
+	VolumeType        string  `json:"volume_type,omitempty"`
+	IOPS              int32   `json:"iops,omitempty"`
+	Throughput        int32   `json:"throughput,omitempty"`
+	Reason            string  `json:"reason,omitempty"`
+	MonthlySavingsUSD float64 `json:"monthly_savings_usd,omitempty"`
+}
+
+// newPlan returns an empty plan of the command.
+func newPlan(command string, now time.Time) actionPlan {
+	return actionPlan{
+		CreatedAt: now.UTC().Truncate(time.Second),
+		Command:   command,
+		Actions:   []planAction{},
+	}
+}
+
+// readPlanKey returns the key of --plan-key-file, nil without it.
+func readPlanKey() ([]byte, error) {
+	if planKeyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(planKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --plan-key-file: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("invalid --plan-key-file %s: the file is empty", planKeyFile)
+	}
+	return key, nil
+}
+
+// digest is the JSON the checksum and signature of the plan cover: the plan
+// without them.
+func (p actionPlan) digest() ([]byte, error) {
+	p.Checksum, p.Signature = "", ""
+	return json.Marshal(p)
+}
+
+// sign sets the checksum of the plan, and its signature with a key.
+func (p *actionPlan) sign(key []byte) error {
+	data, err := p.digest()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	p.Checksum = planChecksumPrefix + hex.EncodeToString(sum[:])
+	p.Signature = ""
+	if key != nil {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		p.Signature = planSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+	return nil
+}
+
+// verify checks the checksum of the plan, and its signature with a key.
+func (p actionPlan) verify(key []byte) error {
+	if p.Checksum == "" {
+		return errors.New("the plan has no checksum: write it again with --plan-file")
+	}
+	signed := p
+	if err := signed.sign(key); err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(p.Checksum), []byte(signed.Checksum)) {
+		return errors.New("checksum mismatch: the plan was changed after it was written")
+	}
+
+	switch {
+	case key == nil && p.Signature != "":
+		return errors.New("the plan is signed: pass the --plan-key-file it was signed with")
+	case key != nil && p.Signature == "":
+		return errors.New("the plan is not signed: write it again with --plan-key-file")
+	case !hmac.Equal([]byte(p.Signature), []byte(signed.Signature)):
+		return errors.New("signature mismatch: the plan was changed or signed with another key")
+	}
+	return nil
+}
+
+// writePlan checksums and, with --plan-key-file, signs the plan and writes
+// it to path. The plan is made for the account of the credentials; there is
+// none with --fixtures.
+func writePlan(path string, plan actionPlan) error {
+	if fixturesDir == "" {
+		account, err := callerAccount(context.Background())
+		if err != nil {
+			return err
+		}
+		plan.AccountID = account
+	}
+
+	key, err := readPlanKey()
+	if err != nil {
+		return err
+	}
+	if err := plan.sign(key); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if skipDryRun("write a plan of %d actions to %s", len(plan.Actions), path) {
+		return nil
+	}
+	if err := createParentDir(path); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	fmt.Printf("Plan of %d actions written to %s\n", len(plan.Actions), path)
+	return nil
+}
+
+// readPlan loads a plan for the command executing it, which only executes
+// the allowed actions, and verifies its checksum and signature.
+func readPlan(path, command string, allowed ...string) (*actionPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var plan actionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+
+	key, err := readPlanKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.verify(key); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+
+	for _, action := range plan.Actions {
+		switch action.Action {
+		case ActionDeleteVolume, ActionDeleteSnapshot, ActionModifyVolume, ActionArchiveSnapshot:
+		default:
+			return nil, fmt.Errorf("invalid plan %s: unknown action %q", path, action.Action)
+		}
+		if !slices.Contains(allowed, action.Action) {
+			return nil, fmt.Errorf("plan %s has %s actions, which %s does not execute: run it with %s --plan", path, action.Action, command, planExecutor(action.Action))
+		}
+		if action.Action == ActionModifyVolume && action.VolumeType == "" && action.IOPS == 0 && action.Throughput == 0 {
+			return nil, fmt.Errorf("invalid plan %s: the ModifyVolume of %s changes nothing", path, action.ResourceID)
+		}
+	}
+	return &plan, nil
+}
+
+// planExecutor is the command executing an action.
+func planExecutor(action string) string {
+	if action == ActionDeleteVolume || action == ActionDeleteSnapshot {
+		return "cleanup"
+	}
+	return "apply"
+}
+
+// checkPlanAccount refuses to execute a plan made for another account than
+// the --account being changed.
+func checkPlanAccount(path string, plan *actionPlan, account string) error {
+	if plan.AccountID != account {
+		return fmt.Errorf("plan %s was made for account %s, not %s", path, cmp.Or(plan.AccountID, "none"), account)
+	}
+	return nil
+}
+
+// has reports whether the plan has an action of the kind.
+func (p *actionPlan) has(action string) bool {
+	return slices.ContainsFunc(p.Actions, func(a planAction) bool { return a.Action == action })
+}
+
+// entity is the resource of the action as the analysis saw it.
+func (a planAction) entity() collector.EntityUsage {
+	return collector.EntityUsage{
+		ID:             a.ResourceID,
+		Type:           a.Type,
+		Region:         a.Region,
+		SourceVolume:   a.SourceVolume,
+		StartTime:      a.StartTime,
+		CreateTime:     a.CreateTime,
+		StorageUsed:    a.StorageUsed,
+		MonthlyCostUSD: a.MonthlyCostUSD,
+		Tags:           a.Tags,
+	}
+}
+
+// cleanupActions converts the deletions of the plan into cleanup actions.
+func (p *actionPlan) cleanupActions() []cleanupAction {
+	actions := make([]cleanupAction, 0, len(p.Actions))
+	for _, action := range p.Actions {
+		actions = append(actions, cleanupAction{
+			Action:      action.Action,
+			Entity:      action.entity(),
+			Owner:       action.Owner,
+			OwnerSource: action.OwnerSource,
+		})
+	}
+	return actions
+}
+
+// volumeModifications converts the ModifyVolume actions of the plan into
+// volume modifications.
+func (p *actionPlan) volumeModifications() []volumeModification {
+	var modifications []volumeModification
+	for _, action := range p.Actions {
+		if action.Action != ActionModifyVolume {
+			continue
+		}
+		input := &ec2.ModifyVolumeInput{VolumeId: aws.String(action.ResourceID)}
+		var changes []string
+		if action.VolumeType != "" {
+			input.VolumeType = types.VolumeType(action.VolumeType)
+			changes = append(changes, action.VolumeType)
+		}
+		if action.IOPS > 0 {
+			input.Iops = aws.Int32(action.IOPS)
+			changes = append(changes, fmt.Sprintf("%d IOPS", action.IOPS))
+		}
+		if action.Throughput > 0 {
+			input.Throughput = aws.Int32(action.Throughput)
+			changes = append(changes, fmt.Sprintf("%d MiB/s", action.Throughput))
+		}
+		modifications = append(modifications, volumeModification{
+			Volume:      action.entity(),
+			Description: "to " + strings.Join(changes, ", "),
+			Input:       input,
+		})
+	}
+	return modifications
+}
+
+// archivals returns the snapshots of the ArchiveSnapshot actions of the
+// plan.
+func (p *actionPlan) archivals() []collector.EntityUsage {
+	var snapshots []collector.EntityUsage
+	for _, action := range p.Actions {
+		if action.Action == ActionArchiveSnapshot {
+			snapshots = append(snapshots, action.entity())
+		}
+	}
+	return snapshots
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Where --pricing takes prices from.
+const (
+	pricingAPI    = "api"
+	pricingStatic = "static"
+	pricingFile   = "file"
+)
+
+var (
+	pricingCacheFile string
+	estimateCost     bool
+	pricingSource    string
+	priceFile        string
+
+	// pricingProvider prices costs and savings as --pricing selected, nil
+	// for the Pricing API.
+	pricingProvider collector.PricingProvider
+)
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&pricingSource, "pricing", "", "where cost estimates and savings take prices from: api (the AWS Pricing API), static (the prices bundled with the binary) or file (--price-file) (default: file with --price-file, api otherwise)")
+	flags.StringVar(&priceFile, "price-file", "", "CSV file of prices with region, kind and price_usd columns, kind being a volume type, snapshot, snapshot-archive or snapshot-archive-retrieval and region * matching every region")
+}
+
+// initPricing selects the pricing provider of --pricing and --price-file.
+func initPricing() error {
+	pricingProvider = nil
+
+	source := pricingSource
+	if source == "" {
+		source = pricingAPI
+		if priceFile != "" {
+			source = pricingFile
+		}
+	}
+
+	switch source {
+	case pricingAPI, pricingStatic:
+		if priceFile != "" {
+			return fmt.Errorf("--price-file needs --pricing file, not %s", source)
+		}
+		if source == pricingStatic {
+			table, err := collector.BundledPrices()
+			if err != nil {
+				return err
+			}
+			pricingProvider = table
+		}
+	case pricingFile:
+		if priceFile == "" {
+			return fmt.Errorf("--pricing file needs --price-file")
+		}
+		file, err := os.Open(priceFile)
+		if err != nil {
+			return fmt.Errorf("failed to read --price-file: %w", err)
+		}
+		defer file.Close()
+		table, err := collector.ReadPriceTable(file, priceFile)
+		if err != nil {
+			return err
+		}
+		pricingProvider = table
+	default:
+		return fmt.Errorf("invalid --pricing %q: must be api, static or file", pricingSource)
+	}
+	return nil
+}
+
+// pricingFromAPI reports whether prices are fetched from the Pricing API.
+func pricingFromAPI() bool {
+	return pricingProvider == nil
+}
+
+// printCostSummary prints the most expensive entities and the monthly total.
+func printCostSummary(w io.Writer, entities []collector.EntityUsage, limit int) {
+	byCost := make([]collector.EntityUsage, len(entities))
+	copy(byCost, entities)
+	sort.SliceStable(byCost, func(i, j int) bool { return byCost[i].MonthlyCostUSD > byCost[j].MonthlyCostUSD })
+
+	total := 0.0
+	for _, entity := range byCost {
+		total += entity.MonthlyCostUSD
+	}
+
+	fmt.Fprintln(w, "Most expensive entities:")
+	for i, entity := range byCost {
+		if i == limit || entity.MonthlyCostUSD == 0 {
+			break
+		}
+		fmt.Fprintf(w, "Monthly Cost: $%.2f, %s ID: %s, Region: %s\n",
+			entity.MonthlyCostUSD, entity.Type, entity.ID, entity.Region)
+	}
+	fmt.Fprintf(w, "Estimated Monthly Cost: $%.2f\n", total)
+}
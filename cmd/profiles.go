@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// defaultAccountConcurrency bounds the accounts scanned at once.
+const defaultAccountConcurrency = 4
+
+var (
+	profiles           []string
+	assumeRoles        []string
+	accountConcurrency int
+	parallelProfiles   bool
+)
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringSliceVar(&profiles, "profiles", nil, "scan with each of these shared config profiles and merge the reports (comma separated)")
+	flags.StringSliceVar(&assumeRoles, "assume-roles", nil, "also scan the account of each of these role ARNs, assumed with the default credentials, and merge the reports (comma separated)")
+	flags.IntVar(&accountConcurrency, "account-concurrency", defaultAccountConcurrency, "accounts of --profiles and --assume-roles scanned at once, 1 for one after the other")
+	flags.BoolVar(&parallelProfiles, "parallel-profiles", false, "scan the --profiles concurrently instead of one after the other")
+	_ = flags.MarkDeprecated("parallel-profiles", "accounts are scanned concurrently, see --account-concurrency")
+}
+
+// scanTarget is an account scanned with a shared config profile, with an
+// assumed role or, for the management account of --org-role, with the
+// default credentials.
+type scanTarget struct {
+	Profile string
+	RoleARN string
+
+	AccountID string // Only known up front for the accounts of --org-role
+}
+
+// scanTargets returns the accounts of --profiles, --assume-roles and
+// --org-role, only those of the shard with --shard-by accounts.
+func scanTargets() []scanTarget {
+	var targets []scanTarget
+	for _, profile := range profiles {
+		targets = append(targets, scanTarget{Profile: profile})
+	}
+	for _, role := range assumeRoles {
+		targets = append(targets, scanTarget{RoleARN: role})
+	}
+	return shardTargets(append(targets, orgTargets...))
+}
+
+// multiAccount reports whether the scan covers the accounts of --profiles,
+// --assume-roles or --org-role rather than the account of the default
+// credentials.
+func multiAccount() bool {
+	return len(profiles) > 0 || len(assumeRoles) > 0 || orgRole != ""
+}
+
+// validateAccounts checks the multi-account flags.
+func validateAccounts() error {
+	if accountConcurrency < 1 {
+		return fmt.Errorf("invalid --account-concurrency %d: must be at least 1", accountConcurrency)
+	}
+	return nil
+}
+
+// firstProfile selects the first of --profiles, if any, for the shared
+// configuration that regions are listed with.
+func firstProfile(o *config.LoadOptions) error {
+	if len(profiles) > 0 {
+		o.SharedConfigProfile = profiles[0]
+	}
+	return nil
+}
+
+// targetLoaders memoizes the configuration loaders of the targets, so that
+// the scans of a serving process load each profile's shared configuration
+// and assume each role only once.
+var (
+	targetLoadersMutex sync.Mutex
+	targetLoaders      = map[scanTarget]collector.ConfigLoader{}
+)
+
+// configLoader returns the loader of the target's configuration.
+func (t scanTarget) configLoader() collector.ConfigLoader {
+	targetLoadersMutex.Lock()
+	defer targetLoadersMutex.Unlock()
+
+	loader, ok := targetLoaders[t]
+	if !ok {
+		loader = t.newConfigLoader()
+		targetLoaders[t] = loader
+	}
+	return loader
+}
+
+func (t scanTarget) newConfigLoader() collector.ConfigLoader {
+	if t.Profile != "" {
+		return collector.NewSharedConfigLoader(config.WithSharedConfigProfile(t.Profile), customEndpoint)
+	}
+	if t.RoleARN == "" {
+		return awsConfigLoader
+	}
+
+	// The role is assumed once, and its credentials cached, for all regions
+	var once sync.Once
+	var credentials aws.CredentialsProvider
+	return func(ctx context.Context, region string) (aws.Config, error) {
+		cfg, err := awsConfigLoader(ctx, region)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		once.Do(func() {
+			provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), t.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = "crankymosquitos"
+			})
+			credentials = aws.NewCredentialsCache(provider)
+		})
+		cfg.Credentials = credentials
+		return cfg, nil
+	}
+}
+
+// logAttrs identifies the target in log messages.
+func (t scanTarget) logAttrs() []any {
+	if t.Profile != "" {
+		return []any{"profile", t.Profile}
+	}
+	if t.RoleARN == "" {
+		return []any{"account", t.AccountID}
+	}
+	return []any{"role", t.RoleARN}
+}
+
+// scanAccounts scans the account of every --profiles profile,
+// --assume-roles role and --org-role account, --account-concurrency at a
+// time, and merges the reports. Every entity is labeled with its account,
+// and with its profile when scanned with one. Accounts that fail are logged
+// and listed in the report's account subtotals with their error instead of
+// failing the scan.
+func scanAccounts(ctx context.Context, opts collector.Options) (*collector.Report, error) {
+	targets := scanTargets()
+	reports := make([]*collector.Report, len(targets))
+	failures := make([]*collector.AccountSummary, len(targets))
+
+	scanAccount := func(i int, target scanTarget) {
+		accountOpts := opts
+		accountOpts.Profile = target.Profile
+		accountOpts.AccountID = target.AccountID
+		accountOpts.LoadConfig = target.configLoader()
+
+		fail := func(err error) {
+			slog.Error("failed to scan account", append(target.logAttrs(), "error", err)...)
+			failures[i] = &collector.AccountSummary{
+				Profile:   target.Profile,
+				Role:      target.RoleARN,
+				AccountID: accountOpts.AccountID,
+				Error:     err.Error(),
+			}
+		}
+
+		cfg, err := accountOpts.LoadConfig(ctx, bootstrapRegion())
+		if err != nil {
+			fail(fmt.Errorf("failed to load configuration: %w", err))
+			return
+		}
+		if accountOpts.AccountID, err = configAccount(ctx, cfg); err != nil {
+			fail(err)
+			return
+		}
+
+		slog.Info("scanning account", append(target.logAttrs(), "account", accountOpts.AccountID)...)
+		report, err := collector.New(accountOpts).Scan(ctx)
+		if err != nil {
+			fail(err)
+			return
+		}
+		reports[i] = report
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(accountConcurrency, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				scanAccount(i, targets[i])
+			}
+		}()
+	}
+	for i := range targets {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var scanned []*collector.Report
+	for _, report := range reports {
+		if report != nil {
+			scanned = append(scanned, report)
+		}
+	}
+
+	merged := collector.MergeReports(scanned...)
+	for _, failure := range failures {
+		if failure != nil {
+			merged.Accounts = append(merged.Accounts, *failure)
+		}
+	}
+	return merged, nil
+}
+
+// printAccounts prints the subtotal of every account of a merged report and
+// the error of every account that could not be scanned.
+func printAccounts(w io.Writer, report *collector.Report) {
+	fmt.Fprintf(w, "Storage by account (%d):\n", len(report.Accounts))
+	for _, account := range report.Accounts {
+		line := "Account: " + accountLabel(account.AccountID)
+		if account.Profile != "" {
+			line += ", Profile: " + account.Profile
+		}
+		if account.Role != "" {
+			line += ", Role: " + account.Role
+		}
+		if account.Error != "" {
+			fmt.Fprintf(w, "%s, Error: %s\n", line, account.Error)
+			continue
+		}
+		line += fmt.Sprintf(", Entities: %d, Storage Used: %s", account.Entities, formatBytes(account.StorageUsed))
+		if report.CostEstimated {
+			line += fmt.Sprintf(", Monthly Cost: $%.2f", account.MonthlyCostUSD)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func accountLabel(accountID string) string {
+	if accountID == "" {
+		return "(unknown)"
+	}
+	return accountID
+}
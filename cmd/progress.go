@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// printJobProgress prints the pending snapshots and the volumes being
+// modified, least complete first, so long backup and migration jobs can be
+// followed from one scan to the next.
+func printJobProgress(w io.Writer, report *collector.Report) {
+	var snapshots, volumes []collector.EntityUsage
+	for _, entity := range report.Entities {
+		if entity.Progress != nil {
+			snapshots = append(snapshots, entity)
+		}
+		if entity.Modification != nil {
+			volumes = append(volumes, entity)
+		}
+	}
+
+	if len(snapshots) > 0 {
+		sort.SliceStable(snapshots, func(i, j int) bool { return *snapshots[i].Progress < *snapshots[j].Progress })
+
+		fmt.Fprintf(w, "Pending snapshots (%d):\n", len(snapshots))
+		for _, entity := range snapshots {
+			fmt.Fprintf(w, "Snapshot ID: %s, Volume: %s, Region: %s, Progress: %.0f%%, Remaining: %s\n",
+				entity.ID, entity.SourceVolume, entity.Region, *entity.Progress,
+				remainingString(entity.StartTime, *entity.Progress, report.GeneratedAt))
+		}
+	}
+
+	if len(volumes) > 0 {
+		sort.SliceStable(volumes, func(i, j int) bool { return volumes[i].Modification.Progress < volumes[j].Modification.Progress })
+
+		fmt.Fprintf(w, "Volume modifications (%d):\n", len(volumes))
+		for _, entity := range volumes {
+			mod := entity.Modification
+			target := "unknown" // Not in replayed reports
+			if mod.TargetSize > 0 {
+				target = mod.TargetVolumeType + " " + formatBytes(mod.TargetSize)
+			}
+			fmt.Fprintf(w, "Volume ID: %s, Region: %s, State: %s, Target: %s, Progress: %.0f%%, Remaining: %s\n",
+				entity.ID, entity.Region, mod.State, target, mod.Progress,
+				remainingString(mod.StartTime, mod.Progress, report.GeneratedAt))
+		}
+	}
+}
+
+// pendingLabel describes the operation in flight on an entity, e.g.
+// "snapshot 45%", or "-" without one.
+func pendingLabel(entity collector.EntityUsage) string {
+	operation := entity.PendingOperation()
+	if operation == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s %.0f%%", operation, entity.PendingProgress())
+}
+
+func remainingString(started time.Time, progress float64, now time.Time) string {
+	remaining, ok := collector.EstimatedRemaining(started, progress, now)
+	if !ok {
+		return "unknown"
+	}
+	return remaining.Round(time.Minute).String()
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"golang.org/x/term"
+)
+
+const (
+	progressRedraw   = 200 * time.Millisecond // Terminal redraw interval
+	progressLogEvery = 15 * time.Second       // Log line interval without a terminal
+	progressBarWidth = 30
+)
+
+var showProgress bool
+
+func init() {
+	addProgressFlags(rootCmd)
+	addProgressFlags(storageS3Cmd)
+}
+
+func addProgressFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&showProgress, "progress", false, "show scan progress and an ETA on stderr, as periodic log lines when stderr is not a terminal")
+}
+
+// scanProgress follows a scan through the collector callbacks and renders
+// it as a progress bar on a terminal or as log lines otherwise.
+type scanProgress struct {
+	w        io.Writer
+	terminal bool
+	started  time.Time
+	scans    int // Collectors reporting into the bar, one per account
+
+	mu           sync.Mutex
+	jobsDone     int
+	jobsTotal    int
+	regionsDone  int
+	regionsTotal int
+	entities     int
+	apiCalls     int64
+	drawn        bool // A bar is on the terminal line
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startProgress hooks a progress display into opts unless --progress is
+// off. The returned function stops the display once the scan is done.
+func startProgress(opts collector.Options) (collector.Options, func()) {
+	if !showProgress {
+		return opts, func() {}
+	}
+
+	p := &scanProgress{
+		w:            os.Stderr,
+		terminal:     term.IsTerminal(int(os.Stderr.Fd())),
+		started:      time.Now(),
+		scans:        max(len(scanTargets()), 1),
+		regionsTotal: len(opts.Regions) * max(len(scanTargets()), 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	onRegion, onJob, onAPICall := opts.OnRegionComplete, opts.OnJobComplete, opts.OnAPICall
+	opts.OnRegionComplete = func(summary collector.RegionSummary) {
+		p.regionComplete(summary, onRegion)
+	}
+	opts.OnJobComplete = func(summary collector.JobSummary) {
+		p.jobComplete(summary)
+		if onJob != nil {
+			onJob(summary)
+		}
+	}
+	opts.OnAPICall = func(region string) {
+		p.apiCall()
+		if onAPICall != nil {
+			onAPICall(region)
+		}
+	}
+
+	go p.run()
+
+	return opts, func() {
+		close(p.stop)
+		<-p.done
+	}
+}
+
+func (p *scanProgress) regionComplete(summary collector.RegionSummary, next func(collector.RegionSummary)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.regionsDone++
+	if next == nil {
+		return
+	}
+
+	// Keep the region summary from being drawn over
+	p.clear()
+	next(summary)
+	if p.terminal {
+		p.draw()
+	}
+}
+
+func (p *scanProgress) jobComplete(summary collector.JobSummary) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.jobsDone++
+	p.jobsTotal = summary.Total * p.scans
+	p.entities += summary.Entities
+}
+
+func (p *scanProgress) apiCall() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.apiCalls++
+}
+
+func (p *scanProgress) run() {
+	defer close(p.done)
+
+	interval := progressLogEvery
+	if p.terminal {
+		interval = progressRedraw
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.terminal {
+				p.draw()
+			} else {
+				p.log()
+			}
+			p.mu.Unlock()
+		case <-p.stop:
+			p.mu.Lock()
+			p.clear()
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// eta extrapolates the remaining time from the jobs done so far.
+func (p *scanProgress) eta() (time.Duration, bool) {
+	if p.jobsDone == 0 || p.jobsTotal == 0 {
+		return 0, false
+	}
+	return collector.EstimatedRemaining(p.started, 100*float64(p.jobsDone)/float64(p.jobsTotal), time.Now())
+}
+
+func (p *scanProgress) etaString() string {
+	eta, ok := p.eta()
+	if !ok {
+		return "unknown"
+	}
+	return eta.Round(time.Second).String()
+}
+
+// draw redraws the progress bar over the current terminal line.
+func (p *scanProgress) draw() {
+	filled := 0
+	if p.jobsTotal > 0 {
+		filled = progressBarWidth * p.jobsDone / p.jobsTotal
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	fmt.Fprintf(p.w, "\r\033[K[%s] Jobs: %d/%d, Regions: %d/%d, Resources: %d, API Calls: %d, ETA: %s",
+		bar, p.jobsDone, p.jobsTotal, p.regionsDone, p.regionsTotal, p.entities, p.apiCalls, p.etaString())
+	p.drawn = true
+}
+
+// clear erases the progress bar, if one is drawn.
+func (p *scanProgress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+func (p *scanProgress) log() {
+	slog.Info("scan progress",
+		"jobs_done", p.jobsDone, "jobs_total", p.jobsTotal,
+		"regions_done", p.regionsDone, "regions_total", p.regionsTotal,
+		"resources", p.entities, "api_calls", p.apiCalls, "eta", p.etaString())
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+var scrapeConfigOptions = struct {
+	JobName            string
+	Target             string
+	MetricsPath        string
+	Scheme             string
+	ScrapeInterval     string
+	CAFile             string
+	InsecureSkipVerify bool
+	BasicAuthUser      string
+	BasicAuthPassFile  string
+	TotalThreshold     float64
+	GrowthPercent      float64
+	WithRules          bool
+}{}
+
+type scrapeConfig struct {
+	JobName        string           `yaml:"job_name"`
+	ScrapeInterval string           `yaml:"scrape_interval,omitempty"`
+	MetricsPath    string           `yaml:"metrics_path"`
+	Scheme         string           `yaml:"scheme"`
+	TLSConfig      *scrapeTLSConfig `yaml:"tls_config,omitempty"`
+	BasicAuth      *scrapeBasicAuth `yaml:"basic_auth,omitempty"`
+	StaticConfigs  []staticConfig   `yaml:"static_configs"`
+}
+
+type scrapeTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+type scrapeBasicAuth struct {
+	Username     string `yaml:"username"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+type staticConfig struct {
+	Targets []string `yaml:"targets"`
+}
+
+type ruleGroups struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []alertRule `yaml:"rules"`
+}
+
+type alertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+var prometheusCmd = &cobra.Command{
+	Use:   "prometheus",
+	Short: "Helpers for wiring the exporter into Prometheus",
+}
+
+var prometheusScrapeConfigCmd = &cobra.Command{
+	Use:   "scrape-config",
+	Short: "Print a scrape_config and example alerting rules for the exporter",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeScrapeConfig(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prometheusCmd)
+	prometheusCmd.AddCommand(prometheusScrapeConfigCmd)
+
+	flags := prometheusScrapeConfigCmd.Flags()
+	flags.StringVar(&scrapeConfigOptions.JobName, "job-name", "crankymosquitos", "scrape job name")
+	flags.StringVar(&scrapeConfigOptions.Target, "target", "localhost:8080", "host:port the exporter listens on")
+	flags.StringVar(&scrapeConfigOptions.MetricsPath, "metrics-path", "/metrics", "path the metrics are served on")
+	flags.StringVar(&scrapeConfigOptions.Scheme, "scheme", "http", "scheme used to scrape the exporter (http or https)")
+	flags.StringVar(&scrapeConfigOptions.ScrapeInterval, "scrape-interval", "5m", "scrape interval; storage changes slowly")
+	flags.StringVar(&scrapeConfigOptions.CAFile, "tls-ca-file", "", "CA certificate Prometheus uses to verify the exporter")
+	flags.BoolVar(&scrapeConfigOptions.InsecureSkipVerify, "tls-insecure-skip-verify", false, "skip verification of the exporter certificate")
+	flags.StringVar(&scrapeConfigOptions.BasicAuthUser, "basic-auth-user", "", "basic auth username")
+	flags.StringVar(&scrapeConfigOptions.BasicAuthPassFile, "basic-auth-password-file", "", "file holding the basic auth password")
+	flags.Float64Var(&scrapeConfigOptions.TotalThreshold, "alert-total-bytes", 50*1024*1024*1024*1024, "total storage in bytes above which the threshold alert fires")
+	flags.Float64Var(&scrapeConfigOptions.GrowthPercent, "alert-growth-percent", 10, "day-over-day growth in percent above which the growth alert fires")
+	flags.BoolVar(&scrapeConfigOptions.WithRules, "rules", true, "also print example alerting rules")
+}
+
+func buildScrapeConfig() scrapeConfig {
+	opts := scrapeConfigOptions
+
+	config := scrapeConfig{
+		JobName:        opts.JobName,
+		ScrapeInterval: opts.ScrapeInterval,
+		MetricsPath:    opts.MetricsPath,
+		Scheme:         opts.Scheme,
+		StaticConfigs:  []staticConfig{{Targets: []string{opts.Target}}},
+	}
+
+	if opts.Scheme == "https" && (opts.CAFile != "" || opts.InsecureSkipVerify) {
+		config.TLSConfig = &scrapeTLSConfig{
+			CAFile:             opts.CAFile,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		}
+	}
+
+	if opts.BasicAuthUser != "" {
+		config.BasicAuth = &scrapeBasicAuth{
+			Username:     opts.BasicAuthUser,
+			PasswordFile: opts.BasicAuthPassFile,
+		}
+	}
+
+	return config
+}
+
+func buildAlertRules() ruleGroups {
+	opts := scrapeConfigOptions
+
+	return ruleGroups{Groups: []ruleGroup{{
+		Name: "crankymosquitos",
+		Rules: []alertRule{
+			{
+				Alert:  "AWSStorageTotalAboveThreshold",
+				Expr:   fmt.Sprintf("aws_total_storage_used > %.0f", opts.TotalThreshold),
+				For:    "1h",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "AWS storage total is {{ $value | humanize1024 }}B",
+				},
+			},
+			{
+				Alert:  "AWSStorageGrowingFast",
+				Expr:   fmt.Sprintf("(aws_total_storage_used - aws_total_storage_used offset 1d) / aws_total_storage_used offset 1d * 100 > %g", opts.GrowthPercent),
+				For:    "1h",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "AWS storage grew {{ $value | humanize }}% in the last day",
+				},
+			},
+			{
+				Alert:  "AWSStorageExporterDown",
+				Expr:   fmt.Sprintf(`up{job="%s"} == 0`, opts.JobName),
+				For:    "15m",
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary": "crankymosquitos exporter is not being scraped",
+				},
+			},
+		},
+	}}}
+}
+
+func writeScrapeConfig(w io.Writer) error {
+	fmt.Fprintln(w, "# Add to scrape_configs in prometheus.yml")
+	if err := writeYAML(w, []scrapeConfig{buildScrapeConfig()}); err != nil {
+		return err
+	}
+
+	if !scrapeConfigOptions.WithRules {
+		return nil
+	}
+
+	fmt.Fprintln(w, "\n# Example alerting rules file")
+	return writeYAML(w, buildAlertRules())
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var pushOptions = struct {
+	URL      string
+	Job      string
+	Instance string
+}{}
+
+func init() {
+	addPushFlags(rootCmd)
+	addPushFlags(storageS3Cmd)
+}
+
+func addPushFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&pushOptions.URL, "pushgateway-url", "", "push the metrics to this Pushgateway after the scan instead of serving them")
+	flags.StringVar(&pushOptions.Job, "pushgateway-job", "crankymosquitos", "job label of the pushed metrics")
+	flags.StringVar(&pushOptions.Instance, "pushgateway-instance", "", "instance label of the pushed metrics (default: the host name)")
+}
+
+// pushMetrics replaces the metrics of the job and instance on the
+// Pushgateway with the gauges of a completed scan. Only the exporter's own
+// gauges are pushed, not the Go runtime metrics.
+func pushMetrics(report *collector.Report) error {
+	instance := pushOptions.Instance
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to determine instance label: %w", err)
+		}
+		instance = hostname
+	}
+
+	if skipDryRun("push metrics to %s (job: %s, instance: %s)", pushOptions.URL, pushOptions.Job, instance) {
+		return nil
+	}
+
+	registry := prometheus.NewRegistry()
+	metrics := newMetrics()
+	if err := metrics.Register(registry); err != nil {
+		return err
+	}
+	metrics.Observe(report)
+
+	err := push.New(pushOptions.URL, pushOptions.Job).
+		Gatherer(registry).
+		Grouping("instance", instance).
+		Push()
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", pushOptions.URL, err)
+	}
+
+	fmt.Fprintf(summaryOut, "Pushed metrics to %s (job: %s, instance: %s)\n", pushOptions.URL, pushOptions.Job, instance)
+	return nil
+}
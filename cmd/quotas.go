@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	quotas             bool
+	quotaWarnThreshold float64
+)
+
+func init() {
+	rootCmd.Flags().BoolVar(&quotas, "quotas", false, "compare the EBS snapshot and volume storage quotas of every scanned region with their usage, read through the Service Quotas API")
+	rootCmd.Flags().Float64Var(&quotaWarnThreshold, "quota-warn-threshold", 80, "with --quotas, warn about quotas used above this percentage")
+}
+
+// validateQuotaOptions checks the quota flags before the scan starts.
+func validateQuotaOptions() error {
+	if quotaWarnThreshold <= 0 || quotaWarnThreshold > 100 {
+		return fmt.Errorf("invalid --quota-warn-threshold %v: expected a percentage between 0 and 100", quotaWarnThreshold)
+	}
+	return nil
+}
+
+// reportQuota is a service quota in the JSON report.
+type reportQuota struct {
+	Region             string  `json:"region"`
+	AccountID          string  `json:"account_id,omitempty"`
+	Code               string  `json:"quota_code"`
+	Name               string  `json:"name"`
+	Unit               string  `json:"unit"`
+	Usage              float64 `json:"usage"`
+	Quota              float64 `json:"quota"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+	Applied            bool    `json:"applied,omitempty"`
+}
+
+// reportQuotas converts the quota usages of a report for the JSON report.
+func reportQuotas(report *collector.Report) []reportQuota {
+	var quotas []reportQuota
+	for _, quota := range report.Quotas {
+		quotas = append(quotas, reportQuota{
+			Region:             quota.Region,
+			AccountID:          quota.AccountID,
+			Code:               quota.Code,
+			Name:               quota.Name,
+			Unit:               quota.Unit,
+			Usage:              quota.Usage,
+			Quota:              quota.Quota,
+			UtilizationPercent: quota.Utilization() * 100,
+			Applied:            quota.Applied,
+		})
+	}
+	return quotas
+}
+
+// printQuotas prints the usage of every quota, then warns about the quotas
+// used above --quota-warn-threshold.
+func printQuotas(w io.Writer, usages []collector.QuotaUsage) {
+	var warnings []collector.QuotaUsage
+	for _, usage := range usages {
+		fmt.Fprintf(w, "Quota: %s, %s\n", usage.Name, quotaString(usage))
+		if usage.Utilization()*100 >= quotaWarnThreshold {
+			warnings = append(warnings, usage)
+		}
+	}
+
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Quotas above %.0f%% (%d):\n", quotaWarnThreshold, len(warnings))
+	for _, usage := range warnings {
+		fmt.Fprintf(w, "Quota: %s, %s, Quota Code: %s\n", usage.Name, quotaString(usage), usage.Code)
+		slog.Warn("service quota nearly exhausted", "quota", usage.Name, "quota_code", usage.Code, "region", usage.Region,
+			"account", usage.AccountID, "usage", usage.Usage, "quota_value", usage.Quota, "utilization_percent", usage.Utilization()*100)
+	}
+}
+
+// quotaString formats the region and usage of a quota.
+func quotaString(usage collector.QuotaUsage) string {
+	line := "Region: " + usage.Region
+	if usage.AccountID != "" {
+		line += ", Account: " + usage.AccountID
+	}
+	return fmt.Sprintf("%s, Usage: %s of %s %s (%.1f%%)",
+		line, formatQuotaValue(usage.Usage), formatQuotaValue(usage.Quota), usage.Unit, usage.Utilization()*100)
+}
+
+// formatQuotaValue formats counts as integers and TiB with two decimals.
+func formatQuotaValue(value float64) string {
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d", int64(value))
+	}
+	return fmt.Sprintf("%.2f", value)
+}
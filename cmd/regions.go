@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+var (
+	includeRegions []string
+	excludeRegions []string
+
+	regionsCacheFile string
+	// A regions cache older than --regions-cache-ttl is still used but
+	// refreshed in the background.
+	regionsCacheTTL string
+	refreshRegions  bool
+
+	// regionsCacheAge is the age of the regions cache the scan used, 0 when
+	// the regions were looked up.
+	regionsCacheAge time.Duration
+)
+
+var regionsCmd = &cobra.Command{
+	Use:   "regions",
+	Short: "Inspect the regions a scan covers",
+}
+
+var regionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the enabled regions and whether a scan covers them",
+	Long: `Lists the regions enabled for the account, read from --regions-cache-file
+unless --refresh-regions is given, and marks the ones --regions,
+--exclude-regions and --resource-group leave out of a scan.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, err := getAllAwsRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+		scanned, err := getScanRegions()
+		if err != nil {
+			return err
+		}
+
+		writeRegions(os.Stdout, all, scanned)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(regionsCmd)
+	regionsCmd.AddCommand(regionsListCmd)
+
+	rootCmd.PersistentFlags().StringSliceVar(&includeRegions, "regions", nil, "only scan these regions (comma separated)")
+	rootCmd.PersistentFlags().StringSliceVar(&excludeRegions, "exclude-regions", nil, "skip these regions (comma separated)")
+	rootCmd.PersistentFlags().StringVar(&regionsCacheFile, "regions-cache-file", "", "file the enabled regions are cached in (default: regions.json in --state-dir)")
+	rootCmd.PersistentFlags().StringVar(&regionsCacheTTL, "regions-cache-ttl", "7d", "refresh the regions cache in the background once it is this old")
+	rootCmd.PersistentFlags().BoolVar(&refreshRegions, "refresh-regions", false, "look up the enabled regions instead of using the cache")
+}
+
+// writeRegions prints every enabled region, sorted by name, and whether the
+// scan covers it.
+func writeRegions(w io.Writer, all, scanned []types.Region) {
+	covered := map[string]bool{}
+	for _, region := range scanned {
+		covered[aws.ToString(region.RegionName)] = true
+	}
+
+	names := make([]string, 0, len(all))
+	for _, region := range all {
+		names = append(names, aws.ToString(region.RegionName))
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tSCANNED")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%t\n", name, covered[name])
+	}
+	tw.Flush()
+
+	line := fmt.Sprintf("Enabled Regions: %d, Scanned Regions: %d", len(all), len(scanned))
+	if regionsCacheAge > 0 {
+		line += fmt.Sprintf(", Cache Age: %s", regionsCacheAge.Round(time.Second))
+	}
+	fmt.Fprintln(w, line)
+}
+
+// getAllAwsRegions returns the regions enabled for the account. The result
+// of the first lookup is cached in --regions-cache-file and reused on
+// subsequent runs; a cache older than --regions-cache-ttl is refreshed in the
+// background while the cached regions are returned. --refresh-regions
+// always looks them up.
+func getAllAwsRegions() ([]types.Region, error) {
+	ttl, err := parseAge(regionsCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --regions-cache-ttl: %w", err)
+	}
+	if refreshRegions {
+		regionsCacheAge = 0
+		return refreshRegionsCache()
+	}
+
+	regions, age, err := readRegionsCache()
+	if err == nil && len(regions) > 0 && inPartition(regions) {
+		regionsCacheAge = age
+		if age >= ttl {
+			go func() {
+				if _, err := refreshRegionsCache(); err != nil {
+					slog.Warn("failed to refresh regions cache, keeping the cached one", "error", err)
+				}
+			}()
+		}
+		return regions, nil
+	}
+
+	return refreshRegionsCache()
+}
+
+// inPartition reports whether every region belongs to --partition, so a
+// cache written for another partition is looked up again.
+func inPartition(regions []types.Region) bool {
+	for _, region := range regions {
+		if awsres.Partition(aws.ToString(region.RegionName)) != partition {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshRegionsCache looks up the enabled regions and rewrites the cache.
+func refreshRegionsCache() ([]types.Region, error) {
+	cfg, err := loadAwsConfig(bootstrapRegion())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := newEC2Client(cfg).DescribeRegions(context.Background(), &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	if fixturesDir != "" {
+		return resp.Regions, nil // Leave the cache to the real regions
+	}
+	if err := writeRegionsCache(resp.Regions); err != nil {
+		slog.Error("failed to write regions cache", "error", err)
+	}
+
+	return resp.Regions, nil
+}
+
+// getScanRegions returns the regions a scan covers, applying --regions and
+// --exclude-regions. With --resource-group it also loads the scan scope and
+// keeps only the regions holding members, and with --shard the regions of
+// the shard.
+func getScanRegions() ([]types.Region, error) {
+	regions, err := getAllAwsRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err = filterRegions(regions, includeRegions, excludeRegions)
+	if err != nil {
+		return nil, err
+	}
+
+	if resourceGroup == "" {
+		return shardRegions(regions), nil
+	}
+
+	scope, err = loadResourceGroupScope(resourceGroup, regions)
+	if err != nil {
+		return nil, err
+	}
+
+	var scoped []types.Region
+	for _, region := range regions {
+		if scope.HasRegion(*region.RegionName) {
+			scoped = append(scoped, region)
+		}
+	}
+
+	return shardRegions(scoped), nil
+}
+
+// filterRegions keeps the included regions (all when include is empty) minus
+// the excluded ones. Every named region must exist in regions.
+func filterRegions(regions []types.Region, include, exclude []string) ([]types.Region, error) {
+	known := map[string]bool{}
+	for _, region := range regions {
+		known[*region.RegionName] = true
+	}
+
+	toSet := func(flag string, names []string) (map[string]bool, error) {
+		set := map[string]bool{}
+		var unknown []string
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+			set[name] = true
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("unknown region(s) in --%s: %s", flag, strings.Join(unknown, ", "))
+		}
+		return set, nil
+	}
+
+	included, err := toSet("regions", include)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := toSet("exclude-regions", exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []types.Region
+	for _, region := range regions {
+		name := *region.RegionName
+		if (len(included) == 0 || included[name]) && !excluded[name] {
+			filtered = append(filtered, region)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil, errors.New("no regions left to scan after applying region filters")
+	}
+
+	return filtered, nil
+}
+
+// readRegionsCache returns the cached regions and the age of the cache.
+func readRegionsCache() ([]types.Region, time.Duration, error) {
+	info, err := os.Stat(regionsCacheFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	data, err := readCacheFile(regionsCacheFile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var regions []types.Region
+	if err := json.Unmarshal(data, &regions); err != nil {
+		return nil, 0, err
+	}
+
+	return regions, time.Since(info.ModTime()), nil
+}
+
+// writeRegionsCache replaces the cache through a temporary file so a
+// background refresh never leaves a partial cache behind.
+func writeRegionsCache(regions []types.Region) error {
+	if skipDryRun("write %s", regionsCacheFile) {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(regions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeCacheFile(regionsCacheFile, data)
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configWatcher re-applies the config file to the flags of a serving command
+// whenever the file changes, so regions, services, thresholds and
+// notification targets can change without restarting the exporter. Flags
+// given on the command line keep their value. Server flags such as
+// --listen-address are only read at start.
+type configWatcher struct {
+	cmd        *cobra.Command
+	changes    chan struct{}
+	generation prometheus.Gauge
+	count      int
+}
+
+// watchConfig starts watching the config file in use, or returns nil when no
+// config file was read.
+func watchConfig(cmd *cobra.Command) (*configWatcher, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, nil
+	}
+
+	w := &configWatcher{
+		cmd:     cmd,
+		changes: make(chan struct{}, 1),
+		generation: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "crankymosquitos_config_generation",
+			Help: "Number of times the config file was loaded, starting at 1",
+		}),
+		count: 1,
+	}
+	if err := prometheus.DefaultRegisterer.Register(w.generation); err != nil {
+		return nil, err
+	}
+	w.generation.Set(1)
+
+	// Events arriving while a scan runs collapse into a single reload, which
+	// the scan loop applies between scans.
+	viper.OnConfigChange(func(fsnotify.Event) {
+		select {
+		case w.changes <- struct{}{}:
+		default:
+		}
+	})
+	viper.WatchConfig()
+
+	return w, nil
+}
+
+// Changes returns the channel signalled when the config file changed. It is
+// nil, and so never ready, for a nil watcher.
+func (w *configWatcher) Changes() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.changes
+}
+
+// reload applies the changed config file and returns the flags whose value
+// changed. An invalid config leaves the previous values in place.
+func (w *configWatcher) reload() ([]string, error) {
+	before := map[string]string{}
+	w.cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if !flag.Changed {
+			before[flag.Name] = flag.Value.String()
+			resetFlag(flag, flag.DefValue)
+		}
+	})
+
+	err := applyConfig(w.cmd)
+	if err == nil {
+		err = initLogging()
+	}
+	if err == nil {
+		err = initConcurrency()
+	}
+	if err == nil {
+		err = initPricing()
+	}
+	if err == nil {
+		err = initFilters()
+	}
+	if err != nil {
+		for name, value := range before {
+			resetFlag(w.cmd.Flags().Lookup(name), value)
+		}
+		if restoreErr := errors.Join(initLogging(), initConcurrency(), initPricing(), initFilters()); restoreErr != nil {
+			slog.Error("failed to restore the previous config", "error", restoreErr)
+		}
+		return nil, err
+	}
+
+	var changed []string
+	w.cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if value, ok := before[flag.Name]; ok && value != flag.Value.String() {
+			changed = append(changed, flag.Name)
+		}
+	})
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	w.count++
+	w.generation.Set(float64(w.count))
+	slog.Info("config reloaded", "file", viper.ConfigFileUsed(), "generation", w.count, "changed", changed)
+
+	return changed, nil
+}
+
+// resetFlag sets a flag from its String form, e.g. its DefValue. Map flags
+// cannot be cleared through pflag, so keys removed from the config keep
+// their value until the next restart.
+func resetFlag(flag *pflag.Flag, value string) {
+	var err error
+	switch v := flag.Value.(type) {
+	case pflag.SliceValue:
+		items := []string{}
+		if trimmed := strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"); trimmed != "" {
+			items = strings.Split(trimmed, ",")
+		}
+		err = v.Replace(items)
+	default:
+		if flag.Value.Type() == "stringToString" {
+			return
+		}
+		err = flag.Value.Set(value)
+	}
+	if err != nil {
+		slog.Error("failed to reset flag", "flag", flag.Name, "error", err)
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+	"github.com/taylormonacelli/crankymosquitos/schema"
+)
+
+var replayFiles []string
+
+func init() {
+	addReplayFlags(rootCmd)
+	addReplayFlags(storageS3Cmd)
+}
+
+func addReplayFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&replayFiles, "from-file", nil, "replay this JSON report instead of scanning AWS, e.g. to render it in another format or serve its metrics offline; several reports, such as those of the --shard replicas, are merged into one")
+}
+
+// replayReports replays the reports of --from-file, merged when there are
+// several. Merged reports of the shards of one account carry no account
+// subtotals.
+func replayReports(paths []string) (*collector.Report, error) {
+	if len(paths) == 1 {
+		return replayReport(paths[0])
+	}
+
+	reports := make([]*collector.Report, len(paths))
+	for i, path := range paths {
+		report, err := replayReport(path)
+		if err != nil {
+			return nil, err
+		}
+		reports[i] = report
+	}
+
+	merged := collector.MergeReports(reports...)
+	if len(merged.Accounts) < 2 {
+		merged.Accounts = nil
+	}
+	return merged, nil
+}
+
+// replayReport loads a report written with --output json, of any schema
+// version, as if it had just been scanned. It dates from when it was
+// scanned, or from the file's modification time for version 1 reports,
+// which do not record it. Reports carry no tags, so the entities cannot be
+// grouped by tag again.
+func replayReport(path string) (*collector.Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+
+	read, err := schema.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rowUnits := humanize.GB
+	if read.Units != "" {
+		if rowUnits, err = humanize.ParseUnits(read.Units); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	report := &collector.Report{GeneratedAt: read.GeneratedAt}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = info.ModTime()
+	}
+	for _, row := range read.Entities {
+		entity, costEstimated, err := rowEntity(row, rowUnits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		report.Entities = append(report.Entities, entity)
+		report.TotalStorageUsed += entity.StorageUsed
+		report.CostEstimated = report.CostEstimated || costEstimated
+	}
+
+	if groupBy != "" {
+		slog.Warn("ignoring --group-by: replayed reports carry no tags")
+	}
+	report.Stacks = collector.GroupByStack(report.Entities)
+	if hasOwners(report.Entities) {
+		report.Owners = collector.GroupByOwner(report.Entities)
+	}
+	if hasAccessClasses(report.Entities) {
+		report.AccessClasses = collector.AccessClassTotals(report.Entities)
+	}
+
+	return report, nil
+}
+
+func hasOwners(entities []collector.EntityUsage) bool {
+	for _, entity := range entities {
+		if entity.Owner != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAccessClasses(entities []collector.EntityUsage) bool {
+	for _, entity := range entities {
+		if entity.AccessClass != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// rowEntity converts a report row back into the entity reportRows built it
+// from. Sizes are read in the units of the report, rounded as written. It also reports whether the
+// row carries a cost estimate.
+func rowEntity(row map[string]interface{}, rowUnits humanize.Units) (collector.EntityUsage, bool, error) {
+	str := func(column string) string {
+		value, _ := row[column].(string)
+		return value
+	}
+	size := func(column string) (int64, error) {
+		if str(column) == "" {
+			return 0, nil
+		}
+		size, err := humanize.ParseValue(str(column), rowUnits)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q of %s", column, str(column), str("ID"))
+		}
+		return size, nil
+	}
+
+	entity := collector.EntityUsage{
+		ID:               str("ID"),
+		Region:           str("Region"),
+		Type:             str("Type"),
+		Engine:           str("Engine"),
+		FileSystemType:   str("FileSystemType"),
+		VolumeType:       str("VolumeType"),
+		InstanceType:     str("InstanceType"),
+		InstanceState:    str("InstanceState"),
+		AutoScalingGroup: str("AutoScalingGroup"),
+		KubeCluster:      str("KubeCluster"),
+		KubeNamespace:    str("KubeNamespace"),
+		KubePVC:          str("KubePVC"),
+		BackupVault:      str("BackupVault"),
+		ResourceType:     str("ResourceType"),
+		SnapshotOwner:    str("SnapshotOwner"),
+		SourceVolume:     str("SourceVolume"),
+		Description:      str("Description"),
+		AccessClass:      str("AccessClass"),
+		Recommendation:   str("Recommendation"),
+		Profile:          str("Profile"),
+		AccountID:        str("AccountID"),
+		Stack:            str("Stack"),
+		Owner:            str("Owner"),
+		OwnerSource:      str("OwnerSource"),
+	}
+	if attached := str("AttachedInstance"); attached != "Not Attached" {
+		entity.AttachedInstance = attached
+	}
+	entity.Public, _ = row["Public"].(bool)
+	entity.Encrypted, _ = row["Encrypted"].(bool)
+	entity.MultiAttach, _ = row["MultiAttach"].(bool)
+	if exists, ok := row["VolumeExists"].(bool); ok {
+		entity.VolumeExists = &exists
+	}
+	if started := str("StartTime"); started != "" {
+		entity.StartTime, _ = time.Parse(time.RFC3339, started) // A date-time per the schema
+	}
+	if pods := str("KubePods"); pods != "" {
+		entity.KubePods = strings.Split(pods, ",")
+	}
+	if iops, ok := row["IOPS"].(json.Number); ok {
+		value, _ := iops.Int64() // An integer per the schema
+		entity.IOPS = int32(value)
+	}
+	if throughput, ok := row["Throughput"].(json.Number); ok {
+		value, _ := throughput.Int64() // An integer per the schema
+		entity.Throughput = int32(value)
+	}
+	if progress, ok := row["PendingProgress"].(json.Number); ok {
+		value, _ := progress.Float64()
+		switch str("PendingOperation") {
+		case collector.OperationSnapshot:
+			entity.Progress = &value
+		case collector.OperationModifying, collector.OperationOptimizing:
+			entity.Modification = &collector.VolumeModification{State: str("PendingOperation"), Progress: value}
+		}
+	}
+	if _, id, found := strings.Cut(str("InstanceLink"), "instanceId="); found {
+		entity.InstanceID = id
+	}
+
+	var err error
+	if entity.StorageUsed, err = size("StorageUsed"); err != nil {
+		return entity, false, err
+	}
+	if entity.AllocatedStorage, err = size("AllocatedStorage"); err != nil {
+		return entity, false, err
+	}
+
+	if count, ok := row["ObjectCount"].(json.Number); ok {
+		entity.ObjectCount, _ = count.Int64() // An integer per the schema
+	}
+
+	if age := str("BackupAgeHours"); age != "" {
+		hours := math.Inf(1)
+		if age != "never" {
+			hours, _ = strconv.ParseFloat(age, 64) // A decimal per the schema
+		}
+		entity.BackupAgeHours = &hours
+
+		// Only whether the SLA was met is recorded, so pick the whole-hour
+		// maximum age closest to the age that reproduces it
+		violated, _ := row["BackupSLAViolated"].(bool)
+		switch {
+		case math.IsInf(hours, 1):
+		case violated:
+			entity.BackupSLAMaxAge = time.Duration(max(math.Ceil(hours)-1, 0)) * time.Hour
+		default:
+			entity.BackupSLAMaxAge = time.Duration(math.Ceil(hours)) * time.Hour
+		}
+	}
+
+	if age := str("SnapshotAgeSeconds"); age != "" {
+		seconds := math.Inf(1)
+		if age != "never" {
+			seconds, _ = strconv.ParseFloat(age, 64) // An integer per the schema
+		}
+		entity.SnapshotAge = &seconds
+		entity.SnapshotGap, _ = row["SnapshotCoverageGap"].(bool)
+	}
+
+	cost := str("MonthlyCostUSD")
+	if cost != "" {
+		entity.MonthlyCostUSD, _ = strconv.ParseFloat(cost, 64) // A decimal per the schema
+	}
+
+	return entity, cost != "", nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/taylormonacelli/crankymosquitos/schema"
+)
+
+var (
+	reportSchemaVersion string
+	reportPrintSchema   bool
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Work with written storage reports",
+}
+
+var reportValidateCmd = &cobra.Command{
+	Use:   "validate FILE",
+	Short: "Validate a report against its JSON Schema",
+	Long: `Validates a report written by the scan against the JSON Schema of
+its version, exiting non-zero when it does not comply. The version is
+detected from the report unless --schema-version is given. Use
+--print-schema to write the schema itself to stdout.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if reportPrintSchema {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reportPrintSchema {
+			version := reportSchemaVersion
+			if version == "" {
+				version = schema.LatestVersion
+			}
+			data, err := schema.Raw(version)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if reportSchemaVersion == "" {
+			report, err := schema.Read(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			fmt.Printf("%s: valid (schema v%s)\n", args[0], report.Version)
+			return nil
+		}
+
+		if err := schema.Validate(reportSchemaVersion, file); err != nil {
+			return fmt.Errorf("%s does not match report schema v%s: %w", args[0], reportSchemaVersion, err)
+		}
+
+		fmt.Printf("%s: valid (schema v%s)\n", args[0], reportSchemaVersion)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportValidateCmd)
+
+	reportValidateCmd.Flags().StringVar(&reportSchemaVersion, "schema-version", "", "report schema version to validate against (default: detected from the report)")
+	reportValidateCmd.Flags().BoolVar(&reportPrintSchema, "print-schema", false, "print the JSON Schema instead of validating a file")
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroups"
+	rgtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroups/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	resourceGroup string
+
+	// scope limits collection to resource group members; nil means unscoped.
+	scope *collector.Scope
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&resourceGroup, "resource-group", "", "only collect members of this AWS Resource Group")
+}
+
+// parseMemberArn splits a resource ARN into its region, resource type and ID,
+// e.g. "volume" and "vol-0123" or "db" and "mydb".
+func parseMemberArn(resourceArn string) (string, string, string, error) {
+	parsed, err := arn.Parse(resourceArn)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if parsed.Service == "s3" {
+		return "", "bucket", parsed.Resource, nil
+	}
+
+	resourceType, id, found := strings.Cut(parsed.Resource, "/")
+	if !found {
+		resourceType, id, found = strings.Cut(parsed.Resource, ":")
+	}
+	if !found {
+		return "", "", "", fmt.Errorf("unsupported resource ARN %s", resourceArn)
+	}
+
+	return parsed.Region, resourceType, id, nil
+}
+
+// loadResourceGroupScope resolves the members of a resource group in every
+// region. Regions where the group does not exist are skipped.
+func loadResourceGroupScope(group string, regions []types.Region) (*collector.Scope, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	semaphore := make(chan struct{}, concurrency)
+	s := collector.NewScope()
+	found := false
+
+	for _, region := range regions {
+		wg.Add(1)
+
+		go func(region string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			cfg, err := loadAwsConfig(region)
+			if err != nil {
+				slog.Error("failed to create Resource Groups client", "region", region, "error", err)
+				return
+			}
+
+			arns, err := listGroupResources(context.Background(), resourcegroups.NewFromConfig(cfg), group)
+			var notFound *rgtypes.NotFoundException
+			if errors.As(err, &notFound) {
+				return
+			}
+			if err != nil {
+				slog.Error("failed to list resource group members", "group", group, "region", region, "error", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			found = true
+			for _, resourceArn := range arns {
+				memberRegion, resourceType, id, err := parseMemberArn(resourceArn)
+				if err != nil {
+					slog.Warn("ignoring resource group member", "error", err)
+					continue
+				}
+				s.Add(memberRegion, id, resourceType)
+			}
+		}(*region.RegionName)
+	}
+
+	wg.Wait()
+
+	if !found {
+		return nil, fmt.Errorf("resource group %s not found in any region", group)
+	}
+
+	return s, nil
+}
+
+func listGroupResources(ctx context.Context, client *resourcegroups.Client, group string) ([]string, error) {
+	var arns []string
+
+	paginator := resourcegroups.NewListGroupResourcesPaginator(client, &resourcegroups.ListGroupResourcesInput{
+		Group: aws.String(group),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Resources {
+			if item.Identifier != nil {
+				arns = append(arns, aws.ToString(item.Identifier.ResourceArn))
+			}
+		}
+	}
+
+	return arns, nil
+}
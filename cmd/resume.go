@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var resumeFile string
+
+func init() {
+	rootCmd.Flags().StringVar(&resumeFile, "resume", "", "checkpoint the scan in this file and resume an interrupted scan from it, skipping the regions and snapshot pages it completed; removed once a scan completes")
+}
+
+// withCheckpoint adds the --resume checkpoint to the options of a scan.
+func withCheckpoint(opts collector.Options) (collector.Options, error) {
+	if resumeFile == "" {
+		return opts, nil
+	}
+	if err := createParentDir(resumeFile); err != nil {
+		return opts, fmt.Errorf("failed to create --resume directory: %w", err)
+	}
+
+	checkpoint, err := collector.LoadCheckpoint(resumeFile, opts)
+	if err != nil {
+		return opts, err
+	}
+	if completed, listing := checkpoint.Regions(); completed > 0 || listing > 0 {
+		slog.Info("resuming scan from checkpoint", "file", resumeFile, "regions_completed", completed, "regions_listing_snapshots", listing)
+	}
+	opts.Checkpoint = checkpoint
+	return opts, nil
+}
+
+// checkpointContext returns the context of a checkpointed scan, canceled by
+// SIGINT and SIGTERM so that the checkpoint is written before exiting.
+func checkpointContext(opts collector.Options) (context.Context, context.CancelFunc) {
+	if opts.Checkpoint == nil {
+		return context.Background(), func() {}
+	}
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var rightsizingOptions = struct {
+	Lookback   string
+	Percentile float64
+	Headroom   float64
+	PlanFile   string
+}{}
+
+var analyzeRightsizingCmd = &cobra.Command{
+	Use:   "rightsizing",
+	Short: "Recommend lower provisioned IOPS and throughput for io1, io2 and gp3 volumes",
+	Long: `Reads the IOPS and throughput of every io1, io2 and gp3 volume from
+CloudWatch over --lookback, takes the --percentile of the five minute
+averages, adds --headroom percent and recommends provisioning that instead
+when it is less than the volume has. The projected monthly savings use the
+us-east-1 list prices of provisioned IOPS and throughput; the storage price
+does not change. Volumes without metrics, such as unattached ones, are left
+out.
+
+With --plan-file the recommendations that would save money are written as
+a JSON plan, which apply --plan modifies the volumes with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := rightsizingOptions
+		lookback, err := parseAge(opts.Lookback)
+		if err != nil {
+			return fmt.Errorf("invalid --lookback: %w", err)
+		}
+		if opts.Percentile <= 0 || opts.Percentile > 100 {
+			return fmt.Errorf("invalid --percentile %g: must be above 0 and at most 100", opts.Percentile)
+		}
+		if opts.Headroom < 0 {
+			return fmt.Errorf("invalid --headroom %g: must not be negative", opts.Headroom)
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		scanOpts := collectorOptions(regions)
+		scanOpts.Services = []string{collector.ServiceEBS}
+		scanOpts.AccessLookback = lookback
+
+		c := collector.New(scanOpts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		recommendations := c.Rightsizing(context.Background(), report.Entities, opts.Percentile, opts.Headroom)
+		recommendations, ignored := ignoreFindings(recommendations, func(recommendation collector.VolumeRightsizing) collector.EntityUsage { return recommendation.Volume })
+		writeRightsizing(os.Stdout, recommendations, opts.Percentile)
+		printIgnored(os.Stdout, ignored)
+
+		if opts.PlanFile != "" {
+			return writePlan(opts.PlanFile, rightsizingPlan(recommendations, time.Now()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeRightsizingCmd)
+
+	flags := analyzeRightsizingCmd.Flags()
+	flags.StringVar(&rightsizingOptions.Lookback, "lookback", "14d", "window the IOPS and throughput usage is read from")
+	flags.Float64Var(&rightsizingOptions.Percentile, "percentile", 99, "percentile of the five minute usage averages to size for")
+	flags.Float64Var(&rightsizingOptions.Headroom, "headroom", 20, "percent added to the usage percentile")
+	flags.StringVar(&rightsizingOptions.PlanFile, "plan-file", "", "write the recommendations that would save money as a JSON plan for apply --plan")
+}
+
+// rightsizingCommand is the AWS CLI command applying a recommendation.
+func rightsizingCommand(r collector.VolumeRightsizing) string {
+	command := fmt.Sprintf("aws ec2 modify-volume --region %s --volume-id %s --iops %d", r.Volume.Region, r.Volume.ID, r.IOPS)
+	if r.Throughput > 0 {
+		command += fmt.Sprintf(" --throughput %d", r.Throughput)
+	}
+	return command
+}
+
+// throughputLabel formats provisioned throughput, which only gp3 has.
+func throughputLabel(throughput int32) string {
+	if throughput == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", throughput)
+}
+
+func writeRightsizing(w io.Writer, recommendations []collector.VolumeRightsizing, percentile float64) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "VOLUME\tREGION\tTYPE\tSIZE\tIOPS\tP%g IOPS\tNEW IOPS\tMIB/S\tP%g MIB/S\tNEW MIB/S\tSAVINGS\n", percentile, percentile)
+
+	var savings float64
+	var downsize []collector.VolumeRightsizing
+	for _, r := range recommendations {
+		v := r.Volume
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%.0f\t%d\t%s\t%.1f\t%s\t$%.2f\n",
+			v.ID, v.Region, v.VolumeType, formatBytes(v.StorageUsed), v.IOPS, r.UsedIOPS, r.IOPS,
+			throughputLabel(v.Throughput), r.UsedThroughput, throughputLabel(r.Throughput), r.MonthlySavingsUSD)
+		if r.Downsize() && r.MonthlySavingsUSD > 0 {
+			savings += r.MonthlySavingsUSD
+			downsize = append(downsize, r)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Provisioned Volumes: %d, Worth Downsizing: %d, Potential Monthly Savings: $%.2f\n",
+		len(recommendations), len(downsize), savings)
+	for _, r := range downsize {
+		fmt.Fprintln(w, rightsizingCommand(r))
+	}
+}
+
+// rightsizingPlan returns the recommendations that would save money as a
+// plan.
+func rightsizingPlan(recommendations []collector.VolumeRightsizing, now time.Time) actionPlan {
+	plan := newPlan("analyze rightsizing", now)
+	for _, r := range recommendations {
+		if !r.Downsize() || r.MonthlySavingsUSD <= 0 {
+			continue
+		}
+		plan.Actions = append(plan.Actions, planAction{
+			Action:            ActionModifyVolume,
+			ResourceID:        r.Volume.ID,
+			Type:              r.Volume.Type,
+			Region:            r.Volume.Region,
+			StorageUsed:       r.Volume.StorageUsed,
+			MonthlyCostUSD:    r.Volume.MonthlyCostUSD,
+			Tags:              r.Volume.Tags,
+			IOPS:              r.IOPS,
+			Throughput:        r.Throughput,
+			MonthlySavingsUSD: r.MonthlySavingsUSD,
+		})
+	}
+	return plan
+}
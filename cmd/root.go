@@ -4,8 +4,11 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -16,23 +19,68 @@ var cfgFile string
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "crankymosquitos",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	Run: func(cmd *cobra.Command, args []string) {
-		main()
+	Short: "Report and export the storage used across AWS accounts and regions",
+	Long: `Scans the EBS volumes and snapshots, RDS databases, EFS and FSx file
+systems and AWS Backup recovery points of every enabled region and reports
+the storage each of them uses; storage s3 does the same for S3 buckets.
+
+  crankymosquitos scan        scan once and write the report
+  crankymosquitos serve       scan and serve the results as Prometheus metrics
+  crankymosquitos regions list
+                              list the regions a scan covers
+  crankymosquitos analyze ... recommend cheaper or safer storage
+  crankymosquitos cleanup     delete unattached volumes and old snapshots
+
+Without a subcommand it behaves like serve, taking the same flags. The
+region, profile, logging and cache flags are shared by every subcommand.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+		initStateDir()
+		if err := initLogging(); err != nil {
+			return err
+		}
+		if err := validatePartition(); err != nil {
+			return err
+		}
+		if err := initFixtures(cmd); err != nil {
+			return err
+		}
+		if err := initUnits(); err != nil {
+			return err
+		}
+		if _, err := atRestSealer(); err != nil {
+			return err
+		}
+		if err := initConcurrency(); err != nil {
+			return err
+		}
+		if err := initShard(); err != nil {
+			return err
+		}
+		if err := initMetrics(); err != nil {
+			return err
+		}
+		if err := initPricing(); err != nil {
+			return err
+		}
+		if err := initFilters(); err != nil {
+			return err
+		}
+		// The flags are valid; errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStorage(cmd, false)
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	shareScanFlags()
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -46,11 +94,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.crankymosquitos.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.crankymosquitos.yaml, then crankymosquitos/config.yaml in the user config directory)")
 
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.Flags().BoolVar(&estimateCost, "estimate-cost", false, "estimate the monthly cost of volumes and snapshots with the prices of --pricing")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -69,10 +115,40 @@ func initConfig() {
 		viper.SetConfigName(".crankymosquitos")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Read CRANKY_* environment variables, with "-" and "." in keys
+	// replaced by "_".
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	// If a config file is found, read it in, falling back to the user's
+	// config directory.
+	err := viper.ReadInConfig()
+	if cfgFile == "" && errors.As(err, new(viper.ConfigFileNotFoundError)) {
+		if path := userConfigFile(); path != "" {
+			viper.SetConfigFile(path)
+			err = viper.ReadInConfig()
+		}
+	}
+	switch {
+	case err == nil:
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	case cfgFile != "":
+		// A config file given explicitly has to be readable.
+		cobra.CheckErr(err)
+	}
+}
+
+// userConfigFile returns crankymosquitos/config.yaml in the user's config
+// directory, or "" when it does not exist.
+func userConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "crankymosquitos", "config.yaml")
+	if _, err := os.Stat(path); err != nil {
+		return ""
 	}
+	return path
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var s3ListFallback bool
+
+var storageS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Report the size of every S3 bucket",
+	Long: `Walks all buckets, reading BucketSizeBytes and NumberOfObjects from
+CloudWatch. Buckets without CloudWatch datapoints are sized by listing their
+objects unless --list-fallback=false is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatter, err := initOutput()
+		if err != nil {
+			return err
+		}
+
+		return runScan(cmd, formatter, s3Options, false)
+	},
+}
+
+func init() {
+	storageCmd.AddCommand(storageS3Cmd)
+
+	storageS3Cmd.Flags().BoolVar(&s3ListFallback, "list-fallback", true, "list objects when CloudWatch has no datapoints for a bucket")
+}
+
+// s3Options builds the options of a bucket-only scan from the flags.
+func s3Options() (collector.Options, error) {
+	regions, err := getScanRegions()
+	if err != nil {
+		return collector.Options{}, fmt.Errorf("failed to retrieve AWS regions: %w", err)
+	}
+
+	opts := collectorOptions(regions)
+	opts.Services = []string{collector.ServiceS3}
+	opts.S3ListFallback = s3ListFallback
+
+	return opts, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan every service once and write the report",
+	Long: `Scans every service once, writes the report in the --output format and
+exits without serving metrics. CloudWatch, OTLP, statsd, Pushgateway and
+upload sinks still receive the results when enabled.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStorage(cmd, true)
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Scan every service and serve the results as Prometheus metrics",
+	Long: `Scans every service, writes the report and serves the metrics, the scan
+status and the report over HTTP, rescanning every --refresh-interval. This
+is what running crankymosquitos without a subcommand does.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStorage(cmd, false)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	rootCmd.AddCommand(serveCmd)
+}
+
+// shareScanFlags gives scan, serve and watch the local flags of the root
+// command, whose scan they run. It must run after every init has
+// registered its flags.
+func shareScanFlags() {
+	scanCmd.Flags().AddFlagSet(rootCmd.Flags())
+	serveCmd.Flags().AddFlagSet(rootCmd.Flags())
+	watchCmd.Flags().AddFlagSet(rootCmd.Flags())
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+)
+
+var serverOptions = struct {
+	ListenAddress     string
+	MetricsPath       string
+	TLSCert           string
+	TLSKey            string
+	BasicAuthUser     string
+	BasicAuthPassFile string
+	APIKeysFile       string
+	RefreshInterval   string
+	MaxStaleness      string
+}{}
+
+func init() {
+	addServerFlags(rootCmd)
+	addServerFlags(storageS3Cmd)
+}
+
+func addServerFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&serverOptions.ListenAddress, "listen-address", ":8080", "address the metrics server listens on")
+	flags.StringVar(&serverOptions.MetricsPath, "metrics-path", "/metrics", "path the Prometheus metrics are served on")
+	flags.StringVar(&serverOptions.TLSCert, "tls-cert", "", "serve HTTPS with this certificate file (requires --tls-key)")
+	flags.StringVar(&serverOptions.TLSKey, "tls-key", "", "private key file of --tls-cert")
+	flags.StringVar(&serverOptions.BasicAuthUser, "basic-auth-user", "", "require HTTP basic auth with this user name")
+	flags.StringVar(&serverOptions.BasicAuthPassFile, "basic-auth-password-file", "", "file holding the password of --basic-auth-user")
+	flags.StringVar(&serverOptions.RefreshInterval, "refresh-interval", "", "scan again this often while serving, e.g. 15m or 1d (default: scan once)")
+	flags.StringVar(&serverOptions.MaxStaleness, "max-staleness", "", "rescan when a scrape finds the metrics older than this, e.g. 1h (default: never)")
+	flags.StringVar(&serverOptions.APIKeysFile, "api-keys-file", "", "YAML file of API keys, each optionally scoped to accounts and tags, required to query the server")
+}
+
+// validateServerOptions checks the server flags before the scan starts.
+func validateServerOptions() error {
+	opts := serverOptions
+	if !strings.HasPrefix(opts.MetricsPath, "/") {
+		return fmt.Errorf("invalid --metrics-path %q: must start with /", opts.MetricsPath)
+	}
+	switch opts.MetricsPath {
+	case "/status", "/report", "/healthz", "/readyz":
+		return fmt.Errorf("--metrics-path %s is reserved", opts.MetricsPath)
+	}
+	if strings.HasPrefix(opts.MetricsPath, "/api/") {
+		return fmt.Errorf("--metrics-path %s is reserved for the query API", opts.MetricsPath)
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if (opts.BasicAuthUser == "") != (opts.BasicAuthPassFile == "") {
+		return errors.New("--basic-auth-user and --basic-auth-password-file must be given together")
+	}
+	if opts.RefreshInterval != "" {
+		if _, err := parseAge(opts.RefreshInterval); err != nil {
+			return fmt.Errorf("invalid --refresh-interval: %w", err)
+		}
+	}
+	if opts.MaxStaleness != "" {
+		if _, err := parseAge(opts.MaxStaleness); err != nil {
+			return fmt.Errorf("invalid --max-staleness: %w", err)
+		}
+	}
+	if opts.APIKeysFile != "" && opts.BasicAuthUser != "" {
+		return errors.New("--api-keys-file and --basic-auth-user cannot be used together")
+	}
+	return nil
+}
+
+// basicAuthPassword reads --basic-auth-password-file, ignoring trailing
+// newlines.
+func basicAuthPassword() (string, error) {
+	data, err := os.ReadFile(serverOptions.BasicAuthPassFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read basic auth password: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// serveMetrics serves the Prometheus metrics, the scan status, the finished
+// report, the query API and the health probes in the background. With API keys every
+// request but the probes needs one, and scoped keys only see their own
+// entities. The returned channel receives the error the server stops with.
+func serveMetrics(status *scanStatus, keys *apiKeys) (<-chan error, error) {
+	opts := serverOptions
+
+	mux := http.NewServeMux()
+	mux.Handle(opts.MetricsPath, scopedMetrics(promhttp.Handler()))
+	mux.Handle("/status", status)
+	mux.HandleFunc("/report", status.serveReport)
+	mux.HandleFunc(apiEntitiesPath, status.serveEntities)
+	mux.HandleFunc(apiSummaryPath, status.serveSummary)
+
+	var handler http.Handler = mux
+	if keys != nil {
+		handler = keys.authenticate(handler, []string{opts.MetricsPath, "/status", "/report", apiEntitiesPath, apiSummaryPath})
+	}
+	if opts.BasicAuthUser != "" {
+		password, err := basicAuthPassword()
+		if err != nil {
+			return nil, err
+		}
+		handler = basicAuth(handler, opts.BasicAuthUser, password)
+	}
+
+	// Kubernetes probes carry no credentials
+	probes := http.NewServeMux()
+	probes.HandleFunc("/healthz", status.serveHealth)
+	probes.HandleFunc("/readyz", status.serveReadiness)
+	probes.Handle("/", handler)
+
+	server := &http.Server{Addr: opts.ListenAddress, Handler: probes}
+
+	scheme := "http"
+	if opts.TLSCert != "" {
+		scheme = "https"
+	}
+	fmt.Fprintf(summaryOut, "Listening for requests on %s://%s%s...\n", scheme, displayAddress(opts.ListenAddress), opts.MetricsPath)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if opts.TLSCert != "" {
+			serverErr <- server.ListenAndServeTLS(opts.TLSCert, opts.TLSKey)
+			return
+		}
+		serverErr <- server.ListenAndServe()
+	}()
+
+	return serverErr, nil
+}
+
+// rescanRequests lets scrapes of stale metrics ask the scan loop for a
+// fresh scan and wait for it.
+type rescanRequests struct {
+	requests chan struct{}
+
+	mu   sync.Mutex
+	done chan struct{} // Closed when the next scan finishes; nil with no waiters
+}
+
+func newRescanRequests() *rescanRequests {
+	return &rescanRequests{requests: make(chan struct{}, 1)}
+}
+
+// wait asks for a rescan, unless one was already asked for, and blocks until
+// a scan finishes or ctx is done.
+func (r *rescanRequests) wait(ctx context.Context) error {
+	r.mu.Lock()
+	if r.done == nil {
+		r.done = make(chan struct{})
+		select {
+		case r.requests <- struct{}{}:
+		default:
+		}
+	}
+	done := r.done
+	r.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("rescan still running: %w", ctx.Err())
+	}
+}
+
+// finished releases the scrapes waiting for a scan. The scan that just
+// finished answers any pending request too.
+func (r *rescanRequests) finished() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.requests:
+	default:
+	}
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+}
+
+// displayAddress fills in localhost for an address without a host.
+func displayAddress(address string) string {
+	if strings.HasPrefix(address, ":") {
+		return "localhost" + address
+	}
+	return address
+}
+
+// basicAuth rejects requests that do not carry the given credentials.
+func basicAuth(next http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		if !ok || !userMatch || !passwordMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="crankymosquitos"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
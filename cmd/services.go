@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var scanServices []string
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&scanServices, "services", collector.DefaultServices,
+		"services to scan: "+strings.Join(collector.AllServices, ", "))
+}
+
+// validateServices checks the --services values.
+func validateServices() error {
+	if len(scanServices) == 0 {
+		return errors.New("--services must not be empty")
+	}
+	for _, service := range scanServices {
+		if !slices.Contains(collector.AllServices, service) {
+			return fmt.Errorf("invalid --services %q: expected one of %s", service, strings.Join(collector.AllServices, ", "))
+		}
+	}
+	return nil
+}
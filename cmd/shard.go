@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// What --shard partitions.
+const (
+	shardByRegions  = "regions"
+	shardByAccounts = "accounts"
+)
+
+var (
+	shardSpec string
+	shardBy   string
+
+	// shard is the parsed --shard, the zero value without it.
+	shard scanShard
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&shardSpec, "shard", "", "scan only shard I of N, e.g. 2/5, so that N replicas split the scan; merge their reports with --from-file")
+	rootCmd.Flags().StringVar(&shardBy, "shard-by", shardByRegions, "what --shard partitions: regions, or accounts of --profiles, --assume-roles and --org-role")
+}
+
+// scanShard is shard Index of Count, numbered from 1.
+type scanShard struct {
+	Index, Count int
+}
+
+func (s scanShard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// initShard parses --shard and --shard-by.
+func initShard() error {
+	shard = scanShard{}
+	if shardSpec == "" {
+		return nil
+	}
+
+	index, count, _ := strings.Cut(shardSpec, "/")
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return fmt.Errorf("invalid --shard %q: expected I/N with I from 1 to N, e.g. 2/5", shardSpec)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || i < 1 || i > n {
+		return fmt.Errorf("invalid --shard %q: expected I/N with I from 1 to N, e.g. 2/5", shardSpec)
+	}
+
+	switch shardBy {
+	case shardByRegions:
+	case shardByAccounts:
+		if !multiAccount() {
+			return fmt.Errorf("--shard-by accounts needs --profiles, --assume-roles or --org-role")
+		}
+	default:
+		return fmt.Errorf("invalid --shard-by %q: must be regions or accounts", shardBy)
+	}
+
+	shard = scanShard{Index: i, Count: n}
+	return nil
+}
+
+// members returns the keys of the shard: every Count-th of the sorted keys,
+// from the Index-th. Replicas given the same keys agree on the partition,
+// and the shards differ in size by one key at most.
+func (s scanShard) members(keys []string) map[string]bool {
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+
+	members := map[string]bool{}
+	for i, key := range sorted {
+		if i%s.Count == s.Index-1 {
+			members[key] = true
+		}
+	}
+	return members
+}
+
+// shardRegions keeps the regions of the shard with --shard-by regions.
+func shardRegions(regions []types.Region) []types.Region {
+	if shard.Count == 0 || shardBy != shardByRegions {
+		return regions
+	}
+
+	names := make([]string, len(regions))
+	for i, region := range regions {
+		names[i] = *region.RegionName
+	}
+	members := shard.members(names)
+
+	var kept []types.Region
+	for _, region := range regions {
+		if members[*region.RegionName] {
+			kept = append(kept, region)
+		}
+	}
+	if len(kept) == 0 {
+		slog.Warn("shard has no regions to scan", "shard", shard, "regions", len(regions))
+	}
+	return kept
+}
+
+// shardTargets keeps the accounts of the shard with --shard-by accounts.
+func shardTargets(targets []scanTarget) []scanTarget {
+	if shard.Count == 0 || shardBy != shardByAccounts {
+		return targets
+	}
+
+	keys := make([]string, len(targets))
+	for i, target := range targets {
+		keys[i] = target.shardKey()
+	}
+	members := shard.members(keys)
+
+	var kept []scanTarget
+	for _, target := range targets {
+		if members[target.shardKey()] {
+			kept = append(kept, target)
+		}
+	}
+	if len(kept) == 0 {
+		slog.Warn("shard has no accounts to scan", "shard", shard, "accounts", len(targets))
+	}
+	return kept
+}
+
+// shardKey identifies the target across replicas.
+func (t scanTarget) shardKey() string {
+	switch {
+	case t.Profile != "":
+		return "profile:" + t.Profile
+	case t.RoleARN != "":
+		return "role:" + t.RoleARN
+	}
+	return "account:" + t.AccountID
+}
+
+// shardServices leaves S3, which is global, to the first shard of
+// --shard-by regions, so that merged shard reports count every bucket once.
+func shardServices(services []string) ([]string, error) {
+	if shard.Count == 0 || shardBy != shardByRegions || shard.Index == 1 || !slices.Contains(services, collector.ServiceS3) {
+		return services, nil
+	}
+
+	services = slices.DeleteFunc(slices.Clone(services), func(service string) bool { return service == collector.ServiceS3 })
+	if len(services) == 0 {
+		return nil, fmt.Errorf("shard %s has nothing to scan: S3 is global and scanned by shard 1", shard)
+	}
+	return services, nil
+}
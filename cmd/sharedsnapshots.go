@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	sharedSnapshots        bool
+	snapshotOwners         []string
+	includeSharedSnapshots bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&sharedSnapshots, "shared-snapshots", false, "also list the snapshots other accounts shared with the account and flag the account's public snapshots")
+	rootCmd.PersistentFlags().StringSliceVar(&snapshotOwners, "snapshot-owners", []string{"self"}, "collect the snapshots of these owners: self, amazon or account IDs, e.g. 123456789012,self")
+	rootCmd.PersistentFlags().BoolVar(&includeSharedSnapshots, "include-shared-snapshots", false, "also collect the snapshots other accounts shared with the account and count their storage")
+}
+
+// validateSnapshotOwners checks the --snapshot-owners values.
+func validateSnapshotOwners() error {
+	if len(snapshotOwners) == 0 {
+		return errors.New("--snapshot-owners must not be empty")
+	}
+	for _, owner := range snapshotOwners {
+		if owner != "self" && owner != "amazon" && !accountIDPattern.MatchString(owner) {
+			return fmt.Errorf("invalid --snapshot-owners %q: must be self, amazon or a 12-digit account ID", owner)
+		}
+	}
+	return nil
+}
+
+// printSnapshotSharing prints the public snapshots as security findings,
+// followed by the snapshots shared with the account.
+func printSnapshotSharing(w io.Writer, entities []collector.EntityUsage) {
+	var public, shared []collector.EntityUsage
+	for _, entity := range entities {
+		if entity.Public {
+			public = append(public, entity)
+		}
+		if entity.Type == collector.EntityTypeSharedSnapshot {
+			shared = append(shared, entity)
+		}
+	}
+
+	if len(public) > 0 {
+		fmt.Fprintf(w, "Security findings: public snapshots (%d):\n", len(public))
+		for _, entity := range public {
+			fmt.Fprintf(w, "Snapshot ID: %s, Region: %s, Source Volume: %s, Storage Used: %s\n",
+				entity.ID, entity.Region, entity.SourceVolume, formatBytes(entity.StorageUsed))
+		}
+	}
+
+	if len(shared) > 0 {
+		fmt.Fprintf(w, "Snapshots shared with the account (%d):\n", len(shared))
+		for _, entity := range shared {
+			fmt.Fprintf(w, "Snapshot ID: %s, Region: %s, Owner: %s, Volume Size: %s\n",
+				entity.ID, entity.Region, entity.SnapshotOwner, formatBytes(entity.AllocatedStorage))
+		}
+	}
+}
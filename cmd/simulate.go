@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var simulateOptions = struct {
+	Retention collector.RetentionPolicy
+	PlanFile  string
+}{}
+
+// retentionPolicy is the policy of a simulate retention plan.
+type retentionPolicy struct {
+	KeepDaily   int `json:"keep_daily"`
+	KeepWeekly  int `json:"keep_weekly"`
+	KeepMonthly int `json:"keep_monthly"`
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Preview the effect of policies on the scanned storage",
+}
+
+var simulateRetentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Apply a snapshot retention policy to every volume and show what it would delete",
+	Long: `Groups the snapshots by source volume and applies the retention policy
+to each set: the newest snapshot of each of the last --keep-daily days,
+--keep-weekly weeks and --keep-monthly months is kept, as are pending
+snapshots and snapshots backing an AMI. Every other snapshot is listed with
+the storage and estimated monthly cost deleting it would reclaim. Nothing is
+deleted.
+
+With --plan-file the deletions are written as a JSON plan that
+cleanup --plan executes later.
+
+Snapshots are incremental, so without --accurate-snapshot-size the savings
+count the full size of every deleted snapshot and are an upper bound.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceSnapshots}
+		opts.EstimateCost = true
+
+		c := collector.New(opts)
+		report, err := c.Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		policy := simulateOptions.Retention
+		chains := collector.SnapshotChains(report.Entities, policy, c.AMISnapshotIDs(context.Background()))
+		writeRetentionSimulation(os.Stdout, chains)
+
+		if simulateOptions.PlanFile == "" {
+			return nil
+		}
+		return writePlan(simulateOptions.PlanFile, retentionPlan(chains, policy, time.Now()))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.AddCommand(simulateRetentionCmd)
+
+	flags := simulateRetentionCmd.Flags()
+	flags.IntVar(&simulateOptions.Retention.Daily, "keep-daily", 7, "keep the newest snapshot of each of this many days")
+	flags.IntVar(&simulateOptions.Retention.Weekly, "keep-weekly", 4, "keep the newest snapshot of each of this many weeks")
+	flags.IntVar(&simulateOptions.Retention.Monthly, "keep-monthly", 12, "keep the newest snapshot of each of this many months")
+	flags.StringVar(&simulateOptions.PlanFile, "plan-file", "", "write the deletions as a JSON plan for cleanup --plan")
+}
+
+// writeRetentionSimulation prints the snapshots the policy would delete,
+// volume by volume, and what deleting them would reclaim.
+func writeRetentionSimulation(w io.Writer, chains []collector.SnapshotChain) {
+	var volumes, deleted int
+	var bytes int64
+	var cost float64
+
+	for _, chain := range chains {
+		pruned := chain.Prunable()
+		if len(pruned) == 0 {
+			continue
+		}
+		volumes++
+		deleted += len(pruned)
+
+		var chainBytes int64
+		var chainCost float64
+		for _, snapshot := range pruned {
+			chainBytes += snapshot.StorageUsed
+			chainCost += snapshot.MonthlyCostUSD
+		}
+		bytes += chainBytes
+		cost += chainCost
+
+		volume := chain.Volume
+		if chain.VolumeDeleted {
+			volume += " (deleted)"
+		}
+		fmt.Fprintf(w, "Volume: %s, Region: %s, Snapshots: %d, Kept: %d, Deleted: %d, Reclaimable Storage: %s, Reclaimable Monthly Cost: $%.2f\n",
+			volume, chain.Region, len(chain.Snapshots), len(chain.Snapshots)-len(pruned), len(pruned), formatBytes(chainBytes), chainCost)
+		for _, snapshot := range pruned {
+			fmt.Fprintf(w, "  Delete Snapshot: %s, Started: %s, Size: %s, Monthly Cost: $%.2f\n",
+				snapshot.ID, snapshot.StartTime.UTC().Format("2006-01-02 15:04"), formatBytes(snapshot.StorageUsed), snapshot.MonthlyCostUSD)
+		}
+	}
+
+	fmt.Fprintf(w, "Volumes: %d, Affected: %d, Snapshots Deleted: %d, Reclaimable Storage: %s, Reclaimable Monthly Cost: $%.2f\n",
+		len(chains), volumes, deleted, formatBytes(bytes), cost)
+}
+
+// retentionPlan returns the deletions of the policy as a plan.
+func retentionPlan(chains []collector.SnapshotChain, policy collector.RetentionPolicy, now time.Time) actionPlan {
+	plan := newPlan("simulate retention", now)
+	plan.Policy = &retentionPolicy{
+		KeepDaily:   policy.Daily,
+		KeepWeekly:  policy.Weekly,
+		KeepMonthly: policy.Monthly,
+	}
+	for _, chain := range chains {
+		for _, snapshot := range chain.Prunable() {
+			plan.Actions = append(plan.Actions, planAction{
+				Action:         ActionDeleteSnapshot,
+				ResourceID:     snapshot.ID,
+				Type:           snapshot.Type,
+				Region:         snapshot.Region,
+				SourceVolume:   snapshot.SourceVolume,
+				StartTime:      snapshot.StartTime.UTC(),
+				StorageUsed:    snapshot.StorageUsed,
+				MonthlyCostUSD: snapshot.MonthlyCostUSD,
+				Tags:           snapshot.Tags,
+			})
+		}
+	}
+	return plan
+}
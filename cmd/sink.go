@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/taylormonacelli/crankymosquitos/pkg/sink"
+)
+
+func init() {
+	sink.Register("s3", openS3Sink)
+}
+
+// s3Sink writes the report to an S3 object, s3://bucket/key, in the region
+// of the bucket.
+type s3Sink struct {
+	bucket string
+	key    string
+}
+
+func openS3Sink(u *url.URL) (sink.ReportSink, error) {
+	bucket, key, err := parseS3URL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if key == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, fmt.Errorf("invalid S3 URL %q: expected s3://bucket/key", u)
+	}
+	return s3Sink{bucket: bucket, key: key}, nil
+}
+
+func (s s3Sink) Write(ctx context.Context, report []byte) error {
+	client, err := s3ClientForBucket(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Body:   bytes.NewReader(report),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s, err)
+	}
+	return nil
+}
+
+func (s s3Sink) String() string {
+	return "s3://" + s.bucket + "/" + s.key
+}
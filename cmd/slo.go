@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	teamTag  string
+	sloMonth string
+)
+
+var backupSLOCmd = &cobra.Command{
+	Use:   "backup-slo",
+	Short: "Report the backup SLA compliance per team from the scans in --history-db",
+	Long: `Computes, for every volume under a backup SLA, the share of --month it
+met its SLA across the scans recorded in --history-db. Each scan's result
+holds until the next scan, so compliance is weighted by time rather than by
+the number of scans. Volumes are grouped by the --team-tag they carried
+when scanned.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if historyDB == "" {
+			return errors.New("backup-slo requires --history-db")
+		}
+
+		start, err := parseMonth(sloMonth, time.Now())
+		if err != nil {
+			return err
+		}
+
+		db, _, closeHistory, err := openHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closeHistory(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		end := start.AddDate(0, 1, 0)
+		if now := time.Now().UTC(); now.Before(end) {
+			end = now
+		}
+
+		slos, err := backupSLOs(db, start, end)
+		if err != nil {
+			return err
+		}
+
+		writeBackupSLOs(os.Stdout, start, slos)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&teamTag, "team-tag", "Team", "volume tag naming the team a volume's backup SLA is reported under")
+
+	rootCmd.AddCommand(backupSLOCmd)
+	backupSLOCmd.Flags().StringVar(&sloMonth, "month", "", "month to report, as YYYY-MM (default the current month)")
+}
+
+// parseMonth returns the start of a YYYY-MM month in UTC, or of the month of
+// now when month is empty.
+func parseMonth(month string, now time.Time) (time.Time, error) {
+	if month == "" {
+		now = now.UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q: must be YYYY-MM", month)
+	}
+	return start, nil
+}
+
+// volumeSLO is how long a volume met its backup SLA during a period.
+type volumeSLO struct {
+	ID       string
+	Region   string
+	SLA      string
+	Team     string
+	Observed time.Duration // Time covered by scans that checked the volume
+	Met      time.Duration
+}
+
+// Compliance returns the percentage of the observed time the SLA was met.
+func (v volumeSLO) Compliance() float64 {
+	if v.Observed <= 0 {
+		return 0
+	}
+	return 100 * float64(v.Met) / float64(v.Observed)
+}
+
+// backupCheck is a backup_checks row with the time of its scan.
+type backupCheck struct {
+	ScanID    int64
+	ScannedAt time.Time
+	ID        string
+	Region    string
+	SLA       string
+	Team      string
+	Met       bool
+}
+
+// backupSLOs returns the backup SLA compliance of every volume checked
+// between start and end, including by the last scan before start.
+func backupSLOs(db *sql.DB, start, end time.Time) ([]volumeSLO, error) {
+	rows, err := db.Query(`
+SELECT s.id, s.scanned_at, c.id, c.region, c.sla, c.team, c.met
+FROM scans s JOIN backup_checks c ON c.scan_id = s.id
+WHERE s.scanned_at < ? AND s.scanned_at >= COALESCE(
+	(SELECT MAX(scanned_at) FROM scans WHERE scanned_at <= ?), '')
+ORDER BY s.scanned_at, s.id`, historyTime(end), historyTime(start))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup checks: %w", err)
+	}
+	defer rows.Close()
+
+	var checks []backupCheck
+	for rows.Next() {
+		var check backupCheck
+		var scannedAt string
+		err := rows.Scan(&check.ScanID, &scannedAt, &check.ID, &check.Region, &check.SLA, &check.Team, &check.Met)
+		if err != nil {
+			return nil, err
+		}
+		if check.ScannedAt, err = time.Parse(time.RFC3339, scannedAt); err != nil {
+			return nil, fmt.Errorf("invalid scan time %q: %w", scannedAt, err)
+		}
+		checks = append(checks, check)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Every scan's result lasts until the next scan, or the end of the
+	// period for the last one.
+	var scanTimes []time.Time
+	for i, check := range checks {
+		if i == 0 || check.ScanID != checks[i-1].ScanID {
+			scanTimes = append(scanTimes, check.ScannedAt)
+		}
+	}
+	until := func(scannedAt time.Time) time.Time {
+		i := sort.Search(len(scanTimes), func(i int) bool { return scanTimes[i].After(scannedAt) })
+		if i < len(scanTimes) {
+			return scanTimes[i]
+		}
+		return end
+	}
+
+	byVolume := map[string]*volumeSLO{}
+	var keys []string
+	for _, check := range checks {
+		from, to := check.ScannedAt, until(check.ScannedAt)
+		if from.Before(start) {
+			from = start
+		}
+		if !to.After(from) {
+			continue
+		}
+
+		key := check.Region + "/" + check.ID
+		slo, ok := byVolume[key]
+		if !ok {
+			slo = &volumeSLO{ID: check.ID, Region: check.Region}
+			byVolume[key] = slo
+			keys = append(keys, key)
+		}
+		// The latest scan decides the SLA and team a volume is listed under.
+		slo.SLA, slo.Team = check.SLA, check.Team
+		slo.Observed += to.Sub(from)
+		if check.Met {
+			slo.Met += to.Sub(from)
+		}
+	}
+
+	slos := make([]volumeSLO, 0, len(keys))
+	for _, key := range keys {
+		slos = append(slos, *byVolume[key])
+	}
+	sort.Slice(slos, func(i, j int) bool {
+		if slos[i].Team != slos[j].Team {
+			return slos[i].Team < slos[j].Team
+		}
+		if slos[i].Compliance() != slos[j].Compliance() {
+			return slos[i].Compliance() < slos[j].Compliance()
+		}
+		return slos[i].ID < slos[j].ID
+	})
+
+	return slos, nil
+}
+
+// writeBackupSLOs prints the volumes of every team, least compliant first,
+// followed by the team's compliance over all its volumes.
+func writeBackupSLOs(w io.Writer, month time.Time, slos []volumeSLO) {
+	fmt.Fprintf(w, "Backup SLO report for %s\n", month.Format("2006-01"))
+	if len(slos) == 0 {
+		fmt.Fprintln(w, "No volumes under a backup SLA were scanned")
+		return
+	}
+
+	for i := 0; i < len(slos); {
+		team := slos[i].Team
+		var observed, met time.Duration
+
+		label := team
+		if label == "" {
+			label = "(untagged)"
+		}
+		fmt.Fprintf(w, "\nTeam: %s\n", label)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VOLUME\tREGION\tSLA\tOBSERVED (HOURS)\tCOMPLIANCE")
+		for ; i < len(slos) && slos[i].Team == team; i++ {
+			slo := slos[i]
+			observed += slo.Observed
+			met += slo.Met
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f\t%.2f%%\n",
+				slo.ID, slo.Region, slo.SLA, slo.Observed.Hours(), slo.Compliance())
+		}
+		tw.Flush()
+
+		fmt.Fprintf(w, "Team Compliance: %.2f%%\n", volumeSLO{Observed: observed, Met: met}.Compliance())
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	snapshotCreatedAfter  string
+	snapshotCreatedBefore string
+	snapshotStorageTier   string
+
+	accurateSnapshotSize    bool
+	snapshotSizeConcurrency int
+
+	snapshotFilter collector.SnapshotFilter
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&snapshotCreatedAfter, "created-after", "", "only include snapshots started at or after this time (RFC3339 or YYYY-MM-DD)")
+	rootCmd.PersistentFlags().StringVar(&snapshotCreatedBefore, "created-before", "", "only include snapshots started before this time (RFC3339 or YYYY-MM-DD)")
+	rootCmd.PersistentFlags().StringVar(&snapshotStorageTier, "storage-tier", "", "only include snapshots in this storage tier (standard or archive)")
+	rootCmd.PersistentFlags().BoolVar(&accurateSnapshotSize, "accurate-snapshot-size", false, "measure the changed blocks of each snapshot with the EBS direct APIs instead of using its volume size")
+	rootCmd.PersistentFlags().IntVar(&snapshotSizeConcurrency, "snapshot-size-concurrency", collector.DefaultSnapshotSizeConcurrency, "concurrent EBS direct API calls with --accurate-snapshot-size")
+}
+
+func parseWindowTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// initSnapshotFilters validates the snapshot filter flags.
+func initSnapshotFilters() error {
+	switch snapshotStorageTier {
+	case "", "standard", "archive":
+	default:
+		return fmt.Errorf("invalid --storage-tier %q: must be standard or archive", snapshotStorageTier)
+	}
+	if err := validateSnapshotOwners(); err != nil {
+		return err
+	}
+
+	filter, err := getSnapshotFilter()
+	if err != nil {
+		return err
+	}
+	snapshotFilter = filter
+
+	return nil
+}
+
+func getSnapshotFilter() (collector.SnapshotFilter, error) {
+	filter := collector.SnapshotFilter{StorageTier: snapshotStorageTier}
+	var err error
+
+	if snapshotCreatedAfter != "" {
+		if filter.After, err = parseWindowTime(snapshotCreatedAfter); err != nil {
+			return filter, fmt.Errorf("invalid --created-after: %w", err)
+		}
+	}
+	if snapshotCreatedBefore != "" {
+		if filter.Before, err = parseWindowTime(snapshotCreatedBefore); err != nil {
+			return filter, fmt.Errorf("invalid --created-before: %w", err)
+		}
+	}
+	if !filter.After.IsZero() && !filter.Before.IsZero() && !filter.After.Before(filter.Before) {
+		return filter, fmt.Errorf("--created-after must be earlier than --created-before")
+	}
+
+	return filter, nil
+}
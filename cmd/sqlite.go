@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteFormat writes the report as a SQLite database to --output-file.
+const sqliteFormat = "sqlite"
+
+const sqliteSchema = `
+CREATE TABLE scan (
+	generated_at       TEXT    NOT NULL,
+	regions            TEXT    NOT NULL,
+	entity_count       INTEGER NOT NULL,
+	total_storage_used INTEGER NOT NULL,
+	cost_estimated     INTEGER NOT NULL,
+	group_by_tag       TEXT
+);
+
+CREATE TABLE region_summaries (
+	region           TEXT    NOT NULL PRIMARY KEY,
+	entities         INTEGER NOT NULL,
+	storage_used     INTEGER NOT NULL,
+	duration_seconds REAL    NOT NULL
+);
+
+CREATE TABLE entities (
+	id                  TEXT    NOT NULL,
+	region              TEXT    NOT NULL,
+	type                TEXT    NOT NULL,
+	storage_used        INTEGER NOT NULL,
+	allocated_storage   INTEGER,
+	attached_instance   TEXT,
+	volume_type         TEXT,
+	iops                INTEGER,
+	throughput          INTEGER,
+	encrypted           INTEGER,
+	multi_attach        INTEGER,
+	engine              TEXT,
+	file_system_type    TEXT,
+	object_count        INTEGER,
+	source_volume       TEXT,
+	volume_exists       INTEGER,
+	description         TEXT,
+	state               TEXT,
+	start_time          TEXT,
+	create_time         TEXT,
+	backup_age_hours    REAL,
+	backup_sla_violated INTEGER,
+	access_class        TEXT,
+	recommendation      TEXT,
+	link                TEXT,
+	profile             TEXT,
+	account_id          TEXT,
+	stack               TEXT,
+	owner               TEXT,
+	pending_operation   TEXT,
+	pending_progress    REAL,
+	PRIMARY KEY (id, region)
+);
+CREATE INDEX entities_type ON entities (type);
+CREATE INDEX entities_region ON entities (region);
+CREATE INDEX entities_storage_used ON entities (storage_used);
+
+CREATE TABLE tags (
+	entity_id TEXT NOT NULL,
+	region    TEXT NOT NULL,
+	key       TEXT NOT NULL,
+	value     TEXT NOT NULL,
+	PRIMARY KEY (entity_id, region, key),
+	FOREIGN KEY (entity_id, region) REFERENCES entities (id, region)
+);
+CREATE INDEX tags_key_value ON tags (key, value);
+
+CREATE TABLE costs (
+	entity_id        TEXT NOT NULL,
+	region           TEXT NOT NULL,
+	price_type       TEXT NOT NULL,
+	monthly_cost_usd REAL NOT NULL,
+	PRIMARY KEY (entity_id, region),
+	FOREIGN KEY (entity_id, region) REFERENCES entities (id, region)
+);
+CREATE INDEX costs_monthly_cost_usd ON costs (monthly_cost_usd);
+`
+
+// writeSQLite writes the report to a new SQLite database at path, replacing
+// any existing file.
+func writeSQLite(path string, report *collector.Report) error {
+	if skipDryRun("write %d entities to %s", len(report.Entities), path) {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	if err := insertScan(tx, report); err != nil {
+		return err
+	}
+	for _, entity := range report.Entities {
+		if err := insertEntity(tx, report, entity); err != nil {
+			return fmt.Errorf("failed to insert %s %s: %w", entity.Type, entity.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertScan(tx *sql.Tx, report *collector.Report) error {
+	var regions []string
+	for _, summary := range report.Regions {
+		regions = append(regions, summary.Region)
+
+		_, err := tx.Exec(`INSERT INTO region_summaries VALUES (?, ?, ?, ?)`,
+			summary.Region, summary.Entities, summary.StorageUsed, summary.Duration.Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to insert region summary: %w", err)
+		}
+	}
+
+	_, err := tx.Exec(`INSERT INTO scan VALUES (?, ?, ?, ?, ?, ?)`,
+		report.GeneratedAt.UTC().Format(time.RFC3339), strings.Join(regions, ","), len(report.Entities),
+		report.TotalStorageUsed, report.CostEstimated, nullString(report.GroupByTag))
+	if err != nil {
+		return fmt.Errorf("failed to insert scan metadata: %w", err)
+	}
+
+	return nil
+}
+
+func insertEntity(tx *sql.Tx, report *collector.Report, entity collector.EntityUsage) error {
+	var allocated, objectCount sql.NullInt64
+	switch entity.Type {
+	case collector.EntityTypeBucket, collector.EntityTypeDynamoDBTable:
+		objectCount = sql.NullInt64{Int64: entity.ObjectCount, Valid: true}
+	case collector.EntityTypeDBInstance, collector.EntityTypeDBCluster, collector.EntityTypeFSx, collector.EntityTypeRedshiftCluster:
+		allocated = sql.NullInt64{Int64: entity.AllocatedStorage, Valid: true}
+	}
+
+	var backupAge sql.NullFloat64
+	var backupViolated sql.NullBool
+	if entity.BackupAgeHours != nil {
+		backupAge = sql.NullFloat64{Float64: *entity.BackupAgeHours, Valid: true}
+		backupViolated = sql.NullBool{Bool: entity.BackupSLAViolated(), Valid: true}
+	}
+
+	var iops, throughput sql.NullInt64
+	var encrypted, multiAttach sql.NullBool
+	switch entity.Type {
+	case collector.EntityTypeVolume:
+		iops = sql.NullInt64{Int64: int64(entity.IOPS), Valid: entity.IOPS > 0}
+		throughput = sql.NullInt64{Int64: int64(entity.Throughput), Valid: entity.Throughput > 0}
+		encrypted = sql.NullBool{Bool: entity.Encrypted, Valid: true}
+		multiAttach = sql.NullBool{Bool: entity.MultiAttach, Valid: true}
+	case collector.EntityTypeSnapshot:
+		encrypted = sql.NullBool{Bool: entity.Encrypted, Valid: true}
+	}
+
+	var volumeExists sql.NullBool
+	if entity.VolumeExists != nil {
+		volumeExists = sql.NullBool{Bool: *entity.VolumeExists, Valid: true}
+	}
+
+	var pendingProgress sql.NullFloat64
+	if entity.PendingOperation() != "" {
+		pendingProgress = sql.NullFloat64{Float64: entity.PendingProgress(), Valid: true}
+	}
+
+	_, err := tx.Exec(`INSERT INTO entities VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entity.ID, entity.Region, entity.Type, entity.StorageUsed, allocated,
+		nullString(entity.AttachedInstance), nullString(entity.VolumeType), iops, throughput, encrypted, multiAttach, nullString(entity.Engine), nullString(entity.FileSystemType), objectCount,
+		nullString(entity.SourceVolume), volumeExists, nullString(entity.Description), nullString(entity.State), nullTime(entity.StartTime), nullTime(entity.CreateTime),
+		backupAge, backupViolated, nullString(entity.AccessClass), nullString(entity.Recommendation),
+		nullString(consoleLink(entity)), nullString(entity.Profile), nullString(entity.AccountID), nullString(entity.Stack), nullString(entity.Owner),
+		nullString(entity.PendingOperation()), pendingProgress)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range entity.Tags {
+		if _, err := tx.Exec(`INSERT INTO tags VALUES (?, ?, ?, ?)`, entity.ID, entity.Region, key, value); err != nil {
+			return err
+		}
+	}
+
+	if kind := collector.PriceKind(entity); report.CostEstimated && kind != "" {
+		_, err := tx.Exec(`INSERT INTO costs VALUES (?, ?, ?, ?)`, entity.ID, entity.Region, kind, entity.MonthlyCostUSD)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339), Valid: true}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// stateDir holds the caches, the tag groups file and the cleanup audit log
+// whose own flags are not set, see initStateDir.
+var stateDir string
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&stateDir, "state-dir", "", "directory the caches, tag groups file and cleanup audit log are written to (default: crankymosquitos in the user cache directory)")
+	flags.StringVar(&pricingCacheFile, "pricing-cache-file", "", "file the prices of --pricing api are cached in (default: pricing.json in --state-dir)")
+	flags.StringVar(&snapshotSizeCacheFile, "snapshot-size-cache-file", "", "file the measured snapshot sizes are cached in (default: snapshot-sizes.json in --state-dir)")
+	flags.StringVar(&nameCacheFile, "name-cache-file", "", "file the instance and volume names are cached in (default: names.json in --state-dir)")
+	flags.StringVar(&groupsOutputFile, "groups-file", "", "file the tag groups of --group-by-tag are written to (default: storage-groups.json in --state-dir)")
+}
+
+// defaultStateDir is crankymosquitos in the user's cache directory, or the
+// working directory when there is none.
+func defaultStateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "crankymosquitos")
+}
+
+// initStateDir places every state file left unset in --state-dir. The
+// directories are created when the files are first written.
+func initStateDir() {
+	if stateDir == "" {
+		stateDir = defaultStateDir()
+	}
+	for path, name := range map[*string]string{
+		&regionsCacheFile:        "regions.json",
+		&pricingCacheFile:        "pricing.json",
+		&snapshotSizeCacheFile:   "snapshot-sizes.json",
+		&nameCacheFile:           "names.json",
+		&groupsOutputFile:        "storage-groups.json",
+		&cleanupOptions.AuditLog: "cleanup-audit.jsonl",
+	} {
+		if *path == "" {
+			*path = filepath.Join(stateDir, name)
+		}
+	}
+}
+
+// createParentDir creates the directory a file is written to.
+func createParentDir(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0o700)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var statsDOptions = struct {
+	Address string
+	Tags    []string
+}{}
+
+func init() {
+	addStatsDFlags(rootCmd)
+	addStatsDFlags(storageS3Cmd)
+}
+
+func addStatsDFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&statsDOptions.Address, "statsd-address", "", "also send the storage gauges to this DogStatsD agent after the scan (e.g. localhost:8125)")
+	flags.StringSliceVar(&statsDOptions.Tags, "statsd-tags", nil, "tags added to every statsd gauge (e.g. env:prod)")
+}
+
+// sendStatsD sends the report to --statsd-address when it is set.
+func sendStatsD(report *collector.Report) error {
+	if statsDOptions.Address == "" {
+		return nil
+	}
+
+	if skipDryRun("send metrics to statsd at %s", statsDOptions.Address) {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	account := "" // Entities carry their account with --profiles and --assume-roles
+	if !multiAccount() && len(replayFiles) == 0 {
+		var err error
+		if account, err = callerAccount(ctx); err != nil {
+			slog.Warn("sending statsd gauges without account tags", "error", err)
+		}
+	}
+
+	opts := collector.StatsDOptions{Address: statsDOptions.Address, Tags: statsDOptions.Tags, AccountID: account}
+	if err := collector.SendStatsD(ctx, opts, report); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summaryOut, "Sent metrics to statsd at %s\n", statsDOptions.Address)
+	return nil
+}
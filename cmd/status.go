@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+// scanStatus tracks the progress of the running scan for /status and holds
+// the finished report for /report, /healthz and /readyz.
+type scanStatus struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	done      bool
+	scans     int // Scans finished since the server started
+	regions   []collector.RegionSummary
+	jobsDone  int
+	jobsTotal int
+	report    *collector.Report
+	rows      []output.Row // Rows of report, built once by finish
+}
+
+// regionStatus is one region of the /status response.
+type regionStatus struct {
+	Region          string  `json:"region"`
+	Entities        int     `json:"entities"`
+	StorageUsed     int64   `json:"storage_used"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type statusResponse struct {
+	StartedAt time.Time      `json:"started_at"`
+	Done      bool           `json:"done"`
+	Regions   []regionStatus `json:"regions"`
+	JobsDone  int            `json:"jobs_done"`
+	JobsTotal int            `json:"jobs_total"`
+
+	GeneratedAt         *time.Time `json:"generated_at,omitempty"`
+	InventoryAgeSeconds *float64   `json:"inventory_age_seconds,omitempty"`
+}
+
+// reportResponse is the /report response: the report rows together with
+// when they were collected.
+type reportResponse struct {
+	GeneratedAt         time.Time    `json:"generated_at"`
+	InventoryAgeSeconds float64      `json:"inventory_age_seconds"`
+	TotalStorageUsed    int64        `json:"total_storage_used"`
+	Entities            []output.Row `json:"entities"`
+}
+
+// healthResponse is the /healthz and /readyz response.
+type healthResponse struct {
+	Ready              bool             `json:"ready"`
+	ScansCompleted     int              `json:"scans_completed"`
+	LastScanAt         *time.Time       `json:"last_scan_at,omitempty"`
+	LastScanAgeSeconds *float64         `json:"last_scan_age_seconds,omitempty"`
+	RegionErrors       map[string]int64 `json:"region_errors"`
+}
+
+func newScanStatus() *scanStatus {
+	return &scanStatus{startedAt: time.Now()}
+}
+
+// printRegionSummary prints a summary line for a region as it completes.
+func printRegionSummary(summary collector.RegionSummary) {
+	fmt.Fprintf(summaryOut, "Region Complete: %s, Entities: %d, Storage Used: %s, Duration: %s\n",
+		summary.Region, summary.Entities, formatBytes(summary.StorageUsed), summary.Duration.Round(time.Millisecond))
+}
+
+// failedRegion is one entry of the failed_regions of a JSON report.
+type failedRegion struct {
+	Region          string  `json:"region"`
+	AccountID       string  `json:"account_id,omitempty"`
+	Profile         string  `json:"profile,omitempty"`
+	Reason          string  `json:"reason"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// failedRegions converts the failed regions of a report for JSON output.
+func failedRegions(report *collector.Report) []failedRegion {
+	var failed []failedRegion
+	for _, region := range report.FailedRegions {
+		failed = append(failed, failedRegion{
+			Region:          region.Region,
+			AccountID:       region.AccountID,
+			Profile:         region.Profile,
+			Reason:          region.Reason,
+			DurationSeconds: region.Duration.Seconds(),
+		})
+	}
+	return failed
+}
+
+// printFailedRegions prints the regions left out of the report.
+func printFailedRegions(w io.Writer, failed []collector.FailedRegion) {
+	fmt.Fprintf(w, "Failed regions (%d):\n", len(failed))
+	for _, region := range failed {
+		line := "Region: " + region.Region
+		if region.AccountID != "" {
+			line += ", Account: " + region.AccountID
+		}
+		if region.Profile != "" {
+			line += ", Profile: " + region.Profile
+		}
+		fmt.Fprintf(w, "%s, Reason: %s\n", line, region.Reason)
+	}
+}
+
+// regionComplete prints a finished region's summary and records it.
+func (s *scanStatus) regionComplete(summary collector.RegionSummary) {
+	printRegionSummary(summary)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regions = append(s.regions, summary)
+}
+
+// jobComplete records the progress of the scan.
+func (s *scanStatus) jobComplete(summary collector.JobSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobsDone = max(s.jobsDone, summary.Done)
+	s.jobsTotal = summary.Total
+}
+
+// finish marks the scan done and publishes its report.
+func (s *scanStatus) finish(report *collector.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.scans++
+	s.report = report
+	if streamOutput {
+		sortReportEntities(report.Entities) // Rows are built per request
+	} else {
+		s.rows = reportRows(report)
+	}
+}
+
+// restart marks a new scan started. The previous report stays on /report
+// until the new scan finishes.
+func (s *scanStatus) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startedAt = time.Now()
+	s.done = false
+	s.regions = nil
+	s.jobsDone, s.jobsTotal = 0, 0
+}
+
+// ServeHTTP serves /status. A scoped API key gets the region totals of its
+// own entities in the latest report instead of those of the running scan.
+func (s *scanStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	response := statusResponse{
+		StartedAt: s.startedAt,
+		Done:      s.done,
+		Regions:   []regionStatus{},
+		JobsDone:  s.jobsDone,
+		JobsTotal: s.jobsTotal,
+	}
+	regions := s.regions
+	if key := requestKey(r); key != nil {
+		regions = nil
+		if s.report != nil {
+			regions = key.scope(s.report).Regions
+		}
+	}
+	for _, summary := range regions {
+		response.Regions = append(response.Regions, regionStatus{
+			Region:          summary.Region,
+			Entities:        summary.Entities,
+			StorageUsed:     summary.StorageUsed,
+			DurationSeconds: summary.Duration.Seconds(),
+		})
+	}
+	if s.report != nil {
+		generatedAt := s.report.GeneratedAt
+		age := time.Since(generatedAt).Seconds()
+		response.GeneratedAt = &generatedAt
+		response.InventoryAgeSeconds = &age
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveReport serves the finished report, or 503 while the scan runs. A
+// scoped API key only gets its own entities.
+func (s *scanStatus) serveReport(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	report, rows := s.report, s.rows
+	s.mu.Unlock()
+
+	if report == nil {
+		http.Error(w, "scan in progress", http.StatusServiceUnavailable)
+		return
+	}
+	if key := requestKey(r); key != nil {
+		report = key.scope(report)
+		if !streamOutput {
+			rows = reportRows(report)
+		}
+	}
+
+	response := reportResponse{
+		GeneratedAt:         report.GeneratedAt,
+		InventoryAgeSeconds: time.Since(report.GeneratedAt).Seconds(),
+		TotalStorageUsed:    report.TotalStorageUsed,
+		Entities:            rows,
+	}
+	if streamOutput {
+		streamJSONResponse(w, struct {
+			reportResponse
+			Entities *[]output.Row `json:"entities,omitempty"`
+		}{reportResponse: response}, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// health reports whether a scan has finished, how old its report is and the
+// errors of each region in it.
+func (s *scanStatus) health() healthResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response := healthResponse{ScansCompleted: s.scans, RegionErrors: map[string]int64{}}
+	if s.report != nil {
+		generatedAt := s.report.GeneratedAt
+		age := time.Since(generatedAt).Seconds()
+		response.Ready = true
+		response.LastScanAt = &generatedAt
+		response.LastScanAgeSeconds = &age
+		for region, count := range s.report.RegionErrors {
+			response.RegionErrors[region] = count
+		}
+	}
+	return response
+}
+
+// serveHealth answers liveness probes: the server is up, even while the
+// first scan runs.
+func (s *scanStatus) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.health(), http.StatusOK)
+}
+
+// serveReadiness answers readiness probes with 503 until the first scan has
+// finished.
+func (s *scanStatus) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	response := s.health()
+	code := http.StatusOK
+	if !response.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, response, code)
+}
+
+func writeHealth(w http.ResponseWriter, response healthResponse, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Debug("failed to write health response", "error", err)
+	}
+}
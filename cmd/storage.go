@@ -2,358 +2,708 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
-	"sort"
+	"log/slog"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-
-	"github.com/taylormonacelli/lemondrop"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
 )
 
-type ByStorageUsedEntity []EntityUsage
-
-func (a ByStorageUsedEntity) Len() int           { return len(a) }
-func (a ByStorageUsedEntity) Less(i, j int) bool { return a[i].StorageUsed > a[j].StorageUsed }
-func (a ByStorageUsedEntity) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type EntityUsage struct {
-	ID               string
-	StorageUsed      int64
-	Region           string
-	IsVolume         bool
-	AttachedInstance string // New field to store the attached EC2 instance ID
-}
-
 var (
-	totalStorageUsed   int64
-	entityMutex        sync.Mutex
-	entities           []EntityUsage
-	concurrentChannels = 100 // Set the default concurrent channel count
-
-	ebsStorageUsed = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "aws_ebs_storage_used",
-			Help: "EBS storage used by volume",
-		},
-		[]string{"volume_id", "region", "attached_instance"}, // Added "attached_instance" label
-	)
-
-	snapshotStorageUsed = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "aws_snapshot_storage_used",
-			Help: "Snapshot storage used by snapshot",
-		},
-		[]string{"snapshot_id", "region", "attached_instance"}, // Added "attached_instance" label
-	)
-
-	totalStorageUsedMetric = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "aws_total_storage_used",
-			Help: "Total storage used by all volumes and snapshots",
-		},
-	)
+	snapshotSizeCacheFile string
+	nameCacheFile         string
 )
 
-func main() {
-	// Register the Prometheus metrics
-	prometheus.MustRegister(ebsStorageUsed)
-	prometheus.MustRegister(snapshotStorageUsed)
-	prometheus.MustRegister(totalStorageUsedMetric)
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Report storage used by individual AWS services",
+}
+
+func init() {
+	rootCmd.AddCommand(storageCmd)
+}
 
-	regions, err := lemondrop.GetAllAwsRegions()
+// runStorage scans every service. With once it writes the report and exits
+// instead of serving the metrics.
+func runStorage(cmd *cobra.Command, once bool) error {
+	formatter, err := initOutput()
 	if err != nil {
-		log.Fatalf("Failed to retrieve AWS regions: %v\n", err)
+		return err
 	}
 
-	var wg sync.WaitGroup
+	return runScan(cmd, formatter, storageOptions, once)
+}
 
-	semaphore := make(chan struct{}, concurrentChannels)
+// storageOptions builds the options of a scan of every service from the
+// flags.
+func storageOptions() (collector.Options, error) {
+	groupByTag, err := parseGroupBy(groupBy)
+	if err != nil {
+		return collector.Options{}, err
+	}
+	if err := validateServices(); err != nil {
+		return collector.Options{}, err
+	}
 
-	// Launch goroutines to query volumes and snapshots concurrently
-	for _, region := range regions {
-		wg.Add(2)
+	regions, err := getScanRegions()
+	if err != nil {
+		return collector.Options{}, fmt.Errorf("failed to retrieve AWS regions: %w", err)
+	}
 
-		go func(region string) {
-			client, err := lemondrop.GetEc2Client(region)
-			if err != nil {
-				log.Printf("Failed to create EC2 client for region %s: %v\n", region, err)
-				wg.Done()
-				return
-			}
+	opts := collectorOptions(regions)
+	if opts.Services, err = shardServices(scanServices); err != nil {
+		return collector.Options{}, err
+	}
+	opts.EstimateCost = estimateCost
+	opts.GroupByTag = groupByTag
+	opts.ClassifyAccess = classifyAccess
+	opts.InstanceDetails = instanceDetails
+
+	if classifyAccess {
+		opts.AccessLookback, err = parseAge(accessLookback)
+		if err != nil {
+			return collector.Options{}, fmt.Errorf("invalid --access-lookback: %w", err)
+		}
+	}
+	if err := findingsOptions(&opts); err != nil {
+		return collector.Options{}, err
+	}
+	if err := validateQuotaOptions(); err != nil {
+		return collector.Options{}, err
+	}
+	opts.Quotas = quotas
+	opts.Owners = ownerOptions.Resolve
+	opts.OwnerTags = ownerOptions.Tags
+	opts.OwnerFromCloudTrail = ownerOptions.CloudTrail
+	opts.AccountOwners = ownerOptions.AccountOwners
 
-			semaphore <- struct{}{} // Acquire a semaphore slot
-			getEBSStorageUsed(client, region, &wg)
-			<-semaphore // Release the semaphore slot
-		}(*region.RegionName)
+	return withCheckpoint(opts)
+}
 
-		go func(region string) {
-			client, err := lemondrop.GetEc2Client(region)
-			if err != nil {
-				log.Printf("Failed to create EC2 client for region %s: %v\n", region, err)
-				wg.Done()
-				return
-			}
+// collectorOptions builds the collector options shared by every scanning
+// command from the global flags.
+func collectorOptions(regions []types.Region) collector.Options {
+	opts := collector.Options{
+		Partition:      partition,
+		S3UsePathStyle: endpointURL != "",
+		Concurrency:    concurrency,
+		JobTimeout:     jobTimeout,
+		RegionTimeout:  regionTimeout,
+		LoadConfig:     awsConfigLoader,
+		NewEC2Client:   newEC2Client,
+		MaxAPIRetries:  maxAPIRetries,
+		APIRateLimit:   apiRateLimit,
+		MaxAPICalls:    maxAPICalls,
+		Scope:          scope,
+		SnapshotFilter: snapshotFilter,
+		TagFilters:     tagFilters,
+		Pricing:        pricingProvider,
+		PriceCacheFile: pricingCacheFile,
+		BackupSLATag:   backupSLATag,
+		StackTags:      stackTags,
+
+		AccurateSnapshotSize:    accurateSnapshotSize,
+		SnapshotSizeConcurrency: snapshotSizeConcurrency,
+		SnapshotSizeCacheFile:   snapshotSizeCacheFile,
+		SharedSnapshots:         sharedSnapshots,
+		SnapshotOwners:          snapshotOwners,
+		IncludeSharedSnapshots:  includeSharedSnapshots,
+		NameCacheFile:           nameCacheFile,
+		NameLookupConcurrency:   nameLookupConcurrency,
+
+		DryRun: dryRun,
+
+		OnRegionComplete: printRegionSummary,
+	}
+	opts.Sealer, _ = atRestSealer() // Validated before the command runs
+	if maxAPIRetries == 0 {
+		opts.MaxAPIRetries = -1 // --max-api-retries 0 disables retries
+	}
+	opts.APIBudgetDegrade = apiBudgetAction == apiBudgetDegrade
+	for _, region := range regions {
+		opts.Regions = append(opts.Regions, *region.RegionName)
+	}
 
-			semaphore <- struct{}{} // Acquire a semaphore slot
-			getSnapshotStorageUsed(client, region, &wg)
-			<-semaphore // Release the semaphore slot
-		}(*region.RegionName)
+	if ttl, err := parseAge(nameCacheTTL); err != nil {
+		slog.Warn("not caching resource names", "error", fmt.Errorf("invalid --name-cache-ttl: %w", err))
+	} else {
+		opts.NameCacheTTL = ttl
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
+	maxAges, err := backupSLAMaxAges()
+	if err != nil {
+		slog.Warn("skipping backup coverage", "error", err)
+	} else {
+		opts.BackupSLA = maxAges
+	}
 
-	// Sort the entities by storage used in descending order
-	entityMutex.Lock()
-	sort.Sort(sort.Reverse(ByStorageUsedEntity(entities)))
-	entityMutex.Unlock()
-	totalStorageUsedMetric.Set(float64(totalStorageUsed))
+	if age, err := parseAge(maxSnapshotAge); err != nil {
+		slog.Warn("skipping snapshot coverage", "error", fmt.Errorf("invalid --max-snapshot-age: %w", err))
+	} else {
+		opts.MaxSnapshotAge = age
+	}
 
-	output := []map[string]interface{}{}
+	return opts
+}
 
-	for _, entity := range entities {
-		entityType := "Volume"
-		entityLink := ""
-		if !entity.IsVolume {
-			entityType = "Snapshot"
-			entityLink = fmt.Sprintf("https://%s.console.aws.amazon.com/ec2/home?region=%s#SnapshotDetails:snapshotId=%s",
-				strings.ToLower(entity.Region), entity.Region, entity.ID)
-		} else if entity.AttachedInstance == "" {
-			entityLink = fmt.Sprintf("https://%s.console.aws.amazon.com/ec2/home?region=%s#VolumeDetails:volumeId=%s",
-				strings.ToLower(entity.Region), entity.Region, entity.ID)
+// runScan scans, writes the report and serves the resulting metrics. The
+// HTTP server starts before the scan so /status can report progress. With
+// once or --pushgateway-url the command exits after one scan without
+// starting a server, pushing the metrics when a URL is given; a budget flag
+// also exits after one scan, with status 2 when a budget is exceeded. While
+// serving, it scans again every --refresh-interval and whenever a change to
+// the config file rebuilds the options or a scrape finds the metrics older
+// than --max-staleness, and sends the lifecycle events between consecutive
+// scans. With --from-file every scan replays the files. It returns when a
+// scan, writing its report or the server fails.
+func runScan(cmd *cobra.Command, formatter output.Formatter, options func() (collector.Options, error), once bool) error {
+	if err := validateFilters(); err != nil {
+		return err
+	}
+	if err := validateBudgets(); err != nil {
+		return err
+	}
+	if err := validateAccounts(); err != nil {
+		return err
+	}
+	var opts collector.Options
+	if len(replayFiles) == 0 {
+		var err error
+		if opts, err = options(); err != nil {
+			return err
 		}
+	}
 
-		attachedInstance := entity.AttachedInstance
-		if attachedInstance == "" {
-			attachedInstance = "Not Attached"
+	if once || pushOptions.URL != "" || budgetsEnabled() {
+		report, err := scan(opts)
+		if err != nil {
+			return err
 		}
+		if err := writeReport(formatter, report); err != nil {
+			return err
+		}
+		if pushOptions.URL != "" {
+			if err := pushMetrics(report); err != nil {
+				return err
+			}
+		}
+		enforceBudgets(report)
+		return nil
+	}
 
-		size := fmt.Sprintf("%.0f", float64(entity.StorageUsed)/(1024*1024*1024)) // Remove "GB" suffix
-
-		output2 := fmt.Sprintf("Storage Used: %s, %s ID: %s, Region: %s, Attached Instance: %s",
-			formatBytes(entity.StorageUsed), entityType, entity.ID, entity.Region, attachedInstance)
-
-		if entityLink != "" {
-			output2 += fmt.Sprintf(", Link: %s", entityLink)
+	if err := validateServerOptions(); err != nil {
+		return err
+	}
+	if err := validateEventOptions(); err != nil {
+		return err
+	}
+	keys, err := loadAPIKeys(serverOptions.APIKeysFile)
+	if err != nil {
+		return err
+	}
+	var accountID string
+	if keys.scopesAccounts() && !multiAccount() && len(replayFiles) == 0 {
+		// Label the entities with the account so keys can be scoped to it
+		if accountID, err = callerAccount(context.Background()); err != nil {
+			return fmt.Errorf("failed to determine the account for --api-keys-file: %w", err)
 		}
-		fmt.Println(output2)
+	}
 
-		output = append(output, map[string]interface{}{
-			"Type":             entityType,
-			"ID":               entity.ID,
-			"StorageUsed":      size,
-			"Region":           entity.Region,
-			"AttachedInstance": attachedInstance,
-			"Link":             entityLink,
-		})
+	rescans := newRescanRequests()
+	metrics := newMetrics()
+	if serverOptions.MaxStaleness != "" {
+		metrics.MaxStaleness, _ = parseAge(serverOptions.MaxStaleness) // Validated above
+		metrics.Refresh = rescans.wait
+	}
+	if err := metrics.Register(prometheus.DefaultRegisterer); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
 	}
 
-	// Convert the output to JSON
-	jsonOutput, err := json.MarshalIndent(output, "", "  ")
+	watcher, err := watchConfig(cmd)
 	if err != nil {
-		log.Fatalf("Failed to convert output to JSON: %v\n", err)
+		return fmt.Errorf("failed to watch config file: %w", err)
 	}
 
-	// Write the JSON to a file
-	err = os.WriteFile("storage.json", jsonOutput, 0o644)
+	status := newScanStatus()
+	serverErr, err := serveMetrics(status, keys)
 	if err != nil {
-		log.Fatalf("Failed to write JSON to file: %v\n", err)
+		return fmt.Errorf("failed to start metrics server: %w", err)
 	}
 
-	totalStorageUsedTB := float64(totalStorageUsed) / (1024 * 1024 * 1024 * 1024)
-	fmt.Printf("Total Storage Used: %.2f TB\n", totalStorageUsedTB)
-	fmt.Printf("Output written to output.json\n")
-	fmt.Printf("Listening for requests on localhost:8080/metrics...\n")
+	for {
+		opts.AccountID = accountID
+		opts.OnRegionComplete = status.regionComplete
+		opts.OnJobComplete = status.jobComplete
 
-	// Start the Prometheus HTTP server
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
+		report, err := scan(opts)
+		if err != nil {
+			return err
+		}
 
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d bytes", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+		metrics.Observe(report)
+		keys.observe(report)
+		if err := writeReport(formatter, report); err != nil {
+			return err
+		}
+		emitLifecycleEvents(report)
+		status.finish(report)
+		rescans.finished()
+
+		var refresh <-chan time.Time
+		if serverOptions.RefreshInterval != "" {
+			interval, err := parseAge(serverOptions.RefreshInterval)
+			if err != nil {
+				slog.Warn("scanning once: invalid --refresh-interval", "error", err)
+			} else if interval > 0 {
+				refresh = time.After(interval)
+			}
+		}
+		for rescan := false; !rescan; {
+			select {
+			case err := <-serverErr:
+				return err
+			case <-refresh:
+				rescan = true
+			case <-rescans.requests:
+				rescan = true
+			case <-watcher.Changes():
+				rescan = reloadOptions(watcher, options, &opts)
+			}
+		}
+		status.restart()
 	}
-	return fmt.Sprintf("%.0f GB", float64(bytes)/float64(div))
 }
 
-func getInstanceName(client *ec2.Client, instanceID string) string {
-	params := &ec2.DescribeInstancesInput{
-		InstanceIds: []string{instanceID},
+// reloadOptions applies a changed config file and rebuilds the scan options
+// from it. It reports false, keeping the current options, when nothing
+// changed or the new config is invalid.
+func reloadOptions(watcher *configWatcher, options func() (collector.Options, error), opts *collector.Options) bool {
+	changed, err := watcher.reload()
+	if err != nil {
+		slog.Warn("ignoring config change", "error", err)
+		return false
+	}
+	if len(changed) == 0 {
+		return false
+	}
+	if err := validateFilters(); err != nil {
+		slog.Warn("ignoring config change", "error", err)
+		return false
+	}
+	if len(replayFiles) > 0 {
+		return true // Replays read no options
 	}
-	resp, err := client.DescribeInstances(context.Background(), params)
+	reloaded, err := options()
 	if err != nil {
-		log.Printf("Failed to describe instances: %v\n", err)
-		return ""
+		slog.Warn("ignoring config change", "error", err)
+		return false
 	}
+	*opts = reloaded
+	return true
+}
 
-	if len(resp.Reservations) == 0 || len(resp.Reservations[0].Instances) == 0 {
-		log.Printf("No instance found with ID: %s\n", instanceID)
-		return ""
+// scan runs the collector, once per account with --profiles, --assume-roles
+// or --org-role and with a progress display with --progress, records the
+// age of the regions cache, compares the report with --history-db and
+// publishes it to CloudWatch, OTLP and statsd when enabled. With --from-file it
+// replays the report instead, touching neither AWS nor CloudWatch.
+func scan(opts collector.Options) (*collector.Report, error) {
+	if len(replayFiles) > 0 {
+		report, err := replayReports(replayFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay report: %w", err)
+		}
+		compareHistory(report)
+		addFindings(report, true)
+		if err := exportOTel(report); err != nil {
+			slog.Error("failed to export metrics over OTLP", "error", err)
+		}
+		if err := sendStatsD(report); err != nil {
+			slog.Error("failed to send metrics to statsd", "error", err)
+		}
+		return report, nil
 	}
 
-	instance := resp.Reservations[0].Instances[0]
-	for _, tag := range instance.Tags {
-		if *tag.Key == "Name" {
-			return *tag.Value
-		}
+	if err := discoverOrgAccounts(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to discover organization accounts: %w", err)
 	}
+	opts, stopProgress := startProgress(opts)
 
-	return ""
-}
+	ctx, stop := checkpointContext(opts)
+	defer stop()
 
-func getVolumeName(client *ec2.Client, volumeID string) string {
-	params := &ec2.DescribeVolumesInput{
-		VolumeIds: []string{volumeID},
+	var report *collector.Report
+	var err error
+	if multiAccount() {
+		report, err = scanAccounts(ctx, opts)
+	} else {
+		report, err = collector.New(opts).Scan(ctx)
+	}
+	stopProgress()
+	if err != nil && opts.Checkpoint != nil {
+		return nil, fmt.Errorf("failed to scan storage: %w; rerun with --resume %s to continue", err, resumeFile)
 	}
-	resp, err := client.DescribeVolumes(context.Background(), params)
 	if err != nil {
-		log.Printf("Failed to describe volumes: %v\n", err)
-		return ""
+		return nil, fmt.Errorf("failed to scan storage: %w", err)
 	}
-
-	if len(resp.Volumes) == 0 {
-		log.Printf("No volume found with ID: %s\n", volumeID)
-		return ""
+	if err := opts.Checkpoint.Remove(); err != nil {
+		slog.Error("failed to remove checkpoint", "file", resumeFile, "error", err)
+	}
+	if regionsCacheAge > 0 {
+		report.SetCacheAge(collector.CacheRegions, regionsCacheAge)
 	}
+	if report.Caller, err = callerIdentity(context.Background()); err != nil {
+		slog.Warn("not recording the caller identity of the scan", "error", err)
+	}
+	logRun(report)
+	correlateKubernetes(report)
+	compareHistory(report)
+	addFindings(report, false)
 
-	volume := resp.Volumes[0]
-	for _, tag := range volume.Tags {
-		if *tag.Key == "Name" {
-			return *tag.Value
-		}
+	if err := publishCloudWatch(report); err != nil {
+		slog.Error("failed to publish metrics to CloudWatch", "error", err)
+	}
+	if err := exportOTel(report); err != nil {
+		slog.Error("failed to export metrics over OTLP", "error", err)
+	}
+	if err := sendStatsD(report); err != nil {
+		slog.Error("failed to send metrics to statsd", "error", err)
 	}
 
-	return ""
+	return report, nil
 }
 
-func getEBSStorageUsed(client *ec2.Client, region string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// logRun logs what the scan covered, for the audit trail.
+func logRun(report *collector.Report) {
+	attrs := []any{
+		"started_at", report.StartedAt.UTC().Format(time.RFC3339),
+		"finished_at", report.GeneratedAt.UTC().Format(time.RFC3339),
+		"duration", report.GeneratedAt.Sub(report.StartedAt).Round(time.Millisecond),
+		"regions_scanned", len(report.RegionsScanned()),
+		"regions_failed", len(report.FailedRegions),
+	}
+	if report.Caller != nil {
+		attrs = append(attrs, "caller_account", report.Caller.Account, "caller_arn", report.Caller.ARN)
+	}
+	var calls int64
+	for _, count := range report.APICalls {
+		calls += count
+	}
+	attrs = append(attrs, "api_calls", calls)
+	if report.APIBudgetReached {
+		attrs = append(attrs, "api_budget_reached", true)
+	}
+	slog.Info("scan complete", attrs...)
+}
 
-	log.Printf("Querying volumes in region: %s\n", region)
-	params := &ec2.DescribeVolumesInput{}
-	resp, err := client.DescribeVolumes(context.Background(), params)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidVolume.NotFound" {
-				// Handle the case when the volume does not exist
-				log.Printf("Invalid volume ID: %s\n", aerr.Message())
-				return
-			}
-		}
+// reportRows converts the entities into report rows in --sort order.
+func reportRows(report *collector.Report) []output.Row {
+	entities := report.Entities
+	sortReportEntities(entities)
 
-		log.Printf("Failed to describe volumes in region %s: %v\n", region, err)
-		return
+	rows := []output.Row{}
+	for _, entity := range entities {
+		rows = append(rows, reportRow(report, entity))
 	}
+	return rows
+}
 
-	var volumes []EntityUsage
-
-	for _, volume := range resp.Volumes {
-		size := int64(*volume.Size) * 1024 * 1024 * 1024 // Convert from GB to bytes
-		totalStorageUsed += size
+// reportRow converts an entity of the report to its report row.
+func reportRow(report *collector.Report, entity collector.EntityUsage) output.Row {
+	entityLink := consoleLink(entity)
 
-		entity := EntityUsage{
-			ID:               *volume.VolumeId,
-			StorageUsed:      size,
-			Region:           region,
-			IsVolume:         true,
-			AttachedInstance: "", // Initialize the attached instance ID as empty
-		}
+	attachedInstance := entity.AttachedInstance
+	if attachedInstance == "" {
+		attachedInstance = "Not Attached"
+	}
 
-		if volume.Attachments != nil && len(volume.Attachments) > 0 {
-			// Volume is attached to an instance
-			entity.AttachedInstance = *volume.Attachments[0].InstanceId
+	size := sizeValue(entity.StorageUsed)
 
-			// Get instance name and replace instance ID with the tag "Name"
-			instanceName := getInstanceName(client, entity.AttachedInstance)
-			if instanceName != "" {
-				entity.AttachedInstance = instanceName
-			}
+	row := output.Row{
+		"Type":             entity.Type,
+		"ID":               entity.ID,
+		"StorageUsed":      size,
+		"Region":           entity.Region,
+		"AttachedInstance": attachedInstance,
+		"Link":             entityLink,
+	}
+	if arn := entityARN(report, entity); arn != "" {
+		row["ARN"] = arn
+	}
+	if entity.Profile != "" {
+		row["Profile"] = entity.Profile
+	}
+	if entity.AccountID != "" {
+		row["AccountID"] = entity.AccountID
+	}
+	if entity.Stack != "" {
+		row["Stack"] = entity.Stack
+	}
+	if entity.Owner != "" {
+		row["Owner"] = entity.Owner
+	}
+	if entity.OwnerSource != "" {
+		row["OwnerSource"] = entity.OwnerSource
+	}
+	switch entity.Type {
+	case collector.EntityTypeBucket, collector.EntityTypeDynamoDBTable:
+		row["ObjectCount"] = entity.ObjectCount
+	case collector.EntityTypeDBInstance, collector.EntityTypeDBCluster, collector.EntityTypeRedshiftCluster:
+		row["Engine"] = entity.Engine
+		row["AllocatedStorage"] = sizeValue(entity.AllocatedStorage)
+	case collector.EntityTypeElastiCacheSnapshot:
+		row["Engine"] = entity.Engine
+	case collector.EntityTypeFSx:
+		row["FileSystemType"] = entity.FileSystemType
+		row["AllocatedStorage"] = sizeValue(entity.AllocatedStorage)
+	case collector.EntityTypeRecoveryPoint:
+		row["BackupVault"] = entity.BackupVault
+		row["ResourceType"] = entity.ResourceType
+	case collector.EntityTypeSharedSnapshot:
+		row["SnapshotOwner"] = entity.SnapshotOwner
+		row["AllocatedStorage"] = sizeValue(entity.AllocatedStorage)
+	case collector.EntityTypeSnapshot:
+		if entity.SnapshotOwner != "" {
+			row["SnapshotOwner"] = entity.SnapshotOwner
+		}
+	}
+	if entity.Type == collector.EntityTypeSnapshot || entity.Type == collector.EntityTypeSharedSnapshot {
+		row["SourceVolume"] = entity.SourceVolume
+		if entity.VolumeExists != nil {
+			row["VolumeExists"] = *entity.VolumeExists
+		}
+		if !entity.StartTime.IsZero() {
+			row["StartTime"] = entity.StartTime.UTC().Format(time.RFC3339)
+		}
+		if entity.Description != "" {
+			row["Description"] = entity.Description
 		}
+	}
+	if entity.Public {
+		row["Public"] = true
+	}
+	if entity.Type == collector.EntityTypeVolume {
+		row["VolumeType"] = entity.VolumeType
+		row["MultiAttach"] = entity.MultiAttach
+		if entity.IOPS > 0 {
+			row["IOPS"] = entity.IOPS
+		}
+		if entity.Throughput > 0 {
+			row["Throughput"] = entity.Throughput
+		}
+	}
+	if entity.Type == collector.EntityTypeVolume || entity.Type == collector.EntityTypeSnapshot {
+		row["Encrypted"] = entity.Encrypted
+	}
+	if operation := entity.PendingOperation(); operation != "" {
+		row["PendingOperation"] = operation
+		row["PendingProgress"] = entity.PendingProgress()
+	}
+	if entity.InstanceState != "" {
+		row["InstanceType"] = entity.InstanceType
+		row["InstanceState"] = entity.InstanceState
+	}
+	if entity.AutoScalingGroup != "" {
+		row["AutoScalingGroup"] = entity.AutoScalingGroup
+	}
+	if entity.KubeCluster != "" {
+		row["KubeCluster"] = entity.KubeCluster
+		row["KubeNamespace"] = entity.KubeNamespace
+		row["KubePVC"] = entity.KubePVC
+		row["KubePods"] = strings.Join(entity.KubePods, ",")
+	}
+	if link := instanceLink(entity); link != "" {
+		row["InstanceLink"] = link
+	}
+	if report.CostEstimated {
+		row["MonthlyCostUSD"] = fmt.Sprintf("%.2f", entity.MonthlyCostUSD)
+	}
+	if entity.BackupAgeHours != nil {
+		row["BackupAgeHours"] = backupAgeString(*entity.BackupAgeHours)
+		row["BackupSLAViolated"] = entity.BackupSLAViolated()
+	}
+	if entity.SnapshotAge != nil {
+		row["SnapshotAgeSeconds"] = snapshotAgeString(*entity.SnapshotAge)
+		row["SnapshotCoverageGap"] = entity.SnapshotGap
+	}
+	if entity.AccessClass != "" {
+		row["AccessClass"] = entity.AccessClass
+		row["Recommendation"] = entity.Recommendation
+	}
+	return row
+}
 
-		volumes = append(volumes, entity)
+// sortEntities sorts the entities by storage used in descending order, then
+// by ID so that the order is the same on every run.
+func sortEntities(entities []collector.EntityUsage) {
+	orderEntities(entities, "size", true)
+}
 
-		ebsStorageUsed.WithLabelValues(*volume.VolumeId, region, entity.AttachedInstance).Set(float64(size))
+// consoleLink returns the AWS console URL of an entity, or "" for entity
+// types and partitions without one.
+func consoleLink(entity collector.EntityUsage) string {
+	switch entity.Type {
+	case collector.EntityTypeVolume:
+		return awsres.VolumeURL(entity.Region, entity.ID)
+	case collector.EntityTypeSnapshot, collector.EntityTypeSharedSnapshot:
+		return awsres.SnapshotURL(entity.Region, entity.ID)
+	case collector.EntityTypeBucket:
+		return awsres.BucketURL(entity.Region, entity.ID)
+	case collector.EntityTypeDBInstance:
+		return awsres.DBInstanceURL(entity.Region, entity.ID)
+	case collector.EntityTypeDBCluster:
+		return awsres.DBClusterURL(entity.Region, entity.ID)
+	case collector.EntityTypeEFS:
+		return awsres.EFSURL(entity.Region, entity.ID)
+	case collector.EntityTypeFSx:
+		return awsres.FSxURL(entity.Region, entity.ID)
+	case collector.EntityTypeRecoveryPoint:
+		return awsres.RecoveryPointURL(entity.Region, entity.BackupVault, entity.ID)
+	case collector.EntityTypeDynamoDBTable:
+		return awsres.DynamoDBTableURL(entity.Region, entity.ID)
+	case collector.EntityTypeRedshiftCluster:
+		return awsres.RedshiftClusterURL(entity.Region, entity.ID)
+	case collector.EntityTypeElastiCacheSnapshot:
+		return awsres.ElastiCacheSnapshotURL(entity.Region, entity.ID)
 	}
 
-	entityMutex.Lock()
-	entities = append(entities, volumes...)
-	entityMutex.Unlock()
+	return ""
 }
 
-func getSnapshotStorageUsed(client *ec2.Client, region string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	log.Printf("Querying snapshots in region: %s\n", region)
-
-	params := &ec2.DescribeSnapshotsInput{
-		OwnerIds: []string{"self"},
+// entityARN returns the ARN of an entity. The ARNs that carry the account ID
+// take the caller's of the report when the entity's is unknown, and are ""
+// without either. The ARN is left out of reportColumns, so that only the
+// JSON and YAML formats list it.
+func entityARN(report *collector.Report, entity collector.EntityUsage) string {
+	switch entity.Type {
+	case collector.EntityTypeSnapshot, collector.EntityTypeSharedSnapshot:
+		return awsres.SnapshotARN(entity.Region, entity.ID)
+	case collector.EntityTypeBucket:
+		return awsres.BucketARN(entity.Region, entity.ID)
+	case collector.EntityTypeRecoveryPoint:
+		return entity.ID
 	}
-	resp, err := client.DescribeSnapshots(context.Background(), params)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidSnapshot.NotFound" {
-				// Handle the case when the snapshot does not exist
-				log.Printf("Invalid snapshot ID: %s\n", aerr.Message())
-				return
-			}
-		}
 
-		log.Printf("Failed to describe snapshots in region %s: %v\n", region, err)
-		return
+	accountID := entity.AccountID
+	if accountID == "" && report.Caller != nil {
+		accountID = report.Caller.Account
 	}
+	if accountID == "" {
+		return ""
+	}
+	switch entity.Type {
+	case collector.EntityTypeVolume:
+		return awsres.VolumeARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeDBInstance:
+		return awsres.DBInstanceARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeDBCluster:
+		return awsres.DBClusterARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeEFS:
+		return awsres.EFSARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeFSx:
+		return awsres.FSxARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeDynamoDBTable:
+		return awsres.DynamoDBTableARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeRedshiftCluster:
+		return awsres.RedshiftClusterARN(entity.Region, accountID, entity.ID)
+	case collector.EntityTypeElastiCacheSnapshot:
+		return awsres.ElastiCacheSnapshotARN(entity.Region, accountID, entity.ID)
+	}
+	return ""
+}
 
-	var snapshots []EntityUsage
-
-	for _, snapshot := range resp.Snapshots {
-		size := int64(*snapshot.VolumeSize) * 1024 * 1024 * 1024 // Convert from GB to bytes
-		totalStorageUsed += size
+// instanceLink returns the console URL of the instance a volume is attached
+// to, or "" for other entities.
+func instanceLink(entity collector.EntityUsage) string {
+	if entity.Type != collector.EntityTypeVolume || entity.InstanceID == "" {
+		return ""
+	}
+	return awsres.InstanceURL(entity.Region, entity.InstanceID)
+}
 
-		entity := EntityUsage{
-			ID:               *snapshot.SnapshotId,
-			StorageUsed:      size,
-			Region:           region,
-			IsVolume:         false,
-			AttachedInstance: "", // Snapshots are not attached to instances, so leave it empty
+// writeReport writes the report in the selected format followed by the
+// summaries, posts the scan summary to the notification webhooks, then
+// uploads it with --upload-s3 and records it in --history-db. Failing to
+// write the report or its summaries is an error; the sinks after them only
+// log their failures.
+func writeReport(formatter output.Formatter, report *collector.Report) error {
+	if formatter == nil {
+		if err := writeSQLite(outputFile, report); err != nil {
+			return fmt.Errorf("failed to write SQLite report: %w", err)
 		}
-
-		// Check if the snapshot has a "Name" tag
-		for _, tag := range snapshot.Tags {
-			if *tag.Key == "Name" {
-				entity.AttachedInstance = *tag.Value
-				break
+		if !dryRun {
+			fmt.Fprintf(summaryOut, "Output written to %s\n", outputFile)
+		}
+	} else {
+		shown := filterReport(report)
+		if streamed() {
+			if err := streamReport(report, shown); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
 			}
+		} else if err := writeRows(envelopeFormatter(outputFormat, formatter, report), reportRows(shown)); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		if len(shown.Entities) < len(report.Entities) {
+			fmt.Fprintf(summaryOut, "Showing %d of %d entities\n", len(shown.Entities), len(report.Entities))
 		}
+	}
 
-		// If the snapshot doesn't have a "Name" tag, check if the volume still exists and get its name
-		if entity.AttachedInstance == "" {
-			volumeID := *snapshot.VolumeId
-			volumeName := getVolumeName(client, volumeID)
-			if volumeName != "" {
-				entity.AttachedInstance = fmt.Sprintf("Volume: %s", volumeName)
-			}
+	fmt.Fprintf(summaryOut, "Total Storage Used: %s\n", formatBytes(report.TotalStorageUsed))
+	if report.CostEstimated {
+		printCostSummary(summaryOut, report.Entities, 20)
+	}
+	if report.GroupByTag != "" {
+		if err := writeGroups(summaryOut, report); err != nil {
+			return fmt.Errorf("failed to write tag groups: %w", err)
 		}
+	}
+	if len(report.Stacks) > 0 {
+		printStacks(summaryOut, report)
+	}
+	if len(report.Owners) > 0 {
+		printOwners(summaryOut, report)
+	}
+	if len(report.Accounts) > 0 {
+		printAccounts(summaryOut, report)
+	}
+	if len(report.FailedRegions) > 0 {
+		printFailedRegions(summaryOut, report.FailedRegions)
+	}
+	printSnapshotSharing(summaryOut, report.Entities)
+	printBackupSLAViolations(summaryOut, report.Entities)
+	printSnapshotCoverageGaps(summaryOut, report.Entities)
+	printStoppedInstanceStorage(summaryOut, report.Entities)
+	printKubernetesStorage(summaryOut, report.Entities)
+	printBackupStorage(summaryOut, collector.SummarizeBackups(report.Entities))
+	printJobProgress(summaryOut, report)
+	if len(report.AccessClasses) > 0 {
+		printAccessClasses(summaryOut, report)
+	}
+	if len(report.Findings) > 0 {
+		printFindings(summaryOut, report.Findings)
+	}
+	if len(report.Quotas) > 0 {
+		printQuotas(summaryOut, report.Quotas)
+	}
+
+	notifyScan(report)
+	fileTickets(report)
 
-		snapshots = append(snapshots, entity)
+	if err := uploadReport(formatter, report); err != nil {
+		slog.Error("failed to upload report", "error", err)
+	}
 
-		snapshotStorageUsed.WithLabelValues(*snapshot.SnapshotId, region, entity.AttachedInstance).Set(float64(size))
+	if historyDB != "" {
+		if err := appendHistory(historyDB, report); err != nil {
+			slog.Error("failed to append scan to history", "file", historyDB, "error", err)
+		}
 	}
 
-	entityMutex.Lock()
-	entities = append(entities, snapshots...)
-	entityMutex.Unlock()
+	return nil
 }
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+	"github.com/taylormonacelli/crankymosquitos/pkg/sink"
+)
+
+// streamOutput writes the report rows one at a time with --stream, and
+// makes serve answer /report and the entities API the same way.
+var streamOutput bool
+
+// streamFlushRows is how many rows a streamed HTTP response writes between
+// flushes.
+const streamFlushRows = 1000
+
+// validateStream checks --stream against the output flags. Table reports
+// are aligned over every row, so they are written whole even then.
+func validateStream() error {
+	if !streamOutput || outputFormat == "table" {
+		return nil
+	}
+	if !slices.Contains(output.StreamFormats, outputFormat) {
+		return fmt.Errorf("--stream cannot write %s reports: --output must be one of %s", outputFormat, strings.Join(output.StreamFormats, ", "))
+	}
+	if _, ok := reportSink.(sink.File); !ok && reportSink != sink.Stdout {
+		return fmt.Errorf("--stream writes to stdout or a file, not %s", reportSink)
+	}
+	return nil
+}
+
+// streamed reports whether writeReport streams the report.
+func streamed() bool {
+	return streamOutput && slices.Contains(output.StreamFormats, outputFormat)
+}
+
+// streamReport writes the rows of the shown entities to the report sink one
+// at a time, followed by the totals of the report: a "totals" member after
+// the entities of a version 2 JSON report, a Total row for csv and jsonl.
+func streamReport(report, shown *collector.Report) error {
+	sortReportEntities(shown.Entities)
+
+	if reportSink == sink.Stdout {
+		w := bufio.NewWriter(os.Stdout)
+		if err := writeStream(w, report, shown); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	if skipDryRun("stream %d rows to %s", len(shown.Entities), reportSink) {
+		return nil
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := writeStream(w, report, shown); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(summaryOut, "Output written to %s\n", reportSink)
+	return nil
+}
+
+func writeStream(w io.Writer, report, shown *collector.Report) error {
+	if outputFormat == "json" && reportSchema != "v1" {
+		return writeStreamedEnvelope(w, report, shown)
+	}
+
+	rows, err := output.NewRowWriter(outputFormat, w, reportColumns)
+	if err != nil {
+		return err
+	}
+	for _, entity := range shown.Entities {
+		if err := rows.WriteRow(reportRow(report, entity)); err != nil {
+			return err
+		}
+	}
+	if outputFormat != "json" {
+		total := output.Row{"Type": "Total", "StorageUsed": sizeValue(report.TotalStorageUsed)}
+		if cost, ok := reportCost(report); ok {
+			total["MonthlyCostUSD"] = cost
+		}
+		if err := rows.WriteRow(total); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		_, err = io.WriteString(w, "\n")
+	}
+	return err
+}
+
+// writeStreamedEnvelope writes a version 2 JSON report with the entities
+// streamed after the metadata and the totals last.
+func writeStreamedEnvelope(w io.Writer, report, shown *collector.Report) error {
+	envelope := newReportEnvelope(report)
+	totals := envelope.Totals
+	envelope.Entities = []output.Row{}
+
+	head, err := json.MarshalIndent(struct {
+		reportEnvelope
+		Totals   *reportTotals `json:"totals,omitempty"`
+		Entities *[]output.Row `json:"entities,omitempty"`
+	}{reportEnvelope: envelope}, "", "  ")
+	if err != nil {
+		return err
+	}
+	head = bytes.TrimSuffix(head, []byte("\n}"))
+	if _, err := fmt.Fprintf(w, "%s,\n  \"entities\": ", head); err != nil {
+		return err
+	}
+
+	rows := output.NewJSONRowWriter(w, "  ")
+	for _, entity := range shown.Entities {
+		if err := rows.WriteRow(reportRow(report, entity)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(totals, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, ",\n  \"totals\": %s\n}\n", data)
+	return err
+}
+
+// streamJSONResponse writes an HTTP JSON response whose last member is the
+// entities array, the rows of the entities of report written one at a
+// time and flushed every streamFlushRows rows. head is the response
+// without its entities, which must marshal to an object.
+func streamJSONResponse(w http.ResponseWriter, head any, report *collector.Report) {
+	data, err := json.Marshal(head)
+	if err != nil || !bytes.HasSuffix(data, []byte("}")) {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	buffered := bufio.NewWriter(w)
+	separator := ","
+	if bytes.Equal(data, []byte("{}")) {
+		separator = ""
+	}
+	fmt.Fprintf(buffered, "%s%s\"entities\":[", data[:len(data)-1], separator)
+
+	encoder := json.NewEncoder(buffered)
+	for i, entity := range report.Entities {
+		if i > 0 {
+			buffered.WriteByte(',')
+		}
+		if err := encoder.Encode(reportRow(report, entity)); err != nil {
+			return // The status is already sent; the client sees truncated JSON
+		}
+		if flusher != nil && (i+1)%streamFlushRows == 0 {
+			if buffered.Flush() != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+	buffered.WriteString("]}\n")
+	if err := buffered.Flush(); err != nil {
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
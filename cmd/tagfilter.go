@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var (
+	filterTags []string
+
+	tagFilters collector.TagFilters
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringArrayVar(&filterTags, "filter-tag", nil, "only scan resources tagged key=value, filtered by EC2 for volumes and snapshots (repeatable; values of one key are ORed, different keys ANDed)")
+}
+
+// initTagFilters validates the --filter-tag flags.
+func initTagFilters() error {
+	filters, err := parseTagFilters(filterTags)
+	if err != nil {
+		return err
+	}
+	tagFilters = filters
+	return nil
+}
+
+// parseTagFilters groups key=value pairs by key. It returns nil when there
+// are no pairs.
+func parseTagFilters(pairs []string) (collector.TagFilters, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	filters := collector.TagFilters{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid --filter-tag %q: expected key=value", pair)
+		}
+		filters[key] = append(filters[key], value)
+	}
+
+	return filters, nil
+}
+
+// initFilters validates the snapshot and tag filter flags and reads the
+// --ignore-file.
+func initFilters() error {
+	if err := initSnapshotFilters(); err != nil {
+		return err
+	}
+	if err := initIgnoreList(); err != nil {
+		return err
+	}
+	return initTagFilters()
+}
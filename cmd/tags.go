@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var tagsOptions = struct {
+	Top       int
+	MaxValues int
+}{}
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "Report which tags cover the most volume and snapshot storage",
+	Long: `Ranks tag keys, and the values of each key, by the volume and
+snapshot storage they cover, and lists keys with more distinct values than
+--max-values. Use it to see which tags are fit for cost allocation.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+
+		report, err := collector.New(opts).Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		writeTagStats(os.Stdout, report, tagsOptions.Top, tagsOptions.MaxValues)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagsCmd)
+
+	tagsCmd.Flags().IntVar(&tagsOptions.Top, "top", 10, "number of tag keys, and values per key, to show")
+	tagsCmd.Flags().IntVar(&tagsOptions.MaxValues, "max-values", 50, "flag tag keys with more distinct values than this")
+}
+
+func writeTagStats(w io.Writer, report *collector.Report, top, maxValues int) {
+	var total int64
+	entities := 0
+	for _, entity := range report.Entities {
+		if entity.Type == collector.EntityTypeVolume || entity.Type == collector.EntityTypeSnapshot {
+			total += entity.StorageUsed
+			entities++
+		}
+	}
+
+	stats := collector.TagStats(report.Entities)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tENTITIES\tSIZE\tCOVERAGE")
+	for i, key := range stats {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t(%d values)\t%d\t%s\t%s\n",
+			key.Key, len(key.Values), key.Entities, formatBytes(key.StorageUsed), percentOf(key.StorageUsed, total))
+		for j, value := range key.Values {
+			if j == top {
+				fmt.Fprintf(tw, "\t(%d more)\t\t\t\n", len(key.Values)-top)
+				break
+			}
+			fmt.Fprintf(tw, "\t%s\t%d\t%s\t%s\n",
+				value.Value, value.Entities, formatBytes(value.StorageUsed), percentOf(value.StorageUsed, total))
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Tag Keys: %d, Tagged Entities: %d of %d\n", len(stats), countTagged(report.Entities), entities)
+
+	for _, key := range stats {
+		if len(key.Values) > maxValues {
+			fmt.Fprintf(w, "High cardinality: %s, Distinct Values: %d, Entities: %d\n",
+				key.Key, len(key.Values), key.Entities)
+		}
+	}
+}
+
+func countTagged(entities []collector.EntityUsage) int {
+	tagged := 0
+	for _, entity := range entities {
+		if (entity.Type == collector.EntityTypeVolume || entity.Type == collector.EntityTypeSnapshot) && len(entity.Tags) > 0 {
+			tagged++
+		}
+	}
+	return tagged
+}
+
+func percentOf(part, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Ticket trackers of --tickets.
+const (
+	trackerJira   = "jira"
+	trackerGitHub = "github"
+)
+
+// untaggedGroup stands in for the --ticket-group-tag value of resources
+// without the tag.
+const untaggedGroup = "(untagged)"
+
+var ticketOptions = struct {
+	Tracker       string
+	MinSeverity   string
+	GroupTag      string
+	Labels        []string
+	JiraURL       string
+	JiraProject   string
+	JiraIssueType string
+	JiraUser      string
+	JiraTokenFile string
+	GitHubAPIURL  string
+	GitHubRepo    string
+	GitHubToken   string
+}{}
+
+func init() {
+	flags := rootCmd.Flags()
+	flags.StringVar(&ticketOptions.Tracker, "tickets", "", "with --findings, open a ticket in jira or github for every finding of --ticket-min-severity, unless one is already open")
+	flags.StringVar(&ticketOptions.MinSeverity, "ticket-min-severity", collector.SeverityHigh, "least severe findings tickets are opened for: critical, high, medium or low")
+	flags.StringVar(&ticketOptions.GroupTag, "ticket-group-tag", "", "open one ticket per value of this tag, e.g. Team, instead of one per resource")
+	flags.StringSliceVar(&ticketOptions.Labels, "ticket-labels", []string{"crankymosquitos"}, "labels of the tickets, also used to find the open ones")
+	flags.StringVar(&ticketOptions.JiraURL, "jira-url", "", "base URL of the Jira site, e.g. https://example.atlassian.net")
+	flags.StringVar(&ticketOptions.JiraProject, "jira-project", "", "key of the Jira project tickets are opened in")
+	flags.StringVar(&ticketOptions.JiraIssueType, "jira-issue-type", "Task", "issue type of the Jira tickets")
+	flags.StringVar(&ticketOptions.JiraUser, "jira-user", "", "email of the Jira Cloud user of --jira-token-file (default: use the token as a Data Center personal access token)")
+	flags.StringVar(&ticketOptions.JiraTokenFile, "jira-token-file", "", "file holding the Jira API token")
+	flags.StringVar(&ticketOptions.GitHubAPIURL, "github-api-url", "https://api.github.com", "GitHub API URL, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server")
+	flags.StringVar(&ticketOptions.GitHubRepo, "github-repo", "", "repository issues are opened in, as owner/name")
+	flags.StringVar(&ticketOptions.GitHubToken, "github-token-file", "", "file holding a GitHub token allowed to create issues")
+}
+
+// validateTicketOptions checks the ticket flags before the scan starts.
+func validateTicketOptions() error {
+	opts := ticketOptions
+	if opts.Tracker == "" {
+		return nil
+	}
+	if !findingsEnabled {
+		return errors.New("--tickets needs --findings")
+	}
+	if !slices.Contains(collector.Severities, opts.MinSeverity) {
+		return fmt.Errorf("invalid --ticket-min-severity %q: must be one of %s", opts.MinSeverity, strings.Join(collector.Severities, ", "))
+	}
+
+	switch opts.Tracker {
+	case trackerJira:
+		if opts.JiraURL == "" || opts.JiraProject == "" || opts.JiraTokenFile == "" {
+			return errors.New("--tickets jira needs --jira-url, --jira-project and --jira-token-file")
+		}
+	case trackerGitHub:
+		if !strings.Contains(opts.GitHubRepo, "/") {
+			return fmt.Errorf("invalid --github-repo %q: expected owner/name", opts.GitHubRepo)
+		}
+		if opts.GitHubToken == "" {
+			return errors.New("--tickets github needs --github-token-file")
+		}
+	default:
+		return fmt.Errorf("invalid --tickets %q: expected %s or %s", opts.Tracker, trackerJira, trackerGitHub)
+	}
+	return nil
+}
+
+// ticket is an issue opened for one or more findings. Key, the finding ID
+// or tag group, leads its title so that the open tickets can be recognized
+// on the next scan.
+type ticket struct {
+	Key      string
+	Title    string
+	Body     string
+	Findings []collector.Finding
+}
+
+// ticketTracker opens tickets in an issue tracker.
+type ticketTracker interface {
+	// openTickets returns the keys of the tickets still open.
+	openTickets(ctx context.Context) (map[string]bool, error)
+	// createTicket opens a ticket and returns its key or URL in the tracker.
+	createTicket(ctx context.Context, t ticket) (string, error)
+}
+
+// ticketKeyPattern matches the key leading the title of a ticket.
+var ticketKeyPattern = regexp.MustCompile(`^\[([^\]]+)\]`)
+
+func ticketTitle(key, summary string) string {
+	return "[" + key + "] " + summary
+}
+
+// fileTickets opens a ticket for every finding of --ticket-min-severity, or
+// for every --ticket-group-tag value of such findings, that has no open
+// ticket yet. Findings without a resource, like budget breaches, always get
+// a ticket of their own.
+func fileTickets(report *collector.Report) {
+	if ticketOptions.Tracker == "" {
+		return
+	}
+
+	tickets := buildTickets(report)
+	if len(tickets) == 0 {
+		return
+	}
+
+	tracker, err := newTicketTracker()
+	if err != nil {
+		slog.Error("failed to open tickets", "error", err)
+		return
+	}
+
+	ctx := context.Background()
+	open, err := tracker.openTickets(ctx)
+	if err != nil {
+		slog.Error("failed to list the open tickets", "tracker", ticketOptions.Tracker, "error", err)
+		return
+	}
+
+	var created, existing int
+	for _, t := range tickets {
+		if open[t.Key] {
+			existing++
+			continue
+		}
+		if skipDryRun("open a %s ticket for %s", ticketOptions.Tracker, t.Key) {
+			continue
+		}
+		id, err := tracker.createTicket(ctx, t)
+		if err != nil {
+			slog.Error("failed to open ticket", "tracker", ticketOptions.Tracker, "key", t.Key, "error", err)
+			continue
+		}
+		created++
+		fmt.Fprintf(summaryOut, "Opened ticket: %s, Key: %s, Findings: %d\n", id, t.Key, len(t.Findings))
+	}
+	fmt.Fprintf(summaryOut, "Tickets: Opened: %d, Already Open: %d\n", created, existing)
+}
+
+// buildTickets groups the findings of --ticket-min-severity into tickets,
+// ordered by key.
+func buildTickets(report *collector.Report) []ticket {
+	minRank := slices.Index(collector.Severities, ticketOptions.MinSeverity)
+
+	groups := map[string]*ticket{}
+	for _, finding := range report.Findings {
+		if slices.Index(collector.Severities, finding.Severity) > minRank {
+			continue
+		}
+
+		key := finding.ID
+		if ticketOptions.GroupTag != "" && finding.Entity != nil {
+			value := finding.Entity.Tags[ticketOptions.GroupTag]
+			if value == "" {
+				value = untaggedGroup
+			}
+			key = ticketOptions.GroupTag + "=" + value
+		}
+		if groups[key] == nil {
+			groups[key] = &ticket{Key: key}
+		}
+		groups[key].Findings = append(groups[key].Findings, finding)
+	}
+
+	tickets := make([]ticket, 0, len(groups))
+	for _, t := range groups {
+		if len(t.Findings) == 1 && t.Key == t.Findings[0].ID {
+			t.Title = ticketTitle(t.Key, t.Findings[0].Summary)
+		} else {
+			t.Title = ticketTitle(t.Key, fmt.Sprintf("Storage findings of %s (%d)", strings.Replace(t.Key, "=", " ", 1), len(t.Findings)))
+		}
+		t.Body = ticketBody(report, t.Findings)
+		tickets = append(tickets, *t)
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].Key < tickets[j].Key })
+	return tickets
+}
+
+// ticketBody describes the findings of a ticket, one paragraph each.
+func ticketBody(report *collector.Report, findings []collector.Finding) string {
+	var body strings.Builder
+	for _, finding := range findings {
+		fmt.Fprintf(&body, "%s (%s): %s\n", finding.ID, finding.Severity, finding.Summary)
+		if entity := finding.Entity; entity != nil {
+			if entity.AccountID != "" {
+				fmt.Fprintf(&body, "Account: %s, ", entity.AccountID)
+			}
+			fmt.Fprintf(&body, "Region: %s, Storage Used: %s", entity.Region, formatBytes(entity.StorageUsed))
+			if report.CostEstimated {
+				fmt.Fprintf(&body, ", Monthly Cost: $%.2f", entity.MonthlyCostUSD)
+			}
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "Remediation: %s\n\n", finding.Remediation)
+	}
+	fmt.Fprintf(&body, "Found by crankymosquitos on %s.", report.GeneratedAt.UTC().Format(time.RFC3339))
+	return body.String()
+}
+
+func newTicketTracker() (ticketTracker, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch ticketOptions.Tracker {
+	case trackerJira:
+		token, err := readTokenFile(ticketOptions.JiraTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --jira-token-file: %w", err)
+		}
+		return &jiraTracker{client: client, token: token}, nil
+	case trackerGitHub:
+		token, err := readTokenFile(ticketOptions.GitHubToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --github-token-file: %w", err)
+		}
+		return &githubTracker{client: client, token: token}, nil
+	}
+	return nil, fmt.Errorf("unknown ticket tracker %q", ticketOptions.Tracker)
+}
+
+// readTokenFile reads a token, ignoring trailing newlines.
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// trackerRequest sends a JSON request to a tracker API and decodes the JSON
+// response into out, unless out is nil.
+func trackerRequest(ctx context.Context, client *http.Client, method, endpoint string, auth func(*http.Request), body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	auth(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// openKeys collects the keys leading the titles of open tickets.
+func openKeys(keys map[string]bool, title string) {
+	if match := ticketKeyPattern.FindStringSubmatch(title); match != nil {
+		keys[match[1]] = true
+	}
+}
+
+// jiraTracker opens Jira issues through the REST API v2, which both Jira
+// Cloud and Data Center serve.
+type jiraTracker struct {
+	client *http.Client
+	token  string
+}
+
+func (j *jiraTracker) auth(req *http.Request) {
+	if ticketOptions.JiraUser != "" {
+		req.SetBasicAuth(ticketOptions.JiraUser, j.token)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+j.token)
+}
+
+func (j *jiraTracker) url(path string) string {
+	return strings.TrimSuffix(ticketOptions.JiraURL, "/") + path
+}
+
+func (j *jiraTracker) openTickets(ctx context.Context) (map[string]bool, error) {
+	jql := fmt.Sprintf("project = %q AND statusCategory != Done", ticketOptions.JiraProject)
+	for _, label := range ticketOptions.Labels {
+		jql += fmt.Sprintf(" AND labels = %q", label)
+	}
+
+	keys := map[string]bool{}
+	for startAt := 0; ; {
+		query := url.Values{"jql": {jql}, "fields": {"summary"}, "startAt": {fmt.Sprint(startAt)}, "maxResults": {"100"}}
+		var page struct {
+			Total  int `json:"total"`
+			Issues []struct {
+				Fields struct {
+					Summary string `json:"summary"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		if err := trackerRequest(ctx, j.client, http.MethodGet, j.url("/rest/api/2/search?"+query.Encode()), j.auth, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues {
+			openKeys(keys, issue.Fields.Summary)
+		}
+		startAt += len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			return keys, nil
+		}
+	}
+}
+
+func (j *jiraTracker) createTicket(ctx context.Context, t ticket) (string, error) {
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": ticketOptions.JiraProject},
+			"issuetype":   map[string]string{"name": ticketOptions.JiraIssueType},
+			"summary":     t.Title,
+			"description": t.Body,
+			"labels":      ticketOptions.Labels,
+		},
+	}
+	var issue struct {
+		Key string `json:"key"`
+	}
+	if err := trackerRequest(ctx, j.client, http.MethodPost, j.url("/rest/api/2/issue"), j.auth, body, &issue); err != nil {
+		return "", err
+	}
+	return issue.Key, nil
+}
+
+// githubTracker opens GitHub issues through the REST API.
+type githubTracker struct {
+	client *http.Client
+	token  string
+}
+
+func (g *githubTracker) auth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+}
+
+func (g *githubTracker) url(path string) string {
+	return strings.TrimSuffix(ticketOptions.GitHubAPIURL, "/") + "/repos/" + ticketOptions.GitHubRepo + path
+}
+
+func (g *githubTracker) openTickets(ctx context.Context) (map[string]bool, error) {
+	keys := map[string]bool{}
+	for page := 1; ; page++ {
+		query := url.Values{"state": {"open"}, "per_page": {"100"}, "page": {fmt.Sprint(page)}}
+		if len(ticketOptions.Labels) > 0 {
+			query.Set("labels", strings.Join(ticketOptions.Labels, ","))
+		}
+		var issues []struct {
+			Title string `json:"title"`
+		}
+		if err := trackerRequest(ctx, g.client, http.MethodGet, g.url("/issues?"+query.Encode()), g.auth, nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			openKeys(keys, issue.Title)
+		}
+		if len(issues) < 100 {
+			return keys, nil
+		}
+	}
+}
+
+func (g *githubTracker) createTicket(ctx context.Context, t ticket) (string, error) {
+	body := map[string]interface{}{
+		"title":  t.Title,
+		"body":   t.Body,
+		"labels": ticketOptions.Labels,
+	}
+	var issue struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := trackerRequest(ctx, g.client, http.MethodPost, g.url("/issues"), g.auth, body, &issue); err != nil {
+		return "", err
+	}
+	return issue.HTMLURL, nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// unencryptedExitCode is the exit status of analyze encryption with
+// --fail-on-unencrypted when it finds unencrypted storage.
+const unencryptedExitCode = 2
+
+var unencryptedOptions = struct {
+	GroupBy           string
+	FailOnUnencrypted bool
+}{}
+
+var analyzeEncryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Report volumes and snapshots that are not encrypted at rest",
+	Long: `Lists every EBS volume and snapshot that is not encrypted at rest,
+totals the unencrypted storage of each region and groups it by the tag of
+--group-by, e.g. to hand the findings to the owning teams.
+
+With --fail-on-unencrypted the command exits with status 2 when it finds
+any, for compliance checks in CI.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tagKey, err := parseGroupBy(unencryptedOptions.GroupBy)
+		if err != nil {
+			return err
+		}
+
+		regions, err := getScanRegions()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS regions: %w", err)
+		}
+
+		opts := collectorOptions(regions)
+		opts.Services = []string{collector.ServiceEBS, collector.ServiceSnapshots}
+
+		report, err := collector.New(opts).Scan(context.Background())
+		if err != nil {
+			return err
+		}
+
+		unencrypted := collector.Unencrypted(report.Entities)
+		writeUnencrypted(os.Stdout, report.Entities, unencrypted, tagKey)
+
+		if unencryptedOptions.FailOnUnencrypted && len(unencrypted) > 0 {
+			fmt.Fprintf(os.Stderr, "Unencrypted storage found: %d volumes and snapshots\n", len(unencrypted))
+			os.Exit(unencryptedExitCode)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeEncryptionCmd)
+
+	flags := analyzeEncryptionCmd.Flags()
+	flags.StringVar(&unencryptedOptions.GroupBy, "group-by", "tag:Team", "group the unencrypted storage by a tag, e.g. tag:Team (empty: no groups)")
+	flags.BoolVar(&unencryptedOptions.FailOnUnencrypted, "fail-on-unencrypted", false, "exit with status 2 when any volume or snapshot is unencrypted")
+}
+
+func writeUnencrypted(w io.Writer, entities, unencrypted []collector.EntityUsage, tagKey string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tREGION\tNAME\tSIZE")
+	for _, entity := range unencrypted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			entity.Type, entity.ID, entity.Region, entity.AttachedInstance, formatBytes(entity.StorageUsed))
+	}
+	tw.Flush()
+
+	var total, bytes int64
+	for _, region := range collector.EncryptionByRegion(entities) {
+		total += region.StorageUsed
+		bytes += region.UnencryptedStorage
+		fmt.Fprintf(w, "Region: %s, Unencrypted: %d of %d, Unencrypted Storage: %s of %s\n",
+			region.Region, region.Unencrypted, region.Entities, formatBytes(region.UnencryptedStorage), formatBytes(region.StorageUsed))
+	}
+
+	if tagKey != "" {
+		fmt.Fprintf(w, "Unencrypted storage by tag %s:\n", tagKey)
+		for _, group := range collector.GroupByTag(unencrypted, tagKey) {
+			fmt.Fprintf(w, "%s: %s, Entities: %d, Storage Used: %s\n",
+				tagKey, groupLabel(group.Value), group.Entities, formatBytes(group.StorageUsed))
+		}
+	}
+
+	fmt.Fprintf(w, "Unencrypted Volumes and Snapshots: %d, Unencrypted Storage: %s, Total Storage: %s\n",
+		len(unencrypted), formatBytes(bytes), formatBytes(total))
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+var (
+	unitsFlag string
+	units     = humanize.GB
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&unitsFlag, "units", string(humanize.GB), "units of the sizes in every output format and of the sizes given to flags: binary (GiB, TiB), si (GB, TB), raw-bytes or gb (whole GB, as AWS reports them)")
+}
+
+// initUnits validates --units.
+func initUnits() error {
+	parsed, err := humanize.ParseUnits(unitsFlag)
+	if err != nil {
+		return err
+	}
+	units = parsed
+	output.Units = parsed
+	return nil
+}
+
+// formatBytes formats a size in --units for people to read.
+func formatBytes(bytes int64) string {
+	return humanize.Bytes(bytes, units)
+}
+
+// parseSize parses a size given to a flag or the API in --units, so that
+// "100GB" is the size the report prints as 100 GB.
+func parseSize(s string) (int64, error) {
+	return humanize.ParseSize(s, units)
+}
+
+// sizeValue formats a size in --units as a report column.
+func sizeValue(bytes int64) string {
+	return humanize.Value(bytes, units)
+}
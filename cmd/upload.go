@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/output"
+)
+
+// reportHashMetadata is the object metadata key holding the content hash of
+// an uploaded report.
+const reportHashMetadata = "report-sha256"
+
+// latestPointerFile is the object under the --upload-s3 prefix that
+// --upload-latest-pointer writes.
+const latestPointerFile = "latest.json"
+
+var (
+	uploadS3            string
+	forceUpload         bool
+	uploadFormats       []string
+	uploadLatestPointer bool
+)
+
+// latestPointer is the latest.json object: where the newest reports were
+// uploaded and the content hash they share.
+type latestPointer struct {
+	GeneratedAt  time.Time         `json:"generated_at"`
+	ReportSHA256 string            `json:"report_sha256"`
+	Bucket       string            `json:"bucket"`
+	Keys         map[string]string `json:"keys"` // By format
+}
+
+// reportExtensions are the file extensions of uploaded reports whose format
+// name is not their extension.
+var reportExtensions = map[string]string{
+	"table":      "txt",
+	sqliteFormat: "db",
+}
+
+func init() {
+	addUploadFlags(rootCmd)
+	addUploadFlags(storageS3Cmd)
+}
+
+func addUploadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&uploadS3, "upload-s3", "", "upload the report to this S3 prefix, e.g. s3://bucket/reports/")
+	cmd.Flags().BoolVar(&forceUpload, "force-upload", false, "upload the report even when it has not changed since the last upload")
+	cmd.Flags().StringSliceVar(&uploadFormats, "upload-format", nil, "formats the report is uploaded in, e.g. json,csv (default: the --output format)")
+	cmd.Flags().BoolVar(&uploadLatestPointer, "upload-latest-pointer", false, "also write latest.json under the prefix, naming the keys of the newest reports")
+}
+
+// validateUploadFormats checks --upload-format. A SQLite report can only be
+// uploaded when it is the --output format, from --output-file.
+func validateUploadFormats() error {
+	for _, format := range uploadFormats {
+		if format == outputFormat {
+			continue
+		}
+		if format == sqliteFormat {
+			return errors.New("--upload-format sqlite requires --output sqlite")
+		}
+		if _, err := output.Get(format); err != nil {
+			return fmt.Errorf("invalid --upload-format: %w", err)
+		}
+	}
+	return nil
+}
+
+// reportUploadFormats returns the formats the report is uploaded in.
+func reportUploadFormats() []string {
+	if len(uploadFormats) == 0 {
+		return []string{outputFormat}
+	}
+	return uploadFormats
+}
+
+// reportExtension returns the file extension of a report format.
+func reportExtension(format string) string {
+	if ext, ok := reportExtensions[format]; ok {
+		return ext
+	}
+	return format
+}
+
+// uploadReport uploads the report to --upload-s3 in every --upload-format,
+// under a timestamped key and the latest/ alias. The content hash of the
+// report is stored with the alias, and a report matching it in every format
+// is not uploaded again unless --force-upload is given. With
+// --upload-latest-pointer latest.json names the timestamped keys.
+func uploadReport(formatter output.Formatter, report *collector.Report) error {
+	if uploadS3 == "" {
+		return nil
+	}
+
+	bucket, prefix, err := parseS3URL(uploadS3)
+	if err != nil {
+		return err
+	}
+
+	hash, err := reportHash(report)
+	if err != nil {
+		return err
+	}
+
+	formats := reportUploadFormats()
+	timestamp := report.GeneratedAt.UTC().Format("20060102T150405Z")
+	keys := map[string]string{}
+	latestKeys := map[string]string{}
+	for _, format := range formats {
+		keys[format] = path.Join(prefix, timestamp+"."+reportExtension(format))
+		latestKeys[format] = path.Join(prefix, "latest", "report."+reportExtension(format))
+	}
+
+	ctx := context.Background()
+
+	client, err := s3ClientForBucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	if !forceUpload {
+		unchanged := true
+		for _, format := range formats {
+			previous, err := uploadedReportHash(ctx, client, bucket, latestKeys[format])
+			if err != nil {
+				return err
+			}
+			unchanged = unchanged && previous == hash
+		}
+		if unchanged {
+			fmt.Fprintf(summaryOut, "Report unchanged since the last upload to s3://%s/%s, skipping upload\n", bucket, path.Join(prefix, "latest"))
+			return nil
+		}
+	}
+
+	for _, format := range formats {
+		key, latestKey := keys[format], latestKeys[format]
+		if skipDryRun("upload the report to s3://%s/%s and s3://%s/%s", bucket, key, bucket, latestKey) {
+			continue
+		}
+
+		body, err := reportBody(format, formatter, report)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range []string{key, latestKey} {
+			if err := putReport(ctx, client, bucket, k, body, hash); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(summaryOut, "Uploaded report to s3://%s/%s\n", bucket, key)
+	}
+
+	if !uploadLatestPointer {
+		return nil
+	}
+	pointerKey := path.Join(prefix, latestPointerFile)
+	if skipDryRun("write s3://%s/%s", bucket, pointerKey) {
+		return nil
+	}
+	pointer, err := json.MarshalIndent(latestPointer{
+		GeneratedAt:  report.GeneratedAt.UTC().Truncate(time.Second),
+		ReportSHA256: hash,
+		Bucket:       bucket,
+		Keys:         keys,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return putReport(ctx, client, bucket, pointerKey, append(pointer, '\n'), hash)
+}
+
+func putReport(ctx context.Context, client *s3.Client, bucket, key string, body []byte, hash string) error {
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(body),
+		Metadata: map[string]string{reportHashMetadata: hash},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// parseS3URL splits s3://bucket/prefix into the bucket and the prefix.
+func parseS3URL(value string) (string, string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q: expected s3://bucket/prefix", value)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// reportHash hashes the report rows, independently of the output format, so
+// that reports of unchanged storage hash the same.
+func reportHash(report *collector.Report) (string, error) {
+	data, err := json.Marshal(reportRows(report))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// reportBody returns the report in a format. The --output format is returned
+// as it was written: the output file when there is one, the formatted rows
+// otherwise.
+func reportBody(format string, formatter output.Formatter, report *collector.Report) ([]byte, error) {
+	if format == outputFormat && outputFile != "" {
+		return os.ReadFile(outputFile)
+	}
+	if format != outputFormat {
+		var err error
+		if formatter, err = output.Get(format); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := envelopeFormatter(format, formatter, report).Format(&buf, reportColumns, reportRows(report)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// s3ClientForBucket returns an S3 client for the region of the bucket.
+func s3ClientForBucket(ctx context.Context, bucket string) (*s3.Client, error) {
+	cfg, err := loadAwsConfig(awsres.S3HomeRegion(partition))
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := s3.NewFromConfig(cfg, s3PathStyle).GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location of bucket %s: %w", bucket, err)
+	}
+
+	cfg, err = loadAwsConfig(collector.BucketRegion(string(location.LocationConstraint)))
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, s3PathStyle), nil
+}
+
+// s3PathStyle addresses buckets in the request path with --endpoint-url,
+// which endpoints such as LocalStack require.
+func s3PathStyle(o *s3.Options) {
+	o.UsePathStyle = endpointURL != ""
+}
+
+// uploadedReportHash returns the content hash stored with an uploaded report,
+// or "" when there is none.
+func uploadedReportHash(ctx context.Context, client *s3.Client, bucket, key string) (string, error) {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return head.Metadata[reportHashMetadata], nil
+}
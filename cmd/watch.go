@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+var watchOptions = struct {
+	Interval      string
+	AlertOver     string
+	AlertTagOver  []string
+	Bell          bool
+	DesktopNotify bool
+	WebhookURL    string
+}{}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Rescan every --interval and alert when storage crosses a threshold",
+	Long: `Scans every service every --interval and prints an alert the moment the
+total storage crosses --alert-over or the storage of a tag crosses
+--alert-tag-over, and again when it falls back under. Every scan prints
+its totals and the change since the previous scan, so that something
+snapshotting in a loop shows up while it happens.
+
+--alert-tag-over takes KEY=VALUE:SIZE for one tag value, or KEY:SIZE for
+every value of the tag, e.g. --alert-tag-over Team=db:5TB,Team:20TB.
+Alerts ring the terminal bell, and optionally raise a desktop notification
+and post to a Slack-compatible webhook. The report itself is not written.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWatch()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	flags := watchCmd.Flags()
+	flags.StringVar(&watchOptions.Interval, "interval", "10m", "time between scans (e.g. 30s, 10m, 1h)")
+	flags.StringVar(&watchOptions.AlertOver, "alert-over", "", "alert when the total storage exceeds this size (e.g. 80TB)")
+	flags.StringSliceVar(&watchOptions.AlertTagOver, "alert-tag-over", nil, "alert when the storage of a tag exceeds a size, as KEY=VALUE:SIZE or KEY:SIZE for every value of KEY")
+	flags.BoolVar(&watchOptions.Bell, "bell", true, "ring the terminal bell on alerts")
+	flags.BoolVar(&watchOptions.DesktopNotify, "desktop-notify", false, "raise a desktop notification on alerts (notify-send on Linux, osascript on macOS)")
+	flags.StringVar(&watchOptions.WebhookURL, "alert-webhook-url", "", "post alerts to this Slack-compatible webhook")
+}
+
+// watchThreshold is a size limit on the storage of the report, or of the
+// resources carrying a tag. An empty Value limits every value of Key
+// separately.
+type watchThreshold struct {
+	Key, Value string
+	Limit      int64
+}
+
+// parseWatchThresholds parses --alert-over and --alert-tag-over.
+func parseWatchThresholds() ([]watchThreshold, error) {
+	var thresholds []watchThreshold
+	if watchOptions.AlertOver != "" {
+		limit, err := parseSize(watchOptions.AlertOver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --alert-over: %w", err)
+		}
+		thresholds = append(thresholds, watchThreshold{Limit: limit})
+	}
+
+	for _, spec := range watchOptions.AlertTagOver {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid --alert-tag-over %q: expected KEY=VALUE:SIZE or KEY:SIZE", spec)
+		}
+		limit, err := parseSize(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --alert-tag-over %q: %w", spec, err)
+		}
+		key, value, _ := strings.Cut(spec[:i], "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid --alert-tag-over %q: expected KEY=VALUE:SIZE or KEY:SIZE", spec)
+		}
+		thresholds = append(thresholds, watchThreshold{Key: key, Value: value, Limit: limit})
+	}
+
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("watch needs --alert-over or --alert-tag-over")
+	}
+	return thresholds, nil
+}
+
+// watchState identifies a label of a threshold, which is over its limit
+// or not.
+type watchState struct {
+	threshold int
+	label     string
+}
+
+// watchUsage is the storage a threshold measures in one scan, keyed by the
+// label of the alert.
+func watchUsage(threshold watchThreshold, report *collector.Report) map[string]int64 {
+	if threshold.Key == "" {
+		return map[string]int64{"Total Storage Used": report.TotalStorageUsed}
+	}
+
+	usage := map[string]int64{}
+	if threshold.Value != "" {
+		usage[fmt.Sprintf("Tag %s=%s", threshold.Key, threshold.Value)] = 0
+	}
+	for _, entity := range report.Entities {
+		value, ok := entity.Tags[threshold.Key]
+		if !ok || (threshold.Value != "" && value != threshold.Value) {
+			continue
+		}
+		usage[fmt.Sprintf("Tag %s=%s", threshold.Key, value)] += entity.StorageUsed
+	}
+	return usage
+}
+
+func runWatch() error {
+	if err := validateFilters(); err != nil {
+		return err
+	}
+	if err := validateAccounts(); err != nil {
+		return err
+	}
+	interval, err := parseAge(watchOptions.Interval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid --interval %q: expected a positive duration such as 10m", watchOptions.Interval)
+	}
+	thresholds, err := parseWatchThresholds()
+	if err != nil {
+		return err
+	}
+	var opts collector.Options
+	if len(replayFiles) == 0 {
+		if opts, err = storageOptions(); err != nil {
+			return err
+		}
+	}
+
+	over := map[watchState]bool{}
+	var previous *collector.Report
+	for {
+		report, err := scan(opts)
+		if err != nil {
+			return err
+		}
+		printWatchStatus(report, previous)
+		checkWatchThresholds(report, thresholds, over)
+		previous = report
+
+		time.Sleep(interval)
+	}
+}
+
+// printWatchStatus prints the totals of a scan and their change since the
+// previous one.
+func printWatchStatus(report, previous *collector.Report) {
+	line := fmt.Sprintf("Scan: %s, Resources: %d, Total Storage Used: %s",
+		report.GeneratedAt.Format(time.RFC3339), len(report.Entities), formatBytes(report.TotalStorageUsed))
+	if previous != nil {
+		line += fmt.Sprintf(", Change: %s, Resources Added: %d",
+			formatBytesDelta(report.TotalStorageUsed-previous.TotalStorageUsed), len(report.Entities)-len(previous.Entities))
+	}
+	fmt.Fprintln(summaryOut, line)
+}
+
+// checkWatchThresholds alerts on every threshold the report crossed since
+// the previous scan. over holds the thresholds and labels that were over
+// their limit.
+func checkWatchThresholds(report *collector.Report, thresholds []watchThreshold, over map[watchState]bool) {
+	var alerts []string
+	for i, threshold := range thresholds {
+		usage := watchUsage(threshold, report)
+		labels := make([]string, 0, len(usage))
+		for label := range usage {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		for _, label := range labels {
+			used := usage[label]
+			state := watchState{i, label}
+			switch {
+			case used > threshold.Limit && !over[state]:
+				over[state] = true
+				alerts = append(alerts, fmt.Sprintf("%s: %s, crossed %s", label, formatBytes(used), formatBytes(threshold.Limit)))
+			case used <= threshold.Limit && over[state]:
+				delete(over, state)
+				alerts = append(alerts, fmt.Sprintf("%s: %s, back under %s", label, formatBytes(used), formatBytes(threshold.Limit)))
+			}
+		}
+	}
+
+	for _, alert := range alerts {
+		raiseWatchAlert(alert)
+	}
+}
+
+// raiseWatchAlert prints an alert and forwards it to the enabled
+// notifiers.
+func raiseWatchAlert(alert string) {
+	bell := ""
+	if watchOptions.Bell {
+		bell = "\a"
+	}
+	fmt.Fprintf(summaryOut, "%sAlert: %s\n", bell, alert)
+
+	if watchOptions.DesktopNotify && !skipDryRun("raise a desktop notification") {
+		if err := desktopNotify("crankymosquitos", alert); err != nil {
+			slog.Error("failed to raise a desktop notification", "error", err)
+		}
+	}
+	if url := watchOptions.WebhookURL; url != "" && !skipDryRun("post the alert to %s", url) {
+		client := &http.Client{Timeout: 30 * time.Second}
+		if err := postJSON(context.Background(), client, url, slackMessage{Text: "crankymosquitos: " + alert}); err != nil {
+			slog.Error("failed to post the alert", "url", url, "error", err)
+		}
+	}
+}
+
+// desktopNotify raises a desktop notification through the notifier of the
+// platform.
+func desktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("notify-send", title, message)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// Package atrest encrypts the files the tool keeps between runs, such as the
+// caches and the history database, with AES-256-GCM. The key comes from a
+// key file or is a KMS data key stored, encrypted, alongside the data.
+//
+// Files written without a Sealer stay readable after encryption is turned
+// on, so existing caches and databases are encrypted the next time they are
+// written.
+package atrest
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// magic starts every sealed file.
+const magic = "CMSEAL1"
+
+// Key schemes recorded after the magic.
+const (
+	schemeKeyFile byte = 1
+	schemeKMS     byte = 2
+)
+
+// KeySize is the size of the AES-256 keys.
+const KeySize = 32
+
+// ErrSealed is returned when a sealed file is read without a Sealer.
+var ErrSealed = errors.New("file is encrypted; pass the key it was encrypted with")
+
+// Sealer encrypts and decrypts file contents.
+type Sealer interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+// IsSealed reports whether data was written by a Sealer.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// ReadFile reads a file and decrypts it when it is sealed. Plain files are
+// returned as they are, whether or not s is nil.
+func ReadFile(s Sealer, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !IsSealed(data) {
+		return data, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrSealed)
+	}
+	plaintext, err := s.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// WriteFile replaces a file with data through path+".tmp", so an
+// interrupted write never leaves a partial file behind, creating its
+// directory as needed. The data is encrypted, and the file readable only by
+// its owner, when s is not nil.
+func WriteFile(s Sealer, path string, data []byte, perm os.FileMode) error {
+	if s != nil {
+		sealed, err := s.Seal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		data, perm = sealed, 0o600
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// seal encrypts plaintext under key, authenticating the header with it.
+func seal(key, header, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, header...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// open decrypts what follows the header of a sealed file.
+func open(key, header, body []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < gcm.NonceSize() {
+		return nil, errors.New("truncated file")
+	}
+	nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// scheme returns the key scheme of a sealed file.
+func scheme(sealed []byte) (byte, error) {
+	if !IsSealed(sealed) || len(sealed) <= len(magic) {
+		return 0, errors.New("not an encrypted file")
+	}
+	return sealed[len(magic)], nil
+}
+
+// KeyFileSealer seals with a static key.
+type KeyFileSealer struct {
+	key []byte
+}
+
+// NewKeyFileSealer reads a key file holding 32 bytes, raw or hex or base64
+// encoded. Such a key can be created with "openssl rand -hex 32".
+func NewKeyFileSealer(path string) (*KeyFileSealer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+
+	if len(data) == KeySize {
+		return &KeyFileSealer{key: data}, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == KeySize {
+		return &KeyFileSealer{key: key}, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == KeySize {
+		return &KeyFileSealer{key: key}, nil
+	}
+	return nil, fmt.Errorf("encryption key %s must hold %d bytes, raw or hex or base64 encoded", path, KeySize)
+}
+
+func (s *KeyFileSealer) Seal(plaintext []byte) ([]byte, error) {
+	return seal(s.key, []byte(magic+string(schemeKeyFile)), plaintext)
+}
+
+func (s *KeyFileSealer) Open(sealed []byte) ([]byte, error) {
+	if kind, err := scheme(sealed); err != nil {
+		return nil, err
+	} else if kind != schemeKeyFile {
+		return nil, errors.New("file was encrypted with a KMS key, not a key file")
+	}
+	headerLen := len(magic) + 1
+	return open(s.key, sealed[:headerLen], sealed[headerLen:])
+}
+
+// KMSAPI is the part of the KMS API a KMSSealer calls.
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSSealer seals with a data key of a KMS key, generated once per process.
+// The encrypted data key is stored in the file header, so opening a file
+// only needs kms:Decrypt on the key.
+type KMSSealer struct {
+	client KMSAPI
+	keyID  string
+
+	mu        sync.Mutex
+	dataKey   []byte
+	encrypted []byte
+	decrypted map[string][]byte // Plaintext data keys by encrypted data key
+}
+
+// NewKMSSealer returns a sealer using the KMS key with the given ID, ARN or
+// alias.
+func NewKMSSealer(client KMSAPI, keyID string) *KMSSealer {
+	return &KMSSealer{client: client, keyID: keyID, decrypted: map[string][]byte{}}
+}
+
+func (s *KMSSealer) Seal(plaintext []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dataKey == nil {
+		out, err := s.client.GenerateDataKey(context.Background(), &kms.GenerateDataKeyInput{
+			KeyId:   aws.String(s.keyID),
+			KeySpec: kmstypes.DataKeySpecAes256,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+		s.dataKey, s.encrypted = out.Plaintext, out.CiphertextBlob
+		s.decrypted[string(out.CiphertextBlob)] = out.Plaintext
+	}
+
+	header := []byte(magic + string(schemeKMS))
+	header = binary.BigEndian.AppendUint16(header, uint16(len(s.encrypted)))
+	header = append(header, s.encrypted...)
+	return seal(s.dataKey, header, plaintext)
+}
+
+func (s *KMSSealer) Open(sealed []byte) ([]byte, error) {
+	if kind, err := scheme(sealed); err != nil {
+		return nil, err
+	} else if kind != schemeKMS {
+		return nil, errors.New("file was encrypted with a key file, not a KMS key")
+	}
+
+	rest := sealed[len(magic)+1:]
+	if len(rest) < 2 {
+		return nil, errors.New("truncated file")
+	}
+	n := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+n {
+		return nil, errors.New("truncated file")
+	}
+	encrypted := rest[2 : 2+n]
+	headerLen := len(magic) + 1 + 2 + n
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.decrypted[string(encrypted)]
+	if !ok {
+		out, err := s.client.Decrypt(context.Background(), &kms.DecryptInput{
+			CiphertextBlob: encrypted,
+			KeyId:          aws.String(s.keyID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+		}
+		key = out.Plaintext
+		s.decrypted[string(encrypted)] = key
+	}
+	return open(key, sealed[:headerLen], sealed[headerLen:])
+}
@@ -0,0 +1,293 @@
+// Package awsres builds the ARNs and AWS console URLs of the resources
+// crankymosquitos reports. Both depend on the partition of the resource's
+// region, so GovCloud and China resources get working ARNs and links too,
+// and console links also on whether the region is an opt-in region.
+package awsres
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// Partitions a region can belong to.
+const (
+	PartitionAWS      = "aws"
+	PartitionChina    = "aws-cn"
+	PartitionGovCloud = "aws-us-gov"
+	PartitionISO      = "aws-iso"
+	PartitionISOB     = "aws-iso-b"
+)
+
+// optInRegions are the commercial regions disabled until an account opts
+// in to them; the others are enabled by default and cannot be opted out of.
+var optInRegions = map[string]bool{
+	"af-south-1":     true,
+	"ap-east-1":      true,
+	"ap-east-2":      true,
+	"ap-south-2":     true,
+	"ap-southeast-3": true,
+	"ap-southeast-4": true,
+	"ap-southeast-5": true,
+	"ap-southeast-7": true,
+	"ca-west-1":      true,
+	"eu-central-2":   true,
+	"eu-south-1":     true,
+	"eu-south-2":     true,
+	"il-central-1":   true,
+	"me-central-1":   true,
+	"me-south-1":     true,
+	"mx-central-1":   true,
+}
+
+// normalizeRegion returns the lower case name of a region, which is how
+// ARNs and console URLs spell it whatever the input, e.g. a config file.
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// Partition returns the partition of a region, PartitionAWS for unknown
+// regions.
+func Partition(region string) string {
+	region = normalizeRegion(region)
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionChina
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionGovCloud
+	case strings.HasPrefix(region, "us-isob-"):
+		return PartitionISOB
+	case strings.HasPrefix(region, "us-iso-"):
+		return PartitionISO
+	}
+	return PartitionAWS
+}
+
+// ValidPartition reports whether the console and bootstrap regions of a
+// partition are known.
+func ValidPartition(partition string) bool {
+	switch partition {
+	case PartitionAWS, PartitionChina, PartitionGovCloud:
+		return true
+	}
+	return false
+}
+
+// BootstrapRegion returns the region the enabled regions of a partition are
+// listed from.
+func BootstrapRegion(partition string) string {
+	switch partition {
+	case PartitionChina:
+		return "cn-north-1"
+	case PartitionGovCloud:
+		return "us-gov-west-1"
+	}
+	return "us-west-2"
+}
+
+// S3HomeRegion returns the region the buckets of a partition are listed
+// from.
+func S3HomeRegion(partition string) string {
+	switch partition {
+	case PartitionChina:
+		return "cn-north-1"
+	case PartitionGovCloud:
+		return "us-gov-west-1"
+	}
+	return "us-east-1"
+}
+
+func build(service, region, accountID, resource string) string {
+	region = normalizeRegion(region)
+	return arn.ARN{
+		Partition: Partition(region),
+		Service:   service,
+		Region:    region,
+		AccountID: accountID,
+		Resource:  resource,
+	}.String()
+}
+
+// VolumeARN returns the ARN of an EBS volume.
+func VolumeARN(region, accountID, id string) string {
+	return build("ec2", region, accountID, "volume/"+id)
+}
+
+// SnapshotARN returns the ARN of an EBS snapshot. Snapshot ARNs carry no
+// account ID.
+func SnapshotARN(region, id string) string {
+	return build("ec2", region, "", "snapshot/"+id)
+}
+
+// ImageARN returns the ARN of an AMI. Image ARNs carry no account ID.
+func ImageARN(region, id string) string {
+	return build("ec2", region, "", "image/"+id)
+}
+
+// BucketARN returns the ARN of an S3 bucket. Bucket ARNs carry neither a
+// region nor an account ID; the region only selects the partition.
+func BucketARN(region, name string) string {
+	return arn.ARN{Partition: Partition(region), Service: "s3", Resource: name}.String()
+}
+
+// DBInstanceARN returns the ARN of an RDS instance.
+func DBInstanceARN(region, accountID, id string) string {
+	return build("rds", region, accountID, "db:"+id)
+}
+
+// DBClusterARN returns the ARN of an RDS cluster.
+func DBClusterARN(region, accountID, id string) string {
+	return build("rds", region, accountID, "cluster:"+id)
+}
+
+// EFSARN returns the ARN of an EFS file system.
+func EFSARN(region, accountID, id string) string {
+	return build("elasticfilesystem", region, accountID, "file-system/"+id)
+}
+
+// FSxARN returns the ARN of an FSx file system.
+func FSxARN(region, accountID, id string) string {
+	return build("fsx", region, accountID, "file-system/"+id)
+}
+
+// DynamoDBTableARN returns the ARN of a DynamoDB table.
+func DynamoDBTableARN(region, accountID, name string) string {
+	return build("dynamodb", region, accountID, "table/"+name)
+}
+
+// RedshiftClusterARN returns the ARN of a Redshift cluster.
+func RedshiftClusterARN(region, accountID, id string) string {
+	return build("redshift", region, accountID, "cluster:"+id)
+}
+
+// ElastiCacheSnapshotARN returns the ARN of an ElastiCache snapshot.
+func ElastiCacheSnapshotARN(region, accountID, name string) string {
+	return build("elasticache", region, accountID, "snapshot:"+name)
+}
+
+// Endpoint returns the regional HTTPS endpoint of a service, e.g.
+// https://dlm.cn-north-1.amazonaws.com.cn.
+func Endpoint(service, region string) string {
+	region = normalizeRegion(region)
+	suffix := "amazonaws.com"
+	if Partition(region) == PartitionChina {
+		suffix = "amazonaws.com.cn"
+	}
+	return fmt.Sprintf("https://%s.%s.%s", service, region, suffix)
+}
+
+// RoleARN returns the ARN of an IAM role in the given partition. IAM is
+// global, so role ARNs carry no region.
+func RoleARN(partition, accountID, name string) string {
+	return arn.ARN{Partition: partition, Service: "iam", AccountID: accountID, Resource: "role/" + name}.String()
+}
+
+// consoleHost returns the console domain of a region, or "" for partitions
+// without a public console. Regions enabled by default have a console
+// domain of their own; opt-in regions do not, so they are served by the
+// global domain, which picks the region from the region query parameter.
+// GovCloud and China have one console domain per partition.
+func consoleHost(region string) string {
+	region = normalizeRegion(region)
+	switch Partition(region) {
+	case PartitionAWS:
+		if region == "" || optInRegions[region] {
+			return "console.aws.amazon.com"
+		}
+		return region + ".console.aws.amazon.com"
+	case PartitionGovCloud:
+		return "console.amazonaws-us-gov.com"
+	case PartitionChina:
+		return "console.amazonaws.cn"
+	}
+	return ""
+}
+
+// consoleURL returns the console URL of a service page in a region, or ""
+// for partitions without a public console.
+func consoleURL(region, service, query string) string {
+	region = normalizeRegion(region)
+	host := consoleHost(region)
+	if host == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://%s/%s/home?region=%s%s", host, service, region, query)
+}
+
+// VolumeURL returns the console URL of an EBS volume.
+func VolumeURL(region, id string) string {
+	return consoleURL(region, "ec2", "#VolumeDetails:volumeId="+id)
+}
+
+// InstanceURL returns the console URL of an EC2 instance.
+func InstanceURL(region, id string) string {
+	return consoleURL(region, "ec2", "#InstanceDetails:instanceId="+id)
+}
+
+// SnapshotURL returns the console URL of an EBS snapshot.
+func SnapshotURL(region, id string) string {
+	return consoleURL(region, "ec2", "#SnapshotDetails:snapshotId="+id)
+}
+
+// ImageURL returns the console URL of an AMI.
+func ImageURL(region, id string) string {
+	return consoleURL(region, "ec2", "#ImageDetails:imageId="+id)
+}
+
+// BucketURL returns the console URL of an S3 bucket. S3 is a global
+// service, so the commercial partition serves every bucket from the s3
+// console domain, whatever the class of its region.
+func BucketURL(region, name string) string {
+	region = normalizeRegion(region)
+	host := consoleHost(region)
+	switch {
+	case host == "":
+		return ""
+	case Partition(region) == PartitionAWS:
+		host = "s3.console.aws.amazon.com"
+	}
+	return fmt.Sprintf("https://%s/s3/buckets/%s?region=%s", host, url.PathEscape(name), region)
+}
+
+// DBInstanceURL returns the console URL of an RDS instance.
+func DBInstanceURL(region, id string) string {
+	return consoleURL(region, "rds", "#database:id="+id+";is-cluster=false")
+}
+
+// DBClusterURL returns the console URL of an RDS cluster.
+func DBClusterURL(region, id string) string {
+	return consoleURL(region, "rds", "#database:id="+id+";is-cluster=true")
+}
+
+// EFSURL returns the console URL of an EFS file system.
+func EFSURL(region, id string) string {
+	return consoleURL(region, "efs", "#/file-systems/"+id)
+}
+
+// FSxURL returns the console URL of an FSx file system.
+func FSxURL(region, id string) string {
+	return consoleURL(region, "fsx", "#file-system-details/"+id)
+}
+
+// RecoveryPointURL returns the console URL of an AWS Backup recovery point
+// in a vault.
+func RecoveryPointURL(region, vault, recoveryPointARN string) string {
+	return consoleURL(region, "backup", "#/backupvaults/details/"+url.PathEscape(vault)+"/"+url.PathEscape(recoveryPointARN))
+}
+
+// DynamoDBTableURL returns the console URL of a DynamoDB table.
+func DynamoDBTableURL(region, name string) string {
+	return consoleURL(region, "dynamodbv2", "#table?name="+url.QueryEscape(name))
+}
+
+// RedshiftClusterURL returns the console URL of a Redshift cluster.
+func RedshiftClusterURL(region, id string) string {
+	return consoleURL(region, "redshiftv2", "#cluster-details?cluster="+url.QueryEscape(id))
+}
+
+// ElastiCacheSnapshotURL returns the console URL of an ElastiCache snapshot.
+func ElastiCacheSnapshotURL(region, name string) string {
+	return consoleURL(region, "elasticache", "#/snapshots/"+url.PathEscape(name))
+}
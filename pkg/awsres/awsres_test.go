@@ -0,0 +1,121 @@
+package awsres
+
+import "testing"
+
+// regionClasses are a region of each class the ARNs and console links
+// differ by.
+var regionClasses = []struct {
+	name, region string
+	partition    string
+	consoleHost  string
+	bucketURL    string
+}{
+	{
+		name:        "default-enabled",
+		region:      "us-east-1",
+		partition:   PartitionAWS,
+		consoleHost: "us-east-1.console.aws.amazon.com",
+		bucketURL:   "https://s3.console.aws.amazon.com/s3/buckets/my%20bucket?region=us-east-1",
+	},
+	{
+		name:        "opt-in",
+		region:      "me-south-1",
+		partition:   PartitionAWS,
+		consoleHost: "console.aws.amazon.com",
+		bucketURL:   "https://s3.console.aws.amazon.com/s3/buckets/my%20bucket?region=me-south-1",
+	},
+	{
+		name:        "GovCloud",
+		region:      "us-gov-west-1",
+		partition:   PartitionGovCloud,
+		consoleHost: "console.amazonaws-us-gov.com",
+		bucketURL:   "https://console.amazonaws-us-gov.com/s3/buckets/my%20bucket?region=us-gov-west-1",
+	},
+	{
+		name:        "China",
+		region:      "cn-north-1",
+		partition:   PartitionChina,
+		consoleHost: "console.amazonaws.cn",
+		bucketURL:   "https://console.amazonaws.cn/s3/buckets/my%20bucket?region=cn-north-1",
+	},
+	{
+		name:      "ISO",
+		region:    "us-iso-east-1",
+		partition: PartitionISO,
+	},
+	{
+		name:      "ISOB",
+		region:    "us-isob-east-1",
+		partition: PartitionISOB,
+	},
+}
+
+func TestPartition(t *testing.T) {
+	for _, class := range regionClasses {
+		t.Run(class.name, func(t *testing.T) {
+			if got := Partition(class.region); got != class.partition {
+				t.Errorf("Partition(%q) = %q, want %q", class.region, got, class.partition)
+			}
+		})
+	}
+	if got := Partition(" CN-NORTHWEST-1 "); got != PartitionChina {
+		t.Errorf("Partition of an unnormalized region = %q, want %q", got, PartitionChina)
+	}
+}
+
+func TestARNs(t *testing.T) {
+	for _, class := range regionClasses {
+		t.Run(class.name, func(t *testing.T) {
+			prefix := "arn:" + class.partition + ":"
+			tests := []struct{ got, want string }{
+				{VolumeARN(class.region, "123456789012", "vol-1"), prefix + "ec2:" + class.region + ":123456789012:volume/vol-1"},
+				{SnapshotARN(class.region, "snap-1"), prefix + "ec2:" + class.region + "::snapshot/snap-1"},
+				{ImageARN(class.region, "ami-1"), prefix + "ec2:" + class.region + "::image/ami-1"},
+				{BucketARN(class.region, "bucket"), prefix + "s3:::bucket"},
+				{DBInstanceARN(class.region, "123456789012", "db"), prefix + "rds:" + class.region + ":123456789012:db:db"},
+				{DBClusterARN(class.region, "123456789012", "aurora"), prefix + "rds:" + class.region + ":123456789012:cluster:aurora"},
+				{EFSARN(class.region, "123456789012", "fs-1"), prefix + "elasticfilesystem:" + class.region + ":123456789012:file-system/fs-1"},
+				{FSxARN(class.region, "123456789012", "fs-2"), prefix + "fsx:" + class.region + ":123456789012:file-system/fs-2"},
+				{DynamoDBTableARN(class.region, "123456789012", "orders"), prefix + "dynamodb:" + class.region + ":123456789012:table/orders"},
+				{RedshiftClusterARN(class.region, "123456789012", "warehouse"), prefix + "redshift:" + class.region + ":123456789012:cluster:warehouse"},
+				{ElastiCacheSnapshotARN(class.region, "123456789012", "nightly"), prefix + "elasticache:" + class.region + ":123456789012:snapshot:nightly"},
+				{RoleARN(class.partition, "123456789012", "reader"), prefix + "iam::123456789012:role/reader"},
+			}
+			for _, test := range tests {
+				if test.got != test.want {
+					t.Errorf("got %q, want %q", test.got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestConsoleHost(t *testing.T) {
+	for _, class := range regionClasses {
+		t.Run(class.name, func(t *testing.T) {
+			if got := consoleHost(class.region); got != class.consoleHost {
+				t.Errorf("consoleHost(%q) = %q, want %q", class.region, got, class.consoleHost)
+			}
+		})
+	}
+	if got := consoleHost(""); got != "console.aws.amazon.com" {
+		t.Errorf("consoleHost of no region = %q, want the global domain", got)
+	}
+}
+
+func TestConsoleURLs(t *testing.T) {
+	for _, class := range regionClasses {
+		t.Run(class.name, func(t *testing.T) {
+			want := ""
+			if class.consoleHost != "" {
+				want = "https://" + class.consoleHost + "/ec2/home?region=" + class.region + "#VolumeDetails:volumeId=vol-1"
+			}
+			if got := VolumeURL(class.region, "vol-1"); got != want {
+				t.Errorf("VolumeURL = %q, want %q", got, want)
+			}
+			if got := BucketURL(class.region, "my bucket"); got != class.bucketURL {
+				t.Errorf("BucketURL = %q, want %q", got, class.bucketURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Access classes of volumes.
+const (
+	AccessHot  = "hot"
+	AccessWarm = "warm"
+	AccessCold = "cold"
+)
+
+// Recommendations for volumes by access class.
+const (
+	RecommendSnapshotAndDelete = "snapshot and delete"
+	RecommendSC1               = "migrate to sc1"
+	RecommendST1               = "migrate to st1"
+)
+
+// DefaultAccessLookback is the CloudWatch window volume IO is summed over.
+const DefaultAccessLookback = 14 * 24 * time.Hour
+
+const (
+	// Volumes with fewer read and write operations per day are cold...
+	coldOpsPerDay = 1_000
+	// ...and volumes with fewer than this warm.
+	warmOpsPerDay = 1_000_000
+
+	// st1 and sc1 volumes cannot be smaller than this.
+	minHDDVolumeSize = 125 * gib
+
+	// GetMetricData accepts at most 500 queries per call, two per volume.
+	volumesPerMetricDataCall = 250
+)
+
+// AccessClassTotal totals the volumes of one access class.
+type AccessClassTotal struct {
+	Class       string
+	Volumes     int
+	StorageUsed int64
+}
+
+// classifyVolumes sets the access class and recommendation of every volume
+// from its attachment, age and the IO operations CloudWatch recorded over the
+// lookback window. Volumes younger than the window are not classified.
+func (c *StorageCollector) classifyVolumes(ctx context.Context, cw *cloudwatch.Client, entities []EntityUsage, now time.Time) {
+	lookback := c.opts.AccessLookback
+
+	var volumes []*EntityUsage
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type == EntityTypeVolume && now.Sub(entity.CreateTime) >= lookback {
+			volumes = append(volumes, entity)
+		}
+	}
+
+	for start := 0; start < len(volumes); start += volumesPerMetricDataCall {
+		batch := volumes[start:min(start+volumesPerMetricDataCall, len(volumes))]
+
+		ops, err := getVolumeOps(ctx, cw, batch, now, lookback)
+		if err != nil {
+			slog.Error("failed to get volume IO metrics", "error", err)
+			continue
+		}
+
+		days := lookback.Hours() / 24
+		for _, volume := range batch {
+			volume.AccessClass = accessClass(*volume, ops[volume.ID]/days)
+			volume.Recommendation = recommendation(*volume)
+		}
+	}
+}
+
+// getVolumeOps returns the read plus write operations of each volume over
+// the lookback window.
+func getVolumeOps(ctx context.Context, cw *cloudwatch.Client, volumes []*EntityUsage, now time.Time, lookback time.Duration) (map[string]float64, error) {
+	period := int32(lookback.Truncate(time.Hour).Seconds())
+
+	// Query IDs are "r" or "w" followed by the index of the volume.
+	metrics := []struct{ prefix, name string }{{"r", "VolumeReadOps"}, {"w", "VolumeWriteOps"}}
+
+	var queries []cwtypes.MetricDataQuery
+	for i, volume := range volumes {
+		for _, metric := range metrics {
+			queries = append(queries, cwtypes.MetricDataQuery{
+				Id: aws.String(fmt.Sprintf("%s%d", metric.prefix, i)),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String("AWS/EBS"),
+						MetricName: aws.String(metric.name),
+						Dimensions: []cwtypes.Dimension{{Name: aws.String("VolumeId"), Value: aws.String(volume.ID)}},
+					},
+					Period: aws.Int32(period),
+					Stat:   aws.String("Sum"),
+				},
+			})
+		}
+	}
+
+	ops := map[string]float64{}
+	paginator := cloudwatch.NewGetMetricDataPaginator(cw, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(now.Add(-lookback)),
+		EndTime:           aws.Time(now),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range page.MetricDataResults {
+			index, err := strconv.Atoi(aws.ToString(result.Id)[1:])
+			if err != nil || index >= len(volumes) {
+				continue
+			}
+			for _, value := range result.Values {
+				ops[volumes[index].ID] += value
+			}
+		}
+	}
+
+	return ops, nil
+}
+
+func accessClass(volume EntityUsage, opsPerDay float64) string {
+	switch {
+	case volume.AttachedInstance == "" || opsPerDay < coldOpsPerDay:
+		return AccessCold
+	case opsPerDay < warmOpsPerDay:
+		return AccessWarm
+	}
+	return AccessHot
+}
+
+func recommendation(volume EntityUsage) string {
+	switch volume.AccessClass {
+	case AccessCold:
+		if volume.AttachedInstance == "" {
+			return RecommendSnapshotAndDelete
+		}
+		if volume.VolumeType != "sc1" && volume.StorageUsed >= minHDDVolumeSize {
+			return RecommendSC1
+		}
+	case AccessWarm:
+		if volume.VolumeType != "st1" && volume.VolumeType != "sc1" && volume.StorageUsed >= minHDDVolumeSize {
+			return RecommendST1
+		}
+	}
+	return ""
+}
+
+// AccessClassTotals totals the classified volumes by access class, hot
+// first.
+func AccessClassTotals(entities []EntityUsage) []AccessClassTotal {
+	totals := []AccessClassTotal{{Class: AccessHot}, {Class: AccessWarm}, {Class: AccessCold}}
+	for _, entity := range entities {
+		for i := range totals {
+			if totals[i].Class == entity.AccessClass {
+				totals[i].Volumes++
+				totals[i].StorageUsed += entity.StorageUsed
+			}
+		}
+	}
+	return totals
+}
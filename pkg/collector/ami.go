@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// ImageUsage is the storage footprint of a self-owned AMI. Snapshots backing
+// several AMIs count towards the StorageUsed of each but towards the
+// UniqueStorageUsed of none, which is what deregistering the AMI and
+// deleting its snapshots would reclaim.
+type ImageUsage struct {
+	ID                string
+	Name              string
+	Region            string
+	CreationDate      time.Time
+	Snapshots         []string
+	StorageUsed       int64
+	UniqueStorageUsed int64
+}
+
+// imageSnapshot is a snapshot of a block device mapping.
+// ImageReport is the storage footprint of the self-owned AMIs.
+type ImageReport struct {
+	Images []ImageUsage // Largest first
+	// Snapshots and StorageUsed count every backing snapshot once, however
+	// many AMIs share it.
+	Snapshots   int
+	StorageUsed int64
+}
+
+type imageSnapshot struct {
+	ID   string
+	Size int64
+}
+
+type describedImage struct {
+	usage     ImageUsage
+	snapshots []imageSnapshot
+}
+
+// Images reports the self-owned AMIs of the configured regions with their
+// storage footprint.
+func (c *StorageCollector) Images(ctx context.Context) ImageReport {
+	images := c.describeImages(ctx)
+	var report ImageReport
+
+	// A snapshot is shared when more than one AMI uses it.
+	users := map[string]int{}
+	for _, image := range images {
+		seen := map[string]bool{}
+		for _, snapshot := range image.snapshots {
+			key := image.usage.Region + "/" + snapshot.ID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if users[key] == 0 {
+				report.Snapshots++
+				report.StorageUsed += snapshot.Size
+			}
+			users[key]++
+		}
+	}
+
+	usages := make([]ImageUsage, 0, len(images))
+	for _, image := range images {
+		usage := image.usage
+		for _, snapshot := range image.snapshots {
+			usage.Snapshots = append(usage.Snapshots, snapshot.ID)
+			usage.StorageUsed += snapshot.Size
+			if users[usage.Region+"/"+snapshot.ID] == 1 {
+				usage.UniqueStorageUsed += snapshot.Size
+			}
+		}
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].StorageUsed != usages[j].StorageUsed {
+			return usages[i].StorageUsed > usages[j].StorageUsed
+		}
+		return usages[i].ID < usages[j].ID
+	})
+	report.Images = usages
+
+	return report
+}
+
+// AMISnapshotIDs returns the IDs of every snapshot backing a self-owned AMI
+// in the configured regions.
+func (c *StorageCollector) AMISnapshotIDs(ctx context.Context) map[string]bool {
+	snapshotIDs := map[string]bool{}
+	for _, image := range c.describeImages(ctx) {
+		for _, snapshot := range image.snapshots {
+			snapshotIDs[snapshot.ID] = true
+		}
+	}
+
+	return snapshotIDs
+}
+
+// describeImages lists the self-owned AMIs of every configured region.
+func (c *StorageCollector) describeImages(ctx context.Context) []describedImage {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+	var images []describedImage
+
+	for _, region := range c.opts.Regions {
+		wg.Add(1)
+
+		go func(region string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			client, err := c.ec2Client(ctx, region)
+			if err != nil {
+				slog.Error("failed to create EC2 client", "region", region, "error", err)
+				return
+			}
+
+			slog.Debug("querying images", "region", region)
+			found, err := describeRegionImages(ctx, client, region)
+			if err != nil {
+				slog.Error("failed to describe images", "region", region, "error", err)
+				return
+			}
+
+			mu.Lock()
+			images = append(images, found...)
+			mu.Unlock()
+		}(region)
+	}
+
+	wg.Wait()
+
+	return images
+}
+
+func describeRegionImages(ctx context.Context, client EC2DescribeAPI, region string) ([]describedImage, error) {
+	var images []describedImage
+
+	paginator := ec2.NewDescribeImagesPaginator(client, &ec2.DescribeImagesInput{
+		Owners: []string{"self"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, image := range page.Images {
+			described := describedImage{usage: ImageUsage{
+				ID:     aws.ToString(image.ImageId),
+				Name:   aws.ToString(image.Name),
+				Region: region,
+			}}
+			if created, err := time.Parse(time.RFC3339, aws.ToString(image.CreationDate)); err == nil {
+				described.usage.CreationDate = created
+			}
+
+			for _, mapping := range image.BlockDeviceMappings {
+				if mapping.Ebs == nil || mapping.Ebs.SnapshotId == nil {
+					continue
+				}
+				described.snapshots = append(described.snapshots, imageSnapshot{
+					ID:   aws.ToString(mapping.Ebs.SnapshotId),
+					Size: int64(aws.ToInt32(mapping.Ebs.VolumeSize)) * gib,
+				})
+			}
+
+			images = append(images, described)
+		}
+	}
+
+	return images, nil
+}
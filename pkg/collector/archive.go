@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// ArchiveMinimumDays is the minimum time Snapshot Archive bills a snapshot
+// for. Snapshots restored or deleted earlier are charged the remainder.
+const ArchiveMinimumDays = 90
+
+// ArchiveCandidate is a standard tier snapshot that could move to Snapshot
+// Archive, with the monthly cost of either tier. Costs are in USD.
+type ArchiveCandidate struct {
+	Snapshot EntityUsage
+	Age      time.Duration
+
+	StandardMonthlyCostUSD float64
+	ArchiveMonthlyCostUSD  float64
+	// MinimumCostUSD is what the archive bills even when the snapshot is
+	// restored or deleted right away: ArchiveMinimumDays of storage.
+	MinimumCostUSD float64
+	// RestoreCostUSD is the retrieval fee of restoring the snapshot to the
+	// standard tier once.
+	RestoreCostUSD float64
+}
+
+// MonthlySavingsUSD is the monthly cost the move would save.
+func (a ArchiveCandidate) MonthlySavingsUSD() float64 {
+	return a.StandardMonthlyCostUSD - a.ArchiveMonthlyCostUSD
+}
+
+// ArchiveCandidates prices moving every completed standard tier snapshot at
+// least olderThan old to Snapshot Archive, largest savings first. Snapshots
+// backing an AMI are left out: instances cannot launch from an archived
+// snapshot. An archived snapshot is a full copy, so its archive cost is
+// that of its StorageUsed, which for incremental snapshots measured with
+// Options.AccurateSnapshotSize understates it.
+func (c *StorageCollector) ArchiveCandidates(ctx context.Context, entities []EntityUsage, amiSnapshots map[string]bool, now time.Time, olderThan time.Duration) ([]ArchiveCandidate, error) {
+	book, err := c.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byRegion := map[string][]EntityUsage{}
+	for _, entity := range entities {
+		if entity.Type != EntityTypeSnapshot || entity.State != "completed" || amiSnapshots[entity.ID] {
+			continue
+		}
+		if EntityAge(entity, now) < olderThan {
+			continue
+		}
+		byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+	}
+
+	var candidates []ArchiveCandidate
+	for region, snapshots := range byRegion {
+		prices := map[string]float64{}
+		for _, kind := range []string{snapshotPriceKey, snapshotArchivePriceKey, snapshotRetrievalPriceKey} {
+			if prices[kind], err = book.Price(ctx, region, kind); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			slog.Error("failed to look up archive prices", "region", region, "error", err)
+			continue
+		}
+
+		for _, snapshot := range snapshots {
+			gb := float64(snapshot.StorageUsed) / gib
+			archive := prices[snapshotArchivePriceKey] * gb
+			candidates = append(candidates, ArchiveCandidate{
+				Snapshot:               snapshot,
+				Age:                    EntityAge(snapshot, now),
+				StandardMonthlyCostUSD: prices[snapshotPriceKey] * gb,
+				ArchiveMonthlyCostUSD:  archive,
+				MinimumCostUSD:         archive * ArchiveMinimumDays / 30,
+				RestoreCostUSD:         prices[snapshotRetrievalPriceKey] * gb,
+			})
+		}
+	}
+
+	savePrices(book)
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].MonthlySavingsUSD() != candidates[j].MonthlySavingsUSD() {
+			return candidates[i].MonthlySavingsUSD() > candidates[j].MonthlySavingsUSD()
+		}
+		return candidates[i].Snapshot.ID < candidates[j].Snapshot.ID
+	})
+
+	return candidates, nil
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+// emptyPayloadHash is the SigV4 payload hash of a request without a body,
+// the SHA-256 of nothing.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// apiRequest is a GET request to a REST API without a service client among
+// the dependencies, which is DLM only; every other service is called through
+// its SDK client.
+type apiRequest struct {
+	name      string // Counted as the service of the API call
+	operation string // Counted as the operation of the API call
+	service   string // Signing name and endpoint prefix
+	path      string
+}
+
+// callAPI sends a SigV4-signed request to the API of a region and returns
+// the response body. Failed attempts are retried as the SDK clients retry
+// them, with the retryer of cfg, so Options.MaxAPIRetries and the throttle
+// backoff and counting apply; the call is counted once, retries not.
+func (c *StorageCollector) callAPI(ctx context.Context, cfg aws.Config, region string, request apiRequest) ([]byte, error) {
+	if cfg.Credentials == nil {
+		return nil, errors.New("no credentials configured")
+	}
+	if err := c.countAPICall(region, request.name, request.operation); err != nil {
+		return nil, err
+	}
+
+	var retryer aws.Retryer = retry.NewStandard()
+	if cfg.Retryer != nil {
+		retryer = cfg.Retryer()
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, err := sendAPIRequest(ctx, cfg, region, request)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= retryer.MaxAttempts() || !retryer.IsErrorRetryable(err) {
+			c.countRegionError(region)
+			return nil, err
+		}
+
+		delay, delayErr := retryer.RetryDelay(attempt, err)
+		if delayErr != nil {
+			c.countRegionError(region)
+			return nil, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// sendAPIRequest makes one attempt of a callAPI request. Error responses
+// are returned as smithy API errors, which the retryer classifies by their
+// status and error code.
+func sendAPIRequest(ctx context.Context, cfg aws.Config, region string, request apiRequest) ([]byte, error) {
+	endpoint := awsres.Endpoint(request.service, region)
+	if cfg.BaseEndpoint != nil {
+		endpoint = strings.TrimSuffix(aws.ToString(cfg.BaseEndpoint), "/")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+request.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, emptyPayloadHash, request.service, region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	var client aws.HTTPClient = http.DefaultClient
+	if cfg.HTTPClient != nil {
+		client = cfg.HTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// REST APIs name the error in X-Amzn-ErrorType, e.g.
+		// "ThrottlingException:http://internal.amazon.com/coral/..."
+		code, _, _ := strings.Cut(resp.Header.Get("X-Amzn-ErrorType"), ":")
+		if code == "" {
+			code = resp.Status
+		}
+		return nil, &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: resp},
+			Err:      &smithy.GenericAPIError{Code: code, Message: strings.TrimSpace(string(body))},
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// ApplyBackupSLA sets BackupAgeHours on every volume whose tag value matches
+// an SLA. Volumes that were never snapshotted get an infinite age.
+func ApplyBackupSLA(entities []EntityUsage, tag string, sla map[string]time.Duration, now time.Time) {
+	latest := latestSnapshots(entities)
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type != EntityTypeVolume {
+			continue
+		}
+
+		maxAge, ok := sla[entity.Tags[tag]]
+		if !ok {
+			continue
+		}
+
+		age := math.Inf(1)
+		if last, ok := latest[entity.ID]; ok {
+			age = now.Sub(last).Hours()
+		}
+
+		entity.BackupAgeHours = &age
+		entity.BackupSLAMaxAge = maxAge
+	}
+}
+
+// ApplySnapshotCoverage sets SnapshotAge on every in-use volume and
+// flags the ones whose latest completed snapshot is older than maxAge, or
+// that were never snapshotted, with SnapshotGap.
+func ApplySnapshotCoverage(entities []EntityUsage, maxAge time.Duration, now time.Time) {
+	latest := latestSnapshots(entities)
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type != EntityTypeVolume || entity.AttachedInstance == "" {
+			continue
+		}
+
+		age := math.Inf(1)
+		if last, ok := latest[entity.ID]; ok {
+			age = now.Sub(last).Seconds()
+		}
+
+		entity.SnapshotAge = &age
+		entity.SnapshotGap = age > maxAge.Seconds()
+	}
+}
+
+// latestSnapshots returns the start time of the most recent completed
+// snapshot of every volume, by volume ID.
+func latestSnapshots(entities []EntityUsage) map[string]time.Time {
+	latest := map[string]time.Time{}
+	for _, entity := range entities {
+		if entity.Type != EntityTypeSnapshot || entity.State != "completed" {
+			continue
+		}
+		if entity.StartTime.After(latest[entity.SourceVolume]) {
+			latest[entity.SourceVolume] = entity.StartTime
+		}
+	}
+	return latest
+}
+
+// BackupSLAViolated reports whether the volume's latest snapshot is older
+// than its SLA allows.
+func (e EntityUsage) BackupSLAViolated() bool {
+	return e.BackupAgeHours != nil && *e.BackupAgeHours > e.BackupSLAMaxAge.Hours()
+}
@@ -0,0 +1,234 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+)
+
+// checkpointInterval bounds how often the snapshot pages of a region are
+// written to the checkpoint; completed regions are written at once.
+const checkpointInterval = 10 * time.Second
+
+// snapshotPageSize is the DescribeSnapshots page size of a checkpointed
+// scan.
+const snapshotPageSize = 1000
+
+// Checkpoint records the progress of a scan in a file so that an
+// interrupted scan resumes where it stopped: completed regions are not
+// scanned again and the snapshot listing of a region resumes from its last
+// completed page. A checkpoint only resumes scans with the same services,
+// snapshot owners and filters as the scan that wrote it. Its methods may be
+// called concurrently; a nil Checkpoint records nothing.
+type Checkpoint struct {
+	file   string
+	sealer atrest.Sealer
+
+	mu      sync.Mutex
+	state   checkpointState
+	written time.Time
+}
+
+type checkpointState struct {
+	Fingerprint string
+	Regions     map[string]*checkpointRegion // By checkpointKey
+}
+
+// checkpointRegion is the progress of a region: its entities once it
+// completed, or the snapshots listed so far.
+type checkpointRegion struct {
+	Completed bool          `json:",omitempty"`
+	Entities  []EntityUsage `json:",omitempty"`
+
+	SnapshotsListed bool             `json:",omitempty"` // Every page of Snapshots was listed
+	SnapshotsToken  string           `json:",omitempty"` // NextToken of the next page
+	Snapshots       []types.Snapshot `json:",omitempty"`
+}
+
+// LoadCheckpoint returns the checkpoint of the scans of opts in file. A
+// missing file, or one written by a scan with other options, starts a new
+// checkpoint; Options.Sealer encrypts it.
+func LoadCheckpoint(file string, opts Options) (*Checkpoint, error) {
+	fingerprint, err := checkpointFingerprint(opts)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{
+		file:   file,
+		sealer: opts.Sealer,
+		state:  checkpointState{Fingerprint: fingerprint, Regions: map[string]*checkpointRegion{}},
+	}
+
+	data, err := atrest.ReadFile(opts.Sealer, file)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", file, err)
+	}
+	if state.Fingerprint != fingerprint {
+		slog.Warn("starting over: checkpoint written by a scan with other options", "file", file)
+		return checkpoint, nil
+	}
+	if state.Regions != nil {
+		checkpoint.state.Regions = state.Regions
+	}
+	return checkpoint, nil
+}
+
+// checkpointFingerprint identifies the options whose scans a checkpoint
+// can resume.
+func checkpointFingerprint(opts Options) (string, error) {
+	services := slices.Clone(opts.Services)
+	if len(services) == 0 {
+		services = DefaultServices
+	}
+	slices.Sort(services)
+
+	data, err := json.Marshal([]any{
+		services, opts.SnapshotOwners, opts.SnapshotFilter, opts.TagFilters,
+		opts.IncludeSharedSnapshots, opts.SharedSnapshots, opts.AccurateSnapshotSize, opts.ClassifyAccess,
+		opts.InstanceDetails,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Regions returns the number of completed regions, and the number of
+// regions with snapshot pages, recorded.
+func (c *Checkpoint) Regions() (completed, listing int) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, region := range c.state.Regions {
+		if region.Completed {
+			completed++
+		} else if len(region.Snapshots) > 0 || region.SnapshotsListed {
+			listing++
+		}
+	}
+	return completed, listing
+}
+
+// Flush writes the checkpoint.
+func (c *Checkpoint) Flush() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write()
+}
+
+// Remove deletes the checkpoint file of a completed scan and forgets its
+// progress, so the next scan starts over.
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Regions = map[string]*checkpointRegion{}
+	if err := os.Remove(c.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// write must be called with c.mu held.
+func (c *Checkpoint) write() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	c.written = time.Now()
+	return atrest.WriteFile(c.sealer, c.file, data, 0o600)
+}
+
+func (c *Checkpoint) region(key string) *checkpointRegion {
+	region, ok := c.state.Regions[key]
+	if !ok {
+		region = &checkpointRegion{}
+		c.state.Regions[key] = region
+	}
+	return region
+}
+
+// completed returns the entities of a region completed by an earlier scan.
+func (c *Checkpoint) completed(key string) ([]EntityUsage, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	region, ok := c.state.Regions[key]
+	if !ok || !region.Completed {
+		return nil, false
+	}
+	return region.Entities, true
+}
+
+// complete records the entities of a completed region and writes the
+// checkpoint.
+func (c *Checkpoint) complete(key string, entities []EntityUsage) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Regions[key] = &checkpointRegion{Completed: true, Entities: entities}
+	if err := c.write(); err != nil {
+		slog.Error("failed to write checkpoint", "file", c.file, "error", err)
+	}
+}
+
+// snapshotPages returns the snapshots of a region listed by an earlier
+// scan, the token of the next page and whether every page was listed.
+func (c *Checkpoint) snapshotPages(key string) (snapshots []types.Snapshot, token string, listed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	region, ok := c.state.Regions[key]
+	if !ok {
+		return nil, "", false
+	}
+	return slices.Clone(region.Snapshots), region.SnapshotsToken, region.SnapshotsListed
+}
+
+// snapshotPage records the snapshots of a region listed up to the page
+// before token, "" once every page was listed. The checkpoint is written
+// at most every checkpointInterval, and after the last page.
+func (c *Checkpoint) snapshotPage(key string, snapshots []types.Snapshot, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	region := c.region(key)
+	region.Snapshots = snapshots
+	region.SnapshotsToken = token
+	region.SnapshotsListed = token == ""
+
+	if token != "" && time.Since(c.written) < checkpointInterval {
+		return
+	}
+	if err := c.write(); err != nil {
+		slog.Error("failed to write checkpoint", "file", c.file, "error", err)
+	}
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// loadConfig returns the configuration buildConfig builds for a region,
+// building it once per collector so that the jobs, name lookups and
+// analyses of a region share its retryer, middleware and credentials
+// instead of each going through Options.LoadConfig again. Failures are not
+// remembered, so a later call retries them.
+func (c *StorageCollector) loadConfig(ctx context.Context, region string) (aws.Config, error) {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+
+	if cfg, ok := c.configs[region]; ok {
+		return cfg, nil
+	}
+
+	cfg, err := c.buildConfig(ctx, region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if c.configs == nil {
+		c.configs = map[string]aws.Config{}
+	}
+	c.configs[region] = cfg
+	return cfg, nil
+}
+
+// ec2Client returns the EC2 client of a region, created once per collector.
+func (c *StorageCollector) ec2Client(ctx context.Context, region string) (EC2DescribeAPI, error) {
+	cfg, err := c.loadConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return c.regionEC2Client(region, cfg), nil
+}
+
+// regionEC2Client returns the EC2 client of a region, creating it from cfg,
+// the region's loadConfig configuration, on first use.
+func (c *StorageCollector) regionEC2Client(region string, cfg aws.Config) EC2DescribeAPI {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+
+	if client, ok := c.ec2Clients[region]; ok {
+		return client
+	}
+	if c.ec2Clients == nil {
+		c.ec2Clients = map[string]EC2DescribeAPI{}
+	}
+	client := c.opts.NewEC2Client(cfg)
+	c.ec2Clients[region] = client
+	return client
+}
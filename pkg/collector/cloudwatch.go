@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// getLatestMetricAverage returns the most recent Average datapoint of a
+// CloudWatch metric within the lookback window, and whether one was found.
+func getLatestMetricAverage(ctx context.Context, cw *cloudwatch.Client, namespace, name string, dimensions []cwtypes.Dimension, lookback time.Duration, period int32) (float64, bool, error) {
+	now := time.Now()
+	resp, err := cw.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String(namespace),
+		MetricName: aws.String(name),
+		Dimensions: dimensions,
+		StartTime:  aws.Time(now.Add(-lookback)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int32(period),
+		Statistics: []cwtypes.Statistic{cwtypes.StatisticAverage},
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	var latest *cwtypes.Datapoint
+	for i := range resp.Datapoints {
+		point := &resp.Datapoints[i]
+		if latest == nil || point.Timestamp.After(*latest.Timestamp) {
+			latest = point
+		}
+	}
+
+	if latest == nil {
+		return 0, false, nil
+	}
+
+	return aws.ToFloat64(latest.Average), true, nil
+}
@@ -0,0 +1,555 @@
+// Package collector scans AWS accounts for the storage their volumes,
+// snapshots, buckets and databases use.
+//
+// A StorageCollector holds no global state, so several can scan different
+// accounts or regions concurrently:
+//
+//	c := collector.New(collector.Options{Regions: []string{"us-east-1"}})
+//	report, err := c.Scan(ctx)
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+	"golang.org/x/time/rate"
+)
+
+// Services a collector can scan.
+const (
+	ServiceEBS       = "ebs"
+	ServiceSnapshots = "snapshots"
+	ServiceRDS       = "rds"
+	ServiceEFS       = "efs"
+	ServiceFSx       = "fsx"
+	ServiceS3        = "s3"
+	ServiceBackup    = "backup"
+
+	ServiceDynamoDB    = "dynamodb"
+	ServiceRedshift    = "redshift"
+	ServiceElastiCache = "elasticache"
+)
+
+// DefaultServices are scanned when Options.Services is empty.
+var DefaultServices = []string{ServiceEBS, ServiceSnapshots, ServiceRDS, ServiceEFS, ServiceFSx, ServiceBackup}
+
+// AllServices lists every service a collector can scan, the default ones
+// first.
+var AllServices = []string{ServiceEBS, ServiceSnapshots, ServiceRDS, ServiceEFS, ServiceFSx, ServiceBackup, ServiceS3, ServiceDynamoDB, ServiceRedshift, ServiceElastiCache}
+
+// DefaultConcurrency bounds the concurrent per-region API workers.
+const DefaultConcurrency = 100
+
+// DefaultJobTimeout bounds a scan job when Options.JobTimeout is zero.
+const DefaultJobTimeout = 10 * time.Minute
+
+// ConfigLoader returns the AWS configuration used for a region.
+type ConfigLoader func(ctx context.Context, region string) (aws.Config, error)
+
+// LoadDefaultConfig loads the shared AWS configuration for a region.
+func LoadDefaultConfig(ctx context.Context, region string) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx, config.WithRegion(region))
+}
+
+// NewSharedConfigLoader returns a ConfigLoader that loads the shared AWS
+// configuration once, on first use, and derives every region's
+// configuration from it. Credentials are not resolved until the first API
+// call and are then cached for all regions, so scanning many regions does
+// not resolve or refresh them once per region. The options, such as
+// config.WithSharedConfigProfile, apply to that one load.
+func NewSharedConfigLoader(optFns ...func(*config.LoadOptions) error) ConfigLoader {
+	var (
+		once sync.Once
+		base aws.Config
+		err  error
+	)
+
+	return func(ctx context.Context, region string) (aws.Config, error) {
+		once.Do(func() {
+			base, err = config.LoadDefaultConfig(ctx, optFns...)
+		})
+		if err != nil {
+			return aws.Config{}, err
+		}
+
+		cfg := base.Copy()
+		cfg.Region = region
+		return cfg, nil
+	}
+}
+
+// Options configure a StorageCollector.
+type Options struct {
+	// Regions to scan. S3 is global and ignores it.
+	Regions []string
+	// Partition the regions belong to, awsres.PartitionAWS when empty. S3
+	// buckets are listed from its home region.
+	Partition string
+	// S3UsePathStyle addresses buckets in the request path, as endpoints
+	// such as LocalStack require.
+	S3UsePathStyle bool
+	// Services to scan, DefaultServices when empty.
+	Services []string
+	// Concurrency bounds concurrent API workers, DefaultConcurrency when zero.
+	Concurrency int
+	// JobTimeout bounds each scan job, one service in one region,
+	// DefaultJobTimeout when zero and unbounded when negative.
+	JobTimeout time.Duration
+	// RegionTimeout bounds all the jobs of a region together, from the
+	// start of its first job, when positive. A region running out of time
+	// is left out of the report and listed in Report.FailedRegions.
+	RegionTimeout time.Duration
+	// LoadConfig builds the AWS configuration per region, a
+	// NewSharedConfigLoader when nil. Its retryer is replaced by NewRetryer.
+	LoadConfig ConfigLoader
+	// NewEC2Client creates the EC2 clients, NewEC2Client when nil. Tests
+	// inject an in-memory fake through it.
+	NewEC2Client EC2ClientFactory
+	// MaxAPIRetries bounds the retries of a failed or throttled API call,
+	// DefaultMaxAPIRetries when zero and none when negative.
+	MaxAPIRetries int
+	// APIRateLimit bounds the EC2 API calls per second in each region,
+	// retries included, with a token bucket. Zero means no limit.
+	APIRateLimit float64
+	// MaxAPICalls bounds the AWS API calls of a scan, retries not counted.
+	// Past it the scan fails with ErrAPIBudgetExceeded, or with
+	// APIBudgetDegrade carries on without its enrichment lookups. Zero
+	// means no limit.
+	MaxAPICalls int64
+	// APIBudgetDegrade skips the lookups of names, instance details, volume
+	// modifications, snapshot sizes, access classes and AMIs once
+	// MaxAPICalls is reached, instead of failing the scan.
+	APIBudgetDegrade bool
+
+	// Scope limits collection to its members when set.
+	Scope *Scope
+	// SnapshotFilter narrows the snapshots collected.
+	SnapshotFilter SnapshotFilter
+	// TagFilters limits collection to resources with matching tags, passed
+	// to EC2 as server-side filters.
+	TagFilters TagFilters
+	// AccurateSnapshotSize measures snapshots with the EBS direct APIs
+	// instead of reporting the size of their source volume.
+	AccurateSnapshotSize bool
+	// SharedSnapshots also lists the snapshots other accounts shared with
+	// this one and flags the snapshots this account made public.
+	SharedSnapshots bool
+	// SnapshotOwners are the owners whose snapshots are collected: "self",
+	// "amazon" or account IDs. Only "self" when empty.
+	SnapshotOwners []string
+	// IncludeSharedSnapshots also collects the snapshots other accounts
+	// shared with this one as regular snapshots, counting their storage.
+	IncludeSharedSnapshots bool
+	// SnapshotSizeConcurrency bounds the EBS direct API workers,
+	// DefaultSnapshotSizeConcurrency when zero.
+	SnapshotSizeConcurrency int
+	// SnapshotSizeCacheFile caches measured snapshot sizes between runs
+	// when set.
+	SnapshotSizeCacheFile string
+	// NameCacheFile caches the Name tags of instances and volumes between
+	// runs when set, for NameCacheTTL.
+	NameCacheFile string
+	NameCacheTTL  time.Duration
+	// NameLookupConcurrency bounds the concurrent batches of name and
+	// instance lookups across the regions of a scan,
+	// DefaultNameLookupConcurrency when zero.
+	NameLookupConcurrency int
+	// InstanceDetails looks up the type, state and Auto Scaling group of the
+	// instances volumes are attached to on every scan, along with their
+	// names, which then bypass the name cache.
+	InstanceDetails bool
+	// Sealer encrypts the pricing, snapshot size and name caches when set.
+	Sealer atrest.Sealer
+	// S3ListFallback sizes buckets by listing their objects when CloudWatch
+	// has no datapoints.
+	S3ListFallback bool
+
+	// EstimateCost prices volumes and snapshots with Pricing.
+	EstimateCost bool
+	// Pricing prices estimated costs and the savings of analyses; nil uses
+	// the Pricing API.
+	Pricing PricingProvider
+	// PriceCacheFile caches the prices fetched from the Pricing API between
+	// runs when set.
+	PriceCacheFile string
+
+	// BackupSLATag is the volume tag whose value selects a BackupSLA entry.
+	BackupSLATag string
+	// BackupSLA maps BackupSLATag values to the maximum snapshot age.
+	BackupSLA map[string]time.Duration
+	// MaxSnapshotAge flags the in-use volumes whose latest snapshot is
+	// older, see ApplySnapshotCoverage. Zero skips the check, which also
+	// needs ServiceEBS and ServiceSnapshots.
+	MaxSnapshotAge time.Duration
+
+	// GroupByTag aggregates volumes and snapshots by this tag when set.
+	GroupByTag string
+	// StackTags name the stack that deployed an entity, first match wins,
+	// DefaultStackTags when nil.
+	StackTags []string
+
+	// ClassifyAccess classifies volumes as hot, warm or cold from their
+	// attachment and CloudWatch IO activity and recommends cheaper storage
+	// for cold and warm ones.
+	ClassifyAccess bool
+	// AccessLookback is the window IO activity is summed over,
+	// DefaultAccessLookback when zero.
+	AccessLookback time.Duration
+
+	// Findings ranks the problems of the scanned resources into
+	// Report.Findings, see FindFindings. StaleSnapshotAge is the age of a
+	// stale snapshot, DefaultStaleSnapshotAge when zero.
+	Findings         bool
+	StaleSnapshotAge time.Duration
+
+	// Quotas compares the EBS service quotas of every scanned region with
+	// the usage of the scanned entities into Report.Quotas.
+	Quotas bool
+
+	// Owners resolves the owner of every entity into EntityUsage.Owner and
+	// Report.Owners: the first of OwnerTags the entity is tagged with, then
+	// with OwnerFromCloudTrail the CloudTrail identity that created a volume
+	// or snapshot, then the AccountOwners entry of its account, "*" for any
+	// account. Entities nothing resolves are owned by OwnerUnknown.
+	Owners              bool
+	OwnerTags           []string
+	OwnerFromCloudTrail bool
+	AccountOwners       map[string]string
+
+	// Profile and AccountID label every entity with the AWS profile and
+	// account it was scanned with when set.
+	Profile   string
+	AccountID string
+
+	// DryRun reads the caches without writing them back.
+	DryRun bool
+
+	// Checkpoint records the progress of the scan and skips what an
+	// interrupted earlier scan completed, when set. Regions with failed API
+	// calls are not recorded as completed.
+	Checkpoint *Checkpoint
+
+	// OnRegionComplete is called with each region's summary as soon as the
+	// region has been scanned. It may be called concurrently.
+	OnRegionComplete func(RegionSummary)
+	// OnJobComplete is called as each scan job finishes, with the progress
+	// of the scan. It may be called concurrently.
+	OnJobComplete func(JobSummary)
+	// OnAPICall is called with the region of every AWS API call the
+	// collector makes, retries not counted. It may be called concurrently.
+	OnAPICall func(region string)
+}
+
+// Report is the result of a scan.
+type Report struct {
+	Entities         []EntityUsage
+	Regions          []RegionSummary // In completion order
+	GroupByTag       string
+	Groups           []TagGroup               // Only set with Options.GroupByTag
+	Stacks           []TagGroup               // Storage per stack, see Options.StackTags
+	AccessClasses    []AccessClassTotal       // Only set with Options.ClassifyAccess
+	Accounts         []AccountSummary         // Only set for merged reports, failed accounts last
+	Growth           *Growth                  // Only set when compared with an earlier scan
+	Forecast         *Forecast                // Only set when fitted to earlier scans
+	Findings         []Finding                // Most severe first, only set with Options.Findings
+	Quotas           []QuotaUsage             // Most utilized first, only set with Options.Quotas
+	Owners           []TagGroup               // Storage per owner, largest first, only set with Options.Owners
+	CacheAges        map[string]time.Duration // Age of the cached data used, by cache name
+	APIThrottles     map[string]int64         // Throttled API attempts, by error code
+	RegionThrottles  map[string]int64         // Throttled API attempts, by region
+	APICalls         map[APICallKey]int64     // API calls by region, service and operation, retries not counted
+	APIBudgetReached bool                     // Options.MaxAPICalls was reached, see Options.APIBudgetDegrade
+	RegionErrors     map[string]int64         // Failed API calls and scan jobs, by region
+	FailedRegions    []FailedRegion           // Regions left out of the report
+	TotalStorageUsed int64
+	StartedAt        time.Time       // When the scan started
+	GeneratedAt      time.Time       // When the scan finished
+	Caller           *CallerIdentity // Identity the scan ran as, set by the caller of Scan
+	CostEstimated    bool
+}
+
+// CallerIdentity is the AWS identity a scan ran as, as returned by
+// sts:GetCallerIdentity.
+type CallerIdentity struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// RegionsScanned returns the regions the report covers, sorted.
+func (r *Report) RegionsScanned() []string {
+	var regions []string
+	for _, summary := range r.Regions {
+		if !slices.Contains(regions, summary.Region) {
+			regions = append(regions, summary.Region)
+		}
+	}
+	slices.Sort(regions)
+	return regions
+}
+
+// TotalAPICalls returns the API calls of the scan by service.
+func (r *Report) TotalAPICalls() map[string]int64 {
+	calls := map[string]int64{}
+	for key, count := range r.APICalls {
+		calls[key.Service] += count
+	}
+	return calls
+}
+
+// OperationAPICalls returns the API calls of the scan by service and
+// operation, e.g. "EC2.DescribeVolumes".
+func (r *Report) OperationAPICalls() map[string]int64 {
+	calls := map[string]int64{}
+	for key, count := range r.APICalls {
+		calls[key.Service+"."+key.Operation] += count
+	}
+	return calls
+}
+
+// Caches reported in Report.CacheAges.
+const (
+	CachePricing = "pricing"
+	CacheRegions = "regions"
+)
+
+// SetCacheAge records how old the data taken from a cache was. Callers that
+// resolve regions from their own cache report it under CacheRegions.
+func (r *Report) SetCacheAge(cache string, age time.Duration) {
+	if r.CacheAges == nil {
+		r.CacheAges = map[string]time.Duration{}
+	}
+	r.CacheAges[cache] = age
+}
+
+// StorageCollector scans the configured regions and services.
+type StorageCollector struct {
+	opts Options
+
+	entityMutex      sync.Mutex
+	entities         []EntityUsage
+	regions          []RegionSummary
+	failedRegions    []FailedRegion
+	totalStorageUsed int64
+
+	snapshotSizes     *snapshotSizeCache
+	snapshotSizeSlots chan struct{}
+
+	names            *nameCache // Kept across scans
+	nameResolver     *resolver[string]
+	instanceResolver *resolver[instanceDetails]
+
+	throttleMutex   sync.Mutex
+	throttles       map[string]int64
+	regionThrottles map[string]int64     // Guarded by throttleMutex
+	regionErrors    map[string]int64     // Guarded by throttleMutex
+	apiCalls        map[APICallKey]int64 // Guarded by throttleMutex
+	apiCallTotal    int64                // Guarded by throttleMutex
+	apiBudget       bool                 // Reached, guarded by throttleMutex
+	abortScan       context.CancelCauseFunc
+
+	limiterMutex sync.Mutex
+	limiters     map[string]*rate.Limiter // By region, kept across scans
+
+	clientMutex sync.Mutex
+	configs     map[string]aws.Config     // By region, see loadConfig
+	ec2Clients  map[string]EC2DescribeAPI // By region, see ec2Client
+}
+
+// APICallKey identifies the API calls of an operation of a service in a
+// region.
+type APICallKey struct {
+	Region    string
+	Service   string
+	Operation string
+}
+
+// New returns a collector for the given options.
+func New(opts Options) *StorageCollector {
+	if len(opts.Services) == 0 {
+		opts.Services = DefaultServices
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Partition == "" {
+		opts.Partition = awsres.PartitionAWS
+	}
+	if opts.JobTimeout == 0 {
+		opts.JobTimeout = DefaultJobTimeout
+	}
+	if opts.LoadConfig == nil {
+		opts.LoadConfig = NewSharedConfigLoader()
+	}
+	if opts.NewEC2Client == nil {
+		opts.NewEC2Client = NewEC2Client
+	}
+	if opts.SnapshotSizeConcurrency <= 0 {
+		opts.SnapshotSizeConcurrency = DefaultSnapshotSizeConcurrency
+	}
+	if opts.NameLookupConcurrency <= 0 {
+		opts.NameLookupConcurrency = DefaultNameLookupConcurrency
+	}
+	if opts.MaxAPIRetries == 0 {
+		opts.MaxAPIRetries = DefaultMaxAPIRetries
+	}
+	if opts.StackTags == nil {
+		opts.StackTags = DefaultStackTags
+	}
+	if opts.AccessLookback <= 0 {
+		opts.AccessLookback = DefaultAccessLookback
+	}
+
+	return &StorageCollector{opts: opts}
+}
+
+func (c *StorageCollector) enabled(service string) bool {
+	if len(c.opts.TagFilters) > 0 && !taggedServices[service] {
+		return false // Nothing it collects can match a tag filter
+	}
+	for _, s := range c.opts.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan collects every enabled service and returns the report. Failures in
+// individual regions are logged and leave those regions out of the report.
+// A collector runs one Scan at a time; use separate collectors to scan
+// concurrently.
+func (c *StorageCollector) Scan(ctx context.Context) (*Report, error) {
+	started := time.Now()
+	c.entities = nil
+	c.regions = nil
+	c.failedRegions = nil
+	c.totalStorageUsed = 0
+	c.throttles = nil
+	c.regionThrottles = nil
+	c.regionErrors = nil
+	c.apiCalls = nil
+	c.apiCallTotal = 0
+	c.apiBudget = false
+
+	ctx, c.abortScan = context.WithCancelCause(ctx)
+	defer c.abortScan(nil)
+
+	if c.opts.AccurateSnapshotSize {
+		c.snapshotSizes = loadSnapshotSizeCache(c.opts.SnapshotSizeCacheFile, c.opts.Sealer)
+		c.snapshotSizeSlots = make(chan struct{}, c.opts.SnapshotSizeConcurrency)
+	}
+
+	c.nameResolver = newResolver[string](c.opts.NameLookupConcurrency)
+	c.instanceResolver = newResolver[instanceDetails](c.opts.NameLookupConcurrency)
+	if c.opts.NameCacheFile != "" && c.opts.NameCacheTTL > 0 && c.names == nil {
+		c.names = loadNameCache(c.opts.NameCacheFile, c.opts.Sealer, c.opts.NameCacheTTL)
+	}
+
+	if slices.ContainsFunc(regionalServices, c.enabled) {
+		c.scanRegions(ctx)
+	}
+	if ctx.Err() != nil {
+		if err := c.opts.Checkpoint.Flush(); err != nil {
+			slog.Error("failed to write checkpoint", "error", err)
+		}
+	}
+
+	if c.snapshotSizes != nil && !c.opts.DryRun {
+		if err := c.snapshotSizes.save(); err != nil {
+			slog.Error("failed to write snapshot size cache", "error", err)
+		}
+	}
+	if c.names != nil && !c.opts.DryRun {
+		if err := c.names.save(); err != nil {
+			slog.Error("failed to write name cache", "error", err)
+		}
+	}
+	if c.enabled(ServiceS3) {
+		if err := c.scanS3(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+
+	for i := range c.entities {
+		c.entities[i].Profile = c.opts.Profile
+		c.entities[i].AccountID = c.opts.AccountID
+		c.entities[i].Stack = StackOf(c.entities[i], c.opts.StackTags)
+	}
+	for i := range c.failedRegions {
+		c.failedRegions[i].Profile = c.opts.Profile
+		c.failedRegions[i].AccountID = c.opts.AccountID
+	}
+
+	report := &Report{
+		Entities:         c.entities,
+		Regions:          c.regions,
+		FailedRegions:    c.failedRegions,
+		TotalStorageUsed: c.totalStorageUsed,
+		StartedAt:        started,
+		GeneratedAt:      time.Now(),
+	}
+
+	if c.opts.EstimateCost {
+		if err := c.estimateCosts(ctx, report); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.opts.GroupByTag != "" {
+		report.GroupByTag = c.opts.GroupByTag
+		report.Groups = GroupByTag(report.Entities, c.opts.GroupByTag)
+	}
+
+	report.Stacks = GroupByStack(report.Entities)
+
+	if c.opts.Owners {
+		c.resolveOwners(ctx, report.Entities)
+		report.Owners = GroupByOwner(report.Entities)
+	}
+
+	if len(c.opts.BackupSLA) > 0 {
+		ApplyBackupSLA(report.Entities, c.opts.BackupSLATag, c.opts.BackupSLA, report.GeneratedAt)
+	}
+
+	if c.opts.MaxSnapshotAge > 0 && c.enabled(ServiceEBS) && c.enabled(ServiceSnapshots) {
+		ApplySnapshotCoverage(report.Entities, c.opts.MaxSnapshotAge, report.GeneratedAt)
+	}
+
+	if c.opts.ClassifyAccess {
+		report.AccessClasses = AccessClassTotals(report.Entities)
+	}
+
+	if c.opts.Findings {
+		var amiSnapshots map[string]bool
+		if c.enabled(ServiceEBS) && c.enabled(ServiceSnapshots) && !c.skipEnrichment("AMI snapshots") {
+			amiSnapshots = c.AMISnapshotIDs(ctx)
+		}
+		report.Findings = FindFindings(report.Entities, amiSnapshots, report.GeneratedAt, c.opts.StaleSnapshotAge)
+	}
+
+	if c.opts.Quotas && !c.skipEnrichment("service quotas") {
+		report.Quotas = c.quotaUsages(ctx, report)
+	}
+
+	c.throttleMutex.Lock()
+	report.APIThrottles = c.throttles
+	report.RegionThrottles = c.regionThrottles
+	report.RegionErrors = c.regionErrors
+	report.APICalls = c.apiCalls
+	report.APIBudgetReached = c.apiBudget
+	c.throttleMutex.Unlock()
+
+	return report, nil
+}
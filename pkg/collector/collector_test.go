@@ -0,0 +1,435 @@
+package collector_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector/collectortest"
+)
+
+const gib = int64(1) << 30
+
+func tags(kv ...string) []types.Tag {
+	var tags []types.Tag
+	for i := 0; i+1 < len(kv); i += 2 {
+		tags = append(tags, types.Tag{Key: aws.String(kv[i]), Value: aws.String(kv[i+1])})
+	}
+	return tags
+}
+
+func volume(id string, size int32, volumeType types.VolumeType, instance string, kv ...string) types.Volume {
+	v := types.Volume{
+		VolumeId:   aws.String(id),
+		Size:       aws.Int32(size),
+		VolumeType: volumeType,
+		State:      types.VolumeStateAvailable,
+		CreateTime: aws.Time(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Tags:       tags(kv...),
+	}
+	if instance != "" {
+		v.State = types.VolumeStateInUse
+		v.Attachments = []types.VolumeAttachment{{InstanceId: aws.String(instance), VolumeId: aws.String(id)}}
+	}
+	return v
+}
+
+func snapshot(id, volumeID string, size int32, kv ...string) types.Snapshot {
+	return types.Snapshot{
+		SnapshotId: aws.String(id),
+		VolumeId:   aws.String(volumeID),
+		VolumeSize: aws.Int32(size),
+		State:      types.SnapshotStateCompleted,
+		Progress:   aws.String("100%"),
+		StartTime:  aws.Time(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+		OwnerId:    aws.String("123456789012"),
+		Tags:       tags(kv...),
+	}
+}
+
+func instance(id, name string) types.Instance {
+	return types.Instance{
+		InstanceId: aws.String(id),
+		State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+		Tags:       tags("Name", name),
+	}
+}
+
+// scan scans the regions of fake with the EBS and snapshot services.
+func scan(t *testing.T, fake *collectortest.FakeEC2, regions []string, edit func(*collector.Options)) *collector.Report {
+	t.Helper()
+
+	opts := collector.Options{
+		Regions:      regions,
+		Services:     []string{collector.ServiceEBS, collector.ServiceSnapshots},
+		Concurrency:  4,
+		LoadConfig:   collectortest.LoadConfig,
+		NewEC2Client: fake.Client,
+	}
+	if edit != nil {
+		edit(&opts)
+	}
+
+	report, err := collector.New(opts).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	return report
+}
+
+// byID returns the entities of the report keyed by region and ID.
+func byID(report *collector.Report) map[string]collector.EntityUsage {
+	entities := map[string]collector.EntityUsage{}
+	for _, entity := range report.Entities {
+		entities[entity.Region+"/"+entity.ID] = entity
+	}
+	return entities
+}
+
+func TestScan(t *testing.T) {
+	errThrottled := errors.New("api error Throttling: Rate exceeded")
+
+	tests := []struct {
+		name    string
+		setup   func(fake *collectortest.FakeEC2)
+		regions []string
+		edit    func(*collector.Options)
+
+		wantIDs   []string // region/ID, sorted
+		wantTotal int64
+		wantFail  []string // Failed regions
+		check     func(t *testing.T, entities map[string]collector.EntityUsage)
+	}{
+		{
+			name: "volumes",
+			setup: func(fake *collectortest.FakeEC2) {
+				fake.Region("us-east-1").Volumes = []types.Volume{
+					volume("vol-a", 100, types.VolumeTypeGp3, ""),
+					volume("vol-b", 8, types.VolumeTypeIo2, ""),
+				}
+			},
+			regions:   []string{"us-east-1"},
+			wantIDs:   []string{"us-east-1/vol-a", "us-east-1/vol-b"},
+			wantTotal: 108 * gib,
+			check: func(t *testing.T, entities map[string]collector.EntityUsage) {
+				a := entities["us-east-1/vol-a"]
+				if a.Type != collector.EntityTypeVolume || a.StorageUsed != 100*gib || a.VolumeType != "gp3" {
+					t.Errorf("vol-a = %s %d %s, want Volume %d gp3", a.Type, a.StorageUsed, a.VolumeType, 100*gib)
+				}
+				if !a.CreateTime.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)) {
+					t.Errorf("vol-a CreateTime = %s", a.CreateTime)
+				}
+			},
+		},
+		{
+			name: "snapshots",
+			setup: func(fake *collectortest.FakeEC2) {
+				region := fake.Region("us-east-1")
+				region.Volumes = []types.Volume{volume("vol-a", 10, types.VolumeTypeGp3, "", "Name", "db")}
+				region.Snapshots = []types.Snapshot{
+					snapshot("snap-1", "vol-a", 10),
+					snapshot("snap-2", "vol-gone", 20, "Name", "old backup"),
+				}
+			},
+			regions:   []string{"us-east-1"},
+			wantIDs:   []string{"us-east-1/snap-1", "us-east-1/snap-2", "us-east-1/vol-a"},
+			wantTotal: 40 * gib,
+			check: func(t *testing.T, entities map[string]collector.EntityUsage) {
+				one, two := entities["us-east-1/snap-1"], entities["us-east-1/snap-2"]
+				if one.Type != collector.EntityTypeSnapshot || one.SourceVolume != "vol-a" {
+					t.Errorf("snap-1 = %s from %s, want Snapshot from vol-a", one.Type, one.SourceVolume)
+				}
+				if one.AttachedInstance != "Volume: db" {
+					t.Errorf("snap-1 AttachedInstance = %q, want the name of its volume", one.AttachedInstance)
+				}
+				if two.AttachedInstance != "old backup" {
+					t.Errorf("snap-2 AttachedInstance = %q, want its own Name tag", two.AttachedInstance)
+				}
+				if one.VolumeExists == nil || !*one.VolumeExists {
+					t.Errorf("snap-1 VolumeExists = %v, want true", one.VolumeExists)
+				}
+				if two.VolumeExists == nil || *two.VolumeExists {
+					t.Errorf("snap-2 VolumeExists = %v, want false", two.VolumeExists)
+				}
+			},
+		},
+		{
+			name: "tags",
+			setup: func(fake *collectortest.FakeEC2) {
+				region := fake.Region("us-east-1")
+				region.Volumes = []types.Volume{
+					volume("vol-a", 10, types.VolumeTypeGp3, "", "Team", "web", "aws:cloudformation:stack-name", "api"),
+					volume("vol-b", 20, types.VolumeTypeGp3, "", "Team", "db"),
+				}
+				region.Snapshots = []types.Snapshot{snapshot("snap-1", "vol-a", 10, "Team", "web")}
+			},
+			regions:   []string{"us-east-1"},
+			wantIDs:   []string{"us-east-1/snap-1", "us-east-1/vol-a", "us-east-1/vol-b"},
+			wantTotal: 40 * gib,
+			check: func(t *testing.T, entities map[string]collector.EntityUsage) {
+				a := entities["us-east-1/vol-a"]
+				if a.Tags["Team"] != "web" || a.Stack != "api" {
+					t.Errorf("vol-a Tags = %v, Stack = %q, want Team web and stack api", a.Tags, a.Stack)
+				}
+				if got := entities["us-east-1/snap-1"].Tags["Team"]; got != "web" {
+					t.Errorf("snap-1 Team tag = %q, want web", got)
+				}
+			},
+		},
+		{
+			name: "tag filters",
+			setup: func(fake *collectortest.FakeEC2) {
+				region := fake.Region("us-east-1")
+				region.Volumes = []types.Volume{
+					volume("vol-a", 10, types.VolumeTypeGp3, "", "Team", "web"),
+					volume("vol-b", 20, types.VolumeTypeGp3, "", "Team", "db"),
+					volume("vol-c", 30, types.VolumeTypeGp3, ""),
+				}
+				region.Snapshots = []types.Snapshot{
+					snapshot("snap-1", "vol-a", 10, "Team", "web"),
+					snapshot("snap-2", "vol-b", 20, "Team", "db"),
+				}
+			},
+			regions: []string{"us-east-1"},
+			edit: func(opts *collector.Options) {
+				opts.TagFilters = collector.TagFilters{"Team": {"web"}}
+			},
+			wantIDs:   []string{"us-east-1/snap-1", "us-east-1/vol-a"},
+			wantTotal: 20 * gib,
+		},
+		{
+			name: "attachments",
+			setup: func(fake *collectortest.FakeEC2) {
+				region := fake.Region("us-east-1")
+				region.Instances = []types.Instance{instance("i-1", "web-1")}
+				region.Volumes = []types.Volume{
+					volume("vol-a", 10, types.VolumeTypeGp3, "i-1"),
+					volume("vol-b", 10, types.VolumeTypeGp3, "i-unnamed"),
+					volume("vol-c", 10, types.VolumeTypeGp3, ""),
+				}
+			},
+			regions:   []string{"us-east-1"},
+			wantIDs:   []string{"us-east-1/vol-a", "us-east-1/vol-b", "us-east-1/vol-c"},
+			wantTotal: 30 * gib,
+			check: func(t *testing.T, entities map[string]collector.EntityUsage) {
+				for id, want := range map[string][2]string{
+					"vol-a": {"web-1", "i-1"},
+					"vol-b": {"i-unnamed", "i-unnamed"},
+					"vol-c": {"", ""},
+				} {
+					got := entities["us-east-1/"+id]
+					if got.AttachedInstance != want[0] || got.InstanceID != want[1] {
+						t.Errorf("%s attached to %q (%q), want %q (%q)", id, got.AttachedInstance, got.InstanceID, want[0], want[1])
+					}
+				}
+			},
+		},
+		{
+			name: "API errors",
+			setup: func(fake *collectortest.FakeEC2) {
+				region := fake.Region("us-east-1")
+				region.Volumes = []types.Volume{volume("vol-a", 10, types.VolumeTypeGp3, "")}
+				region.Snapshots = []types.Snapshot{snapshot("snap-1", "vol-a", 10)}
+				region.Errors[collectortest.OpDescribeSnapshots] = errThrottled
+
+				other := fake.Region("us-west-2")
+				other.Volumes = []types.Volume{volume("vol-b", 5, types.VolumeTypeGp2, "")}
+				other.Errors[collectortest.OpDescribeVolumes] = errThrottled
+				other.Snapshots = []types.Snapshot{snapshot("snap-2", "vol-b", 5)}
+			},
+			regions:   []string{"us-east-1", "us-west-2"},
+			wantIDs:   []string{"us-east-1/vol-a", "us-west-2/snap-2"},
+			wantTotal: 15 * gib,
+			check: func(t *testing.T, entities map[string]collector.EntityUsage) {
+				// The source volume lookup fails too, which leaves it unknown
+				if exists := entities["us-west-2/snap-2"].VolumeExists; exists != nil {
+					t.Errorf("snap-2 VolumeExists = %v, want unset", *exists)
+				}
+			},
+		},
+		{
+			name: "failed region",
+			setup: func(fake *collectortest.FakeEC2) {
+				fake.Region("us-east-1").Volumes = []types.Volume{volume("vol-a", 10, types.VolumeTypeGp3, "")}
+				fake.Region("eu-west-1").Volumes = []types.Volume{volume("vol-b", 20, types.VolumeTypeGp3, "")}
+			},
+			regions: []string{"us-east-1", "eu-west-1"},
+			edit: func(opts *collector.Options) {
+				opts.LoadConfig = func(ctx context.Context, region string) (aws.Config, error) {
+					if region == "eu-west-1" {
+						return aws.Config{}, errors.New("no credentials for eu-west-1")
+					}
+					return collectortest.LoadConfig(ctx, region)
+				}
+			},
+			wantIDs:   []string{"us-east-1/vol-a"},
+			wantTotal: 10 * gib,
+			wantFail:  []string{"eu-west-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := collectortest.NewFakeEC2()
+			tt.setup(fake)
+			report := scan(t, fake, tt.regions, tt.edit)
+
+			entities := byID(report)
+			if got := slices.Sorted(maps.Keys(entities)); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("entities = %v, want %v", got, tt.wantIDs)
+			}
+			if report.TotalStorageUsed != tt.wantTotal {
+				t.Errorf("TotalStorageUsed = %d, want %d", report.TotalStorageUsed, tt.wantTotal)
+			}
+
+			var sum int64
+			for _, entity := range report.Entities {
+				sum += entity.StorageUsed
+			}
+			if sum != report.TotalStorageUsed {
+				t.Errorf("entities sum to %d, TotalStorageUsed is %d", sum, report.TotalStorageUsed)
+			}
+
+			var failed []string
+			for _, region := range report.FailedRegions {
+				failed = append(failed, region.Region)
+				if !strings.Contains(region.Reason, "failed to create clients") {
+					t.Errorf("failed region %s reason = %q", region.Region, region.Reason)
+				}
+			}
+			if !slices.Equal(failed, tt.wantFail) {
+				t.Errorf("failed regions = %v, want %v", failed, tt.wantFail)
+			}
+			if len(report.Regions)+len(report.FailedRegions) != len(tt.regions) {
+				t.Errorf("%d regions scanned and %d failed, want %d", len(report.Regions), len(report.FailedRegions), len(tt.regions))
+			}
+
+			if tt.check != nil {
+				tt.check(t, entities)
+			}
+		})
+	}
+}
+
+// TestScanRegionsConcurrently merges many regions scanned at once, which
+// the race detector checks, into the totals of a sequential scan.
+func TestScanRegionsConcurrently(t *testing.T) {
+	fake := collectortest.NewFakeEC2()
+	var regions []string
+	for i := range 40 {
+		name := fmt.Sprintf("test-region-%d", i)
+		regions = append(regions, name)
+
+		region := fake.Region(name)
+		for j := range i%5 + 1 {
+			id := fmt.Sprintf("vol-%d-%d", i, j)
+			region.Volumes = append(region.Volumes, volume(id, int32(i+j+1), types.VolumeTypeGp3, ""))
+			region.Snapshots = append(region.Snapshots, snapshot("snap-"+id[4:], id, int32(j+1)))
+		}
+	}
+
+	sequential := scan(t, fake, regions, func(opts *collector.Options) { opts.Concurrency = 1 })
+	concurrent := scan(t, fake, regions, func(opts *collector.Options) { opts.Concurrency = 32 })
+
+	if sequential.TotalStorageUsed == 0 {
+		t.Fatal("the sequential scan found nothing")
+	}
+	if concurrent.TotalStorageUsed != sequential.TotalStorageUsed {
+		t.Errorf("TotalStorageUsed = %d, want %d", concurrent.TotalStorageUsed, sequential.TotalStorageUsed)
+	}
+	if len(concurrent.Entities) != len(sequential.Entities) {
+		t.Errorf("%d entities, want %d", len(concurrent.Entities), len(sequential.Entities))
+	}
+	if len(concurrent.Regions) != len(regions) {
+		t.Errorf("%d regions scanned, want %d", len(concurrent.Regions), len(regions))
+	}
+
+	want := map[string]collector.RegionSummary{}
+	for _, summary := range sequential.Regions {
+		want[summary.Region] = summary
+	}
+	for _, summary := range concurrent.Regions {
+		if w := want[summary.Region]; summary.Entities != w.Entities || summary.StorageUsed != w.StorageUsed {
+			t.Errorf("region %s: %d entities using %d bytes, want %d using %d",
+				summary.Region, summary.Entities, summary.StorageUsed, w.Entities, w.StorageUsed)
+		}
+	}
+}
+
+// TestScanPages lists the volumes and snapshots of every page of
+// DescribeVolumes and DescribeSnapshots.
+func TestScanPages(t *testing.T) {
+	fake := collectortest.NewFakeEC2()
+	region := fake.Region("us-east-1")
+	region.PageSize = 2
+	for i := range 5 {
+		region.Volumes = append(region.Volumes, volume(fmt.Sprintf("vol-%d", i), 10, types.VolumeTypeGp3, ""))
+	}
+	region.Snapshots = []types.Snapshot{
+		snapshot("snap-1", "vol-1", 10),
+		snapshot("snap-2", "vol-2", 10),
+		snapshot("snap-3", "vol-3", 10),
+	}
+
+	report := scan(t, fake, []string{"us-east-1"}, nil)
+	if len(report.Entities) != 8 || report.TotalStorageUsed != 80*gib {
+		t.Errorf("%d entities using %d bytes, want 8 using %d", len(report.Entities), report.TotalStorageUsed, 80*gib)
+	}
+}
+
+// TestScanAPIErrorCodes checks that the EC2 error codes the scan expects are
+// recognized as such, rather than logged as failures.
+func TestScanAPIErrorCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		service   string
+		operation string
+		code      string
+		wantLog   string
+		wantNoLog string
+	}{
+		{"volume not found", collector.ServiceEBS, collectortest.OpDescribeVolumes, "InvalidVolume.NotFound", "invalid volume ID", "failed to describe volumes"},
+		{"volumes unauthorized", collector.ServiceEBS, collectortest.OpDescribeVolumes, "UnauthorizedOperation", "not authorized to describe volumes", "failed to describe volumes"},
+		{"snapshot not found", collector.ServiceSnapshots, collectortest.OpDescribeSnapshots, "InvalidSnapshot.NotFound", "invalid snapshot ID", "failed to describe snapshots"},
+		{"snapshots unauthorized", collector.ServiceSnapshots, collectortest.OpDescribeSnapshots, "UnauthorizedOperation", "not authorized to describe snapshots", "failed to describe snapshots"},
+		{"other error", collector.ServiceEBS, collectortest.OpDescribeVolumes, "InternalError", "failed to describe volumes", "invalid volume ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+			fake := collectortest.NewFakeEC2()
+			region := fake.Region("us-east-1")
+			region.Volumes = []types.Volume{volume("vol-a", 10, types.VolumeTypeGp3, "")}
+			region.Snapshots = []types.Snapshot{snapshot("snap-1", "vol-a", 10)}
+			region.Errors[tt.operation] = &smithy.GenericAPIError{Code: tt.code, Message: "denied or missing"}
+
+			report := scan(t, fake, []string{"us-east-1"}, func(opts *collector.Options) {
+				opts.Services = []string{tt.service}
+			})
+			if len(report.Entities) != 0 {
+				t.Errorf("%d entities, want none", len(report.Entities))
+			}
+			if !strings.Contains(logs.String(), "msg=\""+tt.wantLog+"\"") {
+				t.Errorf("logs lack %q:\n%s", tt.wantLog, logs.String())
+			}
+			if strings.Contains(logs.String(), "msg=\""+tt.wantNoLog+"\"") {
+				t.Errorf("logs contain %q:\n%s", tt.wantNoLog, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+// Package collectortest provides an in-memory EC2 API for exercising the
+// collector without AWS credentials:
+//
+//	fake := collectortest.NewFakeEC2()
+//	fake.Region("us-east-1").Volumes = []types.Volume{...}
+//	c := collector.New(collector.Options{
+//		Regions:      []string{"us-east-1"},
+//		LoadConfig:   collectortest.LoadConfig,
+//		NewEC2Client: fake.Client,
+//	})
+package collectortest
+
+import (
+	"context"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Operations that FakeRegion.Errors can fail.
+const (
+	OpDescribeInstances            = "DescribeInstances"
+	OpDescribeInstanceTypes        = "DescribeInstanceTypes"
+	OpDescribeVolumes              = "DescribeVolumes"
+	OpDescribeVolumesModifications = "DescribeVolumesModifications"
+	OpDescribeSnapshots            = "DescribeSnapshots"
+	OpDescribeImages               = "DescribeImages"
+)
+
+// LoadConfig is a collector.ConfigLoader that returns static credentials, so
+// nothing is read from the environment or the shared config files.
+func LoadConfig(ctx context.Context, region string) (aws.Config, error) {
+	return aws.Config{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDFAKE", "fake", ""),
+	}, nil
+}
+
+// FakeEC2 holds the resources of every region of a fake account.
+type FakeEC2 struct {
+	mu      sync.Mutex
+	regions map[string]*FakeRegion
+}
+
+// NewFakeEC2 returns a fake account without regions.
+func NewFakeEC2() *FakeEC2 {
+	return &FakeEC2{regions: map[string]*FakeRegion{}}
+}
+
+// Region returns the resources of a region, adding the region if needed.
+func (f *FakeEC2) Region(name string) *FakeRegion {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	region, ok := f.regions[name]
+	if !ok {
+		region = &FakeRegion{name: name, account: f, Errors: map[string]error{}}
+		f.regions[name] = region
+	}
+	return region
+}
+
+// Client is a collector.EC2ClientFactory returning the region of cfg. A
+// region never added answers with no resources and is not added, so the
+// bootstrap region DescribeRegions is called in is only listed when it has
+// resources of its own.
+func (f *FakeEC2) Client(cfg aws.Config) collector.EC2DescribeAPI {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if region, ok := f.regions[cfg.Region]; ok {
+		return region
+	}
+	return &FakeRegion{name: cfg.Region, account: f, Errors: map[string]error{}}
+}
+
+// FakeRegion is the in-memory EC2 API of one region. Describe calls support
+// the IDs parameters and the filters the collector sends; other filters are
+// ignored. Calls return a single page, unless PageSize splits the volumes
+// and snapshots into pages.
+type FakeRegion struct {
+	name    string
+	account *FakeEC2
+
+	Instances           []types.Instance
+	InstanceTypes       []types.InstanceTypeInfo
+	Volumes             []types.Volume
+	VolumesModification []types.VolumeModification
+	Snapshots           []types.Snapshot
+	Images              []types.Image
+
+	// SharedSnapshots are owned by other accounts and restorable by this
+	// one. PublicSnapshots holds the IDs of the Snapshots any account can
+	// restore.
+	SharedSnapshots []types.Snapshot
+	PublicSnapshots map[string]bool
+
+	// PageSize is the number of volumes or snapshots per page of
+	// DescribeVolumes and DescribeSnapshots; 0 returns them all at once.
+	PageSize int
+
+	// Errors fails the operations named by their Op constants.
+	Errors map[string]error
+}
+
+var _ collector.EC2DescribeAPI = (*FakeRegion)(nil)
+
+// DescribeRegions lists every region added to the account.
+func (r *FakeRegion) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	r.account.mu.Lock()
+	names := make([]string, 0, len(r.account.regions))
+	for name := range r.account.regions {
+		names = append(names, name)
+	}
+	r.account.mu.Unlock()
+	sort.Strings(names)
+
+	output := &ec2.DescribeRegionsOutput{}
+	for _, name := range names {
+		output.Regions = append(output.Regions, types.Region{RegionName: aws.String(name)})
+	}
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	if err := r.Errors[OpDescribeInstances]; err != nil {
+		return nil, err
+	}
+
+	var instances []types.Instance
+	for _, instance := range r.Instances {
+		id := aws.ToString(instance.InstanceId)
+		fields := map[string]string{"instance-id": id}
+		if instance.State != nil {
+			fields["instance-state-name"] = string(instance.State.Name)
+		}
+		if matchIDs(params.InstanceIds, id) && matchFilters(params.Filters, fields) {
+			instances = append(instances, instance)
+		}
+	}
+
+	output := &ec2.DescribeInstancesOutput{}
+	if len(instances) > 0 {
+		output.Reservations = []types.Reservation{{Instances: instances}}
+	}
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	if err := r.Errors[OpDescribeInstanceTypes]; err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range params.InstanceTypes {
+		names = append(names, string(name))
+	}
+
+	output := &ec2.DescribeInstanceTypesOutput{}
+	for _, info := range r.InstanceTypes {
+		if matchIDs(names, string(info.InstanceType)) {
+			output.InstanceTypes = append(output.InstanceTypes, info)
+		}
+	}
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	if err := r.Errors[OpDescribeVolumes]; err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeVolumesOutput{}
+	for _, volume := range r.Volumes {
+		id := aws.ToString(volume.VolumeId)
+		fields := withTags(map[string]string{"volume-id": id}, volume.Tags)
+		if matchIDs(params.VolumeIds, id) && matchFilters(params.Filters, fields) {
+			output.Volumes = append(output.Volumes, volume)
+		}
+	}
+	output.Volumes, output.NextToken = paginate(output.Volumes, params.NextToken, r.PageSize)
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeVolumesModifications(ctx context.Context, params *ec2.DescribeVolumesModificationsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesModificationsOutput, error) {
+	if err := r.Errors[OpDescribeVolumesModifications]; err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeVolumesModificationsOutput{}
+	for _, modification := range r.VolumesModification {
+		id := aws.ToString(modification.VolumeId)
+		fields := map[string]string{"volume-id": id, "modification-state": string(modification.ModificationState)}
+		if matchIDs(params.VolumeIds, id) && matchFilters(params.Filters, fields) {
+			output.VolumesModifications = append(output.VolumesModifications, modification)
+		}
+	}
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	if err := r.Errors[OpDescribeSnapshots]; err != nil {
+		return nil, err
+	}
+
+	snapshots := r.Snapshots
+	switch {
+	case slices.Contains(params.RestorableByUserIds, "self"):
+		snapshots = r.SharedSnapshots
+	case slices.Contains(params.RestorableByUserIds, "all"):
+		snapshots = nil
+		for _, snapshot := range r.Snapshots {
+			if r.PublicSnapshots[aws.ToString(snapshot.SnapshotId)] {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+
+	output := &ec2.DescribeSnapshotsOutput{}
+	for _, snapshot := range snapshots {
+		id := aws.ToString(snapshot.SnapshotId)
+		fields := withTags(map[string]string{
+			"snapshot-id":  id,
+			"volume-id":    aws.ToString(snapshot.VolumeId),
+			"storage-tier": string(snapshot.StorageTier),
+			"start-time":   aws.ToTime(snapshot.StartTime).UTC().Format("2006-01-02T15:04:05.000Z"),
+		}, snapshot.Tags)
+		if matchIDs(params.SnapshotIds, id) && matchFilters(params.Filters, fields) {
+			output.Snapshots = append(output.Snapshots, snapshot)
+		}
+	}
+	output.Snapshots, output.NextToken = paginate(output.Snapshots, params.NextToken, r.PageSize)
+	return output, nil
+}
+
+func (r *FakeRegion) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if err := r.Errors[OpDescribeImages]; err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeImagesOutput{}
+	for _, image := range r.Images {
+		id := aws.ToString(image.ImageId)
+		if matchIDs(params.ImageIds, id) && matchFilters(params.Filters, map[string]string{"image-id": id}) {
+			output.Images = append(output.Images, image)
+		}
+	}
+	return output, nil
+}
+
+// paginate returns the page of items a NextToken, the offset of the page,
+// starts and the token of the page after it, or nil after the last page.
+func paginate[T any](items []T, token *string, size int) ([]T, *string) {
+	if size <= 0 {
+		return items, nil
+	}
+	start, _ := strconv.Atoi(aws.ToString(token))
+	start = min(start, len(items))
+	end := min(start+size, len(items))
+	if end == len(items) {
+		return items[start:end], nil
+	}
+	return items[start:end], aws.String(strconv.Itoa(end))
+}
+
+// matchIDs reports whether id is one of ids, or ids is empty.
+func matchIDs(ids []string, id string) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// withTags adds the tag:KEY filter fields of tags to fields.
+func withTags(fields map[string]string, tags []types.Tag) map[string]string {
+	for _, tag := range tags {
+		fields["tag:"+aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return fields
+}
+
+// matchFilters reports whether the fields match every filter the fake knows.
+// Values may use the * and ? wildcards, like the EC2 API.
+func matchFilters(filters []types.Filter, fields map[string]string) bool {
+	for _, filter := range filters {
+		name := aws.ToString(filter.Name)
+		field, ok := fields[name]
+		if !ok {
+			if strings.HasPrefix(name, "tag:") {
+				return false // The resource lacks the tag
+			}
+			continue
+		}
+
+		matched := false
+		for _, value := range filter.Values {
+			if ok, _ := path.Match(value, field); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
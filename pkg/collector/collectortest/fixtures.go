@@ -0,0 +1,301 @@
+package collectortest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// Fixture files of a region directory. Each holds a JSON array of the EC2
+// API objects of the FakeRegion field of the same name, except
+// public-snapshots.json, which lists the IDs of the public Snapshots.
+const (
+	FixtureInstances           = "instances.json"
+	FixtureInstanceTypes       = "instance-types.json"
+	FixtureVolumes             = "volumes.json"
+	FixtureVolumesModification = "volume-modifications.json"
+	FixtureSnapshots           = "snapshots.json"
+	FixtureSharedSnapshots     = "shared-snapshots.json"
+	FixturePublicSnapshots     = "public-snapshots.json"
+	FixtureImages              = "images.json"
+)
+
+// fixtureFields returns the FakeRegion field each fixture file fills.
+func (r *FakeRegion) fixtureFields() map[string]any {
+	return map[string]any{
+		FixtureInstances:           &r.Instances,
+		FixtureInstanceTypes:       &r.InstanceTypes,
+		FixtureVolumes:             &r.Volumes,
+		FixtureVolumesModification: &r.VolumesModification,
+		FixtureSnapshots:           &r.Snapshots,
+		FixtureSharedSnapshots:     &r.SharedSnapshots,
+		FixtureImages:              &r.Images,
+	}
+}
+
+// LoadFixtures returns a fake account holding the fixtures of dir, one
+// subdirectory per region, as written by a Recorder. Missing fixture files
+// leave their resources empty.
+func LoadFixtures(dir string) (*FakeEC2, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	fake := NewFakeEC2()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		region := fake.Region(entry.Name())
+
+		files := region.fixtureFields()
+		var public []string
+		files[FixturePublicSnapshots] = &public
+		for file, field := range files {
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name(), file))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read fixtures: %w", err)
+			}
+			if err := json.Unmarshal(data, field); err != nil {
+				return nil, fmt.Errorf("failed to decode fixture %s/%s: %w", entry.Name(), file, err)
+			}
+		}
+
+		region.PublicSnapshots = map[string]bool{}
+		for _, id := range public {
+			region.PublicSnapshots[id] = true
+		}
+	}
+
+	if len(fake.regions) == 0 {
+		return nil, fmt.Errorf("no region directories in fixtures %s", dir)
+	}
+	return fake, nil
+}
+
+// Recorder captures the responses of a real EC2 API as fixtures that
+// LoadFixtures reads back. Resource, account and KMS key IDs are replaced
+// by pseudonyms, consistently within a recording; names and tags are kept.
+// The fixtures of a region are rewritten after every call.
+type Recorder struct {
+	dir  string
+	next collector.EC2ClientFactory
+	key  []byte // Keys the pseudonyms of the recording
+
+	mu      sync.Mutex
+	regions map[string]*recording
+}
+
+// recording holds the objects recorded in a region, by ID.
+type recording struct {
+	objects map[string]map[string]any // By fixture file
+}
+
+// NewRecorder returns a Recorder writing to dir the responses of the
+// clients next creates.
+func NewRecorder(dir string, next collector.EC2ClientFactory) *Recorder {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key) // Never fails
+	return &Recorder{dir: dir, next: next, key: key, regions: map[string]*recording{}}
+}
+
+// Client is a collector.EC2ClientFactory recording the responses of the
+// region of cfg.
+func (r *Recorder) Client(cfg aws.Config) collector.EC2DescribeAPI {
+	return &recordingClient{EC2DescribeAPI: r.next(cfg), recorder: r, region: cfg.Region}
+}
+
+// record adds objects to a fixture file of a region and rewrites the file.
+func (r *Recorder) record(region, file string, objects map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.regions[region]
+	if !ok {
+		rec = &recording{objects: map[string]map[string]any{}}
+		r.regions[region] = rec
+	}
+	if rec.objects[file] == nil {
+		rec.objects[file] = map[string]any{}
+	}
+	for id, object := range objects {
+		rec.objects[file][id] = object
+	}
+
+	ids := make([]string, 0, len(rec.objects[file]))
+	for id := range rec.objects[file] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]any, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, rec.objects[file][id])
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, region, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(r.scrub(data), '\n'), 0o644)
+}
+
+var (
+	resourceIDPattern = regexp.MustCompile(`\b(vol|snap|i|ami|eni|subnet|vpc|sg)-[0-9a-f]{8,17}\b`)
+	// Account IDs are quoted or ARN fields; sizes are bare JSON numbers
+	accountIDPattern = regexp.MustCompile(`[":][0-9]{12}\b`)
+	uuidPattern      = regexp.MustCompile(`\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// scrub replaces the resource, account and KMS key IDs of data by
+// pseudonyms of the same shape.
+func (r *Recorder) scrub(data []byte) []byte {
+	data = resourceIDPattern.ReplaceAllFunc(data, func(id []byte) []byte {
+		prefix, _, _ := bytes.Cut(id, []byte("-"))
+		return []byte(string(prefix) + "-" + r.pseudonym(id)[:len(id)-len(prefix)-1])
+	})
+	data = accountIDPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		n := new(big.Int).SetBytes([]byte(r.pseudonym(match[1:])[:16]))
+		return fmt.Appendf(match[:1:1], "%012d", n.Mod(n, big.NewInt(1e12)))
+	})
+	return uuidPattern.ReplaceAllFunc(data, func(id []byte) []byte {
+		p := r.pseudonym(id)
+		return []byte(p[0:8] + "-" + p[8:12] + "-" + p[12:16] + "-" + p[16:20] + "-" + p[20:32])
+	})
+}
+
+// pseudonym returns the hex HMAC of id under the recording key.
+func (r *Recorder) pseudonym(id []byte) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(id)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordingClient records the responses of one region. Calls failing or
+// recording failing pass the response through unrecorded.
+type recordingClient struct {
+	collector.EC2DescribeAPI
+	recorder *Recorder
+	region   string
+}
+
+func (c *recordingClient) save(file string, objects map[string]any) {
+	if err := c.recorder.record(c.region, file, objects); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record fixture %s/%s: %v\n", c.region, file, err)
+	}
+}
+
+func (c *recordingClient) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeInstances(ctx, params, optFns...)
+	if err == nil {
+		objects := map[string]any{}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				objects[aws.ToString(instance.InstanceId)] = instance
+			}
+		}
+		c.save(FixtureInstances, objects)
+	}
+	return output, err
+}
+
+func (c *recordingClient) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeInstanceTypes(ctx, params, optFns...)
+	if err == nil {
+		objects := map[string]any{}
+		for _, info := range output.InstanceTypes {
+			objects[string(info.InstanceType)] = info
+		}
+		c.save(FixtureInstanceTypes, objects)
+	}
+	return output, err
+}
+
+func (c *recordingClient) DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeVolumes(ctx, params, optFns...)
+	if err == nil {
+		objects := map[string]any{}
+		for _, volume := range output.Volumes {
+			objects[aws.ToString(volume.VolumeId)] = volume
+		}
+		c.save(FixtureVolumes, objects)
+	}
+	return output, err
+}
+
+func (c *recordingClient) DescribeVolumesModifications(ctx context.Context, params *ec2.DescribeVolumesModificationsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesModificationsOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeVolumesModifications(ctx, params, optFns...)
+	if err == nil {
+		objects := map[string]any{}
+		for _, modification := range output.VolumesModifications {
+			objects[aws.ToString(modification.VolumeId)] = modification
+		}
+		c.save(FixtureVolumesModification, objects)
+	}
+	return output, err
+}
+
+// DescribeSnapshots records the owned snapshots, the snapshots shared with
+// the account and the IDs of the public ones apart, as the fake serves them.
+func (c *recordingClient) DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeSnapshots(ctx, params, optFns...)
+	if err != nil {
+		return output, err
+	}
+
+	objects := map[string]any{}
+	for _, snapshot := range output.Snapshots {
+		id := aws.ToString(snapshot.SnapshotId)
+		objects[id] = snapshot
+		if slices.Contains(params.RestorableByUserIds, "all") {
+			objects[id] = id
+		}
+	}
+	switch {
+	case slices.Contains(params.RestorableByUserIds, "self"):
+		c.save(FixtureSharedSnapshots, objects)
+	case slices.Contains(params.RestorableByUserIds, "all"):
+		c.save(FixturePublicSnapshots, objects)
+	default:
+		c.save(FixtureSnapshots, objects)
+	}
+	return output, nil
+}
+
+func (c *recordingClient) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	output, err := c.EC2DescribeAPI.DescribeImages(ctx, params, optFns...)
+	if err == nil {
+		objects := map[string]any{}
+		for _, image := range output.Images {
+			objects[aws.ToString(image.ImageId)] = image
+		}
+		c.save(FixtureImages, objects)
+	}
+	return output, err
+}
+
+var _ collector.EC2DescribeAPI = (*recordingClient)(nil)
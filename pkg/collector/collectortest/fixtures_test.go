@@ -0,0 +1,92 @@
+package collectortest_test
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector/collectortest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// goldenScan is the part of a report the golden file holds, leaving out
+// timings.
+type goldenScan struct {
+	Regions          []string
+	TotalStorageUsed int64
+	Entities         []collector.EntityUsage
+}
+
+// TestScanFixtures scans the regions the fixtures list, as --fixtures does,
+// and compares the report with testdata/scan.golden.json. Run with -update
+// to rewrite it after changing the fixtures or the collector.
+func TestScanFixtures(t *testing.T) {
+	fake, err := collectortest.LoadFixtures(filepath.Join("testdata", "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The regions are listed from the bootstrap region, which has no fixtures
+	bootstrap := fake.Client(aws.Config{Region: awsres.BootstrapRegion(awsres.PartitionAWS)})
+	listed, err := bootstrap.DescribeRegions(context.Background(), &ec2.DescribeRegionsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var regions []string
+	for _, region := range listed.Regions {
+		regions = append(regions, aws.ToString(region.RegionName))
+	}
+	if want := []string{"me-south-1", "us-east-1"}; !slices.Equal(regions, want) {
+		t.Fatalf("listed regions %v, want those with fixtures %v", regions, want)
+	}
+
+	report, err := collector.New(collector.Options{
+		Regions:      regions,
+		Services:     []string{collector.ServiceEBS, collector.ServiceSnapshots},
+		Concurrency:  4,
+		LoadConfig:   collectortest.LoadConfig,
+		NewEC2Client: fake.Client,
+	}).Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entities := report.Entities
+	slices.SortFunc(entities, func(a, b collector.EntityUsage) int {
+		return cmp.Or(cmp.Compare(a.Region, b.Region), cmp.Compare(a.ID, b.ID))
+	})
+	got, err := json.MarshalIndent(goldenScan{
+		Regions:          report.RegionsScanned(),
+		TotalStorageUsed: report.TotalStorageUsed,
+		Entities:         entities,
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "scan.golden.json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the scan differs from %s, run go test -update to accept it:\n%s", golden, got)
+	}
+}
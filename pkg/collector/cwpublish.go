@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// DefaultCloudWatchNamespace is the namespace PublishCloudWatch writes to
+// when none is given.
+const DefaultCloudWatchNamespace = "CrankyMosquitos"
+
+// maxMetricDataPerCall is the PutMetricData limit on datapoints per request.
+const maxMetricDataPerCall = 1000
+
+// PublishCloudWatch writes the storage used by every volume and snapshot and
+// the report total to CloudWatch, batching the datapoints to stay within the
+// PutMetricData limits.
+func PublishCloudWatch(ctx context.Context, client *cloudwatch.Client, namespace string, report *Report) error {
+	if namespace == "" {
+		namespace = DefaultCloudWatchNamespace
+	}
+
+	data := cloudWatchData(report)
+
+	for start := 0; start < len(data); start += maxMetricDataPerCall {
+		end := min(start+maxMetricDataPerCall, len(data))
+
+		_, err := client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(namespace),
+			MetricData: data[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put metric data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func cloudWatchData(report *Report) []cwtypes.MetricDatum {
+	timestamp := aws.Time(report.GeneratedAt)
+
+	datum := func(name string, value int64, dimensions ...cwtypes.Dimension) cwtypes.MetricDatum {
+		return cwtypes.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dimensions,
+			Timestamp:  timestamp,
+			Unit:       cwtypes.StandardUnitBytes,
+			Value:      aws.Float64(float64(value)),
+		}
+	}
+	dimension := func(name, value string) cwtypes.Dimension {
+		return cwtypes.Dimension{Name: aws.String(name), Value: aws.String(value)}
+	}
+
+	var data []cwtypes.MetricDatum
+	for _, entity := range report.Entities {
+		switch entity.Type {
+		case EntityTypeVolume:
+			data = append(data, datum("VolumeStorageUsed", entity.StorageUsed,
+				dimension("VolumeId", entity.ID), dimension("Region", entity.Region)))
+		case EntityTypeSnapshot:
+			data = append(data, datum("SnapshotStorageUsed", entity.StorageUsed,
+				dimension("SnapshotId", entity.ID), dimension("Region", entity.Region)))
+		}
+	}
+	data = append(data, datum("TotalStorageUsed", report.TotalStorageUsed))
+
+	return data
+}
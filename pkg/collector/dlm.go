@@ -0,0 +1,278 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Resource types a lifecycle policy targets.
+const (
+	DLMResourceVolume   = "VOLUME"
+	DLMResourceInstance = "INSTANCE"
+)
+
+// Tag key prefixes of the snapshots DLM and AWS Backup create.
+const (
+	dlmTagPrefix    = "aws:dlm:"
+	backupTagPrefix = "aws:backup:"
+)
+
+// LifecyclePolicy is an enabled Data Lifecycle Manager policy creating EBS
+// snapshots.
+type LifecyclePolicy struct {
+	ID            string
+	Region        string
+	Description   string
+	ResourceTypes []string          // DLMResourceVolume or DLMResourceInstance
+	TargetTags    map[string]string // Resources carrying any of them are targeted
+	Default       bool              // Default policies target every resource of their type in the region
+}
+
+// targets reports whether the policy snapshots resources of the type
+// carrying tags.
+func (p LifecyclePolicy) targets(resourceType string, tags map[string]string) bool {
+	if !slices.Contains(p.ResourceTypes, resourceType) {
+		return false
+	}
+	if p.Default {
+		return true
+	}
+	for key, value := range p.TargetTags {
+		if v, ok := tags[key]; ok && v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DLMCoverage cross-references the volumes and snapshots of a report with
+// the lifecycle policies of their regions.
+type DLMCoverage struct {
+	Policies []LifecyclePolicy
+	// Uncovered holds the volumes no policy targets, either by their own
+	// tags or by the tags of the instance they are attached to.
+	Uncovered []EntityUsage
+	// Unmanaged holds the snapshots neither DLM nor AWS Backup created.
+	Unmanaged []EntityUsage
+	// FailedRegions lists the regions whose policies could not be read.
+	// Their volumes are left out of Uncovered.
+	FailedRegions []string
+}
+
+// DLMCoverage reads the lifecycle policies of every region holding volumes
+// or snapshots and reports the volumes without snapshot coverage and the
+// snapshots created outside any policy, largest first.
+func (c *StorageCollector) DLMCoverage(ctx context.Context, entities []EntityUsage) DLMCoverage {
+	byRegion := map[string][]EntityUsage{}
+	for _, entity := range entities {
+		if entity.Type == EntityTypeVolume || entity.Type == EntityTypeSnapshot {
+			byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+	var coverage DLMCoverage
+
+	for region, regionEntities := range byRegion {
+		wg.Add(1)
+
+		go func(region string, entities []EntityUsage) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			var unmanaged []EntityUsage
+			for _, entity := range entities {
+				if entity.Type == EntityTypeSnapshot && !managedSnapshot(entity) {
+					unmanaged = append(unmanaged, entity)
+				}
+			}
+
+			policies, uncovered, err := c.regionDLMCoverage(ctx, region, entities)
+
+			mu.Lock()
+			defer mu.Unlock()
+			coverage.Unmanaged = append(coverage.Unmanaged, unmanaged...)
+			if err != nil {
+				slog.Error("failed to read lifecycle policies", "region", region, "error", err)
+				coverage.FailedRegions = append(coverage.FailedRegions, region)
+				return
+			}
+			coverage.Policies = append(coverage.Policies, policies...)
+			coverage.Uncovered = append(coverage.Uncovered, uncovered...)
+		}(region, regionEntities)
+	}
+
+	wg.Wait()
+
+	sort.Slice(coverage.Policies, func(i, j int) bool {
+		if coverage.Policies[i].Region != coverage.Policies[j].Region {
+			return coverage.Policies[i].Region < coverage.Policies[j].Region
+		}
+		return coverage.Policies[i].ID < coverage.Policies[j].ID
+	})
+	sortBySize(coverage.Uncovered)
+	sortBySize(coverage.Unmanaged)
+	sort.Strings(coverage.FailedRegions)
+
+	return coverage
+}
+
+// regionDLMCoverage returns the lifecycle policies of a region and the
+// volumes among entities that none of them targets.
+func (c *StorageCollector) regionDLMCoverage(ctx context.Context, region string, entities []EntityUsage) ([]LifecyclePolicy, []EntityUsage, error) {
+	cfg, err := c.loadConfig(ctx, region)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create clients: %w", err)
+	}
+
+	policies, err := c.lifecyclePolicies(ctx, cfg, region)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var instanceTags map[string]map[string]string
+	if slices.ContainsFunc(policies, func(p LifecyclePolicy) bool { return slices.Contains(p.ResourceTypes, DLMResourceInstance) }) {
+		instanceTags, err = describeInstanceTags(ctx, c.regionEC2Client(region, cfg))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+	}
+
+	var uncovered []EntityUsage
+	for _, entity := range entities {
+		if entity.Type != EntityTypeVolume {
+			continue
+		}
+		covered := slices.ContainsFunc(policies, func(p LifecyclePolicy) bool {
+			if p.targets(DLMResourceVolume, entity.Tags) {
+				return true
+			}
+			tags, attached := instanceTags[entity.InstanceID]
+			return attached && p.targets(DLMResourceInstance, tags)
+		})
+		if !covered {
+			uncovered = append(uncovered, entity)
+		}
+	}
+
+	return policies, uncovered, nil
+}
+
+// managedSnapshot reports whether DLM or AWS Backup created the snapshot,
+// which both tag their snapshots with reserved aws: tags.
+func managedSnapshot(entity EntityUsage) bool {
+	for key := range entity.Tags {
+		if strings.HasPrefix(key, dlmTagPrefix) || strings.HasPrefix(key, backupTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortBySize(entities []EntityUsage) {
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].StorageUsed != entities[j].StorageUsed {
+			return entities[i].StorageUsed > entities[j].StorageUsed
+		}
+		return entities[i].ID < entities[j].ID
+	})
+}
+
+// describeInstanceTags returns the tags of every instance of a region by
+// instance ID.
+func describeInstanceTags(ctx context.Context, client EC2DescribeAPI) (map[string]map[string]string, error) {
+	tags := map[string]map[string]string{}
+
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				tags[aws.ToString(instance.InstanceId)] = tagMap(instance.Tags)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// dlmPolicySummary and dlmPolicy are the parts of the DLM
+// GetLifecyclePolicies and GetLifecyclePolicy responses the coverage needs.
+type dlmPolicySummary struct {
+	PolicyID string `json:"PolicyId"`
+}
+
+type dlmPolicy struct {
+	PolicyID      string `json:"PolicyId"`
+	Description   string
+	DefaultPolicy bool
+	PolicyDetails struct {
+		ResourceType  string // Only set for default policies
+		ResourceTypes []string
+		TargetTags    []struct{ Key, Value string }
+	}
+}
+
+// lifecyclePolicies lists the enabled EBS snapshot policies of a region.
+// DLM is called over its REST API with callAPI.
+func (c *StorageCollector) lifecyclePolicies(ctx context.Context, cfg aws.Config, region string) ([]LifecyclePolicy, error) {
+	var list struct{ Policies []dlmPolicySummary }
+	query := url.Values{"state": {"ENABLED"}, "policyTypes": {"EBS_SNAPSHOT_MANAGEMENT"}}
+	if err := c.callDLM(ctx, cfg, region, "GetLifecyclePolicies", "/policies?"+query.Encode(), &list); err != nil {
+		return nil, fmt.Errorf("failed to list lifecycle policies: %w", err)
+	}
+
+	var policies []LifecyclePolicy
+	for _, summary := range list.Policies {
+		var response struct{ Policy dlmPolicy }
+		if err := c.callDLM(ctx, cfg, region, "GetLifecyclePolicy", "/policies/"+url.PathEscape(summary.PolicyID), &response); err != nil {
+			return nil, fmt.Errorf("failed to get lifecycle policy %s: %w", summary.PolicyID, err)
+		}
+
+		details := response.Policy.PolicyDetails
+		policy := LifecyclePolicy{
+			ID:            response.Policy.PolicyID,
+			Region:        region,
+			Description:   response.Policy.Description,
+			ResourceTypes: details.ResourceTypes,
+			TargetTags:    map[string]string{},
+			Default:       response.Policy.DefaultPolicy,
+		}
+		if details.ResourceType != "" {
+			policy.ResourceTypes = append(policy.ResourceTypes, details.ResourceType)
+		}
+		for _, tag := range details.TargetTags {
+			policy.TargetTags[tag.Key] = tag.Value
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// callDLM sends a GET request for an operation of the DLM API of a region
+// and decodes the JSON response into out.
+func (c *StorageCollector) callDLM(ctx context.Context, cfg aws.Config, region, operation, path string, out any) error {
+	body, err := c.callAPI(ctx, cfg, region, apiRequest{name: "DLM", operation: operation, service: "dlm", path: path})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
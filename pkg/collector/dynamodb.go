@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// getDynamoDBStorageUsed reports the size of every DynamoDB table, which
+// DynamoDB updates about every six hours.
+func (c *StorageCollector) getDynamoDBStorageUsed(ctx context.Context, client *dynamodb.Client, region string) []EntityUsage {
+	slog.Debug("querying DynamoDB tables", "region", region)
+
+	var tables []EntityUsage
+
+	paginator := dynamodb.NewListTablesPaginator(client, &dynamodb.ListTablesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to list DynamoDB tables", "region", region, "error", err)
+			break
+		}
+
+		for _, name := range page.TableNames {
+			described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+			if err != nil {
+				slog.Error("failed to describe DynamoDB table", "region", region, "table", name, "error", err)
+				continue
+			}
+
+			table := described.Table
+			tables = append(tables, EntityUsage{
+				ID:          name,
+				Region:      region,
+				Type:        EntityTypeDynamoDBTable,
+				StorageUsed: aws.ToInt64(table.TableSizeBytes),
+				ObjectCount: aws.ToInt64(table.ItemCount),
+				State:       string(table.TableStatus),
+			})
+		}
+	}
+
+	return c.scoped(region, tables)
+}
@@ -0,0 +1,530 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+const gib = 1024 * 1024 * 1024
+
+// nameLookupBatch is the number of IDs resolved per call. Filter values are
+// limited to 200, and filtering, unlike passing IDs, does not fail the whole
+// call when one of them no longer exists.
+const nameLookupBatch = 200
+
+// idBatches splits ids, without duplicates, into batches of nameLookupBatch.
+func idBatches(ids []string) [][]string {
+	seen := map[string]bool{}
+	var batches [][]string
+	var batch []string
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		batch = append(batch, id)
+		if len(batch) == nameLookupBatch {
+			batches = append(batches, batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// nameTag returns the value of the Name tag, or "".
+func nameTag(tags []types.Tag) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == "Name" {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// autoScalingGroupTag is the tag EC2 Auto Scaling puts on the instances it
+// launches.
+const autoScalingGroupTag = "aws:autoscaling:groupName"
+
+// instanceDetails is what a volume entry shows of the instance it is
+// attached to.
+type instanceDetails struct {
+	Name             string
+	InstanceType     string
+	State            string // running, stopped, ...
+	AutoScalingGroup string
+}
+
+// getInstanceNames returns the Name tags of the given instances of a region,
+// by instance ID. Instances without a Name tag are left out. A failed batch
+// is logged and skipped, and its error returned along with the other names.
+func getInstanceNames(ctx context.Context, client EC2DescribeAPI, instanceIDs []string) (map[string]string, error) {
+	details, lookupErr := getInstanceDetails(ctx, client, instanceIDs)
+	names := map[string]string{}
+	for id, instance := range details {
+		if instance.Name != "" {
+			names[id] = instance.Name
+		}
+	}
+	return names, lookupErr
+}
+
+// getInstanceDetails returns the details of the given instances of a region,
+// by instance ID. A failed batch is logged and skipped, and its error
+// returned along with the other details.
+func getInstanceDetails(ctx context.Context, client EC2DescribeAPI, instanceIDs []string) (map[string]instanceDetails, error) {
+	details := map[string]instanceDetails{}
+	var lookupErr error
+
+	for _, batch := range idBatches(instanceIDs) {
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.Error("failed to describe instances", "error", err)
+				lookupErr = err
+				break
+			}
+
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					tags := tagMap(instance.Tags)
+					detail := instanceDetails{
+						Name:             tags["Name"],
+						InstanceType:     string(instance.InstanceType),
+						AutoScalingGroup: tags[autoScalingGroupTag],
+					}
+					if instance.State != nil {
+						detail.State = string(instance.State.Name)
+					}
+					details[aws.ToString(instance.InstanceId)] = detail
+				}
+			}
+		}
+	}
+
+	return details, lookupErr
+}
+
+// getVolumeNames returns the Name tags of the given volumes of a region, by
+// volume ID. Deleted volumes and volumes without a Name tag are left out. A
+// failed batch is logged and skipped, and its error returned along with the
+// other names.
+func getVolumeNames(ctx context.Context, client EC2DescribeAPI, volumeIDs []string) (map[string]string, error) {
+	names := map[string]string{}
+	var lookupErr error
+
+	for _, batch := range idBatches(volumeIDs) {
+		paginator := ec2.NewDescribeVolumesPaginator(client, &ec2.DescribeVolumesInput{
+			Filters: []types.Filter{{Name: aws.String("volume-id"), Values: batch}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.Error("failed to describe volumes", "error", err)
+				lookupErr = err
+				break
+			}
+
+			for _, volume := range page.Volumes {
+				if name := nameTag(volume.Tags); name != "" {
+					names[aws.ToString(volume.VolumeId)] = name
+				}
+			}
+		}
+	}
+
+	return names, lookupErr
+}
+
+// lookupNames returns the names fetch finds for the IDs, through the
+// resolver of the scan and the name cache when there is one.
+func (c *StorageCollector) lookupNames(ctx context.Context, region string, ids []string, fetch func(context.Context, []string) (map[string]string, error)) map[string]string {
+	if c.skipEnrichment("names") {
+		return nil
+	}
+	return c.nameResolver.resolve(ctx, region, ids, func(ctx context.Context, batch []string) (map[string]string, error) {
+		if c.names == nil {
+			return fetch(ctx, batch)
+		}
+		return c.names.lookup(ctx, region, batch, fetch)
+	})
+}
+
+func (c *StorageCollector) getEBSStorageUsed(ctx context.Context, client EC2DescribeAPI, region string) []EntityUsage {
+	slog.Debug("querying volumes", "region", region)
+	params := &ec2.DescribeVolumesInput{
+		Filters: c.opts.TagFilters.ec2Filters(),
+	}
+	if c.opts.Scope != nil {
+		params.VolumeIds = c.opts.Scope.IDs(region, "volume")
+		if len(params.VolumeIds) == 0 {
+			return nil
+		}
+	}
+	var described []types.Volume
+	paginator := ec2.NewDescribeVolumesPaginator(client, params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) {
+				switch apiErr.ErrorCode() {
+				case "InvalidVolume.NotFound":
+					// A volume of the scope does not exist
+					slog.Warn("invalid volume ID", "region", region, "error", apiErr.ErrorMessage())
+					return nil
+				case "UnauthorizedOperation":
+					slog.Warn("not authorized to describe volumes", "region", region, "error", apiErr.ErrorMessage())
+					return nil
+				}
+			}
+
+			slog.Error("failed to describe volumes", "region", region, "error", err)
+			return nil
+		}
+		described = append(described, page.Volumes...)
+	}
+
+	var volumes []EntityUsage
+	var instanceIDs []string
+
+	for _, volume := range described {
+		size := int64(*volume.Size) * 1024 * 1024 * 1024 // Convert from GB to bytes
+
+		entity := EntityUsage{
+			ID:               *volume.VolumeId,
+			StorageUsed:      size,
+			Region:           region,
+			Type:             EntityTypeVolume,
+			VolumeType:       string(volume.VolumeType),
+			AttachedInstance: "", // Initialize the attached instance ID as empty
+			Tags:             tagMap(volume.Tags),
+			CreateTime:       aws.ToTime(volume.CreateTime),
+			Encrypted:        aws.ToBool(volume.Encrypted),
+			MultiAttach:      aws.ToBool(volume.MultiAttachEnabled),
+		}
+
+		switch volume.VolumeType {
+		case types.VolumeTypeIo1, types.VolumeTypeIo2:
+			entity.IOPS = aws.ToInt32(volume.Iops)
+		case types.VolumeTypeGp3:
+			entity.IOPS = aws.ToInt32(volume.Iops)
+			entity.Throughput = aws.ToInt32(volume.Throughput)
+		}
+
+		if volume.Attachments != nil && len(volume.Attachments) > 0 {
+			// Volume is attached to an instance
+			entity.AttachedInstance = *volume.Attachments[0].InstanceId
+			entity.InstanceID = entity.AttachedInstance
+			instanceIDs = append(instanceIDs, entity.AttachedInstance)
+		}
+
+		volumes = append(volumes, entity)
+	}
+
+	if !c.skipEnrichment("volume modifications") {
+		modifications := getVolumeModifications(ctx, client, region, params.VolumeIds)
+		for i := range volumes {
+			if modification, ok := modifications[volumes[i].ID]; ok {
+				volumes[i].Modification = &modification
+			}
+		}
+	}
+
+	if c.opts.InstanceDetails && !c.skipEnrichment("instance details") {
+		// Instances stop and start between scans, so their details are
+		// looked up every scan rather than through the name cache
+		details := c.instanceResolver.resolve(ctx, region, instanceIDs, func(ctx context.Context, batch []string) (map[string]instanceDetails, error) {
+			return getInstanceDetails(ctx, client, batch)
+		})
+		for i := range volumes {
+			instance, ok := details[volumes[i].InstanceID]
+			if !ok {
+				continue
+			}
+			if instance.Name != "" {
+				volumes[i].AttachedInstance = instance.Name
+			}
+			volumes[i].InstanceType = instance.InstanceType
+			volumes[i].InstanceState = instance.State
+			volumes[i].AutoScalingGroup = instance.AutoScalingGroup
+		}
+		return volumes
+	}
+
+	// Replace instance IDs with their "Name" tag, looked up in batches
+	instanceNames := c.lookupNames(ctx, region, instanceIDs, func(ctx context.Context, ids []string) (map[string]string, error) {
+		return getInstanceNames(ctx, client, ids)
+	})
+	for i := range volumes {
+		if name, ok := instanceNames[volumes[i].InstanceID]; ok {
+			volumes[i].AttachedInstance = name
+		}
+	}
+
+	return volumes
+}
+
+func (c *StorageCollector) getSnapshotStorageUsed(ctx context.Context, client EC2DescribeAPI, region string) []EntityUsage {
+	slog.Debug("querying snapshots", "region", region)
+
+	filter := c.opts.SnapshotFilter
+	owners := c.opts.SnapshotOwners
+	if len(owners) == 0 {
+		owners = []string{"self"}
+	}
+	params := &ec2.DescribeSnapshotsInput{
+		OwnerIds: owners,
+		Filters:  append(filter.ec2Filters(), c.opts.TagFilters.ec2Filters()...),
+	}
+	if c.opts.Scope != nil {
+		params.SnapshotIds = c.opts.Scope.IDs(region, "snapshot")
+		if len(params.SnapshotIds) == 0 {
+			return nil
+		}
+	}
+	collected, err := c.describeSnapshots(ctx, client, region, params)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "InvalidSnapshot.NotFound":
+				// A snapshot of the scope does not exist
+				slog.Warn("invalid snapshot ID", "region", region, "error", apiErr.ErrorMessage())
+				return nil
+			case "UnauthorizedOperation":
+				slog.Warn("not authorized to describe snapshots", "region", region, "error", apiErr.ErrorMessage())
+				return nil
+			}
+		}
+
+		slog.Error("failed to describe snapshots", "region", region, "error", err)
+		return nil
+	}
+
+	if c.opts.IncludeSharedSnapshots {
+		collected = appendSharedSnapshots(ctx, client, region, params, collected)
+	}
+
+	var snapshots []EntityUsage
+	var unnamed []string // Source volumes of the snapshots without a "Name" tag
+
+	for _, snapshot := range collected {
+		if !filter.Contains(aws.ToTime(snapshot.StartTime)) {
+			continue
+		}
+
+		size := int64(*snapshot.VolumeSize) * 1024 * 1024 * 1024 // Convert from GB to bytes
+
+		entity := EntityUsage{
+			ID:               *snapshot.SnapshotId,
+			StorageUsed:      size,
+			Region:           region,
+			Type:             EntityTypeSnapshot,
+			AttachedInstance: "", // Snapshots are not attached to instances, so leave it empty
+			Tags:             tagMap(snapshot.Tags),
+			SourceVolume:     aws.ToString(snapshot.VolumeId),
+			Description:      aws.ToString(snapshot.Description),
+			StartTime:        aws.ToTime(snapshot.StartTime),
+			State:            string(snapshot.State),
+			Progress:         snapshotProgress(snapshot),
+			Encrypted:        aws.ToBool(snapshot.Encrypted),
+		}
+		if owner := aws.ToString(snapshot.OwnerId); c.opts.AccountID != "" && owner != "" && owner != c.opts.AccountID {
+			entity.SnapshotOwner = owner
+		}
+
+		// Check if the snapshot has a "Name" tag
+		entity.AttachedInstance = nameTag(snapshot.Tags)
+		if entity.AttachedInstance == "" {
+			unnamed = append(unnamed, entity.SourceVolume)
+		}
+
+		snapshots = append(snapshots, entity)
+	}
+
+	// If a snapshot doesn't have a "Name" tag, use the name of its volume if
+	// the volume still exists
+	volumeNames := c.lookupNames(ctx, region, unnamed, func(ctx context.Context, ids []string) (map[string]string, error) {
+		return getVolumeNames(ctx, client, ids)
+	})
+	for i := range snapshots {
+		if snapshots[i].AttachedInstance != "" {
+			continue
+		}
+		if name, ok := volumeNames[snapshots[i].SourceVolume]; ok {
+			snapshots[i].AttachedInstance = fmt.Sprintf("Volume: %s", name)
+		}
+	}
+	c.markSourceVolumes(ctx, client, region, snapshots)
+
+	if c.opts.SharedSnapshots {
+		markPublicSnapshots(ctx, client, region, params, snapshots)
+		if c.opts.Scope == nil {
+			snapshots = append(snapshots, c.getSharedSnapshots(ctx, client, region, collected)...)
+		}
+	}
+
+	return snapshots
+}
+
+// describeSnapshots lists the snapshots of params. With Options.Checkpoint
+// they are listed page by page, resuming after the pages an interrupted
+// earlier scan listed; a resumed listing whose page token is rejected
+// starts over.
+func (c *StorageCollector) describeSnapshots(ctx context.Context, client EC2DescribeAPI, region string, params *ec2.DescribeSnapshotsInput) ([]types.Snapshot, error) {
+	if c.opts.Checkpoint == nil || len(params.SnapshotIds) > 0 {
+		return listSnapshots(ctx, client, params)
+	}
+
+	key := c.checkpointKey(region)
+	snapshots, token, listed := c.opts.Checkpoint.snapshotPages(key)
+	if listed {
+		slog.Info("snapshots restored from checkpoint", "region", region, "snapshots", len(snapshots))
+		return snapshots, nil
+	}
+	resumed := token != ""
+	if resumed {
+		slog.Info("resuming snapshots from checkpoint", "region", region, "snapshots", len(snapshots))
+	}
+
+	page := *params
+	page.MaxResults = aws.Int32(snapshotPageSize)
+	for {
+		page.NextToken = nil
+		if token != "" {
+			page.NextToken = aws.String(token)
+		}
+		resp, err := client.DescribeSnapshots(ctx, &page)
+		if err != nil && resumed && ctx.Err() == nil {
+			slog.Warn("starting snapshots over: checkpointed page rejected", "region", region, "error", err)
+			snapshots, token, resumed = nil, "", false
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resumed = false
+
+		snapshots = append(snapshots, resp.Snapshots...)
+		token = aws.ToString(resp.NextToken)
+		c.opts.Checkpoint.snapshotPage(key, snapshots, token)
+		if token == "" {
+			return snapshots, nil
+		}
+	}
+}
+
+// listSnapshots returns the snapshots of every page of params.
+func listSnapshots(ctx context.Context, client EC2DescribeAPI, params *ec2.DescribeSnapshotsInput) ([]types.Snapshot, error) {
+	var snapshots []types.Snapshot
+	paginator := ec2.NewDescribeSnapshotsPaginator(client, params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, page.Snapshots...)
+	}
+	return snapshots, nil
+}
+
+// appendSharedSnapshots adds the snapshots other accounts shared with this
+// one, matching the same filters as owned, to the snapshots already
+// collected.
+func appendSharedSnapshots(ctx context.Context, client EC2DescribeAPI, region string, owned *ec2.DescribeSnapshotsInput, collected []types.Snapshot) []types.Snapshot {
+	params := *owned
+	params.OwnerIds = nil
+	params.RestorableByUserIds = []string{"self"}
+	shared, err := listSnapshots(ctx, client, &params)
+	if err != nil {
+		slog.Error("failed to describe shared snapshots", "region", region, "error", err)
+		return collected
+	}
+
+	seen := map[string]bool{}
+	for _, snapshot := range collected {
+		seen[aws.ToString(snapshot.SnapshotId)] = true
+	}
+	for _, snapshot := range shared {
+		if !seen[aws.ToString(snapshot.SnapshotId)] {
+			collected = append(collected, snapshot)
+		}
+	}
+	return collected
+}
+
+// markPublicSnapshots flags the owned snapshots every account can restore.
+func markPublicSnapshots(ctx context.Context, client EC2DescribeAPI, region string, owned *ec2.DescribeSnapshotsInput, snapshots []EntityUsage) {
+	params := *owned
+	params.RestorableByUserIds = []string{"all"}
+	restorable, err := listSnapshots(ctx, client, &params)
+	if err != nil {
+		slog.Error("failed to describe public snapshots", "region", region, "error", err)
+		return
+	}
+
+	public := map[string]bool{}
+	for _, snapshot := range restorable {
+		public[aws.ToString(snapshot.SnapshotId)] = true
+	}
+	for i := range snapshots {
+		if public[snapshots[i].ID] {
+			slog.Warn("snapshot is public", "region", region, "snapshot", snapshots[i].ID)
+			snapshots[i].Public = true
+		}
+	}
+}
+
+// getSharedSnapshots lists the snapshots of other accounts this account can
+// restore. They cost their owner, not this account, so they use no storage.
+func (c *StorageCollector) getSharedSnapshots(ctx context.Context, client EC2DescribeAPI, region string, owned []types.Snapshot) []EntityUsage {
+	restorable, err := listSnapshots(ctx, client, &ec2.DescribeSnapshotsInput{
+		RestorableByUserIds: []string{"self"},
+		Filters:             c.opts.TagFilters.ec2Filters(),
+	})
+	if err != nil {
+		slog.Error("failed to describe shared snapshots", "region", region, "error", err)
+		return nil
+	}
+
+	own := map[string]bool{}
+	for _, snapshot := range owned {
+		own[aws.ToString(snapshot.SnapshotId)] = true
+	}
+
+	var shared []EntityUsage
+	for _, snapshot := range restorable {
+		owner := aws.ToString(snapshot.OwnerId)
+		if own[aws.ToString(snapshot.SnapshotId)] || (c.opts.AccountID != "" && owner == c.opts.AccountID) {
+			continue
+		}
+		shared = append(shared, EntityUsage{
+			ID:               aws.ToString(snapshot.SnapshotId),
+			Region:           region,
+			Type:             EntityTypeSharedSnapshot,
+			AttachedInstance: nameTag(snapshot.Tags),
+			AllocatedStorage: int64(aws.ToInt32(snapshot.VolumeSize)) * 1024 * 1024 * 1024,
+			Tags:             tagMap(snapshot.Tags),
+			SourceVolume:     aws.ToString(snapshot.VolumeId),
+			Description:      aws.ToString(snapshot.Description),
+			StartTime:        aws.ToTime(snapshot.StartTime),
+			State:            string(snapshot.State),
+			SnapshotOwner:    owner,
+		})
+	}
+	return shared
+}
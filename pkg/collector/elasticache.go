@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+)
+
+// getElastiCacheStorageUsed reports the size of every ElastiCache snapshot,
+// the sum of the cache sizes of its node snapshots.
+func (c *StorageCollector) getElastiCacheStorageUsed(ctx context.Context, client *elasticache.Client, region string) []EntityUsage {
+	slog.Debug("querying ElastiCache snapshots", "region", region)
+
+	var snapshots []EntityUsage
+
+	paginator := elasticache.NewDescribeSnapshotsPaginator(client, &elasticache.DescribeSnapshotsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe ElastiCache snapshots", "region", region, "error", err)
+			break
+		}
+
+		for _, snapshot := range page.Snapshots {
+			entity := EntityUsage{
+				ID:               aws.ToString(snapshot.SnapshotName),
+				Region:           region,
+				Type:             EntityTypeElastiCacheSnapshot,
+				Engine:           aws.ToString(snapshot.Engine),
+				State:            aws.ToString(snapshot.SnapshotStatus),
+				AttachedInstance: aws.ToString(snapshot.ReplicationGroupId),
+			}
+			if entity.AttachedInstance == "" {
+				entity.AttachedInstance = aws.ToString(snapshot.CacheClusterId)
+			}
+			for _, node := range snapshot.NodeSnapshots {
+				// CacheSize is in binary units labelled MB, e.g. "6 MB", as
+				// ParseBytes reads them
+				size, err := humanize.ParseBytes(aws.ToString(node.CacheSize))
+				if err != nil {
+					slog.Warn("invalid ElastiCache snapshot size", "region", region, "snapshot", entity.ID, "error", err)
+				}
+				entity.StorageUsed += size
+				created := aws.ToTime(node.SnapshotCreateTime)
+				if entity.StartTime.IsZero() || created.Before(entity.StartTime) {
+					entity.StartTime = created
+				}
+			}
+
+			snapshots = append(snapshots, entity)
+		}
+	}
+
+	return c.scoped(region, snapshots)
+}
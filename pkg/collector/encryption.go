@@ -0,0 +1,66 @@
+package collector
+
+import "sort"
+
+// RegionEncryption totals the volumes and snapshots of a region and the
+// ones among them that are not encrypted at rest.
+type RegionEncryption struct {
+	Region             string
+	Entities           int
+	StorageUsed        int64
+	Unencrypted        int
+	UnencryptedStorage int64
+}
+
+// Unencrypted returns the volumes and snapshots that are not encrypted at
+// rest, largest first.
+func Unencrypted(entities []EntityUsage) []EntityUsage {
+	var unencrypted []EntityUsage
+	for _, entity := range entities {
+		if isUnencrypted(entity) {
+			unencrypted = append(unencrypted, entity)
+		}
+	}
+	sort.SliceStable(unencrypted, func(i, j int) bool {
+		if unencrypted[i].StorageUsed != unencrypted[j].StorageUsed {
+			return unencrypted[i].StorageUsed > unencrypted[j].StorageUsed
+		}
+		return unencrypted[i].ID < unencrypted[j].ID
+	})
+	return unencrypted
+}
+
+// EncryptionByRegion totals the encryption of volumes and snapshots per
+// region, sorted by region.
+func EncryptionByRegion(entities []EntityUsage) []RegionEncryption {
+	byRegion := map[string]*RegionEncryption{}
+	for _, entity := range entities {
+		if entity.Type != EntityTypeVolume && entity.Type != EntityTypeSnapshot {
+			continue
+		}
+
+		region, ok := byRegion[entity.Region]
+		if !ok {
+			region = &RegionEncryption{Region: entity.Region}
+			byRegion[entity.Region] = region
+		}
+		region.Entities++
+		region.StorageUsed += entity.StorageUsed
+		if !entity.Encrypted {
+			region.Unencrypted++
+			region.UnencryptedStorage += entity.StorageUsed
+		}
+	}
+
+	regions := make([]RegionEncryption, 0, len(byRegion))
+	for _, region := range byRegion {
+		regions = append(regions, *region)
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Region < regions[j].Region })
+
+	return regions
+}
+
+func isUnencrypted(entity EntityUsage) bool {
+	return (entity.Type == EntityTypeVolume || entity.Type == EntityTypeSnapshot) && !entity.Encrypted
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type ByStorageUsedEntity []EntityUsage
+
+func (a ByStorageUsedEntity) Len() int           { return len(a) }
+func (a ByStorageUsedEntity) Less(i, j int) bool { return a[i].StorageUsed > a[j].StorageUsed }
+func (a ByStorageUsedEntity) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// Entity types reported in the output.
+const (
+	EntityTypeVolume         = "Volume"
+	EntityTypeSnapshot       = "Snapshot"
+	EntityTypeBucket         = "Bucket"
+	EntityTypeDBInstance     = "DBInstance"
+	EntityTypeDBCluster      = "DBCluster"
+	EntityTypeEFS            = "EFSFileSystem"
+	EntityTypeFSx            = "FSxFileSystem"
+	EntityTypeRecoveryPoint  = "RecoveryPoint"
+	EntityTypeSharedSnapshot = "SharedSnapshot" // Owned by another account and shared with this one
+
+	EntityTypeDynamoDBTable       = "DynamoDBTable"
+	EntityTypeRedshiftCluster     = "RedshiftCluster"
+	EntityTypeElastiCacheSnapshot = "ElastiCacheSnapshot"
+)
+
+type EntityUsage struct {
+	ID               string
+	StorageUsed      int64
+	Region           string
+	Type             string
+	AttachedInstance string // New field to store the attached EC2 instance ID
+	InstanceID       string // Instance a volume is attached to, even when AttachedInstance holds its Name tag
+	InstanceType     string // Type of the instance a volume is attached to, only set with Options.InstanceDetails
+	InstanceState    string // State of the instance a volume is attached to, only set with Options.InstanceDetails
+	AutoScalingGroup string // Auto Scaling group of the instance a volume is attached to, only set with Options.InstanceDetails
+	ObjectCount      int64  // Number of objects, only set for buckets and DynamoDB tables
+	Engine           string // Database engine, only set for RDS and ElastiCache entities, or the node type of Redshift clusters
+	AllocatedStorage int64  // Provisioned bytes, only set for RDS, FSx, Redshift and shared snapshot entities
+	FileSystemType   string // FSx file system type, only set for FSx entities
+	BackupVault      string // AWS Backup vault, only set for recovery points
+	ResourceType     string // Type of the backed up resource, only set for recovery points
+	VolumeType       string // EBS volume type, only set for volumes
+	IOPS             int32  // Provisioned IOPS, only set for io1, io2 and gp3 volumes
+	Throughput       int32  // Provisioned MiB/s, only set for gp3 volumes
+	MultiAttach      bool   // Multi-Attach enabled, only set for io1 and io2 volumes
+	MonthlyCostUSD   float64
+	Tags             map[string]string
+	SourceVolume     string              // Volume a snapshot was taken from
+	VolumeExists     *bool               // Whether SourceVolume still exists, only set for snapshots whose source volume was looked up
+	Description      string              // Description of a snapshot
+	StartTime        time.Time           // Time a snapshot was started
+	CreateTime       time.Time           // Time a volume was created
+	State            string              // State of a snapshot, table or cluster
+	Public           bool                // Restorable by every account, only set for snapshots with Options.SharedSnapshots
+	Encrypted        bool                // Encrypted at rest, only set for volumes and snapshots
+	SnapshotOwner    string              // Account owning a shared snapshot
+	Progress         *float64            // Percent complete, only set for pending snapshots
+	Modification     *VolumeModification // Only set for volumes being modified
+	BackupAgeHours   *float64            // Hours since the last completed snapshot, only set for volumes under a backup SLA
+	SnapshotAge      *float64            // Seconds since the last completed snapshot, +Inf for none, only set for in-use volumes with Options.MaxSnapshotAge
+	SnapshotGap      bool                // SnapshotAge is over Options.MaxSnapshotAge
+	BackupSLAMaxAge  time.Duration
+	AccessClass      string // AccessHot, AccessWarm or AccessCold, only set for classified volumes
+	Recommendation   string // Suggested storage change for a classified volume
+	Profile          string // AWS profile the entity was scanned with, only set with Options.Profile
+	AccountID        string // Account the entity belongs to, only set with Options.AccountID
+	Stack            string // CloudFormation stack or Terraform workspace, from Options.StackTags
+	Owner            string // Only set with Options.Owners, OwnerUnknown when unresolved
+	OwnerSource      string // Source Owner was resolved from, e.g. OwnerSourceTag
+
+	// The Kubernetes PersistentVolume a volume backs, only set for volumes
+	// correlated with a cluster
+	KubeCluster   string   // Context the cluster was read with
+	KubeNamespace string   // Namespace of KubePVC
+	KubePVC       string   // PersistentVolumeClaim bound to the volume
+	KubePods      []string // Pods mounting KubePVC
+}
+
+// tagMap converts EC2 tags into a key/value map.
+func tagMap(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/fsx"
+)
+
+// getEFSStorageUsed reports the metered size of every EFS file system.
+func (c *StorageCollector) getEFSStorageUsed(ctx context.Context, client *efs.Client, region string) []EntityUsage {
+	slog.Debug("querying EFS file systems", "region", region)
+
+	var fileSystems []EntityUsage
+
+	paginator := efs.NewDescribeFileSystemsPaginator(client, &efs.DescribeFileSystemsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe EFS file systems", "region", region, "error", err)
+			break
+		}
+
+		for _, fileSystem := range page.FileSystems {
+			entity := EntityUsage{
+				ID:               aws.ToString(fileSystem.FileSystemId),
+				Region:           region,
+				Type:             EntityTypeEFS,
+				AttachedInstance: aws.ToString(fileSystem.Name),
+				Tags:             map[string]string{},
+			}
+			if fileSystem.SizeInBytes != nil {
+				entity.StorageUsed = fileSystem.SizeInBytes.Value
+			}
+			for _, tag := range fileSystem.Tags {
+				entity.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+
+			fileSystems = append(fileSystems, entity)
+		}
+	}
+
+	return c.scoped(region, fileSystems)
+}
+
+// getFSxStorageUsed reports the provisioned storage capacity of every FSx
+// file system. FSx does not expose the storage used outside CloudWatch, so
+// the capacity is reported as used.
+func (c *StorageCollector) getFSxStorageUsed(ctx context.Context, client *fsx.Client, region string) []EntityUsage {
+	slog.Debug("querying FSx file systems", "region", region)
+
+	var fileSystems []EntityUsage
+
+	paginator := fsx.NewDescribeFileSystemsPaginator(client, &fsx.DescribeFileSystemsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe FSx file systems", "region", region, "error", err)
+			break
+		}
+
+		for _, fileSystem := range page.FileSystems {
+			entity := EntityUsage{
+				ID:               aws.ToString(fileSystem.FileSystemId),
+				Region:           region,
+				Type:             EntityTypeFSx,
+				FileSystemType:   string(fileSystem.FileSystemType),
+				AllocatedStorage: int64(aws.ToInt32(fileSystem.StorageCapacity)) * gib,
+				Tags:             map[string]string{},
+			}
+			entity.StorageUsed = entity.AllocatedStorage
+			for _, tag := range fileSystem.Tags {
+				entity.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			entity.AttachedInstance = entity.Tags["Name"]
+
+			fileSystems = append(fileSystems, entity)
+		}
+	}
+
+	return c.scoped(region, fileSystems)
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities of findings, most severe first.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// Severities lists the finding severities, most severe first.
+var Severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow}
+
+// Types of findings.
+const (
+	FindingBudgetBreach     = "budget-breach"
+	FindingUnencrypted      = "unencrypted"
+	FindingUnattachedVolume = "unattached-volume"
+	FindingIdleVolume       = "idle-volume"
+	FindingOrphanSnapshot   = "orphan-snapshot"
+	FindingStaleSnapshot    = "stale-snapshot"
+)
+
+// DefaultStaleSnapshotAge is the age past which a snapshot no AMI uses is a
+// stale snapshot finding.
+const DefaultStaleSnapshotAge = 365 * 24 * time.Hour
+
+// Finding is a problem a scan found, ranked by severity and carrying a hint
+// to remediate it.
+type Finding struct {
+	ID          string // Stable across scans, see FindingID
+	Type        string
+	Severity    string
+	Summary     string
+	Remediation string
+	Region      string       // Empty for findings about the whole scan
+	Entity      *EntityUsage // Resource the finding is about, nil for budget breaches
+}
+
+// FindingID identifies a finding by its type and the account, region and
+// ID of its resource, leaving out the empty parts, e.g.
+// unencrypted/us-east-1/vol-0123.
+func FindingID(findingType string, parts ...string) string {
+	id := []string{findingType}
+	for _, part := range parts {
+		if part != "" {
+			id = append(id, part)
+		}
+	}
+	return strings.Join(id, "/")
+}
+
+func entityFinding(findingType, severity string, entity EntityUsage, summary, remediation string) Finding {
+	return Finding{
+		ID:          FindingID(findingType, entity.AccountID, entity.Region, entity.ID),
+		Type:        findingType,
+		Severity:    severity,
+		Summary:     summary,
+		Remediation: remediation,
+		Region:      entity.Region,
+		Entity:      &entity,
+	}
+}
+
+// FindFindings returns the unencrypted resources, unattached and idle
+// volumes, orphan snapshots and stale snapshots of the entities, most
+// severe first. Idle volumes need Options.ClassifyAccess. amiSnapshots
+// holds the snapshots backing an AMI; orphan snapshots are only looked for
+// when it is set, which needs the volumes to have been scanned too, and
+// snapshots still being taken are not orphans yet.
+func FindFindings(entities []EntityUsage, amiSnapshots map[string]bool, now time.Time, staleAge time.Duration) []Finding {
+	if staleAge <= 0 {
+		staleAge = DefaultStaleSnapshotAge
+	}
+
+	var findings []Finding
+	orphaned := map[string]bool{}
+	if amiSnapshots != nil {
+		for _, orphan := range FindOrphans(entities, amiSnapshots, now, 0) {
+			entity := orphan.Entity
+			if slices.Contains(orphan.Reasons, OrphanSourceDeleted) && slices.Contains(orphan.Reasons, OrphanNotInAMI) && entity.PendingOperation() == "" {
+				orphaned[entity.ID] = true
+				findings = append(findings, entityFinding(FindingOrphanSnapshot, SeverityLow, entity,
+					fmt.Sprintf("Snapshot %s outlived its volume %s and backs no AMI", entity.ID, entity.SourceVolume),
+					"delete the snapshot unless it is kept as a backup"))
+			}
+		}
+	}
+
+	for _, entity := range entities {
+		if isUnencrypted(entity) {
+			remediation := "copy a snapshot of the volume with encryption enabled and replace the volume with one restored from it"
+			if entity.Type == EntityTypeSnapshot {
+				remediation = "copy the snapshot with encryption enabled and delete the original"
+			}
+			findings = append(findings, entityFinding(FindingUnencrypted, SeverityHigh, entity,
+				fmt.Sprintf("%s %s is not encrypted at rest", entity.Type, entity.ID), remediation))
+		}
+
+		switch entity.Type {
+		case EntityTypeVolume:
+			if entity.AttachedInstance == "" {
+				findings = append(findings, entityFinding(FindingUnattachedVolume, SeverityMedium, entity,
+					fmt.Sprintf("Volume %s is not attached to any instance", entity.ID),
+					"snapshot the volume if its data is still needed, then delete it"))
+			}
+			if entity.AttachedInstance != "" && entity.AccessClass == AccessCold {
+				remediation := "snapshot and delete the volume if the instance no longer needs it"
+				if entity.Recommendation != "" {
+					remediation = entity.Recommendation + ", or " + remediation
+				}
+				findings = append(findings, entityFinding(FindingIdleVolume, SeverityMedium, entity,
+					fmt.Sprintf("Volume %s attached to %s averaged under %d IO operations a day", entity.ID, entity.AttachedInstance, coldOpsPerDay),
+					remediation))
+			}
+		case EntityTypeSnapshot:
+			age := EntityAge(entity, now)
+			if age >= staleAge && !orphaned[entity.ID] && !amiSnapshots[entity.ID] {
+				findings = append(findings, entityFinding(FindingStaleSnapshot, SeverityLow, entity,
+					fmt.Sprintf("Snapshot %s is %.0f days old", entity.ID, age.Hours()/24),
+					"move the snapshot to the archive tier or delete it"))
+			}
+		}
+	}
+
+	SortFindings(findings)
+	return findings
+}
+
+// SortFindings orders findings most severe first, then by the storage of
+// their resource, largest first, then by ID.
+func SortFindings(findings []Finding) {
+	storage := func(finding Finding) int64 {
+		if finding.Entity == nil {
+			return 0
+		}
+		return finding.Entity.StorageUsed
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if ra, rb := slices.Index(Severities, a.Severity), slices.Index(Severities, b.Severity); ra != rb {
+			return ra < rb
+		}
+		if storage(a) != storage(b) {
+			return storage(a) > storage(b)
+		}
+		return a.ID < b.ID
+	})
+}
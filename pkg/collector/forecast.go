@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Models a forecast can fit. ForecastAuto fits both and keeps the one
+// closest to the samples.
+const (
+	ForecastAuto        = "auto"
+	ForecastLinear      = "linear"
+	ForecastExponential = "exponential"
+)
+
+// ForecastModels lists the models of ComputeForecast.
+var ForecastModels = []string{ForecastAuto, ForecastLinear, ForecastExponential}
+
+// ForecastSample is the storage used by a tag group or region in a scan.
+type ForecastSample struct {
+	Time        time.Time
+	StorageUsed int64
+}
+
+// ForecastSeries is the storage used by a tag group in a region, or by a
+// whole region without grouping, over the recorded scans, oldest first.
+type ForecastSeries struct {
+	Group   string // Value of the grouped tag, empty without grouping
+	Region  string
+	Samples []ForecastSample
+}
+
+// ForecastModel is a least squares fit of storage over time: bytes grow by
+// Slope per second for a linear model, and by a factor of e^Slope per
+// second for an exponential one, from Intercept at Origin.
+type ForecastModel struct {
+	Kind      string
+	Origin    time.Time
+	Intercept float64
+	Slope     float64
+}
+
+// At returns the storage the model predicts at t, never negative.
+func (m ForecastModel) At(t time.Time) float64 {
+	x := t.Sub(m.Origin).Seconds()
+	if m.Kind == ForecastExponential {
+		return m.Intercept * math.Exp(m.Slope*x)
+	}
+	return math.Max(0, m.Intercept+m.Slope*x)
+}
+
+// Crossing returns when the model first reaches limit at or after from,
+// false when it never does. It is from for storage already over the limit.
+func (m ForecastModel) Crossing(limit float64, from time.Time) (time.Time, bool) {
+	if m.At(from) >= limit {
+		return from, true
+	}
+	if m.Slope <= 0 {
+		return time.Time{}, false
+	}
+
+	var x float64
+	if m.Kind == ForecastExponential {
+		x = math.Log(limit/m.Intercept) / m.Slope
+	} else {
+		x = (limit - m.Intercept) / m.Slope
+	}
+	if x > float64(math.MaxInt64)/float64(time.Second) {
+		return time.Time{}, false
+	}
+	return m.Origin.Add(time.Duration(x * float64(time.Second))), true
+}
+
+// FitForecastModel fits a model of the given kind to samples. It returns
+// false when the samples span a single scan time, or when an exponential
+// model is asked of a series that was empty at some point.
+func FitForecastModel(samples []ForecastSample, kind string) (ForecastModel, bool) {
+	if kind == ForecastAuto {
+		linear, ok := FitForecastModel(samples, ForecastLinear)
+		if !ok {
+			return linear, false
+		}
+		exponential, ok := FitForecastModel(samples, ForecastExponential)
+		if ok && squaredError(exponential, samples) < squaredError(linear, samples) {
+			return exponential, true
+		}
+		return linear, true
+	}
+	if len(samples) < 2 {
+		return ForecastModel{}, false
+	}
+
+	model := ForecastModel{Kind: kind, Origin: samples[0].Time}
+	var n, sumX, sumY, sumXX, sumXY float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(model.Origin).Seconds()
+		y := float64(sample.StorageUsed)
+		if kind == ForecastExponential {
+			if sample.StorageUsed <= 0 {
+				return ForecastModel{}, false
+			}
+			y = math.Log(y)
+		}
+		n++
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return ForecastModel{}, false
+	}
+	model.Slope = (n*sumXY - sumX*sumY) / denominator
+	model.Intercept = (sumY - model.Slope*sumX) / n
+	if kind == ForecastExponential {
+		model.Intercept = math.Exp(model.Intercept)
+	}
+	return model, true
+}
+
+// squaredError is the sum of the squared differences, in bytes, between the
+// model and the samples.
+func squaredError(model ForecastModel, samples []ForecastSample) float64 {
+	var sum float64
+	for _, sample := range samples {
+		d := model.At(sample.Time) - float64(sample.StorageUsed)
+		sum += d * d
+	}
+	return sum
+}
+
+// StorageForecast is the storage a series is predicted to use.
+type StorageForecast struct {
+	Group     string
+	Region    string
+	Model     ForecastModel
+	Samples   int
+	Current   int64 // Storage of the latest sample
+	Predicted int64 // Storage at Forecast.Until
+}
+
+// Forecast predicts the storage of tag groups or regions from the scans
+// recorded over time.
+type Forecast struct {
+	GroupBy string // Tag key of the groups, empty without grouping
+	Until   time.Time
+	Series  []StorageForecast // Largest prediction first
+}
+
+// ComputeForecast fits a model of the given kind to every series and
+// predicts its storage at until. Series the model cannot be fitted to, see
+// FitForecastModel, are left out.
+func ComputeForecast(series []ForecastSeries, groupBy, kind string, until time.Time) Forecast {
+	forecast := Forecast{GroupBy: groupBy, Until: until}
+	for _, s := range series {
+		model, ok := FitForecastModel(s.Samples, kind)
+		if !ok {
+			continue
+		}
+		forecast.Series = append(forecast.Series, StorageForecast{
+			Group:     s.Group,
+			Region:    s.Region,
+			Model:     model,
+			Samples:   len(s.Samples),
+			Current:   s.Samples[len(s.Samples)-1].StorageUsed,
+			Predicted: int64(math.Min(math.Round(model.At(until)), math.MaxInt64)),
+		})
+	}
+
+	sort.Slice(forecast.Series, func(i, j int) bool {
+		a, b := forecast.Series[i], forecast.Series[j]
+		if a.Predicted != b.Predicted {
+			return a.Predicted > b.Predicted
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Region < b.Region
+	})
+	return forecast
+}
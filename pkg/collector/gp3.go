@@ -0,0 +1,259 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+const (
+	// gp3 includes this many IOPS and MiB/s of throughput in its storage
+	// price...
+	gp3BaselineIOPS       = 3_000
+	gp3BaselineThroughput = 125
+	// ...and can be provisioned up to these.
+	gp3MaxIOPS       = 16_000
+	gp3MaxThroughput = 1_000
+	// The IOPS of a gp3 volume cannot exceed this multiple of its GiB.
+	gp3IOPSPerGiB = 500
+
+	// us-east-1 list prices of provisioned gp3 IOPS and MiB/s above the
+	// baseline, per month. The Pricing API only serves the storage price
+	// the collector already looks up.
+	gp3IOPSUSDPerMonth       = 0.005
+	gp3ThroughputUSDPerMonth = 0.04
+
+	// Peaks are the busiest five minutes of the lookback window.
+	gp2PeakPeriod = 5 * time.Minute
+
+	// GetMetricData accepts at most 500 queries per call, six per volume.
+	gp2VolumesPerMetricDataCall = 80
+)
+
+// GP3Migration is the gp3 equivalent of a gp2 volume: the IOPS and
+// throughput its observed peaks need and what it would cost.
+type GP3Migration struct {
+	Volume EntityUsage
+
+	// PeakIOPS and PeakThroughput (MiB/s) are the busiest five minutes
+	// CloudWatch recorded over the lookback window.
+	PeakIOPS       float64
+	PeakThroughput float64
+
+	// IOPS and Throughput (MiB/s) to provision on gp3.
+	IOPS       int32
+	Throughput int32
+
+	GP2MonthlyCostUSD float64
+	GP3MonthlyCostUSD float64
+}
+
+// MonthlySavingsUSD is what the migration saves per month, negative when
+// gp3 would cost more.
+func (m GP3Migration) MonthlySavingsUSD() float64 {
+	return m.GP2MonthlyCostUSD - m.GP3MonthlyCostUSD
+}
+
+// GP3Migrations prices every gp2 volume among the entities against its gp3
+// equivalent, sized to the peaks CloudWatch recorded over the access
+// lookback window, largest savings first. Volumes whose metrics or prices
+// cannot be read are left out.
+func (c *StorageCollector) GP3Migrations(ctx context.Context, entities []EntityUsage) ([]GP3Migration, error) {
+	book, err := c.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byRegion := map[string][]*EntityUsage{}
+	for i := range entities {
+		if entities[i].Type == EntityTypeVolume && entities[i].VolumeType == "gp2" {
+			byRegion[entities[i].Region] = append(byRegion[entities[i].Region], &entities[i])
+		}
+	}
+
+	now := time.Now()
+	var migrations []GP3Migration
+	for region, volumes := range byRegion {
+		gp2Price, err := book.Price(ctx, region, "gp2")
+		if err != nil {
+			slog.Error("failed to look up price", "kind", "gp2", "region", region, "error", err)
+			continue
+		}
+		gp3Price, err := book.Price(ctx, region, "gp3")
+		if err != nil {
+			slog.Error("failed to look up price", "kind", "gp3", "region", region, "error", err)
+			continue
+		}
+
+		cfg, err := c.loadConfig(ctx, region)
+		if err != nil {
+			slog.Error("failed to create clients", "region", region, "error", err)
+			continue
+		}
+		cw := cloudwatch.NewFromConfig(cfg)
+
+		for start := 0; start < len(volumes); start += gp2VolumesPerMetricDataCall {
+			batch := volumes[start:min(start+gp2VolumesPerMetricDataCall, len(volumes))]
+
+			peaks, err := getVolumePeaks(ctx, cw, batch, now, c.opts.AccessLookback)
+			if err != nil {
+				slog.Error("failed to get volume IO metrics", "region", region, "error", err)
+				continue
+			}
+
+			for _, volume := range batch {
+				peak := peaks[volume.ID]
+				migrations = append(migrations, gp3Migration(*volume, peak.iops, peak.throughput, gp2Price, gp3Price))
+			}
+		}
+	}
+
+	savePrices(book)
+
+	sort.Slice(migrations, func(i, j int) bool {
+		if migrations[i].MonthlySavingsUSD() != migrations[j].MonthlySavingsUSD() {
+			return migrations[i].MonthlySavingsUSD() > migrations[j].MonthlySavingsUSD()
+		}
+		return migrations[i].Volume.ID < migrations[j].Volume.ID
+	})
+
+	return migrations, nil
+}
+
+// gp3Migration sizes the gp3 equivalent of a gp2 volume to its peaks and
+// prices both from their per GB-month storage prices.
+func gp3Migration(volume EntityUsage, peakIOPS, peakThroughput, gp2Price, gp3Price float64) GP3Migration {
+	size := float64(volume.StorageUsed) / gib
+
+	iops := math.Max(gp3BaselineIOPS, math.Ceil(peakIOPS))
+	iops = math.Min(iops, math.Min(gp3MaxIOPS, math.Max(gp3BaselineIOPS, size*gp3IOPSPerGiB)))
+	throughput := math.Min(math.Max(gp3BaselineThroughput, math.Ceil(peakThroughput)), gp3MaxThroughput)
+
+	return GP3Migration{
+		Volume:            volume,
+		PeakIOPS:          peakIOPS,
+		PeakThroughput:    peakThroughput,
+		IOPS:              int32(iops),
+		Throughput:        int32(throughput),
+		GP2MonthlyCostUSD: gp2Price * size,
+		GP3MonthlyCostUSD: gp3Price*size +
+			(iops-gp3BaselineIOPS)*gp3IOPSUSDPerMonth +
+			(throughput-gp3BaselineThroughput)*gp3ThroughputUSDPerMonth,
+	}
+}
+
+type volumePeak struct {
+	iops       float64
+	throughput float64 // MiB/s
+}
+
+// volumeIO is the IOPS and throughput (MiB/s) of every five minutes of the
+// lookback window CloudWatch recorded.
+type volumeIO struct {
+	iops       []float64
+	throughput []float64
+}
+
+// getVolumePeaks returns the busiest five minutes of IOPS and throughput of
+// each volume over the lookback window.
+func getVolumePeaks(ctx context.Context, cw *cloudwatch.Client, volumes []*EntityUsage, now time.Time, lookback time.Duration) (map[string]volumePeak, error) {
+	series, err := getVolumeIO(ctx, cw, volumes, now, lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	peaks := map[string]volumePeak{}
+	for id, io := range series {
+		var peak volumePeak
+		for _, value := range io.iops {
+			peak.iops = math.Max(peak.iops, value)
+		}
+		for _, value := range io.throughput {
+			peak.throughput = math.Max(peak.throughput, value)
+		}
+		peaks[id] = peak
+	}
+	return peaks, nil
+}
+
+// getVolumeIO returns the IOPS and throughput of each volume for every five
+// minutes of the lookback window.
+func getVolumeIO(ctx context.Context, cw *cloudwatch.Client, volumes []*EntityUsage, now time.Time, lookback time.Duration) (map[string]volumeIO, error) {
+	period := int32(gp2PeakPeriod.Seconds())
+
+	// Raw query IDs are a metric prefix followed by the index of the volume;
+	// the returned expressions are "i" (IOPS) or "t" (MiB/s) and the index.
+	metrics := []struct{ prefix, name string }{
+		{"r", "VolumeReadOps"}, {"w", "VolumeWriteOps"},
+		{"rb", "VolumeReadBytes"}, {"wb", "VolumeWriteBytes"},
+	}
+
+	var queries []cwtypes.MetricDataQuery
+	for i, volume := range volumes {
+		for _, metric := range metrics {
+			queries = append(queries, cwtypes.MetricDataQuery{
+				Id: aws.String(fmt.Sprintf("%s%d", metric.prefix, i)),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String("AWS/EBS"),
+						MetricName: aws.String(metric.name),
+						Dimensions: []cwtypes.Dimension{{Name: aws.String("VolumeId"), Value: aws.String(volume.ID)}},
+					},
+					Period: aws.Int32(period),
+					Stat:   aws.String("Sum"),
+				},
+				ReturnData: aws.Bool(false),
+			})
+		}
+		queries = append(queries,
+			cwtypes.MetricDataQuery{
+				Id:         aws.String(fmt.Sprintf("i%d", i)),
+				Expression: aws.String(fmt.Sprintf("(r%d+w%d)/%d", i, i, period)),
+			},
+			cwtypes.MetricDataQuery{
+				Id:         aws.String(fmt.Sprintf("t%d", i)),
+				Expression: aws.String(fmt.Sprintf("(rb%d+wb%d)/%d/1048576", i, i, period)),
+			},
+		)
+	}
+
+	series := map[string]volumeIO{}
+	paginator := cloudwatch.NewGetMetricDataPaginator(cw, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(now.Add(-lookback)),
+		EndTime:           aws.Time(now),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range page.MetricDataResults {
+			id := aws.ToString(result.Id)
+			index, err := strconv.Atoi(id[1:])
+			if err != nil || index >= len(volumes) {
+				continue
+			}
+
+			io := series[volumes[index].ID]
+			switch id[0] {
+			case 'i':
+				io.iops = append(io.iops, result.Values...)
+			case 't':
+				io.throughput = append(io.throughput, result.Values...)
+			}
+			series[volumes[index].ID] = io
+		}
+	}
+
+	return series, nil
+}
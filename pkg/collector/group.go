@@ -0,0 +1,46 @@
+package collector
+
+import "sort"
+
+// TagGroup totals the volumes and snapshots sharing one value of a tag.
+// Entities without the tag are grouped under the empty value.
+type TagGroup struct {
+	Value          string
+	Entities       int
+	StorageUsed    int64
+	MonthlyCostUSD float64
+}
+
+// GroupByTag aggregates volumes and snapshots by the value of a tag, largest
+// group first.
+func GroupByTag(entities []EntityUsage, key string) []TagGroup {
+	byValue := map[string]*TagGroup{}
+	for _, entity := range entities {
+		if entity.Type != EntityTypeVolume && entity.Type != EntityTypeSnapshot {
+			continue
+		}
+
+		value := entity.Tags[key]
+		group, ok := byValue[value]
+		if !ok {
+			group = &TagGroup{Value: value}
+			byValue[value] = group
+		}
+		group.Entities++
+		group.StorageUsed += entity.StorageUsed
+		group.MonthlyCostUSD += entity.MonthlyCostUSD
+	}
+
+	groups := make([]TagGroup, 0, len(byValue))
+	for _, group := range byValue {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].StorageUsed != groups[j].StorageUsed {
+			return groups[i].StorageUsed > groups[j].StorageUsed
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// StorageGrowth is the growth of the storage of an entity, tag group or
+// region between two scans.
+type StorageGrowth struct {
+	Key    string // Entity ID, tag value or region
+	Region string // Only set for entities
+	Type   string // Only set for entities
+	Before int64
+	After  int64
+}
+
+// Rate is the growth as a fraction of the storage before, e.g. 0.25 for 25%.
+// It is +Inf for storage that grew from nothing.
+func (g StorageGrowth) Rate() float64 {
+	if g.Before == 0 {
+		if g.After == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(g.After-g.Before) / float64(g.Before)
+}
+
+// Growth compares the entities of a scan with those of an earlier scan.
+type Growth struct {
+	Since    time.Time // When the earlier scan ran
+	Until    time.Time
+	GroupBy  string          // Tag key of Groups, empty without grouping
+	Entities []StorageGrowth // Entities in both scans, fastest growing first
+	Groups   []StorageGrowth // By value of the GroupBy tag, volumes and snapshots only
+	Regions  []StorageGrowth
+}
+
+// ComputeGrowth compares the entities of two scans. Entities only in one of
+// them count towards the group and region totals but have no growth of their
+// own. Groups are aggregated like GroupByTag.
+func ComputeGrowth(before, after []EntityUsage, groupBy string) Growth {
+	growth := Growth{GroupBy: groupBy}
+
+	type entityKey struct{ region, id string }
+	previous := map[entityKey]int64{}
+	for _, entity := range before {
+		previous[entityKey{entity.Region, entity.ID}] = entity.StorageUsed
+	}
+	for _, entity := range after {
+		size, ok := previous[entityKey{entity.Region, entity.ID}]
+		if !ok {
+			continue
+		}
+		growth.Entities = append(growth.Entities, StorageGrowth{
+			Key:    entity.ID,
+			Region: entity.Region,
+			Type:   entity.Type,
+			Before: size,
+			After:  entity.StorageUsed,
+		})
+	}
+
+	regions := map[string]*StorageGrowth{}
+	region := func(name string) *StorageGrowth {
+		if regions[name] == nil {
+			regions[name] = &StorageGrowth{Key: name}
+		}
+		return regions[name]
+	}
+	for _, entity := range before {
+		region(entity.Region).Before += entity.StorageUsed
+	}
+	for _, entity := range after {
+		region(entity.Region).After += entity.StorageUsed
+	}
+	for _, g := range regions {
+		growth.Regions = append(growth.Regions, *g)
+	}
+
+	if groupBy != "" {
+		groups := map[string]*StorageGrowth{}
+		group := func(value string) *StorageGrowth {
+			if groups[value] == nil {
+				groups[value] = &StorageGrowth{Key: value}
+			}
+			return groups[value]
+		}
+		for _, g := range GroupByTag(before, groupBy) {
+			group(g.Value).Before = g.StorageUsed
+		}
+		for _, g := range GroupByTag(after, groupBy) {
+			group(g.Value).After = g.StorageUsed
+		}
+		for _, g := range groups {
+			growth.Groups = append(growth.Groups, *g)
+		}
+	}
+
+	sortGrowth(growth.Entities)
+	sortGrowth(growth.Groups)
+	sortGrowth(growth.Regions)
+
+	return growth
+}
+
+// Scope returns the growth of the given entities of the later scan only, as
+// for a tenant seeing part of the report. Entities gone since the earlier
+// scan cannot be attributed and are left out of the group and region totals.
+func (g Growth) Scope(entities []EntityUsage) Growth {
+	scoped := Growth{Since: g.Since, Until: g.Until, GroupBy: g.GroupBy}
+
+	type entityKey struct{ region, id string }
+	previous := map[entityKey]int64{}
+	for _, entity := range g.Entities {
+		previous[entityKey{entity.Region, entity.Key}] = entity.Before
+	}
+
+	regions := map[string]*StorageGrowth{}
+	groups := map[string]*StorageGrowth{}
+	add := func(totals map[string]*StorageGrowth, key string, before, after int64) {
+		if totals[key] == nil {
+			totals[key] = &StorageGrowth{Key: key}
+		}
+		totals[key].Before += before
+		totals[key].After += after
+	}
+	for _, entity := range entities {
+		before, ok := previous[entityKey{entity.Region, entity.ID}]
+		if ok {
+			scoped.Entities = append(scoped.Entities, StorageGrowth{
+				Key:    entity.ID,
+				Region: entity.Region,
+				Type:   entity.Type,
+				Before: before,
+				After:  entity.StorageUsed,
+			})
+		}
+		add(regions, entity.Region, before, entity.StorageUsed)
+		if g.GroupBy != "" && (entity.Type == EntityTypeVolume || entity.Type == EntityTypeSnapshot) {
+			add(groups, entity.Tags[g.GroupBy], before, entity.StorageUsed)
+		}
+	}
+	for _, total := range regions {
+		scoped.Regions = append(scoped.Regions, *total)
+	}
+	for _, total := range groups {
+		scoped.Groups = append(scoped.Groups, *total)
+	}
+
+	sortGrowth(scoped.Entities)
+	sortGrowth(scoped.Groups)
+	sortGrowth(scoped.Regions)
+
+	return scoped
+}
+
+// Exceeding returns the entities growing faster than rate.
+func (g Growth) Exceeding(rate float64) []StorageGrowth {
+	var fast []StorageGrowth
+	for _, entity := range g.Entities {
+		if entity.Rate() > rate {
+			fast = append(fast, entity)
+		}
+	}
+	return fast
+}
+
+// sortGrowth orders by rate, fastest first, then by absolute growth.
+func sortGrowth(growth []StorageGrowth) {
+	sort.Slice(growth, func(i, j int) bool {
+		if growth[i].Rate() != growth[j].Rate() {
+			return growth[i].Rate() > growth[j].Rate()
+		}
+		if d := growth[i].After - growth[i].Before - (growth[j].After - growth[j].Before); d != 0 {
+			return d > 0
+		}
+		if growth[i].Key != growth[j].Key {
+			return growth[i].Key < growth[j].Key
+		}
+		return growth[i].Region < growth[j].Region
+	})
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+)
+
+// IdleVolumes returns the attached volumes without a single read or write
+// operation in CloudWatch over the access lookback window, largest first.
+// Volumes younger than the window are not considered.
+func (c *StorageCollector) IdleVolumes(ctx context.Context, entities []EntityUsage) []EntityUsage {
+	lookback := c.opts.AccessLookback
+	now := time.Now()
+
+	byRegion := map[string][]*EntityUsage{}
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type == EntityTypeVolume && entity.AttachedInstance != "" && now.Sub(entity.CreateTime) >= lookback {
+			byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+		}
+	}
+
+	var idle []EntityUsage
+	for region, volumes := range byRegion {
+		cfg, err := c.loadConfig(ctx, region)
+		if err != nil {
+			slog.Error("failed to create clients", "region", region, "error", err)
+			continue
+		}
+		cw := cloudwatch.NewFromConfig(cfg)
+
+		for start := 0; start < len(volumes); start += volumesPerMetricDataCall {
+			batch := volumes[start:min(start+volumesPerMetricDataCall, len(volumes))]
+
+			ops, err := getVolumeOps(ctx, cw, batch, now, lookback)
+			if err != nil {
+				slog.Error("failed to get volume IO metrics", "region", region, "error", err)
+				continue
+			}
+
+			for _, volume := range batch {
+				if ops[volume.ID] == 0 {
+					idle = append(idle, *volume)
+				}
+			}
+		}
+	}
+
+	sort.Slice(idle, func(i, j int) bool {
+		if idle[i].StorageUsed != idle[j].StorageUsed {
+			return idle[i].StorageUsed > idle[j].StorageUsed
+		}
+		return idle[i].ID < idle[j].ID
+	})
+
+	return idle
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+// IgnoreRule accepts resources known to look wasteful, such as disaster
+// recovery volumes, so that the orphan, idle and cost findings leave them
+// out. The storage they use is still counted. A resource matches a rule
+// when it matches every field the rule sets.
+type IgnoreRule struct {
+	ID     string            `yaml:"id,omitempty"`
+	ARN    string            `yaml:"arn,omitempty"`  // Pattern, * matching any characters
+	Tags   map[string]string `yaml:"tags,omitempty"` // Tag values, all of which must match
+	Reason string            `yaml:"reason,omitempty"`
+
+	arn *regexp.Regexp
+}
+
+// IgnoreList is the rules of an ignore file. A nil IgnoreList ignores
+// nothing.
+type IgnoreList struct {
+	rules []IgnoreRule
+}
+
+// NewIgnoreList validates the rules, each of which must set an ID, an ARN
+// pattern or tags.
+func NewIgnoreList(rules []IgnoreRule) (*IgnoreList, error) {
+	list := &IgnoreList{}
+	for i, rule := range rules {
+		if rule.ID == "" && rule.ARN == "" && len(rule.Tags) == 0 {
+			return nil, fmt.Errorf("ignore rule %d: expected an id, arn or tags", i+1)
+		}
+		if rule.ARN != "" {
+			if !strings.HasPrefix(rule.ARN, "arn:") {
+				return nil, fmt.Errorf("ignore rule %d: invalid arn %q: expected arn:partition:service:region:account:resource", i+1, rule.ARN)
+			}
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(rule.ARN), `\*`, ".*")
+			rule.arn = regexp.MustCompile("^" + pattern + "$")
+		}
+		list.rules = append(list.rules, rule)
+	}
+	return list, nil
+}
+
+// Len returns the number of rules.
+func (l *IgnoreList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.rules)
+}
+
+// Match returns the first rule matching entity.
+func (l *IgnoreList) Match(entity EntityUsage) (IgnoreRule, bool) {
+	if l == nil {
+		return IgnoreRule{}, false
+	}
+	for _, rule := range l.rules {
+		if rule.matches(entity) {
+			return rule, true
+		}
+	}
+	return IgnoreRule{}, false
+}
+
+func (r IgnoreRule) matches(entity EntityUsage) bool {
+	if r.ID != "" && r.ID != entity.ID {
+		return false
+	}
+	if r.arn != nil && !r.arn.MatchString(EntityARN(entity)) {
+		return false
+	}
+	for key, value := range r.Tags {
+		if v, ok := entity.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// EntityARN returns the ARN of an entity, "" for entity types without one.
+// The account ID is left out of the ARNs of entities scanned without
+// Options.AccountID.
+func EntityARN(entity EntityUsage) string {
+	switch entity.Type {
+	case EntityTypeVolume:
+		return awsres.VolumeARN(entity.Region, entity.AccountID, entity.ID)
+	case EntityTypeSnapshot, EntityTypeSharedSnapshot:
+		return awsres.SnapshotARN(entity.Region, entity.ID)
+	case EntityTypeBucket:
+		return awsres.BucketARN(entity.Region, entity.ID)
+	case EntityTypeDBInstance:
+		return awsres.DBInstanceARN(entity.Region, entity.AccountID, entity.ID)
+	case EntityTypeDBCluster:
+		return awsres.DBClusterARN(entity.Region, entity.AccountID, entity.ID)
+	case EntityTypeEFS:
+		return awsres.EFSARN(entity.Region, entity.AccountID, entity.ID)
+	case EntityTypeFSx:
+		return awsres.FSxARN(entity.Region, entity.AccountID, entity.ID)
+	case EntityTypeRecoveryPoint:
+		return entity.ID // Recovery points are identified by their ARN
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// instanceTypesBatch is the most instance types DescribeInstanceTypes takes
+// per call.
+const instanceTypesBatch = 100
+
+// InstanceStorage is the block storage of an EC2 instance: the EBS root and
+// data volumes attached to it and the instance store its type comes with.
+type InstanceStorage struct {
+	ID           string
+	Name         string
+	Region       string
+	InstanceType string
+	State        string
+
+	Volumes           int
+	RootStorage       int64 // EBS root volume; zero for instance-store backed instances
+	DataStorage       int64 // Every other attached EBS volume
+	InstanceStoreSize int64 // Ephemeral storage of the instance type
+}
+
+// EBSStorage is the EBS storage attached to the instance.
+func (i InstanceStorage) EBSStorage() int64 {
+	return i.RootStorage + i.DataStorage
+}
+
+// TotalStorage is the EBS and instance store storage of the instance.
+func (i InstanceStorage) TotalStorage() int64 {
+	return i.EBSStorage() + i.InstanceStoreSize
+}
+
+// AttachedToStoppedInstance reports whether entity is a volume attached to
+// a stopped instance, which is billed for storage the instance does not
+// use. It needs Options.InstanceDetails.
+func AttachedToStoppedInstance(entity EntityUsage) bool {
+	return entity.Type == EntityTypeVolume && entity.InstanceState == string(types.InstanceStateNameStopped)
+}
+
+// Instances reports the block storage of every instance in the configured
+// regions, largest first. Terminated instances are left out.
+func (c *StorageCollector) Instances(ctx context.Context) []InstanceStorage {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+	var instances []InstanceStorage
+
+	for _, region := range c.opts.Regions {
+		wg.Add(1)
+
+		go func(region string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			client, err := c.ec2Client(ctx, region)
+			if err != nil {
+				slog.Error("failed to create EC2 client", "region", region, "error", err)
+				return
+			}
+
+			slog.Debug("querying instances", "region", region)
+			found, err := describeRegionInstances(ctx, client, region)
+			if err != nil {
+				slog.Error("failed to describe instances", "region", region, "error", err)
+				return
+			}
+
+			mu.Lock()
+			instances = append(instances, found...)
+			mu.Unlock()
+		}(region)
+	}
+
+	wg.Wait()
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].TotalStorage() != instances[j].TotalStorage() {
+			return instances[i].TotalStorage() > instances[j].TotalStorage()
+		}
+		return instances[i].ID < instances[j].ID
+	})
+
+	return instances
+}
+
+func describeRegionInstances(ctx context.Context, client EC2DescribeAPI, region string) ([]InstanceStorage, error) {
+	var described []types.Instance
+
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: []string{"pending", "running", "shutting-down", "stopping", "stopped"},
+		}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			described = append(described, reservation.Instances...)
+		}
+	}
+	if len(described) == 0 {
+		return nil, nil
+	}
+
+	volumeSizes, err := getVolumeSizes(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	typeNames := make([]string, 0, len(described))
+	for _, instance := range described {
+		typeNames = append(typeNames, string(instance.InstanceType))
+	}
+	instanceStores := getInstanceStoreSizes(ctx, client, region, typeNames)
+
+	instances := make([]InstanceStorage, 0, len(described))
+	for _, instance := range described {
+		usage := InstanceStorage{
+			ID:                aws.ToString(instance.InstanceId),
+			Name:              nameTag(instance.Tags),
+			Region:            region,
+			InstanceType:      string(instance.InstanceType),
+			InstanceStoreSize: instanceStores[string(instance.InstanceType)],
+		}
+		if instance.State != nil {
+			usage.State = string(instance.State.Name)
+		}
+
+		for _, mapping := range instance.BlockDeviceMappings {
+			if mapping.Ebs == nil {
+				continue
+			}
+			size := volumeSizes[aws.ToString(mapping.Ebs.VolumeId)]
+			usage.Volumes++
+			if aws.ToString(mapping.DeviceName) == aws.ToString(instance.RootDeviceName) {
+				usage.RootStorage += size
+			} else {
+				usage.DataStorage += size
+			}
+		}
+
+		instances = append(instances, usage)
+	}
+
+	return instances, nil
+}
+
+// getVolumeSizes returns the size of every volume of a region, by volume ID.
+func getVolumeSizes(ctx context.Context, client EC2DescribeAPI) (map[string]int64, error) {
+	sizes := map[string]int64{}
+
+	paginator := ec2.NewDescribeVolumesPaginator(client, &ec2.DescribeVolumesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, volume := range page.Volumes {
+			sizes[aws.ToString(volume.VolumeId)] = int64(aws.ToInt32(volume.Size)) * gib
+		}
+	}
+
+	return sizes, nil
+}
+
+// getInstanceStoreSizes returns the instance store capacity of the given
+// instance types, by type. Types without instance store are left out.
+func getInstanceStoreSizes(ctx context.Context, client EC2DescribeAPI, region string, typeNames []string) map[string]int64 {
+	sizes := map[string]int64{}
+
+	seen := map[string]bool{}
+	var unique []types.InstanceType
+	for _, name := range typeNames {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, types.InstanceType(name))
+	}
+
+	for start := 0; start < len(unique); start += instanceTypesBatch {
+		batch := unique[start:min(start+instanceTypesBatch, len(unique))]
+
+		paginator := ec2.NewDescribeInstanceTypesPaginator(client, &ec2.DescribeInstanceTypesInput{
+			InstanceTypes: batch,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.Error("failed to describe instance types", "region", region, "error", err)
+				break
+			}
+			for _, info := range page.InstanceTypes {
+				if info.InstanceStorageInfo == nil {
+					continue
+				}
+				sizes[string(info.InstanceType)] = aws.ToInt64(info.InstanceStorageInfo.TotalSizeInGB) * gib
+			}
+		}
+	}
+
+	return sizes
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy keeps the newest snapshot of each of the last Daily days,
+// Weekly ISO weeks and Monthly months that have snapshots, in the style of
+// grandfather-father-son rotation.
+type RetentionPolicy struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// SnapshotChain is the snapshots taken from one volume, oldest first.
+type SnapshotChain struct {
+	Volume    string
+	Region    string
+	Snapshots []EntityUsage
+	// VolumeDeleted is set when the scan found the volume gone.
+	VolumeDeleted bool
+	// Keep holds the IDs of the snapshots the retention policy keeps,
+	// including pending snapshots and snapshots backing an AMI.
+	Keep map[string]bool
+}
+
+// Prunable returns the snapshots of the chain the policy does not keep.
+func (c SnapshotChain) Prunable() []EntityUsage {
+	var prunable []EntityUsage
+	for _, snapshot := range c.Snapshots {
+		if !c.Keep[snapshot.ID] {
+			prunable = append(prunable, snapshot)
+		}
+	}
+	return prunable
+}
+
+// SnapshotChains groups the snapshots by region and source volume and
+// applies the retention policy to each chain. Snapshots in amiSnapshots are
+// always kept. The chains are sorted by the number of snapshots, longest
+// first.
+func SnapshotChains(all []EntityUsage, policy RetentionPolicy, amiSnapshots map[string]bool) []SnapshotChain {
+	byVolume := map[string]*SnapshotChain{}
+	var chains []*SnapshotChain
+	for _, entity := range all {
+		if entity.Type != EntityTypeSnapshot {
+			continue
+		}
+		key := entity.Region + "/" + entity.SourceVolume
+		chain, ok := byVolume[key]
+		if !ok {
+			chain = &SnapshotChain{Volume: entity.SourceVolume, Region: entity.Region}
+			byVolume[key] = chain
+			chains = append(chains, chain)
+		}
+		chain.Snapshots = append(chain.Snapshots, entity)
+		if entity.VolumeExists != nil {
+			chain.VolumeDeleted = !*entity.VolumeExists
+		}
+	}
+
+	result := make([]SnapshotChain, 0, len(chains))
+	for _, chain := range chains {
+		sort.SliceStable(chain.Snapshots, func(i, j int) bool {
+			return chain.Snapshots[i].StartTime.Before(chain.Snapshots[j].StartTime)
+		})
+		chain.Keep = policy.Retain(chain.Snapshots)
+		for _, snapshot := range chain.Snapshots {
+			if amiSnapshots[snapshot.ID] || snapshot.State == "pending" {
+				chain.Keep[snapshot.ID] = true
+			}
+		}
+		result = append(result, *chain)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if len(result[i].Snapshots) != len(result[j].Snapshots) {
+			return len(result[i].Snapshots) > len(result[j].Snapshots)
+		}
+		if result[i].Region != result[j].Region {
+			return result[i].Region < result[j].Region
+		}
+		return result[i].Volume < result[j].Volume
+	})
+
+	return result
+}
+
+// Retain returns the IDs of the snapshots the policy keeps. Periods are in
+// UTC.
+func (p RetentionPolicy) Retain(snapshots []EntityUsage) map[string]bool {
+	newest := make([]EntityUsage, len(snapshots))
+	copy(newest, snapshots)
+	sort.SliceStable(newest, func(i, j int) bool { return newest[i].StartTime.After(newest[j].StartTime) })
+
+	keep := map[string]bool{}
+	retainPeriods(newest, p.Daily, keep, func(t time.Time) string {
+		return t.UTC().Format("2006-01-02")
+	})
+	retainPeriods(newest, p.Weekly, keep, func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	retainPeriods(newest, p.Monthly, keep, func(t time.Time) string {
+		return t.UTC().Format("2006-01")
+	})
+	return keep
+}
+
+// retainPeriods keeps the newest snapshot of each of the latest n periods.
+// The snapshots are sorted newest first.
+func retainPeriods(newest []EntityUsage, n int, keep map[string]bool, period func(time.Time) string) {
+	seen := map[string]bool{}
+	for _, snapshot := range newest {
+		if len(seen) >= n {
+			return
+		}
+		p := period(snapshot.StartTime)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		keep[snapshot.ID] = true
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"sort"
+	"time"
+)
+
+// AccountSummary is the subtotal of one account of a merged report, or the
+// error its scan failed with.
+type AccountSummary struct {
+	AccountID      string
+	Profile        string
+	Role           string // Assumed role, only set for failed scans
+	Entities       int
+	StorageUsed    int64
+	MonthlyCostUSD float64
+	Error          string
+}
+
+// AccountTotals sums the entities by account and profile, largest first.
+func AccountTotals(entities []EntityUsage) []AccountSummary {
+	type key struct{ accountID, profile string }
+	byAccount := map[key]*AccountSummary{}
+	for _, entity := range entities {
+		k := key{entity.AccountID, entity.Profile}
+		summary, ok := byAccount[k]
+		if !ok {
+			summary = &AccountSummary{AccountID: entity.AccountID, Profile: entity.Profile}
+			byAccount[k] = summary
+		}
+		summary.Entities++
+		summary.StorageUsed += entity.StorageUsed
+		summary.MonthlyCostUSD += entity.MonthlyCostUSD
+	}
+
+	accounts := make([]AccountSummary, 0, len(byAccount))
+	for _, summary := range byAccount {
+		accounts = append(accounts, *summary)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].StorageUsed != accounts[j].StorageUsed {
+			return accounts[i].StorageUsed > accounts[j].StorageUsed
+		}
+		if accounts[i].AccountID != accounts[j].AccountID {
+			return accounts[i].AccountID < accounts[j].AccountID
+		}
+		return accounts[i].Profile < accounts[j].Profile
+	})
+
+	return accounts
+}
+
+// MergeReports combines the reports of scans of different accounts or
+// profiles into one. Tag groups, stacks, owners, access class totals and
+// account subtotals are recomputed over every entity, and the merged report is as
+// old as its oldest part.
+func MergeReports(reports ...*Report) *Report {
+	merged := &Report{}
+
+	for _, report := range reports {
+		merged.Entities = append(merged.Entities, report.Entities...)
+		merged.Regions = append(merged.Regions, report.Regions...)
+		merged.FailedRegions = append(merged.FailedRegions, report.FailedRegions...)
+		merged.Findings = append(merged.Findings, report.Findings...)
+		merged.Quotas = append(merged.Quotas, report.Quotas...)
+		merged.TotalStorageUsed += report.TotalStorageUsed
+		merged.CostEstimated = merged.CostEstimated || report.CostEstimated
+
+		if merged.GeneratedAt.IsZero() || report.GeneratedAt.Before(merged.GeneratedAt) {
+			merged.GeneratedAt = report.GeneratedAt
+		}
+		if merged.StartedAt.IsZero() || (!report.StartedAt.IsZero() && report.StartedAt.Before(merged.StartedAt)) {
+			merged.StartedAt = report.StartedAt
+		}
+		if report.GroupByTag != "" {
+			merged.GroupByTag = report.GroupByTag
+		}
+		if report.AccessClasses != nil {
+			merged.AccessClasses = []AccessClassTotal{}
+		}
+		if report.Owners != nil {
+			merged.Owners = []TagGroup{}
+		}
+
+		for cache, age := range report.CacheAges {
+			if age > merged.CacheAges[cache] {
+				merged.SetCacheAge(cache, age)
+			}
+		}
+		for code, count := range report.APIThrottles {
+			if merged.APIThrottles == nil {
+				merged.APIThrottles = map[string]int64{}
+			}
+			merged.APIThrottles[code] += count
+		}
+		for region, count := range report.RegionThrottles {
+			if merged.RegionThrottles == nil {
+				merged.RegionThrottles = map[string]int64{}
+			}
+			merged.RegionThrottles[region] += count
+		}
+		for key, count := range report.APICalls {
+			if merged.APICalls == nil {
+				merged.APICalls = map[APICallKey]int64{}
+			}
+			merged.APICalls[key] += count
+		}
+		merged.APIBudgetReached = merged.APIBudgetReached || report.APIBudgetReached
+		for region, count := range report.RegionErrors {
+			if merged.RegionErrors == nil {
+				merged.RegionErrors = map[string]int64{}
+			}
+			merged.RegionErrors[region] += count
+		}
+	}
+
+	if merged.GroupByTag != "" {
+		merged.Groups = GroupByTag(merged.Entities, merged.GroupByTag)
+	}
+	merged.Stacks = GroupByStack(merged.Entities)
+	merged.Accounts = AccountTotals(merged.Entities)
+	SortFindings(merged.Findings)
+	SortQuotaUsages(merged.Quotas)
+	if merged.AccessClasses != nil {
+		merged.AccessClasses = AccessClassTotals(merged.Entities)
+	}
+	if merged.Owners != nil {
+		merged.Owners = GroupByOwner(merged.Entities)
+	}
+	if merged.GeneratedAt.IsZero() {
+		merged.GeneratedAt = time.Now()
+	}
+
+	return merged
+}
@@ -0,0 +1,1074 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricDoc describes a metric family the collector can produce. It is
+// recorded from the same options the metric is built with, so generated
+// references cannot drift from the code.
+type MetricDoc struct {
+	Name        string
+	Type        string
+	Help        string
+	Labels      []string
+	Cardinality string
+	Detail      string // Coarsest MetricsOptions.Detail the family is registered at
+	collector   prometheus.Collector
+	enabled     bool // Registered at the configured detail
+}
+
+// Levels of MetricsOptions.Detail, from the most series to the fewest.
+const (
+	MetricDetailEntity = "entity" // Every family, with a series per entity
+	MetricDetailRegion = "region" // Aggregates per region, tag, stack and owner
+	MetricDetailTag    = "tag"    // Aggregates per tag, stack and owner
+	MetricDetailTotal  = "total"  // Totals and the exporter's own metrics
+)
+
+// MetricDetails lists the MetricsOptions.Detail levels, most detailed
+// first.
+var MetricDetails = []string{MetricDetailEntity, MetricDetailRegion, MetricDetailTag, MetricDetailTotal}
+
+// MetricsOptions configures NewMetricsWithOptions.
+type MetricsOptions struct {
+	// Detail, one of MetricDetails, leaves out the families more detailed
+	// than it. Empty registers every family.
+	Detail string
+	// ExtraTags are tag keys whose values label the per-entity and
+	// per-region families, under the label name TagLabel(key). The label
+	// names must be distinct.
+	ExtraTags []string
+	// ConstLabels label every series of every family, e.g. with the shard
+	// of a sharded scan.
+	ConstLabels prometheus.Labels
+}
+
+// familyDetail places a metric family built from the report at a detail
+// level. Families missing from familyDetails are always registered.
+type familyDetail struct {
+	detail string
+	tagged bool // Built per entity, so MetricsOptions.ExtraTags can label it
+}
+
+var familyDetails = map[string]familyDetail{
+	"aws_ebs_storage_used":                                {MetricDetailEntity, true},
+	"aws_snapshot_storage_used":                           {MetricDetailEntity, true},
+	"aws_s3_storage_used":                                 {MetricDetailEntity, true},
+	"aws_rds_storage_allocated":                           {MetricDetailEntity, true},
+	"aws_rds_storage_used":                                {MetricDetailEntity, true},
+	"aws_efs_storage_used":                                {MetricDetailEntity, true},
+	"aws_fsx_storage_capacity":                            {MetricDetailEntity, true},
+	"aws_ebs_monthly_cost_usd":                            {MetricDetailEntity, true},
+	"aws_volume_backup_age_hours":                         {MetricDetailEntity, true},
+	"aws_snapshot_public":                                 {MetricDetailEntity, true},
+	"aws_snapshot_progress_percent":                       {MetricDetailEntity, true},
+	"aws_snapshot_estimated_remaining_seconds":            {MetricDetailEntity, true},
+	"aws_volume_modification_progress_percent":            {MetricDetailEntity, true},
+	"aws_volume_modification_estimated_remaining_seconds": {MetricDetailEntity, true},
+	"aws_shared_snapshots":                                {MetricDetailRegion, true},
+	"aws_unencrypted_storage_bytes":                       {MetricDetailRegion, true},
+	"aws_storage_attached_to_stopped_instances_bytes":     {MetricDetailRegion, true},
+	"aws_storage_pending_operations":                      {MetricDetailRegion, true},
+	"aws_ebs_storage_used_by_type":                        {MetricDetailRegion, true},
+	"aws_storage_used_by_region":                          {MetricDetailRegion, true},
+	"aws_backup_storage_used_by_vault":                    {MetricDetailRegion, true},
+	"aws_backup_storage_used_by_resource_type":            {MetricDetailRegion, true},
+	"aws_storage_growth_rate":                             {MetricDetailRegion, false},
+	"aws_storage_forecast_bytes":                          {MetricDetailRegion, false},
+	"aws_storage_bytes_added_total":                       {MetricDetailRegion, false},
+	"aws_storage_quota_utilization":                       {MetricDetailRegion, false},
+	"aws_storage_bytes_removed_total":                     {MetricDetailRegion, false},
+	"aws_storage_used_by_tag":                             {MetricDetailTag, false},
+	"aws_storage_findings_total":                          {MetricDetailTotal, false},
+	"aws_storage_used_by_stack":                           {MetricDetailTag, false},
+	"aws_storage_used_by_owner":                           {MetricDetailTag, false},
+	"aws_storage_growth_rate_by_tag":                      {MetricDetailTag, false},
+}
+
+// TagLabel returns the label name a tag key of MetricsOptions.ExtraTags is
+// exported under, e.g. tag_team for Team.
+func TagLabel(key string) string {
+	var b strings.Builder
+	b.WriteString("tag_")
+	for _, r := range strings.ToLower(key) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// DefaultRefreshTimeout bounds how long a scrape of stale metrics waits for
+// Metrics.Refresh before serving the cached report, matching the default
+// Prometheus scrape timeout.
+const DefaultRefreshTimeout = 10 * time.Second
+
+// Metrics is a prometheus.Collector publishing the latest observed scan
+// report. The series are generated from the report on every scrape, so
+// series of entities missing from it disappear without being deleted.
+type Metrics struct {
+	// Refresh, when set, is called by a scrape that finds the observed
+	// report older than MaxStaleness. It should block until a fresh report
+	// has been observed or its context is done.
+	Refresh      func(ctx context.Context) error
+	MaxStaleness time.Duration
+
+	docs        []*MetricDoc
+	derivations []func(report *Report)
+	detail      string
+	extraTags   []string
+	constLabels prometheus.Labels
+
+	mu     sync.Mutex // Serializes scrapes, which refill the gauges
+	report *Report
+
+	ebsStorageUsed              *prometheus.GaugeVec
+	snapshotStorageUsed         *prometheus.GaugeVec
+	s3StorageUsed               *prometheus.GaugeVec
+	rdsStorageAllocated         *prometheus.GaugeVec
+	rdsStorageUsed              *prometheus.GaugeVec
+	efsStorageUsed              *prometheus.GaugeVec
+	fsxStorageCapacity          *prometheus.GaugeVec
+	ebsMonthlyCost              *prometheus.GaugeVec
+	volumeBackupAge             *prometheus.GaugeVec
+	volumeSnapshotAge           *prometheus.GaugeVec
+	volumeSnapshotGap           *prometheus.GaugeVec
+	snapshotPublic              *prometheus.GaugeVec
+	sharedSnapshots             *prometheus.GaugeVec
+	unencryptedStorage          *prometheus.GaugeVec
+	stoppedInstanceStorage      *prometheus.GaugeVec
+	pendingOperations           *prometheus.GaugeVec
+	storageUsedByTag            *prometheus.GaugeVec
+	storageUsedByStack          *prometheus.GaugeVec
+	storageUsedByOwner          *prometheus.GaugeVec
+	ebsStorageUsedByType        *prometheus.GaugeVec
+	storageUsedByRegion         *prometheus.GaugeVec
+	storageGrowthRate           *prometheus.GaugeVec
+	storageGrowthRateByTag      *prometheus.GaugeVec
+	storageForecast             *prometheus.GaugeVec
+	storageBytesAdded           *prometheus.CounterVec
+	storageBytesRemoved         *prometheus.CounterVec
+	quotaUtilization            *prometheus.GaugeVec
+	findings                    *prometheus.GaugeVec
+	backupStorageUsedByVault    *prometheus.GaugeVec
+	backupStorageUsedByResource *prometheus.GaugeVec
+	snapshotProgress            *prometheus.GaugeVec
+	snapshotRemaining           *prometheus.GaugeVec
+	volumeModificationProgress  *prometheus.GaugeVec
+	volumeModificationRemaining *prometheus.GaugeVec
+	cacheAge                    *prometheus.GaugeVec
+	apiCalls                    *prometheus.CounterVec
+	apiThrottledByRegion        *prometheus.CounterVec
+	regionFailures              *prometheus.CounterVec
+	scanInfo                    *prometheus.GaugeVec
+	scanRegions                 *prometheus.GaugeVec
+	scanDuration                prometheus.Gauge
+	totalStorageUsed            prometheus.Gauge
+	scrapeDuration              prometheus.Gauge
+	scrapeErrors                prometheus.Counter
+
+	generatedAt atomic.Int64 // UnixNano of the last observed report
+}
+
+// NewMetrics creates the gauges of every family. They are not registered
+// until Register.
+func NewMetrics() *Metrics {
+	return NewMetricsWithOptions(MetricsOptions{})
+}
+
+// NewMetricsWithOptions creates the gauges of the families opts.Detail
+// includes, labeled with opts.ExtraTags.
+func NewMetricsWithOptions(opts MetricsOptions) *Metrics {
+	m := &Metrics{detail: opts.Detail, extraTags: opts.ExtraTags, constLabels: opts.ConstLabels}
+
+	m.ebsStorageUsed = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_ebs_storage_used",
+			Help: "EBS storage used by volume",
+		},
+		[]string{"volume_id", "region", "attached_instance", "account_id", "profile"}, // Added "attached_instance" label
+		"one series per volume",
+	)
+
+	m.snapshotStorageUsed = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_snapshot_storage_used",
+			Help: "Snapshot storage used by snapshot",
+		},
+		[]string{"snapshot_id", "region", "attached_instance", "account_id", "profile"}, // Added "attached_instance" label
+		"one series per snapshot",
+	)
+
+	m.s3StorageUsed = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_s3_storage_used",
+			Help: "S3 storage used by bucket",
+		},
+		[]string{"bucket", "region", "account_id", "profile"},
+		"one series per bucket",
+	)
+
+	m.rdsStorageAllocated = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_rds_storage_allocated",
+			Help: "Storage allocated by RDS instance or Aurora cluster",
+		},
+		[]string{"db_identifier", "engine", "region", "account_id", "profile"},
+		"one series per DB instance or Aurora cluster",
+	)
+
+	m.rdsStorageUsed = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_rds_storage_used",
+			Help: "Storage used by RDS instance or Aurora cluster",
+		},
+		[]string{"db_identifier", "engine", "region", "account_id", "profile"},
+		"one series per DB instance or Aurora cluster",
+	)
+
+	m.efsStorageUsed = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_efs_storage_used",
+			Help: "Metered size of EFS file system",
+		},
+		[]string{"file_system_id", "region", "account_id", "profile"},
+		"one series per EFS file system",
+	)
+
+	m.fsxStorageCapacity = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_fsx_storage_capacity",
+			Help: "Provisioned storage capacity of FSx file system",
+		},
+		[]string{"file_system_id", "file_system_type", "region", "account_id", "profile"},
+		"one series per FSx file system",
+	)
+
+	m.ebsMonthlyCost = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_ebs_monthly_cost_usd",
+			Help: "Estimated monthly storage cost in USD by volume or snapshot",
+		},
+		[]string{"entity_id", "entity_type", "price_type", "region", "account_id", "profile"},
+		"one series per volume and snapshot; only with --estimate-cost",
+	)
+
+	m.volumeBackupAge = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_volume_backup_age_hours",
+			Help: "Hours since the most recent completed snapshot of a volume under a backup SLA",
+		},
+		[]string{"volume_id", "region", "account_id", "profile"},
+		"one series per volume under a backup SLA",
+	)
+
+	m.volumeSnapshotAge = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_volume_snapshot_age_seconds",
+			Help: "Seconds since the most recent completed snapshot of an in-use volume, +Inf when it has none",
+		},
+		[]string{"volume_id", "region", "account_id", "profile"},
+		"one series per in-use volume; not set with --max-snapshot-age 0",
+	)
+
+	m.volumeSnapshotGap = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_volume_snapshot_coverage_gap",
+			Help: "1 for every in-use volume whose most recent snapshot is older than --max-snapshot-age or that has none",
+		},
+		[]string{"volume_id", "region", "account_id", "profile"},
+		"one series per volume with a coverage gap",
+	)
+
+	m.snapshotPublic = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_snapshot_public",
+			Help: "1 for every owned snapshot that any AWS account can restore, a security finding",
+		},
+		[]string{"snapshot_id", "region", "account_id", "profile"},
+		"one series per public snapshot; only with --shared-snapshots",
+	)
+
+	m.sharedSnapshots = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_shared_snapshots",
+			Help: "Snapshots another account shared with the scanned account",
+		},
+		[]string{"owner_id", "region", "account_id", "profile"},
+		"one series per sharing account and region; only with --shared-snapshots",
+	)
+
+	m.unencryptedStorage = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_unencrypted_storage_bytes",
+			Help: "Storage used by the volumes or snapshots (kind) of a region that are not encrypted at rest",
+		},
+		[]string{"region", "kind", "account_id", "profile"},
+		"one series per region and entity type with unencrypted storage",
+	)
+
+	m.stoppedInstanceStorage = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_attached_to_stopped_instances_bytes",
+			Help: "Storage of the volumes of a region attached to stopped instances",
+		},
+		[]string{"region", "account_id", "profile"},
+		"one series per region with volumes attached to stopped instances; only with --instance-details",
+	)
+	m.pendingOperations = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_pending_operations",
+			Help: "Operations in flight in a region, whose sizes are not final yet: snapshots still being taken, volumes being modified or optimized (operation)",
+		},
+		[]string{"region", "operation", "account_id", "profile"},
+		"one series per region and operation with operations in flight",
+	)
+
+	m.storageUsedByTag = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_used_by_tag",
+			Help: "Storage used by volumes and snapshots, aggregated by tag value",
+		},
+		[]string{"tag", "value"},
+		"one series per value of the grouped tag; only with --group-by",
+	)
+
+	m.storageUsedByStack = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_used_by_stack",
+			Help: "Storage used by the entities of a CloudFormation stack or Terraform workspace",
+		},
+		[]string{"stack"},
+		"one series per stack found in the stack tags",
+	)
+
+	m.storageUsedByOwner = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_used_by_owner",
+			Help: "Storage used by the entities of an owner, \"unknown\" for the entities no owner was resolved for",
+		},
+		[]string{"owner"},
+		"one series per owner; only with --owners",
+	)
+
+	m.ebsStorageUsedByType = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_ebs_storage_used_by_type",
+			Help: "EBS storage used by the volumes of a volume type in a region",
+		},
+		[]string{"volume_type", "region"},
+		"one series per volume type and region",
+	)
+
+	m.storageUsedByRegion = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_used_by_region",
+			Help: "Storage used by the entities of a kind (entity type) in a region",
+		},
+		[]string{"region", "kind"},
+		"one series per region and entity type",
+	)
+
+	m.storageGrowthRate = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_growth_rate",
+			Help: "Growth of the storage used in a region since the last scan in the history database at least --growth-window old, as a fraction",
+		},
+		[]string{"region"},
+		"one series per region; only with --history-db",
+	)
+
+	m.storageGrowthRateByTag = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_growth_rate_by_tag",
+			Help: "Growth of the storage used by the volumes and snapshots of a tag value over --growth-window, as a fraction",
+		},
+		[]string{"tag", "value"},
+		"one series per value of the grouped tag; only with --history-db and --group-by",
+	)
+
+	m.storageForecast = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_forecast_bytes",
+			Help: "Storage a region, or a tag value in a region, is predicted to use --forecast-horizon from now by a fit of the scans in the history database",
+		},
+		[]string{"tag", "value", "region"},
+		"one series per region, or per value of the grouped tag and region with --group-by; only with --history-db and --forecast-horizon",
+	)
+
+	m.storageBytesAdded = m.newCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_storage_bytes_added_total",
+			Help: "Bytes added between consecutive scans: new entities, growth of existing ones and entities moving into a tag value",
+		},
+		[]string{"tag", "value", "region"},
+		"one series per region, or per value of the grouped tag and region with --group-by",
+	)
+
+	m.storageBytesRemoved = m.newCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_storage_bytes_removed_total",
+			Help: "Bytes removed between consecutive scans: deleted entities, shrinking of existing ones and entities moving out of a tag value",
+		},
+		[]string{"tag", "value", "region"},
+		"one series per region, or per value of the grouped tag and region with --group-by",
+	)
+
+	m.quotaUtilization = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_quota_utilization",
+			Help: "Share of an EBS service quota of a region the scanned volumes or snapshots use, as a fraction",
+		},
+		[]string{"region", "quota", "quota_code", "account_id", "profile"},
+		"one series per region and EBS quota of a scanned service; only with --quotas",
+	)
+
+	m.findings = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_storage_findings_total",
+			Help: "Findings of the latest scan by severity and type",
+		},
+		[]string{"severity", "type"},
+		"one series per severity and finding type found; only with --findings",
+	)
+
+	m.backupStorageUsedByVault = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_backup_storage_used_by_vault",
+			Help: "Backup size of the recovery points in an AWS Backup vault",
+		},
+		[]string{"vault", "region", "account_id", "profile"},
+		"one series per backup vault with recovery points",
+	)
+
+	m.backupStorageUsedByResource = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_backup_storage_used_by_resource_type",
+			Help: "Backup size of the AWS Backup recovery points of a resource type in a region",
+		},
+		[]string{"resource_type", "region", "account_id", "profile"},
+		"one series per backed up resource type and region",
+	)
+
+	m.snapshotProgress = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_snapshot_progress_percent",
+			Help: "Percent complete of a pending snapshot",
+		},
+		[]string{"snapshot_id", "volume_id", "region", "account_id", "profile"},
+		"one series per pending snapshot",
+	)
+
+	m.snapshotRemaining = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_snapshot_estimated_remaining_seconds",
+			Help: "Estimated seconds until a pending snapshot completes, extrapolated from its progress since it started",
+		},
+		[]string{"snapshot_id", "volume_id", "region", "account_id", "profile"},
+		"one series per pending snapshot with progress",
+	)
+
+	m.volumeModificationProgress = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_volume_modification_progress_percent",
+			Help: "Percent complete of an in-progress volume modification",
+		},
+		[]string{"volume_id", "state", "target_volume_type", "region", "account_id", "profile"},
+		"one series per volume being modified or optimized",
+	)
+
+	m.volumeModificationRemaining = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_volume_modification_estimated_remaining_seconds",
+			Help: "Estimated seconds until a volume modification completes, extrapolated from its progress since it started",
+		},
+		[]string{"volume_id", "state", "target_volume_type", "region", "account_id", "profile"},
+		"one series per volume being modified or optimized with progress",
+	)
+
+	m.cacheAge = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "crankymosquitos_cache_age_seconds",
+			Help: "Age of the cached data the scan used, by cache",
+		},
+		[]string{"cache"},
+		"one series per cache the scan read (regions, pricing)",
+	)
+
+	m.apiCalls = m.newCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_api_calls_total",
+			Help: "AWS API calls made during scans, retries not counted",
+		},
+		[]string{"region", "service"},
+		"one series per region and AWS service called",
+	)
+
+	m.apiThrottledByRegion = m.newCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_api_throttled_total",
+			Help: "AWS API attempts throttled during scans, by region",
+		},
+		[]string{"region"},
+		"one series per region with throttled calls",
+	)
+
+	m.regionFailures = m.newCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_scan_region_failures_total",
+			Help: "Regions left out of scans because they timed out or their clients could not be created",
+		},
+		[]string{"region"},
+		"one series per region that failed a scan",
+	)
+
+	m.scanInfo = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_scan_info",
+			Help: "Always 1, labeled with the AWS identity the last scan ran as",
+		},
+		[]string{"caller_account", "caller_arn"},
+		"one series while a scan report is observed",
+	)
+
+	m.scanRegions = m.newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_scan_regions",
+			Help: "Regions the last scan covered (scanned) or left out (failed)",
+		},
+		[]string{"status"},
+		"two series, scanned and failed",
+	)
+
+	m.scanDuration = m.newGauge(
+		prometheus.GaugeOpts{
+			Name: "aws_scan_duration_seconds",
+			Help: "Seconds the last scan took",
+		},
+	)
+
+	m.totalStorageUsed = m.newGauge(
+		prometheus.GaugeOpts{
+			Name: "aws_total_storage_used",
+			Help: "Total storage used by all volumes and snapshots",
+		},
+	)
+
+	m.scrapeDuration = m.newGauge(
+		prometheus.GaugeOpts{
+			Name: "aws_scrape_duration_seconds",
+			Help: "Seconds the last scrape took, including waiting for the refresh of stale metrics",
+		},
+	)
+
+	m.scrapeErrors = m.newCounter(
+		prometheus.CounterOpts{
+			Name: "aws_scrape_errors_total",
+			Help: "Scrapes that found the metrics stale and could not refresh them in time",
+		},
+	)
+
+	m.newGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "crankymosquitos_inventory_age_seconds",
+			Help: "Seconds since the data behind the metrics was collected, NaN before the first scan",
+		},
+		m.InventoryAge,
+	)
+
+	return m
+}
+
+// addDoc records a metric family, registered when the configured detail
+// includes it.
+func (m *Metrics) addDoc(doc *MetricDoc) {
+	doc.Detail = MetricDetailTotal
+	if family, ok := familyDetails[doc.Name]; ok {
+		doc.Detail = family.detail
+	}
+	doc.enabled = slices.Index(MetricDetails, doc.Detail) >= max(slices.Index(MetricDetails, m.detail), 0)
+	m.docs = append(m.docs, doc)
+}
+
+// familyLabels appends the labels of the extra tags to the labels of a
+// family built per entity.
+func (m *Metrics) familyLabels(name string, labels []string) []string {
+	if !familyDetails[name].tagged {
+		return labels
+	}
+	for _, key := range m.extraTags {
+		labels = append(labels, TagLabel(key))
+	}
+	return labels
+}
+
+// tagValues returns the values of the extra tags on an entity.
+func (m *Metrics) tagValues(entity EntityUsage) []string {
+	values := make([]string, len(m.extraTags))
+	for i, key := range m.extraTags {
+		values[i] = entity.Tags[key]
+	}
+	return values
+}
+
+// tagSeparator joins the extra tag values of an aggregate key.
+const tagSeparator = "\x00"
+
+// aggregateLabels appends the extra tag values joined into tags to label
+// values.
+func (m *Metrics) aggregateLabels(tags string, values ...string) []string {
+	if len(m.extraTags) == 0 {
+		return values
+	}
+	return append(values, strings.Split(tags, tagSeparator)...)
+}
+
+// entityLabels appends the extra tag values of an entity to label values.
+func (m *Metrics) entityLabels(entity EntityUsage, values ...string) []string {
+	return append(values, m.tagValues(entity)...)
+}
+
+func (m *Metrics) newGaugeVec(opts prometheus.GaugeOpts, labels []string, cardinality string) *prometheus.GaugeVec {
+	labels = m.familyLabels(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labels)
+	gauge := prometheus.NewGaugeVec(opts, labels)
+	m.addDoc(&MetricDoc{
+		Name:        prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Type:        "gauge",
+		Help:        opts.Help,
+		Labels:      labels,
+		Cardinality: cardinality,
+		collector:   gauge,
+	})
+	return gauge
+}
+
+func (m *Metrics) newCounterVec(opts prometheus.CounterOpts, labels []string, cardinality string) *prometheus.CounterVec {
+	labels = m.familyLabels(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labels)
+	counter := prometheus.NewCounterVec(opts, labels)
+	m.addDoc(&MetricDoc{
+		Name:        prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Type:        "counter",
+		Help:        opts.Help,
+		Labels:      labels,
+		Cardinality: cardinality,
+		collector:   counter,
+	})
+	return counter
+}
+
+func (m *Metrics) newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	counter := prometheus.NewCounter(opts)
+	m.addDoc(&MetricDoc{
+		Name:        prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Type:        "counter",
+		Help:        opts.Help,
+		Cardinality: "single series",
+		collector:   counter,
+	})
+	return counter
+}
+
+func (m *Metrics) newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	gauge := prometheus.NewGauge(opts)
+	m.addDoc(&MetricDoc{
+		Name:        prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Type:        "gauge",
+		Help:        opts.Help,
+		Cardinality: "single series",
+		collector:   gauge,
+	})
+	return gauge
+}
+
+// DeriveGaugeVec adds a custom gauge vector that derive sets from the
+// observed report on every scrape, after the built-in gauges. The gauge is
+// reset before each derivation so series missing from the latest report
+// disappear. It appears in Docs and must be added before Register.
+func (m *Metrics) DeriveGaugeVec(opts prometheus.GaugeOpts, labels []string, cardinality string, derive func(report *Report, gauge *prometheus.GaugeVec)) {
+	gauge := m.newGaugeVec(opts, labels, cardinality)
+	m.derivations = append(m.derivations, func(report *Report) {
+		gauge.Reset()
+		derive(report, gauge)
+	})
+}
+
+func (m *Metrics) newGaugeFunc(opts prometheus.GaugeOpts, fn func() float64) {
+	gauge := prometheus.NewGaugeFunc(opts, fn)
+	m.addDoc(&MetricDoc{
+		Name:        prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Type:        "gauge",
+		Help:        opts.Help,
+		Cardinality: "single series",
+		collector:   gauge,
+	})
+}
+
+// InventoryAge returns the seconds since the last observed report was
+// generated, or NaN when none was observed yet.
+func (m *Metrics) InventoryAge() float64 {
+	generatedAt := m.generatedAt.Load()
+	if generatedAt == 0 {
+		return math.NaN()
+	}
+	return time.Since(time.Unix(0, generatedAt)).Seconds()
+}
+
+// Register registers the metrics with the registerer, labeled with
+// MetricsOptions.ConstLabels.
+func (m *Metrics) Register(registerer prometheus.Registerer) error {
+	if len(m.constLabels) > 0 {
+		registerer = prometheus.WrapRegistererWith(m.constLabels, registerer)
+	}
+	return registerer.Register(m)
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, doc := range m.docs {
+		if doc.enabled {
+			doc.collector.Describe(ch)
+		}
+	}
+}
+
+// Collect implements prometheus.Collector. It refreshes stale metrics
+// first, then generates every series from the observed report.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	started := time.Now()
+
+	if m.stale() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRefreshTimeout)
+		err := m.Refresh(ctx)
+		cancel()
+		if err != nil {
+			m.scrapeErrors.Inc()
+			slog.Warn("serving stale metrics", "inventory_age", m.InventoryAge(), "error", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.report != nil {
+		m.fill(m.report)
+	}
+	m.scrapeDuration.Set(time.Since(started).Seconds())
+
+	for _, doc := range m.docs {
+		if doc.enabled {
+			doc.collector.Collect(ch)
+		}
+	}
+}
+
+// stale reports whether a scrape should refresh the metrics first.
+func (m *Metrics) stale() bool {
+	if m.Refresh == nil || m.MaxStaleness <= 0 {
+		return false
+	}
+	age := m.InventoryAge()
+	return math.IsNaN(age) || age > m.MaxStaleness.Seconds()
+}
+
+// Docs returns the descriptions of the registered metrics sorted by name.
+func (m *Metrics) Docs() []*MetricDoc {
+	var docs []*MetricDoc
+	for _, doc := range m.docs {
+		if doc.enabled {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// Observe makes the report the one scrapes are generated from and adds its
+// API calls and throttles, and the bytes added and removed since the
+// previously observed report, to the counters.
+func (m *Metrics) Observe(report *Report) {
+	for region, count := range report.RegionThrottles {
+		m.apiThrottledByRegion.WithLabelValues(region).Add(float64(count))
+	}
+	for key, count := range report.APICalls {
+		m.apiCalls.WithLabelValues(key.Region, key.Service).Add(float64(count))
+	}
+	for _, failed := range report.FailedRegions {
+		m.regionFailures.WithLabelValues(failed.Region).Inc()
+	}
+
+	m.mu.Lock()
+	if m.report != nil {
+		m.countChanges(m.report, report)
+	}
+	m.report = report
+	m.mu.Unlock()
+	m.generatedAt.Store(report.GeneratedAt.UnixNano())
+}
+
+// countChanges adds the bytes added and removed between two consecutive
+// reports to the counters, by region and value of the grouped tag of the
+// later report. Regions that failed either scan are left out, so their
+// entities do not count as deleted or new.
+func (m *Metrics) countChanges(before, after *Report) {
+	failed := map[string]bool{}
+	for _, report := range []*Report{before, after} {
+		for _, region := range report.FailedRegions {
+			failed[region.Region] = true
+		}
+	}
+
+	type entityKey struct{ region, id string }
+	type groupKey struct{ value, region string }
+	type entry struct {
+		size  int64
+		group groupKey
+	}
+	group := func(entity EntityUsage) groupKey {
+		if after.GroupByTag == "" {
+			return groupKey{region: entity.Region}
+		}
+		return groupKey{entity.Tags[after.GroupByTag], entity.Region}
+	}
+
+	previous := map[entityKey]entry{}
+	for _, entity := range before.Entities {
+		if !failed[entity.Region] {
+			previous[entityKey{entity.Region, entity.ID}] = entry{entity.StorageUsed, group(entity)}
+		}
+	}
+
+	added := map[groupKey]int64{}
+	removed := map[groupKey]int64{}
+	for _, entity := range after.Entities {
+		if failed[entity.Region] {
+			continue
+		}
+		key := entityKey{entity.Region, entity.ID}
+		current := group(entity)
+		added[current] += 0 // Series start at zero rather than at the first change
+		removed[current] += 0
+		old, ok := previous[key]
+		delete(previous, key)
+		switch {
+		case !ok:
+			added[current] += entity.StorageUsed
+		case old.group != current:
+			removed[old.group] += old.size
+			added[current] += entity.StorageUsed
+		case entity.StorageUsed > old.size:
+			added[current] += entity.StorageUsed - old.size
+		case entity.StorageUsed < old.size:
+			removed[current] += old.size - entity.StorageUsed
+		}
+	}
+	for _, old := range previous {
+		removed[old.group] += old.size
+	}
+
+	for key, size := range added {
+		m.storageBytesAdded.WithLabelValues(after.GroupByTag, key.value, key.region).Add(float64(size))
+	}
+	for key, size := range removed {
+		m.storageBytesRemoved.WithLabelValues(after.GroupByTag, key.value, key.region).Add(float64(size))
+	}
+}
+
+// fill sets the gauges from a report. The gauge vectors are reset first so
+// series of entities missing from the report, e.g. of a region no longer
+// scanned or a deleted volume, disappear.
+func (m *Metrics) fill(report *Report) {
+	for _, doc := range m.docs {
+		if gauge, ok := doc.collector.(*prometheus.GaugeVec); ok {
+			gauge.Reset()
+		}
+	}
+
+	// tags joins the extra tag values of the entities of an aggregate
+	type typeKey struct{ volumeType, region, tags string }
+	type regionKey struct{ region, kind, tags string }
+	type scopedKey struct{ value, region, accountID, profile, tags string }
+	byType := map[typeKey]float64{}
+	byRegion := map[regionKey]float64{}
+	byVault := map[scopedKey]float64{}
+	byResourceType := map[scopedKey]float64{}
+	byOwner := map[scopedKey]float64{}
+	unencrypted := map[scopedKey]float64{}
+	stopped := map[scopedKey]float64{}
+	pending := map[scopedKey]float64{}
+
+	for _, entity := range report.Entities {
+		size := float64(entity.StorageUsed)
+		tags := strings.Join(m.tagValues(entity), tagSeparator)
+
+		byRegion[regionKey{entity.Region, entity.Type, tags}] += size
+		if entity.Type == EntityTypeVolume {
+			byType[typeKey{entity.VolumeType, entity.Region, tags}] += size
+		}
+		if entity.Type == EntityTypeRecoveryPoint {
+			byVault[scopedKey{entity.BackupVault, entity.Region, entity.AccountID, entity.Profile, tags}] += size
+			byResourceType[scopedKey{entity.ResourceType, entity.Region, entity.AccountID, entity.Profile, tags}] += size
+		}
+
+		if entity.Public {
+			m.snapshotPublic.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(1)
+		}
+		if entity.Type == EntityTypeSharedSnapshot {
+			byOwner[scopedKey{entity.SnapshotOwner, entity.Region, entity.AccountID, entity.Profile, tags}]++
+		}
+		if isUnencrypted(entity) {
+			unencrypted[scopedKey{entity.Type, entity.Region, entity.AccountID, entity.Profile, tags}] += size
+		}
+		if AttachedToStoppedInstance(entity) {
+			stopped[scopedKey{"", entity.Region, entity.AccountID, entity.Profile, tags}] += size
+		}
+		if operation := entity.PendingOperation(); operation != "" {
+			pending[scopedKey{operation, entity.Region, entity.AccountID, entity.Profile, tags}]++
+		}
+
+		switch entity.Type {
+		case EntityTypeVolume:
+			m.ebsStorageUsed.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AttachedInstance, entity.AccountID, entity.Profile)...).Set(size)
+		case EntityTypeSnapshot:
+			m.snapshotStorageUsed.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AttachedInstance, entity.AccountID, entity.Profile)...).Set(size)
+		case EntityTypeBucket:
+			m.s3StorageUsed.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(size)
+		case EntityTypeDBInstance, EntityTypeDBCluster:
+			m.rdsStorageAllocated.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Engine, entity.Region, entity.AccountID, entity.Profile)...).Set(float64(entity.AllocatedStorage))
+			m.rdsStorageUsed.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Engine, entity.Region, entity.AccountID, entity.Profile)...).Set(size)
+		case EntityTypeEFS:
+			m.efsStorageUsed.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(size)
+		case EntityTypeFSx:
+			m.fsxStorageCapacity.WithLabelValues(m.entityLabels(entity, entity.ID, entity.FileSystemType, entity.Region, entity.AccountID, entity.Profile)...).Set(float64(entity.AllocatedStorage))
+		}
+
+		if report.CostEstimated {
+			if kind := PriceKind(entity); kind != "" {
+				m.ebsMonthlyCost.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Type, kind, entity.Region, entity.AccountID, entity.Profile)...).Set(entity.MonthlyCostUSD)
+			}
+		}
+
+		if entity.Progress != nil {
+			m.snapshotProgress.WithLabelValues(m.entityLabels(entity, entity.ID, entity.SourceVolume, entity.Region, entity.AccountID, entity.Profile)...).Set(*entity.Progress)
+			if remaining, ok := EstimatedRemaining(entity.StartTime, *entity.Progress, report.GeneratedAt); ok {
+				m.snapshotRemaining.WithLabelValues(m.entityLabels(entity, entity.ID, entity.SourceVolume, entity.Region, entity.AccountID, entity.Profile)...).Set(remaining.Seconds())
+			}
+		}
+
+		if mod := entity.Modification; mod != nil {
+			m.volumeModificationProgress.WithLabelValues(m.entityLabels(entity, entity.ID, mod.State, mod.TargetVolumeType, entity.Region, entity.AccountID, entity.Profile)...).Set(mod.Progress)
+			if remaining, ok := EstimatedRemaining(mod.StartTime, mod.Progress, report.GeneratedAt); ok {
+				m.volumeModificationRemaining.WithLabelValues(m.entityLabels(entity, entity.ID, mod.State, mod.TargetVolumeType, entity.Region, entity.AccountID, entity.Profile)...).Set(remaining.Seconds())
+			}
+		}
+
+		if entity.BackupAgeHours != nil {
+			m.volumeBackupAge.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(*entity.BackupAgeHours)
+		}
+
+		if entity.SnapshotAge != nil {
+			m.volumeSnapshotAge.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(*entity.SnapshotAge)
+			if entity.SnapshotGap {
+				m.volumeSnapshotGap.WithLabelValues(m.entityLabels(entity, entity.ID, entity.Region, entity.AccountID, entity.Profile)...).Set(1)
+			}
+		}
+	}
+
+	for key, size := range byType {
+		m.ebsStorageUsedByType.WithLabelValues(m.aggregateLabels(key.tags, key.volumeType, key.region)...).Set(size)
+	}
+	for key, size := range byRegion {
+		m.storageUsedByRegion.WithLabelValues(m.aggregateLabels(key.tags, key.region, key.kind)...).Set(size)
+	}
+	for key, size := range byVault {
+		m.backupStorageUsedByVault.WithLabelValues(m.aggregateLabels(key.tags, key.value, key.region, key.accountID, key.profile)...).Set(size)
+	}
+	for key, size := range byResourceType {
+		m.backupStorageUsedByResource.WithLabelValues(m.aggregateLabels(key.tags, key.value, key.region, key.accountID, key.profile)...).Set(size)
+	}
+	for key, count := range byOwner {
+		m.sharedSnapshots.WithLabelValues(m.aggregateLabels(key.tags, key.value, key.region, key.accountID, key.profile)...).Set(count)
+	}
+	for key, size := range unencrypted {
+		m.unencryptedStorage.WithLabelValues(m.aggregateLabels(key.tags, key.region, key.value, key.accountID, key.profile)...).Set(size)
+	}
+	for key, size := range stopped {
+		m.stoppedInstanceStorage.WithLabelValues(m.aggregateLabels(key.tags, key.region, key.accountID, key.profile)...).Set(size)
+	}
+	for key, count := range pending {
+		m.pendingOperations.WithLabelValues(m.aggregateLabels(key.tags, key.region, key.value, key.accountID, key.profile)...).Set(count)
+	}
+
+	for _, group := range report.Groups {
+		m.storageUsedByTag.WithLabelValues(report.GroupByTag, group.Value).Set(float64(group.StorageUsed))
+	}
+
+	if growth := report.Growth; growth != nil {
+		for _, region := range growth.Regions {
+			m.storageGrowthRate.WithLabelValues(region.Key).Set(region.Rate())
+		}
+		for _, group := range growth.Groups {
+			m.storageGrowthRateByTag.WithLabelValues(growth.GroupBy, group.Key).Set(group.Rate())
+		}
+	}
+
+	if forecast := report.Forecast; forecast != nil {
+		for _, series := range forecast.Series {
+			m.storageForecast.WithLabelValues(forecast.GroupBy, series.Group, series.Region).Set(float64(series.Predicted))
+		}
+	}
+
+	type findingKey struct{ severity, kind string }
+	findings := map[findingKey]int{}
+	for _, finding := range report.Findings {
+		findings[findingKey{finding.Severity, finding.Type}]++
+	}
+	for key, count := range findings {
+		m.findings.WithLabelValues(key.severity, key.kind).Set(float64(count))
+	}
+
+	for _, quota := range report.Quotas {
+		m.quotaUtilization.WithLabelValues(quota.Region, quota.Name, quota.Code, quota.AccountID, quota.Profile).Set(quota.Utilization())
+	}
+
+	for _, stack := range report.Stacks {
+		m.storageUsedByStack.WithLabelValues(stack.Value).Set(float64(stack.StorageUsed))
+	}
+
+	for _, owner := range report.Owners {
+		m.storageUsedByOwner.WithLabelValues(owner.Value).Set(float64(owner.StorageUsed))
+	}
+
+	for cache, age := range report.CacheAges {
+		m.cacheAge.WithLabelValues(cache).Set(age.Seconds())
+	}
+
+	m.totalStorageUsed.Set(float64(report.TotalStorageUsed))
+
+	var caller CallerIdentity
+	if report.Caller != nil {
+		caller = *report.Caller
+	}
+	m.scanInfo.WithLabelValues(caller.Account, caller.ARN).Set(1)
+	m.scanRegions.WithLabelValues("scanned").Set(float64(len(report.RegionsScanned())))
+	m.scanRegions.WithLabelValues("failed").Set(float64(len(report.FailedRegions)))
+	if !report.StartedAt.IsZero() {
+		m.scanDuration.Set(report.GeneratedAt.Sub(report.StartedAt).Seconds())
+	}
+
+	for _, derive := range m.derivations {
+		derive(report)
+	}
+}
@@ -0,0 +1,116 @@
+package collector_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taylormonacelli/crankymosquitos/pkg/collector"
+)
+
+// series returns the values of the label of each series of a family.
+func series(t *testing.T, registry *prometheus.Registry, family, label string) []string {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, f := range families {
+		if f.GetName() != family {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label {
+					values = append(values, pair.GetValue())
+				}
+			}
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+// TestMetricsDropStaleSeries observes a report without a volume of the one
+// before it, as after the volume was deleted between refreshes, and checks
+// that the volume's series are gone rather than left at their old value.
+func TestMetricsDropStaleSeries(t *testing.T) {
+	metrics := collector.NewMetrics()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	volume := func(id string) collector.EntityUsage {
+		return collector.EntityUsage{
+			ID:          id,
+			Region:      "us-east-1",
+			Type:        collector.EntityTypeVolume,
+			VolumeType:  "gp3",
+			StorageUsed: 10 << 30,
+		}
+	}
+	observe := func(entities ...collector.EntityUsage) {
+		report := &collector.Report{Entities: entities, GeneratedAt: time.Now()}
+		for _, entity := range entities {
+			report.TotalStorageUsed += entity.StorageUsed
+		}
+		metrics.Observe(report)
+	}
+
+	observe(volume("vol-1"), volume("vol-2"))
+	if got, want := series(t, registry, "aws_ebs_storage_used", "volume_id"), []string{"vol-1", "vol-2"}; !slices.Equal(got, want) {
+		t.Fatalf("series of volumes %v, want %v", got, want)
+	}
+
+	observe(volume("vol-1"))
+	if got, want := series(t, registry, "aws_ebs_storage_used", "volume_id"), []string{"vol-1"}; !slices.Equal(got, want) {
+		t.Errorf("series of volumes after vol-2 was deleted %v, want %v", got, want)
+	}
+
+	observe()
+	if got := series(t, registry, "aws_ebs_storage_used", "volume_id"); len(got) != 0 {
+		t.Errorf("series of volumes after all were deleted %v, want none", got)
+	}
+}
+
+func TestMetricsFindings(t *testing.T) {
+	metrics := collector.NewMetrics()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	metrics.Observe(&collector.Report{GeneratedAt: time.Now(), Findings: []collector.Finding{
+		{Type: "unencrypted", Severity: "high"},
+		{Type: "unencrypted", Severity: "high"},
+		{Type: "stale-snapshot", Severity: "low"},
+	}})
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != "aws_storage_findings_total" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			var severity, kind string
+			for _, pair := range metric.GetLabel() {
+				switch pair.GetName() {
+				case "severity":
+					severity = pair.GetValue()
+				case "type":
+					kind = pair.GetValue()
+				}
+			}
+			got[severity+"/"+kind] = metric.GetGauge().GetValue()
+		}
+	}
+	want := map[string]float64{"high/unencrypted": 2, "low/stale-snapshot": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("aws_storage_findings_total = %v, want %v", got, want)
+	}
+}
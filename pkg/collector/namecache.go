@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+)
+
+// cachedName is a Name tag lookup as stored in the name cache. Resources
+// found without a Name tag are cached with an empty name so that they are
+// not looked up again either.
+type cachedName struct {
+	Name      string `json:",omitempty"`
+	FetchedAt time.Time
+}
+
+// nameCache remembers the Name tags of instances and volumes by region and
+// resource ID. Names rarely change, so entries are trusted until they are
+// older than the TTL.
+type nameCache struct {
+	mu     sync.Mutex
+	file   string
+	sealer atrest.Sealer
+	ttl    time.Duration
+	names  map[string]cachedName
+	dirty  bool
+}
+
+func loadNameCache(file string, sealer atrest.Sealer, ttl time.Duration) *nameCache {
+	cache := &nameCache{file: file, sealer: sealer, ttl: ttl, names: map[string]cachedName{}}
+	if file == "" {
+		return cache
+	}
+
+	data, err := atrest.ReadFile(sealer, file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		slog.Warn("ignoring unreadable name cache", "error", err)
+	default:
+		if err := json.Unmarshal(data, &cache.names); err != nil {
+			slog.Warn("ignoring unreadable name cache", "error", err)
+		}
+	}
+
+	return cache
+}
+
+func nameCacheKey(region, id string) string {
+	return region + "/" + id
+}
+
+// lookup returns the names of the resources of a region, calling fetch only
+// for the IDs without a fresh cache entry. Like fetch, it leaves out the
+// resources without a Name tag. When fetch fails only the names it found are
+// cached, and its error is returned along with the names.
+func (c *nameCache) lookup(ctx context.Context, region string, ids []string, fetch func(context.Context, []string) (map[string]string, error)) (map[string]string, error) {
+	now := time.Now()
+	names := map[string]string{}
+	var missing []string
+
+	c.mu.Lock()
+	for _, id := range ids {
+		entry, ok := c.names[nameCacheKey(region, id)]
+		if !ok || now.Sub(entry.FetchedAt) >= c.ttl {
+			missing = append(missing, id)
+			continue
+		}
+		if entry.Name != "" {
+			names[id] = entry.Name
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return names, nil
+	}
+	slog.Debug("looking up names", "region", region, "cached", len(ids)-len(missing), "missing", len(missing))
+
+	fetched, err := fetch(ctx, missing)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range missing {
+		name, ok := fetched[id]
+		if ok {
+			names[id] = name
+		}
+		if ok || err == nil {
+			c.names[nameCacheKey(region, id)] = cachedName{Name: name, FetchedAt: now}
+			c.dirty = true
+		}
+	}
+
+	return names, err
+}
+
+// save writes the cache, dropping expired entries.
+func (c *nameCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty || c.file == "" {
+		return nil
+	}
+
+	now := time.Now()
+	for key, entry := range c.names {
+		if now.Sub(entry.FetchedAt) >= c.ttl {
+			delete(c.names, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(c.names, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := atrest.WriteFile(c.sealer, c.file, data, 0o644); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"sort"
+	"time"
+)
+
+// Reasons an entity is reported as orphaned.
+const (
+	OrphanUnattachedVolume = "unattached volume"
+	OrphanSourceDeleted    = "source volume deleted"
+	OrphanNotInAMI         = "not referenced by an AMI"
+)
+
+// Orphan is an entity that is likely safe to clean up.
+type Orphan struct {
+	Entity  EntityUsage
+	Age     time.Duration
+	Reasons []string
+	// Owner and OwnerSource are set by OwnerChain.AssignOwners.
+	Owner       string
+	OwnerSource string
+}
+
+// EntityAge returns how long ago a volume was created or a snapshot started.
+func EntityAge(entity EntityUsage, now time.Time) time.Duration {
+	switch entity.Type {
+	case EntityTypeVolume:
+		return now.Sub(entity.CreateTime)
+	case EntityTypeSnapshot:
+		return now.Sub(entity.StartTime)
+	}
+	return 0
+}
+
+// FindOrphans returns the unattached volumes and the snapshots whose source
+// volume is gone or that back no AMI, at least olderThan old, largest first.
+// Whether a source volume is gone is read from the snapshot the scan marked,
+// falling back to the volumes among all.
+func FindOrphans(all []EntityUsage, amiSnapshots map[string]bool, now time.Time, olderThan time.Duration) []Orphan {
+	volumes := map[string]bool{}
+	for _, entity := range all {
+		if entity.Type == EntityTypeVolume {
+			volumes[entity.ID] = true
+		}
+	}
+
+	var orphans []Orphan
+	for _, entity := range all {
+		var reasons []string
+
+		switch entity.Type {
+		case EntityTypeVolume:
+			if entity.AttachedInstance == "" {
+				reasons = append(reasons, OrphanUnattachedVolume)
+			}
+		case EntityTypeSnapshot:
+			if entity.SourceVolumeDeleted(volumes) {
+				reasons = append(reasons, OrphanSourceDeleted)
+			}
+			if !amiSnapshots[entity.ID] {
+				reasons = append(reasons, OrphanNotInAMI)
+			}
+		}
+
+		age := EntityAge(entity, now)
+		if len(reasons) == 0 || age < olderThan {
+			continue
+		}
+
+		orphans = append(orphans, Orphan{Entity: entity, Age: age, Reasons: reasons})
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphans[i].Entity.StorageUsed > orphans[j].Entity.StorageUsed
+	})
+
+	return orphans
+}
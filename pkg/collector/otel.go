@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+// OTLPOptions configure ExportOTLP.
+type OTLPOptions struct {
+	// Endpoint is the OTLP/HTTP endpoint URL, e.g. http://localhost:4318.
+	// /v1/metrics is used when it has no path. The standard
+	// OTEL_EXPORTER_OTLP_* variables apply on top of it.
+	Endpoint string
+	// AccountID is recorded as the cloud.account.id resource attribute
+	// when set.
+	AccountID string
+}
+
+// ExportOTLP exports the storage gauges of a report once to an OTLP
+// endpoint. The gauges mirror the Prometheus metrics, with the region of
+// every datapoint in its cloud.region attribute.
+func ExportOTLP(ctx context.Context, opts OTLPOptions, report *Report) error {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/metrics"
+	}
+
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint.String()))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName("crankymosquitos"),
+		semconv.CloudProviderAWS,
+	}
+	if opts.AccountID != "" {
+		attrs = append(attrs, semconv.CloudAccountID(opts.AccountID))
+	}
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(resource.NewSchemaless(attrs...)),
+		sdkmetric.WithReader(reader),
+	)
+	defer provider.Shutdown(ctx)
+
+	if err := recordOTLPGauges(provider.Meter("github.com/taylormonacelli/crankymosquitos"), report); err != nil {
+		return err
+	}
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &metrics); err != nil {
+		return fmt.Errorf("failed to collect metrics: %w", err)
+	}
+
+	if err := exporter.Export(ctx, &metrics); err != nil {
+		return fmt.Errorf("failed to export metrics to %s: %w", opts.Endpoint, err)
+	}
+
+	return exporter.Shutdown(ctx)
+}
+
+func recordOTLPGauges(meter metric.Meter, report *Report) error {
+	gauge := func(name, description string) (metric.Int64Gauge, error) {
+		return meter.Int64Gauge(name, metric.WithDescription(description), metric.WithUnit("By"))
+	}
+
+	ebsUsed, err := gauge("aws.ebs.storage_used", "EBS storage used by volume")
+	if err != nil {
+		return err
+	}
+	snapshotUsed, err := gauge("aws.snapshot.storage_used", "Snapshot storage used by snapshot")
+	if err != nil {
+		return err
+	}
+	s3Used, err := gauge("aws.s3.storage_used", "S3 storage used by bucket")
+	if err != nil {
+		return err
+	}
+	rdsAllocated, err := gauge("aws.rds.storage_allocated", "Storage allocated by RDS instance or Aurora cluster")
+	if err != nil {
+		return err
+	}
+	rdsUsed, err := gauge("aws.rds.storage_used", "Storage used by RDS instance or Aurora cluster")
+	if err != nil {
+		return err
+	}
+	efsUsed, err := gauge("aws.efs.storage_used", "Metered size of EFS file system")
+	if err != nil {
+		return err
+	}
+	fsxCapacity, err := gauge("aws.fsx.storage_capacity", "Provisioned storage capacity of FSx file system")
+	if err != nil {
+		return err
+	}
+	totalUsed, err := gauge("aws.total_storage_used", "Total storage used by all volumes and snapshots")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, entity := range report.Entities {
+		common := []attribute.KeyValue{semconv.CloudRegion(entity.Region)}
+		if entity.AccountID != "" {
+			common = append(common, semconv.CloudAccountID(entity.AccountID))
+		}
+		if entity.Profile != "" {
+			common = append(common, attribute.String("profile", entity.Profile))
+		}
+		attrs := func(kv ...attribute.KeyValue) metric.MeasurementOption {
+			return metric.WithAttributes(append(kv, common...)...)
+		}
+
+		switch entity.Type {
+		case EntityTypeVolume:
+			ebsUsed.Record(ctx, entity.StorageUsed, attrs(
+				attribute.String("volume_id", entity.ID),
+				attribute.String("attached_instance", entity.AttachedInstance)))
+		case EntityTypeSnapshot:
+			snapshotUsed.Record(ctx, entity.StorageUsed, attrs(
+				attribute.String("snapshot_id", entity.ID)))
+		case EntityTypeBucket:
+			s3Used.Record(ctx, entity.StorageUsed, attrs(
+				attribute.String("bucket", entity.ID)))
+		case EntityTypeDBInstance, EntityTypeDBCluster:
+			dbAttrs := attrs(
+				attribute.String("db_identifier", entity.ID),
+				attribute.String("engine", entity.Engine))
+			rdsAllocated.Record(ctx, entity.AllocatedStorage, dbAttrs)
+			rdsUsed.Record(ctx, entity.StorageUsed, dbAttrs)
+		case EntityTypeEFS:
+			efsUsed.Record(ctx, entity.StorageUsed, attrs(
+				attribute.String("file_system_id", entity.ID)))
+		case EntityTypeFSx:
+			fsxCapacity.Record(ctx, entity.AllocatedStorage, attrs(
+				attribute.String("file_system_id", entity.ID),
+				attribute.String("file_system_type", entity.FileSystemType)))
+		}
+	}
+	totalUsed.Record(ctx, report.TotalStorageUsed)
+
+	return nil
+}
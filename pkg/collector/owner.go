@@ -0,0 +1,266 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+// Sources an owner was resolved from.
+const (
+	OwnerSourceTag        = "tag"
+	OwnerSourceCloudTrail = "cloudtrail"
+	OwnerSourceAccount    = "account default"
+)
+
+// OwnerUnknown owns the entities Options.Owners could not resolve an owner
+// for.
+const OwnerUnknown = "unknown"
+
+// OwnerResolver resolves who owns an entity. It returns "" when it cannot
+// tell, leaving the item to the next resolver of an OwnerChain.
+type OwnerResolver interface {
+	ResolveOwner(ctx context.Context, entity EntityUsage) (string, error)
+	// Source names where the owner comes from, e.g. OwnerSourceTag.
+	Source() string
+}
+
+// OwnerChain tries its resolvers in order and assigns the first owner found.
+type OwnerChain []OwnerResolver
+
+// TagOwnerResolver takes the owner from the first of Keys the entity is
+// tagged with.
+type TagOwnerResolver struct {
+	Keys []string
+}
+
+func (r TagOwnerResolver) Source() string { return OwnerSourceTag }
+
+func (r TagOwnerResolver) ResolveOwner(ctx context.Context, entity EntityUsage) (string, error) {
+	for _, key := range r.Keys {
+		if owner := entity.Tags[key]; owner != "" {
+			return owner, nil
+		}
+	}
+	return "", nil
+}
+
+// AccountOwnerResolver takes the owner from a per-account default, with the
+// "*" entry applying to every account not listed. Entities without an
+// AccountID are looked up as Account.
+type AccountOwnerResolver struct {
+	Owners  map[string]string // By account ID
+	Account string
+}
+
+func (r AccountOwnerResolver) Source() string { return OwnerSourceAccount }
+
+func (r AccountOwnerResolver) ResolveOwner(ctx context.Context, entity EntityUsage) (string, error) {
+	account := entity.AccountID
+	if account == "" {
+		account = r.Account
+	}
+	if owner, ok := r.Owners[account]; ok {
+		return owner, nil
+	}
+	return r.Owners["*"], nil
+}
+
+// cloudTrailRate is the LookupEvents quota of an account and region.
+const cloudTrailRate = 2 // Calls per second
+
+// cloudTrailCreateEvents are the events that create volumes and snapshots.
+var cloudTrailCreateEvents = map[string]bool{
+	"CreateVolume":    true,
+	"CreateSnapshot":  true,
+	"CreateSnapshots": true,
+	"CopySnapshot":    true,
+}
+
+// CloudTrailOwnerResolver takes the owner from the identity that created the
+// resource, as recorded by CloudTrail. LookupEvents only reaches back 90 days,
+// so older resources are left to the next resolver.
+type CloudTrailOwnerResolver struct {
+	loadConfig ConfigLoader
+
+	mu      sync.Mutex
+	clients map[string]*cloudtrail.Client
+	tickers map[string]*time.Ticker
+}
+
+// NewCloudTrailOwnerResolver returns a resolver that builds its per-region
+// clients with loadConfig.
+func NewCloudTrailOwnerResolver(loadConfig ConfigLoader) *CloudTrailOwnerResolver {
+	return &CloudTrailOwnerResolver{
+		loadConfig: loadConfig,
+		clients:    map[string]*cloudtrail.Client{},
+		tickers:    map[string]*time.Ticker{},
+	}
+}
+
+func (r *CloudTrailOwnerResolver) Source() string { return OwnerSourceCloudTrail }
+
+func (r *CloudTrailOwnerResolver) client(ctx context.Context, region string) (*cloudtrail.Client, *time.Ticker, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if client, ok := r.clients[region]; ok {
+		return client, r.tickers[region], nil
+	}
+
+	cfg, err := r.loadConfig(ctx, region)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.clients[region] = cloudtrail.NewFromConfig(cfg)
+	r.tickers[region] = time.NewTicker(time.Second / cloudTrailRate)
+	return r.clients[region], r.tickers[region], nil
+}
+
+func (r *CloudTrailOwnerResolver) ResolveOwner(ctx context.Context, entity EntityUsage) (string, error) {
+	if entity.Type != EntityTypeVolume && entity.Type != EntityTypeSnapshot {
+		return "", nil // Only their create events are recognized
+	}
+
+	client, ticker, err := r.client(ctx, entity.Region)
+	if err != nil {
+		return "", err
+	}
+
+	paginator := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{{
+			AttributeKey:   cloudtrailtypes.LookupAttributeKeyResourceName,
+			AttributeValue: aws.String(entity.ID),
+		}},
+	})
+	for paginator.HasMorePages() {
+		select {
+		case <-ticker.C: // Stay within the LookupEvents quota
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		for _, event := range page.Events {
+			if cloudTrailCreateEvents[aws.ToString(event.EventName)] {
+				return aws.ToString(event.Username), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// Close stops the rate limiting of the per-region clients.
+func (r *CloudTrailOwnerResolver) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ticker := range r.tickers {
+		ticker.Stop()
+	}
+}
+
+// Resolve returns the owner of an entity and the source it came from, or
+// two empty strings when no resolver knows. Resolvers that fail are logged
+// and skipped.
+func (c OwnerChain) Resolve(ctx context.Context, entity EntityUsage) (string, string) {
+	for _, resolver := range c {
+		owner, err := resolver.ResolveOwner(ctx, entity)
+		if err != nil {
+			slog.Warn("failed to resolve owner", "type", entity.Type, "id", entity.ID, "source", resolver.Source(), "error", err)
+			continue
+		}
+		if owner != "" {
+			return owner, resolver.Source()
+		}
+	}
+	return "", ""
+}
+
+// AssignOwners resolves the owner of every orphan.
+func (c OwnerChain) AssignOwners(ctx context.Context, orphans []Orphan) {
+	for i := range orphans {
+		orphans[i].Owner, orphans[i].OwnerSource = c.Resolve(ctx, orphans[i].Entity)
+	}
+}
+
+// resolveOwners resolves the owners of the entities with the chain of
+// Options.Owners. The regions are resolved concurrently, since the
+// CloudTrail quota is per region.
+func (c *StorageCollector) resolveOwners(ctx context.Context, entities []EntityUsage) {
+	chain := OwnerChain{TagOwnerResolver{Keys: c.opts.OwnerTags}}
+	if c.opts.OwnerFromCloudTrail && !c.skipEnrichment("CloudTrail owners") {
+		resolver := NewCloudTrailOwnerResolver(c.loadConfig)
+		defer resolver.Close()
+		chain = append(chain, resolver)
+	}
+	if len(c.opts.AccountOwners) > 0 {
+		chain = append(chain, AccountOwnerResolver{Owners: c.opts.AccountOwners, Account: c.opts.AccountID})
+	}
+
+	byRegion := map[string][]int{}
+	for i, entity := range entities {
+		byRegion[entity.Region] = append(byRegion[entity.Region], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, indexes := range byRegion {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range indexes {
+				entities[i].Owner, entities[i].OwnerSource = chain.Resolve(ctx, entities[i])
+				if entities[i].Owner == "" {
+					entities[i].Owner = OwnerUnknown
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// GroupByOwner aggregates the entities by owner, largest owner first.
+// Entities without an owner are grouped under OwnerUnknown.
+func GroupByOwner(entities []EntityUsage) []TagGroup {
+	byOwner := map[string]*TagGroup{}
+	for _, entity := range entities {
+		owner := entity.Owner
+		if owner == "" {
+			owner = OwnerUnknown
+		}
+
+		group, ok := byOwner[owner]
+		if !ok {
+			group = &TagGroup{Value: owner}
+			byOwner[owner] = group
+		}
+		group.Entities++
+		group.StorageUsed += entity.StorageUsed
+		group.MonthlyCostUSD += entity.MonthlyCostUSD
+	}
+
+	groups := make([]TagGroup, 0, len(byOwner))
+	for _, group := range byOwner {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].StorageUsed != groups[j].StorageUsed {
+			return groups[i].StorageUsed > groups[j].StorageUsed
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
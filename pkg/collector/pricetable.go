@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// bundledPrices is the price snapshot of --pricing static.
+//
+//go:embed prices.csv
+var bundledPrices []byte
+
+// anyRegion is the region of a price table row applying to the regions
+// without a row of their own.
+const anyRegion = "*"
+
+// PriceTable is a PricingProvider of fixed prices, keyed by region and kind,
+// which needs no access to the Pricing API.
+type PriceTable struct {
+	prices map[string]float64
+}
+
+// BundledPrices returns the price snapshot shipped with the binary. Its
+// prices are list prices at the time of the release and cover the common
+// regions only.
+func BundledPrices() (*PriceTable, error) {
+	return ReadPriceTable(bytes.NewReader(bundledPrices), "bundled prices")
+}
+
+// ReadPriceTable reads a CSV price table named name, for errors. The header
+// names the region, kind and price_usd columns, in any order; other columns
+// are ignored, as are blank lines and lines starting with #. A kind is a
+// volume type or a kind of PricingProvider, and region * prices it in the
+// regions without a row of their own.
+func ReadPriceTable(r io.Reader, name string) (*PriceTable, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid price file %s: no header", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid price file %s: %w", name, err)
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"region", "kind", "price_usd"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("invalid price file %s: the header has no %s column", name, column)
+		}
+	}
+
+	table := &PriceTable{prices: map[string]float64{}}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid price file %s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i := columns[column]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		region, kind := field("region"), field("kind")
+		if region == "" || kind == "" {
+			return nil, fmt.Errorf("invalid price file %s line %d: region and kind must be set", name, line)
+		}
+		price, err := strconv.ParseFloat(field("price_usd"), 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid price file %s line %d: invalid price_usd %q", name, line, field("price_usd"))
+		}
+
+		key := region + "/" + kind
+		if _, ok := table.prices[key]; ok {
+			return nil, fmt.Errorf("invalid price file %s line %d: %s is priced in %s already", name, line, kind, region)
+		}
+		table.prices[key] = price
+	}
+
+	if len(table.prices) == 0 {
+		return nil, fmt.Errorf("invalid price file %s: no prices", name)
+	}
+	return table, nil
+}
+
+// Price returns the price of the kind in the region, or that of region *.
+func (t *PriceTable) Price(_ context.Context, region, kind string) (float64, error) {
+	if price, ok := t.prices[region+"/"+kind]; ok {
+		return price, nil
+	}
+	if price, ok := t.prices[anyRegion+"/"+kind]; ok {
+		return price, nil
+	}
+	return 0, fmt.Errorf("no %s price for %s in the price table", kind, region)
+}
@@ -0,0 +1,388 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+)
+
+const (
+	// Prices older than this are still served but refreshed in the
+	// background.
+	pricingCacheTTL = 30 * 24 * time.Hour
+
+	// The Pricing API is only served from a few regions.
+	pricingRegion = "us-east-1"
+
+	snapshotPriceKey = "snapshot"
+	// Snapshot Archive storage per GB-month and restores per GB.
+	snapshotArchivePriceKey   = "snapshot-archive"
+	snapshotRetrievalPriceKey = "snapshot-archive-retrieval"
+)
+
+// PricingProvider resolves the USD price of a kind of storage in a region:
+// per GB-month for a volume type (its API name, e.g. gp3), "snapshot" and
+// "snapshot-archive", per GB restored for "snapshot-archive-retrieval".
+// Options.Pricing selects the provider; the Pricing API is used without one.
+type PricingProvider interface {
+	Price(ctx context.Context, region, kind string) (float64, error)
+}
+
+// snapshotUsageTypes are the usage type suffix and price unit of each
+// snapshot price key.
+var snapshotUsageTypes = map[string]struct{ suffix, unit string }{
+	snapshotPriceKey:          {"EBS:SnapshotUsage", "GB-Mo"},
+	snapshotArchivePriceKey:   {"EBS:SnapshotArchiveStorage", "GB-Mo"},
+	snapshotRetrievalPriceKey: {"EBS:SnapshotArchiveRetrieval", "GB"},
+}
+
+// cachedPrice is a per GB-month USD price as stored in the pricing cache.
+// Restores from the archive are priced per GB.
+type cachedPrice struct {
+	USDPerGBMonth float64
+	FetchedAt     time.Time
+}
+
+// priceBook is the PricingProvider of the Pricing API, keyed by region and
+// volume type (or snapshotPriceKey), backed by an optional on-disk pricing
+// cache. Stale prices are served immediately while they are refreshed in
+// the background.
+type priceBook struct {
+	mu         sync.Mutex
+	client     *pricing.Client
+	cacheFile  string
+	sealer     atrest.Sealer
+	prices     map[string]cachedPrice
+	dirty      bool
+	refreshing map[string]bool
+	oldest     time.Time // FetchedAt of the oldest price served
+	readOnly   bool      // Never write the cache
+}
+
+func newPriceBook(ctx context.Context, loadConfig ConfigLoader, cacheFile string, sealer atrest.Sealer) (*priceBook, error) {
+	cfg, err := loadConfig(ctx, pricingRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &priceBook{
+		client:     pricing.NewFromConfig(cfg),
+		cacheFile:  cacheFile,
+		sealer:     sealer,
+		prices:     map[string]cachedPrice{},
+		refreshing: map[string]bool{},
+	}
+
+	if cacheFile == "" {
+		return book, nil
+	}
+
+	data, err := atrest.ReadFile(sealer, cacheFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &book.prices); err != nil {
+			slog.Warn("ignoring unreadable pricing cache", "error", err)
+		}
+	}
+
+	return book, nil
+}
+
+func priceKey(region, kind string) string {
+	return region + "/" + kind
+}
+
+// Price returns the per GB-month price for a volume type or snapshots in the
+// given region. Only prices missing from the cache are fetched inline.
+func (b *priceBook) Price(ctx context.Context, region, kind string) (float64, error) {
+	key := priceKey(region, kind)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if cached, ok := b.prices[key]; ok {
+		if time.Since(cached.FetchedAt) >= pricingCacheTTL && !b.refreshing[key] {
+			b.refreshing[key] = true
+			go b.refresh(region, kind)
+		}
+		b.served(cached.FetchedAt)
+		return cached.USDPerGBMonth, nil
+	}
+
+	price, err := b.fetch(ctx, region, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	b.prices[key] = cachedPrice{USDPerGBMonth: price, FetchedAt: now}
+	b.dirty = true
+	b.served(now)
+
+	return price, nil
+}
+
+func (b *priceBook) served(fetchedAt time.Time) {
+	if b.oldest.IsZero() || fetchedAt.Before(b.oldest) {
+		b.oldest = fetchedAt
+	}
+}
+
+// age returns the age of the oldest price served, or 0 when none was.
+func (b *priceBook) age() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.oldest.IsZero() {
+		return 0
+	}
+	return time.Since(b.oldest)
+}
+
+func (b *priceBook) fetch(ctx context.Context, region, kind string) (float64, error) {
+	if _, ok := snapshotUsageTypes[kind]; ok {
+		return b.fetchSnapshotPrice(ctx, region, kind)
+	}
+	return b.fetchVolumePrice(ctx, region, kind)
+}
+
+// refresh replaces a stale price in the background and persists the cache.
+// Failures keep the stale price.
+func (b *priceBook) refresh(region, kind string) {
+	key := priceKey(region, kind)
+
+	price, err := b.fetch(context.Background(), region, kind)
+
+	b.mu.Lock()
+	delete(b.refreshing, key)
+	if err == nil {
+		b.prices[key] = cachedPrice{USDPerGBMonth: price, FetchedAt: time.Now()}
+		b.dirty = true
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		slog.Warn("failed to refresh price, keeping the cached one", "kind", kind, "region", region, "error", err)
+		return
+	}
+
+	if err := b.save(); err != nil {
+		slog.Error("failed to write pricing cache", "error", err)
+	}
+}
+
+func (b *priceBook) fetchVolumePrice(ctx context.Context, region, volumeType string) (float64, error) {
+	products, err := b.getProducts(ctx, map[string]string{
+		"productFamily": "Storage",
+		"volumeApiName": volumeType,
+		"regionCode":    region,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, product := range products {
+		if price, ok := gbMonthPrice(product); ok {
+			return price, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no price found for %s volumes in %s", volumeType, region)
+}
+
+func (b *priceBook) fetchSnapshotPrice(ctx context.Context, region, kind string) (float64, error) {
+	products, err := b.getProducts(ctx, map[string]string{
+		"productFamily": "Storage Snapshot",
+		"regionCode":    region,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	usage := snapshotUsageTypes[kind]
+	for _, product := range products {
+		if !strings.HasSuffix(product.Product.Attributes["usagetype"], usage.suffix) {
+			continue
+		}
+		if price, ok := unitPrice(product, usage.unit); ok {
+			return price, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no %s price found in %s", kind, region)
+}
+
+// priceListProduct is the subset of a Pricing API price list entry needed to
+// read an on-demand price.
+type priceListProduct struct {
+	Product struct {
+		Attributes map[string]string `json:"attributes"`
+	} `json:"product"`
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				Unit         string            `json:"unit"`
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+func (b *priceBook) getProducts(ctx context.Context, filters map[string]string) ([]priceListProduct, error) {
+	input := &pricing.GetProductsInput{ServiceCode: aws.String("AmazonEC2")}
+	for field, value := range filters {
+		input.Filters = append(input.Filters, pricingtypes.Filter{
+			Field: aws.String(field),
+			Type:  pricingtypes.FilterTypeTermMatch,
+			Value: aws.String(value),
+		})
+	}
+
+	var products []priceListProduct
+
+	paginator := pricing.NewGetProductsPaginator(b.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.PriceList {
+			var product priceListProduct
+			if err := json.Unmarshal([]byte(item), &product); err != nil {
+				return nil, err
+			}
+			products = append(products, product)
+		}
+	}
+
+	return products, nil
+}
+
+func gbMonthPrice(product priceListProduct) (float64, bool) {
+	return unitPrice(product, "GB-Mo")
+}
+
+// unitPrice returns the on-demand USD price of a product per unit.
+func unitPrice(product priceListProduct, unit string) (float64, bool) {
+	for _, term := range product.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			if dimension.Unit != unit {
+				continue
+			}
+			price, err := strconv.ParseFloat(dimension.PricePerUnit["USD"], 64)
+			if err == nil {
+				return price, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// save persists newly fetched prices to the pricing cache.
+func (b *priceBook) save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.dirty || b.cacheFile == "" || b.readOnly {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(b.prices, "", "  ")
+	if err != nil {
+		return err
+	}
+	b.dirty = false
+
+	return atrest.WriteFile(b.sealer, b.cacheFile, data, 0o644)
+}
+
+// PriceKind returns the price type of an entity, or "" when it is not
+// priced.
+func PriceKind(entity EntityUsage) string {
+	switch entity.Type {
+	case EntityTypeVolume:
+		return entity.VolumeType
+	case EntityTypeSnapshot:
+		return snapshotPriceKey
+	}
+	return ""
+}
+
+// pricing returns Options.Pricing, or a price book of the Pricing API
+// without one.
+func (c *StorageCollector) pricing(ctx context.Context) (PricingProvider, error) {
+	if c.opts.Pricing != nil {
+		return c.opts.Pricing, nil
+	}
+
+	book, err := newPriceBook(ctx, c.loadConfig, c.opts.PriceCacheFile, c.opts.Sealer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pricing client: %w", err)
+	}
+	book.readOnly = c.opts.DryRun
+	return book, nil
+}
+
+// savePrices writes the prices a price book of the Pricing API fetched to
+// its cache.
+func savePrices(prices PricingProvider) {
+	book, ok := prices.(*priceBook)
+	if !ok {
+		return
+	}
+	if err := book.save(); err != nil {
+		slog.Error("failed to write pricing cache", "error", err)
+	}
+}
+
+// estimateCosts fills MonthlyCostUSD for every volume and snapshot. Only the
+// storage component is priced; provisioned IOPS and throughput are not.
+func (c *StorageCollector) estimateCosts(ctx context.Context, report *Report) error {
+	prices, err := c.pricing(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range report.Entities {
+		entity := &report.Entities[i]
+
+		kind := PriceKind(*entity)
+		if kind == "" {
+			continue
+		}
+
+		price, err := prices.Price(ctx, entity.Region, kind)
+		if err != nil {
+			slog.Error("failed to look up price", "kind", kind, "region", entity.Region, "error", err)
+			continue
+		}
+
+		entity.MonthlyCostUSD = price * float64(entity.StorageUsed) / gib
+	}
+	report.CostEstimated = true
+	if book, ok := prices.(*priceBook); ok {
+		if age := book.age(); age > 0 {
+			report.SetCacheAge(CachePricing, age)
+		}
+	}
+	savePrices(prices)
+
+	return nil
+}
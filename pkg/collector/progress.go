@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Operations in flight on an entity, see EntityUsage.PendingOperation.
+const (
+	OperationSnapshot   = "snapshot"   // A snapshot still being taken
+	OperationModifying  = "modifying"  // A volume being modified
+	OperationOptimizing = "optimizing" // A modified volume being optimized, usable but slower
+)
+
+// PendingOperation returns the operation in flight on the entity, "" when
+// its size and state are final.
+func (e EntityUsage) PendingOperation() string {
+	switch {
+	case e.Progress != nil:
+		return OperationSnapshot
+	case e.Modification != nil:
+		return e.Modification.State
+	}
+	return ""
+}
+
+// PendingProgress returns the percent complete of the operation in flight
+// on the entity.
+func (e EntityUsage) PendingProgress() float64 {
+	switch {
+	case e.Progress != nil:
+		return *e.Progress
+	case e.Modification != nil:
+		return e.Modification.Progress
+	}
+	return 0
+}
+
+// VolumeModification is an in-progress change of a volume's size, type or
+// performance.
+type VolumeModification struct {
+	State            string  // "modifying" or "optimizing"
+	Progress         float64 // Percent complete
+	TargetVolumeType string
+	TargetSize       int64 // Bytes
+	StartTime        time.Time
+}
+
+// getVolumeModifications returns the volume modifications still in progress
+// in a region by volume ID, limited to volumeIDs when given. Completed and failed modifications are filtered
+// out by the API, so the pages stay small even for accounts that modify
+// volumes often.
+func getVolumeModifications(ctx context.Context, client EC2DescribeAPI, region string, volumeIDs []string) map[string]VolumeModification {
+	modifications := map[string]VolumeModification{}
+
+	batches := [][]string{nil}
+	if len(volumeIDs) > 0 {
+		batches = idBatches(volumeIDs)
+	}
+
+	for _, batch := range batches {
+		filters := []types.Filter{{
+			Name:   aws.String("modification-state"),
+			Values: []string{string(types.VolumeModificationStateModifying), string(types.VolumeModificationStateOptimizing)},
+		}}
+		if batch != nil {
+			filters = append(filters, types.Filter{Name: aws.String("volume-id"), Values: batch})
+		}
+
+		paginator := ec2.NewDescribeVolumesModificationsPaginator(client, &ec2.DescribeVolumesModificationsInput{Filters: filters})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.Error("failed to describe volume modifications", "region", region, "error", err)
+				return modifications
+			}
+			for _, m := range page.VolumesModifications {
+				modifications[aws.ToString(m.VolumeId)] = VolumeModification{
+					State:            string(m.ModificationState),
+					Progress:         float64(aws.ToInt64(m.Progress)),
+					TargetVolumeType: string(m.TargetVolumeType),
+					TargetSize:       int64(aws.ToInt32(m.TargetSize)) * 1024 * 1024 * 1024,
+					StartTime:        aws.ToTime(m.StartTime),
+				}
+			}
+		}
+	}
+
+	return modifications
+}
+
+// snapshotProgress parses the progress of a pending snapshot, e.g. "45%".
+// It returns nil for snapshots that are not pending.
+func snapshotProgress(snapshot types.Snapshot) *float64 {
+	if snapshot.State != types.SnapshotStatePending {
+		return nil
+	}
+	progress, err := strconv.ParseFloat(strings.TrimSuffix(aws.ToString(snapshot.Progress), "%"), 64)
+	if err != nil {
+		progress = 0
+	}
+	return &progress
+}
+
+// EstimatedRemaining extrapolates the time a job started at started needs
+// to finish from its progress at now, assuming a constant rate. It returns
+// false before the job made any progress.
+func EstimatedRemaining(started time.Time, progress float64, now time.Time) (time.Duration, bool) {
+	if progress <= 0 || started.IsZero() {
+		return 0, false
+	}
+	if progress >= 100 {
+		return 0, true
+	}
+	elapsed := now.Sub(started)
+	return time.Duration(float64(elapsed) * (100 - progress) / progress), true
+}
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+// ebsQuota is an EBS service quota and how the entities of the scanned
+// service of a region use it.
+type ebsQuota struct {
+	code, name, unit, service string
+	usage                     func(entity EntityUsage) float64
+}
+
+// volumeStorage returns the usage of a per volume type storage quota,
+// which is in TiB.
+func volumeStorage(volumeType string) func(entity EntityUsage) float64 {
+	return func(entity EntityUsage) float64 {
+		if entity.Type != EntityTypeVolume || entity.VolumeType != volumeType {
+			return 0
+		}
+		return float64(entity.StorageUsed) / (1024 * gib)
+	}
+}
+
+// ebsQuotas are the quotas Options.Quotas reads.
+var ebsQuotas = []ebsQuota{
+	{"L-309BACF6", "Snapshots", "snapshots", ServiceSnapshots, func(entity EntityUsage) float64 {
+		if entity.Type == EntityTypeSnapshot {
+			return 1
+		}
+		return 0
+	}},
+	{"L-D18FCD1D", "gp2 Storage", "TiB", ServiceEBS, volumeStorage("gp2")},
+	{"L-7A658B76", "gp3 Storage", "TiB", ServiceEBS, volumeStorage("gp3")},
+	{"L-FD252861", "io1 Storage", "TiB", ServiceEBS, volumeStorage("io1")},
+	{"L-09BD8365", "io2 Storage", "TiB", ServiceEBS, volumeStorage("io2")},
+	{"L-82ACEF56", "st1 Storage", "TiB", ServiceEBS, volumeStorage("st1")},
+	{"L-17AF77E8", "sc1 Storage", "TiB", ServiceEBS, volumeStorage("sc1")},
+}
+
+// QuotaUsage is how much of a service quota of a region the scanned
+// entities use. Usage only counts the entities in the report, so filters
+// narrowing the scan understate it.
+type QuotaUsage struct {
+	Region    string
+	AccountID string
+	Profile   string
+	Code      string // Service Quotas quota code, e.g. L-7A658B76
+	Name      string
+	Unit      string
+	Usage     float64
+	Quota     float64
+	Applied   bool // The quota was raised from the AWS default
+}
+
+// Utilization is the used share of the quota.
+func (q QuotaUsage) Utilization() float64 {
+	if q.Quota <= 0 {
+		return 0
+	}
+	return q.Usage / q.Quota
+}
+
+// listServiceQuotas returns the values of the EBS quotas of a region by
+// quota code, the applied values or, with defaults, the AWS defaults.
+func listServiceQuotas(ctx context.Context, client *servicequotas.Client, defaults bool) (map[string]float64, error) {
+	values := map[string]float64{}
+	add := func(quotas []types.ServiceQuota) {
+		for _, quota := range quotas {
+			values[aws.ToString(quota.QuotaCode)] = aws.ToFloat64(quota.Value)
+		}
+	}
+
+	if defaults {
+		paginator := servicequotas.NewListAWSDefaultServiceQuotasPaginator(client, &servicequotas.ListAWSDefaultServiceQuotasInput{
+			ServiceCode: aws.String("ebs"),
+			MaxResults:  aws.Int32(100),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			add(page.Quotas)
+		}
+		return values, nil
+	}
+
+	paginator := servicequotas.NewListServiceQuotasPaginator(client, &servicequotas.ListServiceQuotasInput{
+		ServiceCode: aws.String("ebs"),
+		MaxResults:  aws.Int32(100),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		add(page.Quotas)
+	}
+	return values, nil
+}
+
+// quotaUsages reads the EBS quotas of every region of the report and
+// compares them with the usage of its entities, most utilized first.
+// Regions whose quotas cannot be read are logged and left out.
+func (c *StorageCollector) quotaUsages(ctx context.Context, report *Report) []QuotaUsage {
+	byRegion := map[string][]EntityUsage{}
+	for _, entity := range report.Entities {
+		byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+	}
+
+	var usages []QuotaUsage
+	for _, region := range report.RegionsScanned() {
+		cfg, err := c.loadConfig(ctx, region)
+		if err != nil {
+			slog.Warn("failed to read service quotas", "region", region, "error", err)
+			continue
+		}
+		client := servicequotas.NewFromConfig(cfg)
+
+		defaults, err := listServiceQuotas(ctx, client, true)
+		if err != nil {
+			slog.Warn("failed to read service quotas", "region", region, "error", err)
+			continue
+		}
+		applied, err := listServiceQuotas(ctx, client, false)
+		if err != nil {
+			slog.Warn("failed to read applied service quotas, using the defaults", "region", region, "error", err)
+		}
+
+		for _, quota := range ebsQuotas {
+			if !c.enabled(quota.service) {
+				continue
+			}
+			usage := QuotaUsage{
+				Region:    region,
+				AccountID: c.opts.AccountID,
+				Profile:   c.opts.Profile,
+				Code:      quota.code,
+				Name:      quota.name,
+				Unit:      quota.unit,
+			}
+			value, ok := applied[quota.code]
+			if ok {
+				usage.Applied = value != defaults[quota.code]
+			} else if value, ok = defaults[quota.code]; !ok {
+				continue
+			}
+			usage.Quota = value
+			for _, entity := range byRegion[region] {
+				usage.Usage += quota.usage(entity)
+			}
+			usages = append(usages, usage)
+		}
+	}
+
+	SortQuotaUsages(usages)
+	return usages
+}
+
+// SortQuotaUsages sorts quota usages most utilized first.
+func SortQuotaUsages(usages []QuotaUsage) {
+	sort.SliceStable(usages, func(i, j int) bool {
+		if usages[i].Utilization() != usages[j].Utilization() {
+			return usages[i].Utilization() > usages[j].Utilization()
+		}
+		if usages[i].Region != usages[j].Region {
+			return usages[i].Region < usages[j].Region
+		}
+		return usages[i].Code < usages[j].Code
+	})
+}
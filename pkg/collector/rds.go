@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+func (c *StorageCollector) getRDSStorageUsed(ctx context.Context, client *rds.Client, cw *cloudwatch.Client, region string) []EntityUsage {
+	slog.Debug("querying DB instances", "region", region)
+
+	var databases []EntityUsage
+
+	instances := rds.NewDescribeDBInstancesPaginator(client, &rds.DescribeDBInstancesInput{})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe DB instances", "region", region, "error", err)
+			break
+		}
+
+		for _, instance := range page.DBInstances {
+			engine := aws.ToString(instance.Engine)
+
+			// Aurora storage belongs to the cluster, not to its instances.
+			if strings.HasPrefix(engine, "aurora") {
+				continue
+			}
+
+			entity := EntityUsage{
+				ID:               aws.ToString(instance.DBInstanceIdentifier),
+				Region:           region,
+				Type:             EntityTypeDBInstance,
+				Engine:           engine,
+				AllocatedStorage: int64(aws.ToInt32(instance.AllocatedStorage)) * gib,
+			}
+			entity.StorageUsed = entity.AllocatedStorage
+
+			free, ok, err := getLatestRDSMetric(ctx, cw, "FreeStorageSpace", "DBInstanceIdentifier", entity.ID)
+			if err != nil {
+				slog.Error("failed to read FreeStorageSpace", "region", region, "id", entity.ID, "error", err)
+			} else if ok && int64(free) <= entity.AllocatedStorage {
+				entity.StorageUsed = entity.AllocatedStorage - int64(free)
+			}
+
+			databases = append(databases, entity)
+		}
+	}
+
+	slog.Debug("querying DB clusters", "region", region)
+
+	clusters := rds.NewDescribeDBClustersPaginator(client, &rds.DescribeDBClustersInput{})
+	for clusters.HasMorePages() {
+		page, err := clusters.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe DB clusters", "region", region, "error", err)
+			break
+		}
+
+		for _, cluster := range page.DBClusters {
+			engine := aws.ToString(cluster.Engine)
+			if !strings.HasPrefix(engine, "aurora") {
+				// Multi-AZ DB clusters report their storage on the member instances.
+				continue
+			}
+
+			entity := EntityUsage{
+				ID:     aws.ToString(cluster.DBClusterIdentifier),
+				Region: region,
+				Type:   EntityTypeDBCluster,
+				Engine: engine,
+			}
+
+			used, ok, err := getLatestRDSMetric(ctx, cw, "VolumeBytesUsed", "DBClusterIdentifier", entity.ID)
+			if err != nil {
+				slog.Error("failed to read VolumeBytesUsed", "region", region, "id", entity.ID, "error", err)
+			} else if ok {
+				entity.StorageUsed = int64(used)
+			}
+			// Aurora storage grows on demand, so what is used is what is allocated.
+			entity.AllocatedStorage = entity.StorageUsed
+
+			databases = append(databases, entity)
+		}
+	}
+
+	return c.scoped(region, databases)
+}
+
+func getLatestRDSMetric(ctx context.Context, cw *cloudwatch.Client, name, dimension, id string) (float64, bool, error) {
+	return getLatestMetricAverage(ctx, cw, "AWS/RDS", name, []cwtypes.Dimension{
+		{Name: aws.String(dimension), Value: aws.String(id)},
+	}, time.Hour, 300)
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/backup"
+)
+
+// getRecoveryPointStorageUsed reports the backup size of every recovery
+// point in the AWS Backup vaults of a region.
+func (c *StorageCollector) getRecoveryPointStorageUsed(ctx context.Context, client *backup.Client, region string) []EntityUsage {
+	slog.Debug("querying backup vaults", "region", region)
+
+	var vaults []string
+
+	vaultPaginator := backup.NewListBackupVaultsPaginator(client, &backup.ListBackupVaultsInput{})
+	for vaultPaginator.HasMorePages() {
+		page, err := vaultPaginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to list backup vaults", "region", region, "error", err)
+			return nil
+		}
+		for _, vault := range page.BackupVaultList {
+			vaults = append(vaults, aws.ToString(vault.BackupVaultName))
+		}
+	}
+
+	var recoveryPoints []EntityUsage
+
+	for _, vault := range vaults {
+		paginator := backup.NewListRecoveryPointsByBackupVaultPaginator(client, &backup.ListRecoveryPointsByBackupVaultInput{
+			BackupVaultName: aws.String(vault),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.Error("failed to list recovery points", "region", region, "vault", vault, "error", err)
+				break
+			}
+
+			for _, point := range page.RecoveryPoints {
+				entity := EntityUsage{
+					ID:               aws.ToString(point.RecoveryPointArn),
+					StorageUsed:      aws.ToInt64(point.BackupSizeInBytes),
+					Region:           region,
+					Type:             EntityTypeRecoveryPoint,
+					AttachedInstance: aws.ToString(point.ResourceName),
+					BackupVault:      vault,
+					ResourceType:     aws.ToString(point.ResourceType),
+					CreateTime:       aws.ToTime(point.CreationDate),
+					State:            string(point.Status),
+				}
+				if entity.AttachedInstance == "" {
+					entity.AttachedInstance = aws.ToString(point.ResourceArn)
+				}
+
+				recoveryPoints = append(recoveryPoints, entity)
+			}
+		}
+	}
+
+	return c.scoped(region, recoveryPoints)
+}
+
+// BackupUsage is the recovery point storage of a backup vault, resource
+// type or region.
+type BackupUsage struct {
+	Value          string // Vault name, resource type or region
+	Region         string // Empty for the per-region usage
+	RecoveryPoints int
+	StorageUsed    int64
+}
+
+// BackupSummary is the recovery point storage of a report, largest first.
+type BackupSummary struct {
+	ByVault        []BackupUsage
+	ByResourceType []BackupUsage
+	ByRegion       []BackupUsage
+}
+
+// SummarizeBackups sums the recovery points of the entities by vault and by
+// resource type in each region, and by region.
+func SummarizeBackups(entities []EntityUsage) BackupSummary {
+	type key struct{ value, region string }
+	vaults := map[key]*BackupUsage{}
+	resourceTypes := map[key]*BackupUsage{}
+	regions := map[key]*BackupUsage{}
+
+	add := func(usages map[key]*BackupUsage, k key, entity EntityUsage) {
+		usage, ok := usages[k]
+		if !ok {
+			usage = &BackupUsage{Value: k.value, Region: k.region}
+			usages[k] = usage
+		}
+		usage.RecoveryPoints++
+		usage.StorageUsed += entity.StorageUsed
+	}
+
+	for _, entity := range entities {
+		if entity.Type != EntityTypeRecoveryPoint {
+			continue
+		}
+		add(vaults, key{entity.BackupVault, entity.Region}, entity)
+		add(resourceTypes, key{entity.ResourceType, entity.Region}, entity)
+		add(regions, key{value: entity.Region}, entity)
+	}
+
+	sorted := func(usages map[key]*BackupUsage) []BackupUsage {
+		list := make([]BackupUsage, 0, len(usages))
+		for _, usage := range usages {
+			list = append(list, *usage)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].StorageUsed != list[j].StorageUsed {
+				return list[i].StorageUsed > list[j].StorageUsed
+			}
+			if list[i].Value != list[j].Value {
+				return list[i].Value < list[j].Value
+			}
+			return list[i].Region < list[j].Region
+		})
+		return list
+	}
+
+	return BackupSummary{
+		ByVault:        sorted(vaults),
+		ByResourceType: sorted(resourceTypes),
+		ByRegion:       sorted(regions),
+	}
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+)
+
+// getRedshiftStorageUsed reports the storage capacity of every provisioned
+// Redshift cluster and the share of it in use, read from the
+// PercentageDiskSpaceUsed metric. Without a recent data point the capacity
+// is reported as used.
+func (c *StorageCollector) getRedshiftStorageUsed(ctx context.Context, client *redshift.Client, cw *cloudwatch.Client, region string) []EntityUsage {
+	slog.Debug("querying Redshift clusters", "region", region)
+
+	var clusters []EntityUsage
+
+	paginator := redshift.NewDescribeClustersPaginator(client, &redshift.DescribeClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Error("failed to describe Redshift clusters", "region", region, "error", err)
+			break
+		}
+
+		for _, cluster := range page.Clusters {
+			entity := EntityUsage{
+				ID:               aws.ToString(cluster.ClusterIdentifier),
+				Region:           region,
+				Type:             EntityTypeRedshiftCluster,
+				Engine:           aws.ToString(cluster.NodeType),
+				State:            aws.ToString(cluster.ClusterStatus),
+				AllocatedStorage: aws.ToInt64(cluster.TotalStorageCapacityInMegaBytes) << 20,
+				Tags:             map[string]string{},
+			}
+			entity.StorageUsed = entity.AllocatedStorage
+			for _, tag := range cluster.Tags {
+				entity.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			entity.AttachedInstance = entity.Tags["Name"]
+
+			percent, ok, err := getLatestMetricAverage(ctx, cw, "AWS/Redshift", "PercentageDiskSpaceUsed", []cwtypes.Dimension{
+				{Name: aws.String("ClusterIdentifier"), Value: aws.String(entity.ID)},
+			}, time.Hour, 300)
+			if err != nil {
+				slog.Error("failed to read PercentageDiskSpaceUsed", "region", region, "id", entity.ID, "error", err)
+			} else if ok && percent >= 0 && percent <= 100 {
+				entity.StorageUsed = int64(float64(entity.AllocatedStorage) * percent / 100)
+			}
+
+			clusters = append(clusters, entity)
+		}
+	}
+
+	return c.scoped(region, clusters)
+}
@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/backup"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/fsx"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+)
+
+// GlobalRegion is the RegionSummary region of global services such as S3.
+const GlobalRegion = "global"
+
+// RegionSummary totals what a scan found in one region.
+type RegionSummary struct {
+	Region      string
+	Entities    int
+	StorageUsed int64
+	Duration    time.Duration
+}
+
+func summarize(region string, entities []EntityUsage, started time.Time) RegionSummary {
+	summary := RegionSummary{
+		Region:   region,
+		Entities: len(entities),
+		Duration: time.Since(started),
+	}
+	for _, entity := range entities {
+		summary.StorageUsed += entity.StorageUsed
+	}
+	return summary
+}
+
+// FailedRegion is a region left out of a report.
+type FailedRegion struct {
+	Region    string
+	Profile   string // Set like EntityUsage.Profile
+	AccountID string // Set like EntityUsage.AccountID
+	Reason    string
+	Duration  time.Duration
+}
+
+// failRegion records a region left out of the report.
+func (c *StorageCollector) failRegion(region, reason string, started time.Time) {
+	c.countRegionError(region)
+
+	c.entityMutex.Lock()
+	defer c.entityMutex.Unlock()
+	c.failedRegions = append(c.failedRegions, FailedRegion{Region: region, Reason: reason, Duration: time.Since(started)})
+}
+
+// addRegion merges the entities of a completed region and reports its
+// summary, returning the entities kept. Workers never touch the shared
+// totals; each region's sum is merged here once its workers are done.
+func (c *StorageCollector) addRegion(region string, entities []EntityUsage, started time.Time) []EntityUsage {
+	entities = c.tagFiltered(entities)
+	summary := summarize(region, entities, started)
+	slog.Info("region scanned", "region", summary.Region, "entities", summary.Entities,
+		"storage_used", summary.StorageUsed, "duration", summary.Duration)
+	c.mergeRegion(summary, entities)
+	return entities
+}
+
+// restoreRegion merges the entities of a region completed by an
+// interrupted earlier scan.
+func (c *StorageCollector) restoreRegion(region string, entities []EntityUsage) {
+	summary := summarize(region, entities, time.Now())
+	slog.Info("region restored from checkpoint", "region", summary.Region, "entities", summary.Entities,
+		"storage_used", summary.StorageUsed)
+	c.mergeRegion(summary, entities)
+}
+
+func (c *StorageCollector) mergeRegion(summary RegionSummary, entities []EntityUsage) {
+	c.entityMutex.Lock()
+	c.entities = append(c.entities, entities...)
+	c.regions = append(c.regions, summary)
+	c.totalStorageUsed += summary.StorageUsed
+	c.entityMutex.Unlock()
+
+	if c.opts.OnRegionComplete != nil {
+		c.opts.OnRegionComplete(summary)
+	}
+}
+
+// scanJob is one unit of a scan: one service in one region.
+type scanJob struct {
+	region  string
+	service string
+}
+
+// JobSummary reports a finished scan job.
+type JobSummary struct {
+	Region   string
+	Service  string
+	Entities int
+	Duration time.Duration
+	TimedOut bool
+	// Done counts the finished jobs of the scan, out of Total.
+	Done  int
+	Total int
+}
+
+// regionScan collects the results of the jobs of one region. The worker
+// finishing its last job adds the region.
+type regionScan struct {
+	started time.Time
+	pending int
+
+	once   sync.Once
+	ctx    context.Context // Bounded by Options.RegionTimeout
+	cancel context.CancelFunc
+	cfg    aws.Config
+	cfgErr error
+
+	mu    sync.Mutex
+	found []EntityUsage
+}
+
+// regionalServices are the per-region services, in job order.
+var regionalServices = []string{ServiceEBS, ServiceSnapshots, ServiceRDS, ServiceEFS, ServiceFSx, ServiceBackup, ServiceDynamoDB, ServiceRedshift, ServiceElastiCache}
+
+// scanRegions collects the enabled regional services of every region with a
+// pool of Options.Concurrency workers. Each job is one service in one region
+// and runs with its own Options.JobTimeout, and all jobs of a region within
+// Options.RegionTimeout; clients are only created by the workers, so the pool
+// bounds them too.
+func (c *StorageCollector) scanRegions(ctx context.Context) {
+	var jobs []scanJob
+	regions := map[string]*regionScan{}
+	for _, region := range c.opts.Regions {
+		if entities, ok := c.opts.Checkpoint.completed(c.checkpointKey(region)); ok {
+			c.restoreRegion(region, entities)
+			continue
+		}
+		for _, service := range regionalServices {
+			if c.enabled(service) {
+				jobs = append(jobs, scanJob{region: region, service: service})
+			}
+		}
+		regions[region] = &regionScan{started: time.Now()}
+	}
+	for _, job := range jobs {
+		regions[job.region].pending++
+	}
+
+	queue := make(chan scanJob)
+	var wg sync.WaitGroup
+	var progress sync.Mutex
+	done := 0
+
+	for range min(c.opts.Concurrency, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				scan := regions[job.region]
+				summary := c.runJob(ctx, job, scan)
+
+				progress.Lock()
+				done++
+				summary.Done, summary.Total = done, len(jobs)
+				progress.Unlock()
+
+				slog.Debug("scan job complete", "region", summary.Region, "service", summary.Service,
+					"entities", summary.Entities, "duration", summary.Duration, "done", summary.Done, "total", summary.Total)
+				if c.opts.OnJobComplete != nil {
+					c.opts.OnJobComplete(summary)
+				}
+
+				scan.mu.Lock()
+				scan.pending--
+				last := scan.pending == 0
+				scan.mu.Unlock()
+				if last {
+					c.finishRegion(ctx, job.region, scan)
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// runJob queries one service of a region within the job timeout and adds
+// what it found to the region.
+func (c *StorageCollector) runJob(ctx context.Context, job scanJob, scan *regionScan) JobSummary {
+	started := time.Now()
+	summary := JobSummary{Region: job.region, Service: job.service}
+
+	scan.once.Do(func() {
+		scan.ctx, scan.cancel = ctx, func() {}
+		if c.opts.RegionTimeout > 0 {
+			scan.ctx, scan.cancel = context.WithTimeout(ctx, c.opts.RegionTimeout)
+		}
+
+		scan.cfg, scan.cfgErr = c.loadConfig(scan.ctx, job.region)
+		if scan.cfgErr != nil {
+			slog.Error("failed to create clients", "region", job.region, "error", scan.cfgErr)
+		}
+	})
+	if scan.cfgErr != nil || scan.ctx.Err() != nil {
+		summary.Duration = time.Since(started)
+		return summary
+	}
+
+	jobCtx := scan.ctx
+	if c.opts.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(scan.ctx, c.opts.JobTimeout)
+		defer cancel()
+	}
+
+	entities := c.queryService(jobCtx, job, scan.cfg)
+	if errors.Is(scan.ctx.Err(), context.DeadlineExceeded) {
+		summary.TimedOut = true
+	} else if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+		summary.TimedOut = true
+		c.countRegionError(job.region)
+		slog.Warn("scan job timed out", "region", job.region, "service", job.service, "timeout", c.opts.JobTimeout)
+	}
+
+	scan.mu.Lock()
+	scan.found = append(scan.found, entities...)
+	scan.mu.Unlock()
+
+	summary.Entities = len(entities)
+	summary.Duration = time.Since(started)
+	return summary
+}
+
+func (c *StorageCollector) queryService(ctx context.Context, job scanJob, cfg aws.Config) []EntityUsage {
+	switch job.service {
+	case ServiceEBS:
+		return c.getEBSStorageUsed(ctx, c.regionEC2Client(job.region, cfg), job.region)
+	case ServiceSnapshots:
+		return c.getSnapshotStorageUsed(ctx, c.regionEC2Client(job.region, cfg), job.region)
+	case ServiceRDS:
+		return c.getRDSStorageUsed(ctx, rds.NewFromConfig(cfg), cloudwatch.NewFromConfig(cfg), job.region)
+	case ServiceEFS:
+		return c.getEFSStorageUsed(ctx, efs.NewFromConfig(cfg), job.region)
+	case ServiceFSx:
+		return c.getFSxStorageUsed(ctx, fsx.NewFromConfig(cfg), job.region)
+	case ServiceBackup:
+		return c.getRecoveryPointStorageUsed(ctx, backup.NewFromConfig(cfg), job.region)
+	case ServiceDynamoDB:
+		return c.getDynamoDBStorageUsed(ctx, dynamodb.NewFromConfig(cfg), job.region)
+	case ServiceRedshift:
+		return c.getRedshiftStorageUsed(ctx, redshift.NewFromConfig(cfg), cloudwatch.NewFromConfig(cfg), job.region)
+	case ServiceElastiCache:
+		return c.getElastiCacheStorageUsed(ctx, elasticache.NewFromConfig(cfg), job.region)
+	}
+	return nil
+}
+
+// finishRegion measures and classifies what the jobs of a region found and
+// adds the region. Regions whose clients could not be created or that ran out
+// of Options.RegionTimeout are recorded as failed instead.
+func (c *StorageCollector) finishRegion(ctx context.Context, region string, scan *regionScan) {
+	defer scan.cancel()
+
+	if scan.cfgErr == nil && c.opts.AccurateSnapshotSize && !c.skipEnrichment("snapshot sizes") {
+		c.measureSnapshots(scan.ctx, ebs.NewFromConfig(scan.cfg), scan.found)
+	}
+	if scan.cfgErr == nil && c.opts.ClassifyAccess && c.enabled(ServiceEBS) && !c.skipEnrichment("access classes") {
+		c.classifyVolumes(scan.ctx, cloudwatch.NewFromConfig(scan.cfg), scan.found, time.Now())
+	}
+
+	switch {
+	case errors.Is(scan.ctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		slog.Warn("region timed out", "region", region, "timeout", c.opts.RegionTimeout, "entities_dropped", len(scan.found))
+		c.failRegion(region, fmt.Sprintf("timed out after %s", c.opts.RegionTimeout), scan.started)
+	case scan.cfgErr != nil:
+		c.failRegion(region, fmt.Sprintf("failed to create clients: %v", scan.cfgErr), scan.started)
+	default:
+		entities := c.addRegion(region, scan.found, scan.started)
+		if ctx.Err() == nil && c.regionErrorCount(region) == 0 {
+			c.opts.Checkpoint.complete(c.checkpointKey(region), entities)
+		}
+	}
+}
+
+// checkpointKey identifies a region of the scanned account in
+// Options.Checkpoint, which the scans of several accounts may share.
+func (c *StorageCollector) checkpointKey(region string) string {
+	return c.opts.AccountID + "/" + c.opts.Profile + "/" + region
+}
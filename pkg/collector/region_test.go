@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAddRegionConcurrently merges many regions at once, as the region
+// workers of a scan do, which the race detector checks, and compares the
+// totals with the sum of what each region found.
+func TestAddRegionConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	completed := map[string]RegionSummary{}
+	c := New(Options{OnRegionComplete: func(summary RegionSummary) {
+		mu.Lock()
+		completed[summary.Region] = summary
+		mu.Unlock()
+	}})
+
+	const regions = 40
+	var wantEntities int
+	var wantTotal int64
+	var wg sync.WaitGroup
+	for i := range regions {
+		var entities []EntityUsage
+		for j := range i%5 + 1 {
+			entities = append(entities, EntityUsage{
+				ID:          fmt.Sprintf("vol-%d-%d", i, j),
+				Type:        EntityTypeVolume,
+				StorageUsed: int64(i+j+1) << 30,
+			})
+			wantTotal += int64(i+j+1) << 30
+		}
+		wantEntities += len(entities)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.addRegion(fmt.Sprintf("test-region-%d", i), entities, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	if c.totalStorageUsed != wantTotal {
+		t.Errorf("totalStorageUsed = %d, want %d", c.totalStorageUsed, wantTotal)
+	}
+	if len(c.entities) != wantEntities {
+		t.Errorf("%d entities, want %d", len(c.entities), wantEntities)
+	}
+	if len(c.regions) != regions || len(completed) != regions {
+		t.Errorf("%d regions merged and %d reported, want %d", len(c.regions), len(completed), regions)
+	}
+	for _, summary := range c.regions {
+		if got := completed[summary.Region]; got.Entities != summary.Entities || got.StorageUsed != summary.StorageUsed {
+			t.Errorf("region %s reported %d entities using %d bytes, merged %d using %d",
+				summary.Region, got.Entities, got.StorageUsed, summary.Entities, summary.StorageUsed)
+		}
+	}
+}
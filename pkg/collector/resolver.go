@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultNameLookupConcurrency bounds the concurrent batches of name and
+// instance lookups of a scan.
+const DefaultNameLookupConcurrency = 4
+
+// resolver deduplicates the lookups of resource IDs by the region workers
+// of a scan: an ID already resolved is answered from memory, and one being
+// looked up by another worker is waited for instead of looked up again. The
+// remaining IDs are fetched in batches of nameLookupBatch, at most
+// len(slots) batches at a time across the scan.
+type resolver[T any] struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	resolved map[string]*resolution[T] // By nameCacheKey
+}
+
+// resolution is the lookup of an ID, done once the fetch of its batch
+// returned.
+type resolution[T any] struct {
+	done  chan struct{}
+	value T
+	found bool
+}
+
+func newResolver[T any](concurrency int) *resolver[T] {
+	return &resolver[T]{
+		slots:    make(chan struct{}, concurrency),
+		resolved: map[string]*resolution[T]{},
+	}
+}
+
+// resolve returns the values fetch finds for the IDs of a region. Like
+// fetch, it leaves out the IDs without a value. IDs of a failed batch that
+// fetch did not find are forgotten, so that a later lookup retries them.
+func (r *resolver[T]) resolve(ctx context.Context, region string, ids []string, fetch func(context.Context, []string) (map[string]T, error)) map[string]T {
+	var missing []string
+	waits := map[string]*resolution[T]{}
+
+	r.mu.Lock()
+	for _, id := range ids {
+		if _, ok := waits[id]; ok || id == "" {
+			continue
+		}
+		res, ok := r.resolved[nameCacheKey(region, id)]
+		if !ok {
+			res = &resolution[T]{done: make(chan struct{})}
+			r.resolved[nameCacheKey(region, id)] = res
+			missing = append(missing, id)
+		}
+		waits[id] = res
+	}
+	r.mu.Unlock()
+
+	for _, batch := range idBatches(missing) {
+		go func(batch []string) {
+			select {
+			case r.slots <- struct{}{}: // Acquire a lookup slot
+			case <-ctx.Done():
+				r.complete(region, batch, nil, ctx.Err())
+				return
+			}
+			defer func() { <-r.slots }()
+
+			found, err := fetch(ctx, batch)
+			r.complete(region, batch, found, err)
+		}(batch)
+	}
+
+	values := map[string]T{}
+	for id, res := range waits {
+		select {
+		case <-res.done:
+		case <-ctx.Done():
+			return values
+		}
+		if res.found {
+			values[id] = res.value
+		}
+	}
+	return values
+}
+
+// complete records the values fetched for a batch and releases the workers
+// waiting for them.
+func (r *resolver[T]) complete(region string, batch []string, found map[string]T, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range batch {
+		key := nameCacheKey(region, id)
+		res := r.resolved[key]
+		if value, ok := found[id]; ok {
+			res.value, res.found = value, true
+		} else if err != nil {
+			delete(r.resolved, key)
+		}
+		close(res.done)
+	}
+}
@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxAPIRetries bounds the retries of a failed API call when
+// Options.MaxAPIRetries is zero.
+const DefaultMaxAPIRetries = 10
+
+// maxAPIBackoff caps the jittered exponential delay between retries.
+const maxAPIBackoff = 20 * time.Second
+
+// NewRetryer returns a retryer factory for aws.Config.Retryer that retries
+// failed calls, including RequestLimitExceeded and other throttles, up to
+// maxRetries times with jittered exponential backoff. Unlike the SDK
+// default it does not draw from a client-side retry quota, which a scan of
+// every region exhausts within seconds of being throttled. onThrottle, when
+// set, is called with the error code of every throttled attempt.
+func NewRetryer(maxRetries int, onThrottle func(code string)) func() aws.Retryer {
+	return func() aws.Retryer {
+		standard := retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = max(maxRetries, 0) + 1
+			o.MaxBackoff = maxAPIBackoff
+			o.Backoff = retry.NewExponentialJitterBackoff(maxAPIBackoff)
+			o.RateLimiter = ratelimit.None
+		})
+		if onThrottle == nil {
+			return standard
+		}
+		return &throttleRetryer{RetryerV2: standard, onThrottle: onThrottle}
+	}
+}
+
+// throttleRetryer reports throttled attempts. The SDK asks IsErrorRetryable
+// about every failed attempt, including the last one.
+type throttleRetryer struct {
+	aws.RetryerV2
+	onThrottle func(code string)
+}
+
+var isThrottle = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+func (r *throttleRetryer) IsErrorRetryable(err error) bool {
+	if isThrottle.IsErrorThrottle(err) == aws.TrueTernary {
+		code := "unknown"
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			code = apiErr.ErrorCode()
+		}
+		r.onThrottle(code)
+	}
+	return r.RetryerV2.IsErrorRetryable(err)
+}
+
+// buildConfig returns the configuration of a region with the collector's
+// retryer, which counts throttles into the report, middleware counting the
+// calls and those that failed after all retries, the Options.APIRateLimit
+// token bucket and Options.OnAPICall hooked into every client.
+func (c *StorageCollector) buildConfig(ctx context.Context, region string) (aws.Config, error) {
+	cfg, err := c.opts.LoadConfig(ctx, region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	cfg.Retryer = NewRetryer(c.opts.MaxAPIRetries, func(code string) {
+		c.countThrottle(region, code)
+	})
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CountAPICalls",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if err := c.countAPICall(region, awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err != nil && ctx.Err() == nil {
+					c.countRegionError(region)
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+	if limiter := c.limiter(region); limiter != nil {
+		cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+			// Finalize runs once per attempt, after the retry middleware
+			return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("RateLimitEC2",
+				func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+					if awsmiddleware.GetServiceID(ctx) == ec2.ServiceID {
+						if err := limiter.Wait(ctx); err != nil {
+							return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+						}
+					}
+					return next.HandleFinalize(ctx, in)
+				}), middleware.After)
+		})
+	}
+	if onAPICall := c.opts.OnAPICall; onAPICall != nil {
+		cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+			// Initialize runs once per call, before any retries
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("OnAPICall",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					onAPICall(region)
+					return next.HandleInitialize(ctx, in)
+				}), middleware.After)
+		})
+	}
+	return cfg, nil
+}
+
+func (c *StorageCollector) countThrottle(region, code string) {
+	slog.Warn("API call throttled", "region", region, "code", code)
+
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+
+	if c.throttles == nil {
+		c.throttles = map[string]int64{}
+	}
+	c.throttles[code]++
+
+	if c.regionThrottles == nil {
+		c.regionThrottles = map[string]int64{}
+	}
+	c.regionThrottles[region]++
+}
+
+// countAPICall counts an API call about to be made, and refuses it with
+// ErrAPIBudgetExceeded once Options.MaxAPICalls is reached, unless
+// Options.APIBudgetDegrade is set.
+func (c *StorageCollector) countAPICall(region, service, operation string) error {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+
+	if limit := c.opts.MaxAPICalls; limit > 0 && c.apiCallTotal >= limit {
+		if !c.apiBudget {
+			c.apiBudget = true
+			if c.opts.APIBudgetDegrade {
+				slog.Warn("API call budget reached, skipping enrichment lookups", "max_api_calls", limit)
+			} else if c.abortScan != nil {
+				c.abortScan(fmt.Errorf("%w: %d calls", ErrAPIBudgetExceeded, limit))
+			}
+		}
+		if !c.opts.APIBudgetDegrade {
+			return ErrAPIBudgetExceeded
+		}
+	}
+
+	if c.apiCalls == nil {
+		c.apiCalls = map[APICallKey]int64{}
+	}
+	c.apiCalls[APICallKey{Region: region, Service: service, Operation: operation}]++
+	c.apiCallTotal++
+	return nil
+}
+
+// ErrAPIBudgetExceeded fails the calls, and the scan, past
+// Options.MaxAPICalls.
+var ErrAPIBudgetExceeded = errors.New("API call budget exceeded")
+
+// skipEnrichment reports whether the lookup of what is skipped because the
+// API call budget was reached with Options.APIBudgetDegrade.
+func (c *StorageCollector) skipEnrichment(what string) bool {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+
+	if c.apiBudget && c.opts.APIBudgetDegrade {
+		slog.Debug("skipping lookup past the API call budget", "lookup", what)
+		return true
+	}
+	return false
+}
+
+// limiter returns the token bucket of a region, nil without
+// Options.APIRateLimit. Its burst is one second of calls.
+func (c *StorageCollector) limiter(region string) *rate.Limiter {
+	if c.opts.APIRateLimit <= 0 {
+		return nil
+	}
+
+	c.limiterMutex.Lock()
+	defer c.limiterMutex.Unlock()
+
+	if c.limiters == nil {
+		c.limiters = map[string]*rate.Limiter{}
+	}
+	limiter, ok := c.limiters[region]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(c.opts.APIRateLimit), max(int(c.opts.APIRateLimit), 1))
+		c.limiters[region] = limiter
+	}
+	return limiter
+}
+
+func (c *StorageCollector) countRegionError(region string) {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+
+	if c.regionErrors == nil {
+		c.regionErrors = map[string]int64{}
+	}
+	c.regionErrors[region]++
+}
+
+// regionErrorCount returns the failed API calls and scan jobs of a region so
+// far.
+func (c *StorageCollector) regionErrorCount(region string) int64 {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+	return c.regionErrors[region]
+}
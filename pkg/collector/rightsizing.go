@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+)
+
+const (
+	// us-east-1 list price of provisioned io1 and io2 IOPS per month. io2
+	// is cheaper above 32000 IOPS; the first tier is an upper bound.
+	ioIOPSUSDPerMonth = 0.065
+
+	// io1 and io2 volumes need at least this many IOPS.
+	ioMinIOPS = 100
+
+	// gp3 throughput cannot exceed a quarter MiB/s per provisioned IOPS.
+	gp3ThroughputPerIOPS = 0.25
+)
+
+// VolumeRightsizing compares the provisioned IOPS and throughput of an io1,
+// io2 or gp3 volume with what it used over the lookback window.
+type VolumeRightsizing struct {
+	Volume EntityUsage
+
+	// UsedIOPS and UsedThroughput (MiB/s) are the percentile of the five
+	// minute CloudWatch averages over the lookback window.
+	UsedIOPS       float64
+	UsedThroughput float64
+
+	// IOPS and Throughput (MiB/s) recommended for the volume. Throughput
+	// is only set for gp3.
+	IOPS       int32
+	Throughput int32
+
+	MonthlySavingsUSD float64
+}
+
+// Downsize reports whether the recommendation provisions less than the
+// volume has.
+func (r VolumeRightsizing) Downsize() bool {
+	return r.IOPS < r.Volume.IOPS || r.Throughput < r.Volume.Throughput
+}
+
+// Rightsizing sizes the IOPS and throughput of every io1, io2 and gp3
+// volume among the entities to the given percentile of its CloudWatch usage
+// over the access lookback window plus headroom percent, largest savings
+// first. Volumes without metrics, such as unattached ones, are left out.
+func (c *StorageCollector) Rightsizing(ctx context.Context, entities []EntityUsage, percentile, headroom float64) []VolumeRightsizing {
+	byRegion := map[string][]*EntityUsage{}
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type == EntityTypeVolume && entity.IOPS > 0 {
+			byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+		}
+	}
+
+	now := time.Now()
+	var recommendations []VolumeRightsizing
+	for region, volumes := range byRegion {
+		cfg, err := c.loadConfig(ctx, region)
+		if err != nil {
+			slog.Error("failed to create clients", "region", region, "error", err)
+			continue
+		}
+		cw := cloudwatch.NewFromConfig(cfg)
+
+		for start := 0; start < len(volumes); start += gp2VolumesPerMetricDataCall {
+			batch := volumes[start:min(start+gp2VolumesPerMetricDataCall, len(volumes))]
+
+			series, err := getVolumeIO(ctx, cw, batch, now, c.opts.AccessLookback)
+			if err != nil {
+				slog.Error("failed to get volume IO metrics", "region", region, "error", err)
+				continue
+			}
+
+			for _, volume := range batch {
+				io, ok := series[volume.ID]
+				if !ok || len(io.iops) == 0 {
+					continue
+				}
+				recommendations = append(recommendations,
+					rightsize(*volume, usagePercentile(io.iops, percentile), usagePercentile(io.throughput, percentile), headroom))
+			}
+		}
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].MonthlySavingsUSD != recommendations[j].MonthlySavingsUSD {
+			return recommendations[i].MonthlySavingsUSD > recommendations[j].MonthlySavingsUSD
+		}
+		return recommendations[i].Volume.ID < recommendations[j].Volume.ID
+	})
+
+	return recommendations
+}
+
+// rightsize recommends the IOPS and throughput of a volume from its usage
+// plus headroom percent. Recommendations never exceed what the volume has
+// provisioned and stay within the limits of its type.
+func rightsize(volume EntityUsage, usedIOPS, usedThroughput, headroom float64) VolumeRightsizing {
+	scale := 1 + headroom/100
+	provisionedIOPS := float64(volume.IOPS)
+	iops := math.Ceil(usedIOPS * scale)
+
+	r := VolumeRightsizing{Volume: volume, UsedIOPS: usedIOPS, UsedThroughput: usedThroughput}
+
+	switch volume.VolumeType {
+	case "gp3":
+		provisionedThroughput := float64(volume.Throughput)
+		throughput := math.Min(math.Max(gp3BaselineThroughput, math.Ceil(usedThroughput*scale)), provisionedThroughput)
+		iops = math.Max(iops, math.Ceil(throughput/gp3ThroughputPerIOPS))
+		iops = math.Min(math.Max(gp3BaselineIOPS, iops), provisionedIOPS)
+
+		r.IOPS, r.Throughput = int32(iops), int32(throughput)
+		r.MonthlySavingsUSD = (math.Max(provisionedIOPS, gp3BaselineIOPS)-math.Max(iops, gp3BaselineIOPS))*gp3IOPSUSDPerMonth +
+			(math.Max(provisionedThroughput, gp3BaselineThroughput)-math.Max(throughput, gp3BaselineThroughput))*gp3ThroughputUSDPerMonth
+	default:
+		iops = math.Min(math.Max(ioMinIOPS, iops), provisionedIOPS)
+
+		r.IOPS = int32(iops)
+		r.MonthlySavingsUSD = (provisionedIOPS - iops) * ioIOPSUSDPerMonth
+	}
+
+	return r
+}
+
+// usagePercentile returns the nearest-rank percentile of the values.
+func usagePercentile(values []float64, percentile float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/taylormonacelli/crankymosquitos/pkg/awsres"
+)
+
+// regionalClients memoizes per-region CloudWatch and S3 clients.
+type regionalClients struct {
+	loadConfig   ConfigLoader
+	usePathStyle bool
+
+	mu         sync.Mutex
+	cloudwatch map[string]*cloudwatch.Client
+	s3         map[string]*s3.Client
+}
+
+func newRegionalClients(loadConfig ConfigLoader, usePathStyle bool) *regionalClients {
+	return &regionalClients{
+		loadConfig:   loadConfig,
+		usePathStyle: usePathStyle,
+		cloudwatch:   map[string]*cloudwatch.Client{},
+		s3:           map[string]*s3.Client{},
+	}
+}
+
+func (c *regionalClients) get(ctx context.Context, region string) (*s3.Client, *cloudwatch.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.s3[region]; ok {
+		return client, c.cloudwatch[region], nil
+	}
+
+	cfg, err := c.loadConfig(ctx, region)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.s3[region] = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = c.usePathStyle
+	})
+	c.cloudwatch[region] = cloudwatch.NewFromConfig(cfg)
+
+	return c.s3[region], c.cloudwatch[region], nil
+}
+
+// scanS3 collects the size of every bucket owned by the account.
+func (c *StorageCollector) scanS3(ctx context.Context) error {
+	started := time.Now()
+	clients := newRegionalClients(c.loadConfig, c.opts.S3UsePathStyle)
+
+	client, _, err := clients.get(ctx, awsres.S3HomeRegion(c.opts.Partition))
+	if err != nil {
+		return fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	slog.Debug("listing S3 buckets")
+	buckets, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return fmt.Errorf("failed to list buckets: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var found []EntityUsage
+
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+
+	for _, bucket := range buckets.Buckets {
+		if c.opts.Scope != nil && !c.opts.Scope.Includes("", aws.ToString(bucket.Name)) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			entity, err := c.getBucketUsage(ctx, client, clients, name)
+			if err != nil {
+				slog.Error("failed to size bucket", "bucket", name, "error", err)
+				return
+			}
+
+			mu.Lock()
+			found = append(found, entity)
+			mu.Unlock()
+		}(aws.ToString(bucket.Name))
+	}
+
+	wg.Wait()
+
+	c.addRegion(GlobalRegion, found, started)
+
+	return nil
+}
+
+func (c *StorageCollector) getBucketUsage(ctx context.Context, client *s3.Client, clients *regionalClients, bucket string) (EntityUsage, error) {
+	location, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return EntityUsage{}, err
+	}
+
+	region := BucketRegion(string(location.LocationConstraint))
+
+	regionalS3, cw, err := clients.get(ctx, region)
+	if err != nil {
+		return EntityUsage{}, err
+	}
+
+	entity := EntityUsage{
+		ID:     bucket,
+		Region: region,
+		Type:   EntityTypeBucket,
+	}
+
+	found, err := getBucketMetrics(ctx, cw, &entity)
+	if err != nil {
+		slog.Error("failed to read CloudWatch metrics for bucket", "bucket", bucket, "error", err)
+	}
+
+	if !found && c.opts.S3ListFallback {
+		slog.Info("no CloudWatch datapoints for bucket, listing objects", "bucket", bucket)
+		if err := listBucketUsage(ctx, regionalS3, &entity); err != nil {
+			return EntityUsage{}, err
+		}
+	}
+
+	return entity, nil
+}
+
+// BucketRegion maps a GetBucketLocation constraint to its region name.
+func BucketRegion(constraint string) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case "EU":
+		return "eu-west-1"
+	}
+
+	return constraint
+}
+
+// getBucketMetrics sums BucketSizeBytes over every storage class reported for
+// the bucket and reads its object count. It reports whether any size
+// datapoints were found.
+func getBucketMetrics(ctx context.Context, cw *cloudwatch.Client, entity *EntityUsage) (bool, error) {
+	metrics, err := cw.ListMetrics(ctx, &cloudwatch.ListMetricsInput{
+		Namespace:  aws.String("AWS/S3"),
+		MetricName: aws.String("BucketSizeBytes"),
+		Dimensions: []cwtypes.DimensionFilter{
+			{Name: aws.String("BucketName"), Value: aws.String(entity.ID)},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, metric := range metrics.Metrics {
+		value, ok, err := getLatestDailyS3Metric(ctx, cw, "BucketSizeBytes", metric.Dimensions)
+		if err != nil {
+			return found, err
+		}
+		if ok {
+			found = true
+			entity.StorageUsed += int64(value)
+		}
+	}
+
+	count, ok, err := getLatestDailyS3Metric(ctx, cw, "NumberOfObjects", []cwtypes.Dimension{
+		{Name: aws.String("BucketName"), Value: aws.String(entity.ID)},
+		{Name: aws.String("StorageType"), Value: aws.String("AllStorageTypes")},
+	})
+	if err != nil {
+		return found, err
+	}
+	if ok {
+		entity.ObjectCount = int64(count)
+	}
+
+	return found, nil
+}
+
+// getLatestDailyS3Metric reads an S3 storage metric. S3 publishes these once
+// per day, so the last two days are queried.
+func getLatestDailyS3Metric(ctx context.Context, cw *cloudwatch.Client, name string, dimensions []cwtypes.Dimension) (float64, bool, error) {
+	return getLatestMetricAverage(ctx, cw, "AWS/S3", name, dimensions, 48*time.Hour, 86400)
+}
+
+func listBucketUsage(ctx context.Context, client *s3.Client, entity *EntityUsage) error {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(entity.ID)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			entity.StorageUsed += aws.ToInt64(object.Size)
+			entity.ObjectCount++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package collector
+
+// Scope holds the resource IDs that belong to a scan, by region. Members of
+// global services such as S3 are stored under the empty region.
+type Scope struct {
+	members map[string]map[string]string // region -> resource ID -> resource type
+}
+
+// NewScope returns an empty scope.
+func NewScope() *Scope {
+	return &Scope{members: map[string]map[string]string{}}
+}
+
+// Add records a member of the given ARN resource type (e.g. "volume").
+func (s *Scope) Add(region, id, resourceType string) {
+	if s.members[region] == nil {
+		s.members[region] = map[string]string{}
+	}
+	s.members[region][id] = resourceType
+}
+
+// IDs returns the member IDs of the given ARN resource type (e.g. "volume")
+// in a region.
+func (s *Scope) IDs(region, resourceType string) []string {
+	var ids []string
+	for id, t := range s.members[region] {
+		if t == resourceType {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Includes reports whether the resource is a member in the region or among
+// the global members.
+func (s *Scope) Includes(region, id string) bool {
+	if _, ok := s.members[region][id]; ok {
+		return true
+	}
+	_, ok := s.members[""][id]
+	return ok
+}
+
+// HasRegion reports whether the region holds any members.
+func (s *Scope) HasRegion(region string) bool {
+	return len(s.members[region]) > 0
+}
+
+// scoped keeps the entities that are members of the scan scope, if any.
+func (c *StorageCollector) scoped(region string, entities []EntityUsage) []EntityUsage {
+	if c.opts.Scope == nil {
+		return entities
+	}
+
+	var scoped []EntityUsage
+	for _, entity := range entities {
+		if c.opts.Scope.Includes(region, entity.ID) {
+			scoped = append(scoped, entity)
+		}
+	}
+	return scoped
+}
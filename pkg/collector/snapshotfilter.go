@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// EC2 accepts at most this many values for a single filter.
+const maxFilterValues = 200
+
+// SnapshotFilter narrows the snapshots a scan collects. Zero fields do not
+// filter.
+type SnapshotFilter struct {
+	// After and Before bound the snapshot start time to [After, Before).
+	After  time.Time
+	Before time.Time
+	// StorageTier is "standard" or "archive".
+	StorageTier string
+}
+
+// Contains reports whether a snapshot start time falls in the window.
+func (f SnapshotFilter) Contains(t time.Time) bool {
+	if !f.After.IsZero() && t.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !t.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+// startTimePatterns covers the window with start-time wildcard patterns:
+// whole months as "2024-01-*", partial months day by day as "2024-02-03*".
+// The patterns may match a little more than the window, so results are still
+// checked with Contains. It returns nil when the window is open-ended or would
+// need more patterns than a filter accepts.
+func (f SnapshotFilter) startTimePatterns() []string {
+	if f.After.IsZero() || f.Before.IsZero() {
+		return nil
+	}
+
+	var patterns []string
+
+	// Start times are matched as UTC, so the days are those of the UTC window
+	after := f.After.UTC()
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	end := f.Before.UTC()
+	for day.Before(end) {
+		nextMonth := day.AddDate(0, 1, 1-day.Day())
+		if day.Day() == 1 && !nextMonth.After(end) {
+			patterns = append(patterns, day.Format("2006-01-")+"*")
+			day = nextMonth
+		} else {
+			patterns = append(patterns, day.Format(time.DateOnly)+"*")
+			day = day.AddDate(0, 0, 1)
+		}
+
+		if len(patterns) > maxFilterValues {
+			return nil
+		}
+	}
+
+	return patterns
+}
+
+// ec2Filters returns the server-side DescribeSnapshots filters.
+func (f SnapshotFilter) ec2Filters() []types.Filter {
+	var filters []types.Filter
+
+	if f.StorageTier != "" {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("storage-tier"),
+			Values: []string{f.StorageTier},
+		})
+	}
+
+	if patterns := f.startTimePatterns(); len(patterns) > 0 {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("start-time"),
+			Values: patterns,
+		})
+	}
+
+	return filters
+}
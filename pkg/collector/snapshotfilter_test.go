@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStartTimePatterns(t *testing.T) {
+	plus3 := time.FixedZone("+03:00", 3*60*60)
+	minus5 := time.FixedZone("-05:00", -5*60*60)
+
+	tests := []struct {
+		name          string
+		after, before time.Time
+		want          []string
+	}{
+		{
+			name:   "days",
+			after:  time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+			before: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC),
+			want:   []string{"2024-05-02*", "2024-05-03*"},
+		},
+		{
+			name:   "months",
+			after:  time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+			before: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			want:   []string{"2024-04-30*", "2024-05-*", "2024-06-*"},
+		},
+		{
+			// 01:00 at +03:00 is 22:00 on the UTC day before
+			name:   "positive offset",
+			after:  time.Date(2024, 5, 2, 1, 0, 0, 0, plus3),
+			before: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC),
+			want:   []string{"2024-05-01*", "2024-05-02*"},
+		},
+		{
+			// 22:00 at -05:00 is 03:00 on the UTC day after
+			name:   "negative offset",
+			after:  time.Date(2024, 5, 1, 22, 0, 0, 0, minus5),
+			before: time.Date(2024, 5, 2, 22, 0, 0, 0, minus5),
+			want:   []string{"2024-05-02*", "2024-05-03*"},
+		},
+		{
+			name:  "open-ended",
+			after: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "too many months",
+			after:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			before: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SnapshotFilter{After: tt.after, Before: tt.before}.startTimePatterns()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("startTimePatterns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
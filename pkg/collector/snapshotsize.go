@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
+	"github.com/taylormonacelli/crankymosquitos/pkg/atrest"
+)
+
+// DefaultSnapshotSizeConcurrency bounds concurrent EBS direct API calls. The
+// APIs are throttled far more aggressively than EC2.
+const DefaultSnapshotSizeConcurrency = 10
+
+// snapshotSize is a measured snapshot size as stored in the size cache.
+// Incremental sizes depend on the snapshot they were measured against, so a
+// cached size only applies while that parent is unchanged.
+type snapshotSize struct {
+	Bytes  int64
+	Parent string `json:",omitempty"`
+}
+
+// snapshotSizeCache remembers measured sizes by snapshot ID. Snapshots are
+// immutable, so entries never expire.
+type snapshotSizeCache struct {
+	mu     sync.Mutex
+	file   string
+	sealer atrest.Sealer
+	sizes  map[string]snapshotSize
+	dirty  bool
+}
+
+func loadSnapshotSizeCache(file string, sealer atrest.Sealer) *snapshotSizeCache {
+	cache := &snapshotSizeCache{file: file, sealer: sealer, sizes: map[string]snapshotSize{}}
+	if file == "" {
+		return cache
+	}
+
+	data, err := atrest.ReadFile(sealer, file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		slog.Warn("ignoring unreadable snapshot size cache", "error", err)
+	default:
+		if err := json.Unmarshal(data, &cache.sizes); err != nil {
+			slog.Warn("ignoring unreadable snapshot size cache", "error", err)
+		}
+	}
+
+	return cache
+}
+
+func (c *snapshotSizeCache) get(snapshotID, parent string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size, ok := c.sizes[snapshotID]
+	if !ok || size.Parent != parent {
+		return 0, false
+	}
+	return size.Bytes, true
+}
+
+func (c *snapshotSizeCache) put(snapshotID, parent string, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sizes[snapshotID] = snapshotSize{Bytes: bytes, Parent: parent}
+	c.dirty = true
+}
+
+func (c *snapshotSizeCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty || c.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.sizes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atrest.WriteFile(c.sealer, c.file, data, 0o644)
+}
+
+// measureSnapshots replaces the VolumeSize based StorageUsed of completed
+// snapshots with the bytes they actually store: every written block for the
+// oldest snapshot of a volume, the blocks changed since the previous one for
+// the others. Only snapshots collected in this scan are considered parents,
+// so a narrow --created-after window makes its oldest snapshots look full.
+func (c *StorageCollector) measureSnapshots(ctx context.Context, client *ebs.Client, entities []EntityUsage) {
+	byVolume := map[string][]*EntityUsage{}
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type == EntityTypeSnapshot && entity.State == "completed" {
+			byVolume[entity.SourceVolume] = append(byVolume[entity.SourceVolume], entity)
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, snapshots := range byVolume {
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].StartTime.Before(snapshots[j].StartTime) })
+
+		for i, snapshot := range snapshots {
+			parent := ""
+			if i > 0 {
+				parent = snapshots[i-1].ID
+			}
+
+			if bytes, ok := c.snapshotSizes.get(snapshot.ID, parent); ok {
+				snapshot.StorageUsed = bytes
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(snapshot *EntityUsage, parent string) {
+				defer wg.Done()
+
+				c.snapshotSizeSlots <- struct{}{} // Acquire a semaphore slot
+				bytes, err := snapshotBytes(ctx, client, snapshot.ID, parent)
+				<-c.snapshotSizeSlots // Release the semaphore slot
+
+				if err != nil {
+					slog.Warn("failed to measure snapshot, keeping its volume size", "region", snapshot.Region, "id", snapshot.ID, "error", err)
+					return
+				}
+
+				snapshot.StorageUsed = bytes
+				c.snapshotSizes.put(snapshot.ID, parent, bytes)
+			}(snapshot, parent)
+		}
+	}
+
+	wg.Wait()
+}
+
+// snapshotBytes counts the bytes of the blocks a snapshot holds, or of the
+// blocks changed since parent when one is given.
+func snapshotBytes(ctx context.Context, client *ebs.Client, snapshotID, parent string) (int64, error) {
+	var blocks, blockSize int64
+
+	if parent == "" {
+		paginator := ebs.NewListSnapshotBlocksPaginator(client, &ebs.ListSnapshotBlocksInput{
+			SnapshotId: aws.String(snapshotID),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return 0, err
+			}
+			blocks += int64(len(page.Blocks))
+			blockSize = int64(aws.ToInt32(page.BlockSize))
+		}
+
+		return blocks * blockSize, nil
+	}
+
+	paginator := ebs.NewListChangedBlocksPaginator(client, &ebs.ListChangedBlocksInput{
+		FirstSnapshotId:  aws.String(parent),
+		SecondSnapshotId: aws.String(snapshotID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, block := range page.ChangedBlocks {
+			// Blocks only present in the parent were freed, not written.
+			if block.SecondBlockToken != nil {
+				blocks++
+			}
+		}
+		blockSize = int64(aws.ToInt32(page.BlockSize))
+	}
+
+	return blocks * blockSize, nil
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// copiedSnapshotVolume is the VolumeId of snapshots copied from another
+// snapshot, which name no volume.
+const copiedSnapshotVolume = "vol-ffffffff"
+
+// markSourceVolumes sets VolumeExists on the snapshots, looking up their
+// source volumes with DescribeVolumes in batches, Options.Concurrency at a
+// time. The snapshots of a batch that cannot be looked up, and copied
+// snapshots, are left unset.
+func (c *StorageCollector) markSourceVolumes(ctx context.Context, client EC2DescribeAPI, region string, snapshots []EntityUsage) {
+	if len(snapshots) == 0 || c.skipEnrichment("source volumes") {
+		return
+	}
+
+	// Snapshots of the same volume look it up once
+	var ids []string
+	seen := map[string]bool{}
+	for _, snapshot := range snapshots {
+		id := snapshot.SourceVolume
+		if id == "" || id == copiedSnapshotVolume || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+	looked := map[string]bool{} // Volumes looked up without an error
+	existing := map[string]bool{}
+
+	for _, batch := range idBatches(ids) {
+		wg.Add(1)
+
+		go func(batch []string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{} // Acquire a semaphore slot
+			defer func() { <-semaphore }()
+
+			found, err := describeExistingVolumes(ctx, client, batch)
+			if err != nil {
+				slog.Error("failed to look up source volumes", "region", region, "volumes", len(batch), "error", err)
+				return
+			}
+
+			mu.Lock()
+			for _, id := range batch {
+				looked[id] = true
+				existing[id] = found[id]
+			}
+			mu.Unlock()
+		}(batch)
+	}
+
+	wg.Wait()
+
+	for i := range snapshots {
+		if id := snapshots[i].SourceVolume; looked[id] {
+			exists := existing[id]
+			snapshots[i].VolumeExists = &exists
+		}
+	}
+}
+
+// describeExistingVolumes returns the volumes of the IDs that exist.
+func describeExistingVolumes(ctx context.Context, client EC2DescribeAPI, volumeIDs []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	paginator := ec2.NewDescribeVolumesPaginator(client, &ec2.DescribeVolumesInput{
+		Filters: []types.Filter{{Name: aws.String("volume-id"), Values: volumeIDs}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, volume := range page.Volumes {
+			existing[aws.ToString(volume.VolumeId)] = true
+		}
+	}
+	return existing, nil
+}
+
+// SourceVolumeDeleted reports whether the source volume of a snapshot is
+// gone. Without VolumeExists, which the scan sets, the volume is taken to
+// be gone when it is not among the volumes.
+func (e EntityUsage) SourceVolumeDeleted(volumes map[string]bool) bool {
+	if e.VolumeExists != nil {
+		return !*e.VolumeExists
+	}
+	return !volumes[e.SourceVolume]
+}
@@ -0,0 +1,58 @@
+package collector
+
+import "sort"
+
+// DefaultStackTags name the CloudFormation stack or Terraform workspace that
+// deployed a resource, in the order they are tried. CloudFormation tags
+// resources itself; the Terraform tags follow common default_tags
+// conventions.
+var DefaultStackTags = []string{
+	"aws:cloudformation:stack-name",
+	"terraform:workspace",
+	"TerraformWorkspace",
+	"tf-workspace",
+}
+
+// StackOf returns the value of the first of keys the entity is tagged with,
+// or "" when it has none.
+func StackOf(entity EntityUsage, keys []string) string {
+	for _, key := range keys {
+		if value := entity.Tags[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// GroupByStack aggregates the entities deployed by a stack by stack name,
+// largest stack first. Entities of no stack are left out.
+func GroupByStack(entities []EntityUsage) []TagGroup {
+	byStack := map[string]*TagGroup{}
+	for _, entity := range entities {
+		if entity.Stack == "" {
+			continue
+		}
+
+		group, ok := byStack[entity.Stack]
+		if !ok {
+			group = &TagGroup{Value: entity.Stack}
+			byStack[entity.Stack] = group
+		}
+		group.Entities++
+		group.StorageUsed += entity.StorageUsed
+		group.MonthlyCostUSD += entity.MonthlyCostUSD
+	}
+
+	groups := make([]TagGroup, 0, len(byStack))
+	for _, group := range byStack {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].StorageUsed != groups[j].StorageUsed {
+			return groups[i].StorageUsed > groups[j].StorageUsed
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
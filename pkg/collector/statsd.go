@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxStatsDPacket keeps DogStatsD datagrams within the payload of a 1500
+// byte Ethernet frame.
+const maxStatsDPacket = 1432
+
+// StatsDOptions configure SendStatsD.
+type StatsDOptions struct {
+	// Address is the host:port of the DogStatsD agent.
+	Address string
+	// Tags, such as env:prod, are added to every gauge.
+	Tags []string
+	// AccountID tags the gauges of entities without an account of their
+	// own when set.
+	AccountID string
+}
+
+// SendStatsD sends the storage gauges of a report once to a DogStatsD agent
+// over UDP: one gauge per entity, mirroring the Prometheus metrics, and the
+// storage used by region, type and account. Every gauge is tagged with its
+// region, entity type and account.
+func SendStatsD(ctx context.Context, opts StatsDOptions, report *Report) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", opts.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd at %s: %w", opts.Address, err)
+	}
+	defer conn.Close()
+
+	for _, packet := range statsDPackets(statsDLines(opts, report)) {
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("failed to send metrics to statsd at %s: %w", opts.Address, err)
+		}
+	}
+	return nil
+}
+
+type statsDAggregate struct {
+	region, entityType, account string
+}
+
+func statsDLines(opts StatsDOptions, report *Report) []string {
+	var lines []string
+	gauge := func(name string, value int64, tags ...string) {
+		all := make([]string, 0, len(opts.Tags)+len(tags))
+		for _, tag := range append(append([]string(nil), opts.Tags...), tags...) {
+			if !strings.HasSuffix(tag, ":") { // Tags without a value, such as of unattached volumes
+				all = append(all, statsDTag(tag))
+			}
+		}
+		line := name + ":" + strconv.FormatInt(value, 10) + "|g"
+		if len(all) > 0 {
+			line += "|#" + strings.Join(all, ",")
+		}
+		lines = append(lines, line)
+	}
+
+	aggregates := map[statsDAggregate]int64{}
+	for _, entity := range report.Entities {
+		account := entity.AccountID
+		if account == "" {
+			account = opts.AccountID
+		}
+		common := []string{"region:" + entity.Region, "type:" + entity.Type}
+		if account != "" {
+			common = append(common, "account:"+account)
+		}
+		if entity.Profile != "" {
+			common = append(common, "profile:"+entity.Profile)
+		}
+		tags := func(tags ...string) []string { return append(tags, common...) }
+
+		switch entity.Type {
+		case EntityTypeVolume:
+			gauge("aws.ebs.storage_used", entity.StorageUsed, tags("volume_id:"+entity.ID, "attached_instance:"+entity.AttachedInstance)...)
+		case EntityTypeSnapshot:
+			gauge("aws.snapshot.storage_used", entity.StorageUsed, tags("snapshot_id:"+entity.ID)...)
+		case EntityTypeBucket:
+			gauge("aws.s3.storage_used", entity.StorageUsed, tags("bucket:"+entity.ID)...)
+		case EntityTypeDBInstance, EntityTypeDBCluster:
+			gauge("aws.rds.storage_allocated", entity.AllocatedStorage, tags("db_identifier:"+entity.ID, "engine:"+entity.Engine)...)
+			gauge("aws.rds.storage_used", entity.StorageUsed, tags("db_identifier:"+entity.ID, "engine:"+entity.Engine)...)
+		case EntityTypeEFS:
+			gauge("aws.efs.storage_used", entity.StorageUsed, tags("file_system_id:"+entity.ID)...)
+		case EntityTypeFSx:
+			gauge("aws.fsx.storage_capacity", entity.AllocatedStorage, tags("file_system_id:"+entity.ID, "file_system_type:"+entity.FileSystemType)...)
+		}
+		aggregates[statsDAggregate{entity.Region, entity.Type, account}] += entity.StorageUsed
+	}
+
+	keys := make([]statsDAggregate, 0, len(aggregates))
+	for key := range aggregates {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.entityType != b.entityType {
+			return a.entityType < b.entityType
+		}
+		return a.account < b.account
+	})
+	for _, key := range keys {
+		tags := []string{"region:" + key.region, "type:" + key.entityType}
+		if key.account != "" {
+			tags = append(tags, "account:"+key.account)
+		}
+		gauge("aws.storage_used", aggregates[key], tags...)
+	}
+	gauge("aws.total_storage_used", report.TotalStorageUsed)
+
+	return lines
+}
+
+// statsDTag replaces the characters that delimit DogStatsD tags.
+func statsDTag(tag string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(tag)
+}
+
+// statsDPackets joins the lines into newline separated datagrams of at most
+// maxStatsDPacket bytes. A longer line is sent on its own.
+func statsDPackets(lines []string) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxStatsDPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TagFilters limits a scan to resources carrying matching tags. A resource
+// matches when, for every key, its tag value is one of the listed values.
+type TagFilters map[string][]string
+
+// taggedServices are the services whose entities carry tags. The others are
+// skipped entirely when tag filters are set.
+var taggedServices = map[string]bool{
+	ServiceEBS:       true,
+	ServiceSnapshots: true,
+	ServiceEFS:       true,
+	ServiceFSx:       true,
+	ServiceRedshift:  true,
+}
+
+// Matches reports whether tags satisfy every filter.
+func (f TagFilters) Matches(tags map[string]string) bool {
+	for key, values := range f {
+		value, ok := tags[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ec2Filters returns the server-side tag:KEY filters of DescribeVolumes and
+// DescribeSnapshots, in key order.
+func (f TagFilters) ec2Filters() []types.Filter {
+	var filters []types.Filter
+	for _, key := range slices.Sorted(maps.Keys(f)) {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: f[key],
+		})
+	}
+	return filters
+}
+
+// tagFiltered drops the entities that do not match the tag filters. Volumes
+// and snapshots are already filtered by EC2; the other services are filtered
+// here.
+func (c *StorageCollector) tagFiltered(entities []EntityUsage) []EntityUsage {
+	if len(c.opts.TagFilters) == 0 {
+		return entities
+	}
+	return slices.DeleteFunc(entities, func(entity EntityUsage) bool {
+		return !c.opts.TagFilters.Matches(entity.Tags)
+	})
+}
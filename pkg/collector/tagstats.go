@@ -0,0 +1,76 @@
+package collector
+
+import "sort"
+
+// TagValueStats totals the volumes and snapshots carrying one value of a tag.
+type TagValueStats struct {
+	Value       string
+	Entities    int
+	StorageUsed int64
+}
+
+// TagKeyStats totals the volumes and snapshots carrying a tag key. Values
+// holds every distinct value, largest first.
+type TagKeyStats struct {
+	Key         string
+	Entities    int
+	StorageUsed int64
+	Values      []TagValueStats
+}
+
+// TagStats aggregates the tags of volumes and snapshots by key and value,
+// keys with the most storage first.
+func TagStats(entities []EntityUsage) []TagKeyStats {
+	type keyTotals struct {
+		stats  TagKeyStats
+		values map[string]*TagValueStats
+	}
+
+	byKey := map[string]*keyTotals{}
+	for _, entity := range entities {
+		if entity.Type != EntityTypeVolume && entity.Type != EntityTypeSnapshot {
+			continue
+		}
+
+		for key, value := range entity.Tags {
+			totals, ok := byKey[key]
+			if !ok {
+				totals = &keyTotals{stats: TagKeyStats{Key: key}, values: map[string]*TagValueStats{}}
+				byKey[key] = totals
+			}
+			totals.stats.Entities++
+			totals.stats.StorageUsed += entity.StorageUsed
+
+			valueStats, ok := totals.values[value]
+			if !ok {
+				valueStats = &TagValueStats{Value: value}
+				totals.values[value] = valueStats
+			}
+			valueStats.Entities++
+			valueStats.StorageUsed += entity.StorageUsed
+		}
+	}
+
+	stats := make([]TagKeyStats, 0, len(byKey))
+	for _, totals := range byKey {
+		for _, valueStats := range totals.values {
+			totals.stats.Values = append(totals.stats.Values, *valueStats)
+		}
+		sort.Slice(totals.stats.Values, func(i, j int) bool {
+			a, b := totals.stats.Values[i], totals.stats.Values[j]
+			if a.StorageUsed != b.StorageUsed {
+				return a.StorageUsed > b.StorageUsed
+			}
+			return a.Value < b.Value
+		})
+		stats = append(stats, totals.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].StorageUsed != stats[j].StorageUsed {
+			return stats[i].StorageUsed > stats[j].StorageUsed
+		}
+		return stats[i].Key < stats[j].Key
+	})
+
+	return stats
+}
@@ -0,0 +1,367 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Risks of a volume type change to the performance of the workload.
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// hddLimits are the throughput (MiB/s) and IOPS limits of an HDD volume
+// type. Baseline and burst throughput scale with the size of the volume.
+type hddLimits struct {
+	baselinePerTiB, burstPerTiB float64
+	maxBaseline, maxBurst       float64
+	maxIOPS                     float64
+}
+
+// hddVolumeTypes are the limits of the HDD volume types.
+var hddVolumeTypes = map[string]hddLimits{
+	"st1": {baselinePerTiB: 40, burstPerTiB: 250, maxBaseline: 500, maxBurst: 500, maxIOPS: 500},
+	"sc1": {baselinePerTiB: 12, burstPerTiB: 80, maxBaseline: 192, maxBurst: 250, maxIOPS: 250},
+}
+
+func (l hddLimits) baseline(size float64) float64 {
+	return math.Min(l.baselinePerTiB*size/1024, l.maxBaseline)
+}
+
+func (l hddLimits) burst(size float64) float64 {
+	return math.Min(l.burstPerTiB*size/1024, l.maxBurst)
+}
+
+const (
+	// HDD volumes serve large sequential IO; smaller average IO is
+	// random enough to suffer from their latency.
+	sequentialIOKiB = 64
+	largeIOKiB      = 128
+
+	// Volumes idle for this share of the lookback window barely notice
+	// the latency of an HDD volume.
+	mostlyIdleShare = 0.95
+
+	// HDD volumes busier than this share of their IOPS limit are better
+	// served by SSD.
+	hotHDDIOPSShare = 0.8
+)
+
+// TierChange is a recommended change of the type of a volume between SSD
+// (gp2, gp3) and HDD (st1, sc1), from its IO over the lookback window.
+type TierChange struct {
+	Volume     EntityUsage
+	TargetType string
+
+	// IOPS and Throughput (MiB/s) to provision when TargetType is gp3.
+	IOPS       int32
+	Throughput int32
+
+	// PeakIOPS and PeakThroughput are the busiest five minutes, and
+	// AverageThroughput the mean, CloudWatch recorded.
+	PeakIOPS          float64
+	PeakThroughput    float64
+	AverageThroughput float64
+	// AverageIOSizeKiB is the bytes read and written per operation.
+	AverageIOSizeKiB float64
+	// IdleShare is the share of the window without any IO.
+	IdleShare float64
+
+	Risk   string
+	Reason string
+
+	CurrentMonthlyCostUSD float64
+	TargetMonthlyCostUSD  float64
+}
+
+// MonthlySavingsUSD is what the change saves per month, negative when the
+// target type costs more.
+func (t TierChange) MonthlySavingsUSD() float64 {
+	return t.CurrentMonthlyCostUSD - t.TargetMonthlyCostUSD
+}
+
+// volumeUsage is the IO of a volume over the lookback window.
+type volumeUsage struct {
+	peakIOPS, peakThroughput, averageThroughput float64
+	averageIOSizeKiB                            float64
+	idleShare                                   float64
+}
+
+// TierChanges recommends moving attached gp2, gp3 and st1 volumes whose IO
+// fits a cheaper HDD type to st1 or sc1, and hot st1 and sc1 volumes to
+// st1 or gp3, largest savings first. Volumes younger than the access
+// lookback window, and volumes whose metrics or prices cannot be read, are
+// left out.
+func (c *StorageCollector) TierChanges(ctx context.Context, entities []EntityUsage) ([]TierChange, error) {
+	book, err := c.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lookback := c.opts.AccessLookback
+	now := time.Now()
+
+	byRegion := map[string][]*EntityUsage{}
+	for i := range entities {
+		entity := &entities[i]
+		if entity.Type != EntityTypeVolume || entity.AttachedInstance == "" || now.Sub(entity.CreateTime) < lookback {
+			continue
+		}
+		switch entity.VolumeType {
+		case "gp2", "gp3", "st1", "sc1":
+			byRegion[entity.Region] = append(byRegion[entity.Region], entity)
+		}
+	}
+
+	var changes []TierChange
+	for region, volumes := range byRegion {
+		prices := map[string]float64{}
+		for _, volumeType := range []string{"gp2", "gp3", "st1", "sc1"} {
+			price, err := book.Price(ctx, region, volumeType)
+			if err != nil {
+				slog.Error("failed to look up price", "kind", volumeType, "region", region, "error", err)
+				continue
+			}
+			prices[volumeType] = price
+		}
+
+		cfg, err := c.loadConfig(ctx, region)
+		if err != nil {
+			slog.Error("failed to create clients", "region", region, "error", err)
+			continue
+		}
+		cw := cloudwatch.NewFromConfig(cfg)
+
+		for start := 0; start < len(volumes); start += gp2VolumesPerMetricDataCall {
+			batch := volumes[start:min(start+gp2VolumesPerMetricDataCall, len(volumes))]
+
+			series, err := getVolumeIO(ctx, cw, batch, now, lookback)
+			if err != nil {
+				slog.Error("failed to get volume IO metrics", "region", region, "error", err)
+				continue
+			}
+			idle, err := getVolumeIdleTime(ctx, cw, batch, now, lookback)
+			if err != nil {
+				slog.Error("failed to get volume idle time", "region", region, "error", err)
+				continue
+			}
+
+			for _, volume := range batch {
+				usage := summarizeVolumeIO(series[volume.ID], lookback)
+				usage.idleShare = math.Min(idle[volume.ID]/lookback.Seconds(), 1)
+
+				change, ok := tierChange(*volume, usage)
+				if !ok {
+					continue
+				}
+				current, okCurrent := prices[volume.VolumeType]
+				target, okTarget := prices[change.TargetType]
+				if !okCurrent || !okTarget {
+					continue
+				}
+				change.CurrentMonthlyCostUSD = volumeMonthlyCost(*volume, current)
+				change.TargetMonthlyCostUSD = target * float64(volume.StorageUsed) / gib
+				if change.TargetType == "gp3" {
+					change.TargetMonthlyCostUSD += float64(change.IOPS-gp3BaselineIOPS)*gp3IOPSUSDPerMonth +
+						float64(change.Throughput-gp3BaselineThroughput)*gp3ThroughputUSDPerMonth
+				}
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	savePrices(book)
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].MonthlySavingsUSD() != changes[j].MonthlySavingsUSD() {
+			return changes[i].MonthlySavingsUSD() > changes[j].MonthlySavingsUSD()
+		}
+		if riskRank(changes[i].Risk) != riskRank(changes[j].Risk) {
+			return riskRank(changes[i].Risk) < riskRank(changes[j].Risk)
+		}
+		return changes[i].Volume.ID < changes[j].Volume.ID
+	})
+
+	return changes, nil
+}
+
+func riskRank(risk string) int {
+	switch risk {
+	case RiskLow:
+		return 0
+	case RiskMedium:
+		return 1
+	}
+	return 2
+}
+
+// volumeMonthlyCost prices a volume from its per GB-month storage price,
+// adding the IOPS and throughput gp3 volumes provision above the baseline.
+func volumeMonthlyCost(volume EntityUsage, price float64) float64 {
+	cost := price * float64(volume.StorageUsed) / gib
+	if volume.VolumeType == "gp3" {
+		cost += float64(max(volume.IOPS-gp3BaselineIOPS, 0))*gp3IOPSUSDPerMonth +
+			float64(max(volume.Throughput-gp3BaselineThroughput, 0))*gp3ThroughputUSDPerMonth
+	}
+	return cost
+}
+
+// summarizeVolumeIO reduces the five minute IO of a volume to its peaks,
+// mean throughput over the lookback window and average IO size.
+// CloudWatch leaves out the periods without IO.
+func summarizeVolumeIO(io volumeIO, lookback time.Duration) volumeUsage {
+	var usage volumeUsage
+	var ops, mib float64
+	for _, value := range io.iops {
+		usage.peakIOPS = math.Max(usage.peakIOPS, value)
+		ops += value
+	}
+	for _, value := range io.throughput {
+		usage.peakThroughput = math.Max(usage.peakThroughput, value)
+		mib += value
+	}
+	usage.averageThroughput = mib * gp2PeakPeriod.Seconds() / lookback.Seconds()
+	if ops > 0 {
+		usage.averageIOSizeKiB = mib * 1024 / ops
+	}
+	return usage
+}
+
+// tierChange recommends a type for a volume from its IO, if another type
+// suits it better.
+func tierChange(volume EntityUsage, usage volumeUsage) (TierChange, bool) {
+	change := TierChange{
+		Volume:            volume,
+		PeakIOPS:          usage.peakIOPS,
+		PeakThroughput:    usage.peakThroughput,
+		AverageThroughput: usage.averageThroughput,
+		AverageIOSizeKiB:  usage.averageIOSizeKiB,
+		IdleShare:         usage.idleShare,
+	}
+	size := float64(volume.StorageUsed) / gib
+
+	if limits, ok := hddVolumeTypes[volume.VolumeType]; ok && hotHDD(limits, size, usage) {
+		change.Risk = RiskLow
+		if volume.VolumeType == "sc1" && fitsHDD(hddVolumeTypes["st1"], size, usage) && usage.averageIOSizeKiB >= sequentialIOKiB {
+			change.TargetType = "st1"
+			change.Reason = fmt.Sprintf("sequential IO above the sc1 baseline of %.0f MiB/s", limits.baseline(size))
+			return change, true
+		}
+		change.TargetType = "gp3"
+		iops := math.Max(gp3BaselineIOPS, math.Ceil(usage.peakIOPS))
+		change.IOPS = int32(math.Min(iops, math.Min(gp3MaxIOPS, math.Max(gp3BaselineIOPS, size*gp3IOPSPerGiB))))
+		change.Throughput = int32(math.Min(math.Max(gp3BaselineThroughput, math.Ceil(usage.peakThroughput)), gp3MaxThroughput))
+		change.Reason = "IO exceeds what " + volume.VolumeType + " sustains"
+		return change, true
+	}
+
+	if volume.StorageUsed < minHDDVolumeSize || volume.VolumeType == "sc1" {
+		return TierChange{}, false
+	}
+	for _, target := range []string{"sc1", "st1"} {
+		if target == volume.VolumeType {
+			break
+		}
+		limits := hddVolumeTypes[target]
+		if !fitsHDD(limits, size, usage) {
+			continue
+		}
+		change.TargetType = target
+		switch {
+		case usage.peakIOPS == 0:
+			change.Risk = RiskLow
+			change.Reason = "no IO"
+		case usage.idleShare >= mostlyIdleShare:
+			change.Risk = RiskLow
+			change.Reason = fmt.Sprintf("idle %.0f%% of the time", usage.idleShare*100)
+		case usage.averageIOSizeKiB >= largeIOKiB && usage.peakThroughput <= limits.burst(size)/2:
+			change.Risk = RiskLow
+			change.Reason = fmt.Sprintf("large sequential IO well within the %s burst of %.0f MiB/s", target, limits.burst(size))
+		case usage.averageIOSizeKiB >= sequentialIOKiB:
+			change.Risk = RiskMedium
+			change.Reason = fmt.Sprintf("sequential IO within the %s limits", target)
+		default:
+			change.Risk = RiskHigh
+			change.Reason = fmt.Sprintf("small random IO (%.0f KiB average) within the %s limits but slower on HDD", usage.averageIOSizeKiB, target)
+		}
+		return change, true
+	}
+	return TierChange{}, false
+}
+
+// fitsHDD reports whether IO stays within the limits of an HDD type:
+// peaks within its IOPS limit and burst throughput, and the mean within
+// its baseline so that the burst bucket does not run dry.
+func fitsHDD(limits hddLimits, size float64, usage volumeUsage) bool {
+	return usage.peakIOPS <= limits.maxIOPS &&
+		usage.peakThroughput <= limits.burst(size) &&
+		usage.averageThroughput <= limits.baseline(size)
+}
+
+// hotHDD reports whether an HDD volume outgrew its type: its mean
+// throughput drains the burst bucket, it nears the IOPS limit, or it
+// serves small random IO most of the time.
+func hotHDD(limits hddLimits, size float64, usage volumeUsage) bool {
+	return usage.averageThroughput > limits.baseline(size) ||
+		usage.peakIOPS > limits.maxIOPS*hotHDDIOPSShare ||
+		(usage.averageIOSizeKiB > 0 && usage.averageIOSizeKiB < sequentialIOKiB && usage.idleShare < 0.5)
+}
+
+// getVolumeIdleTime returns the seconds each volume spent without any IO
+// over the lookback window.
+func getVolumeIdleTime(ctx context.Context, cw *cloudwatch.Client, volumes []*EntityUsage, now time.Time, lookback time.Duration) (map[string]float64, error) {
+	period := int32(lookback.Truncate(time.Hour).Seconds())
+
+	// Query IDs are "idle" followed by the index of the volume.
+	var queries []cwtypes.MetricDataQuery
+	for i, volume := range volumes {
+		queries = append(queries, cwtypes.MetricDataQuery{
+			Id: aws.String(fmt.Sprintf("idle%d", i)),
+			MetricStat: &cwtypes.MetricStat{
+				Metric: &cwtypes.Metric{
+					Namespace:  aws.String("AWS/EBS"),
+					MetricName: aws.String("VolumeIdleTime"),
+					Dimensions: []cwtypes.Dimension{{Name: aws.String("VolumeId"), Value: aws.String(volume.ID)}},
+				},
+				Period: aws.Int32(period),
+				Stat:   aws.String("Sum"),
+			},
+		})
+	}
+
+	idle := map[string]float64{}
+	paginator := cloudwatch.NewGetMetricDataPaginator(cw, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(now.Add(-lookback)),
+		EndTime:           aws.Time(now),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range page.MetricDataResults {
+			index, err := strconv.Atoi(aws.ToString(result.Id)[len("idle"):])
+			if err != nil || index >= len(volumes) {
+				continue
+			}
+			for _, value := range result.Values {
+				idle[volumes[index].ID] += value
+			}
+		}
+	}
+
+	return idle, nil
+}
@@ -0,0 +1,199 @@
+// Package humanize formats byte sizes in the units crankymosquitos reports
+// them in and parses the sizes given to its threshold flags in the same
+// units.
+package humanize
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Units selects how sizes are written.
+type Units string
+
+const (
+	// Binary scales by powers of 1024: KiB, MiB, GiB, TiB and PiB.
+	Binary Units = "binary"
+	// SI scales by powers of 1000: kB, MB, GB, TB and PB.
+	SI Units = "si"
+	// RawBytes writes the exact number of bytes.
+	RawBytes Units = "raw-bytes"
+	// GB writes whole gibibytes labelled GB, as AWS reports volume and
+	// snapshot sizes, and tebibytes labelled TB from 1 TiB up.
+	GB Units = "gb"
+)
+
+// AllUnits lists the supported units.
+var AllUnits = []Units{Binary, SI, RawBytes, GB}
+
+const (
+	kib = 1 << 10
+	gib = 1 << 30
+	tib = 1 << 40
+)
+
+var (
+	binaryPrefixes = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	siPrefixes     = []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+)
+
+// sizeUnits are the units sizes are parsed in, in bytes, by lowercase name.
+// Decimal prefixes are powers of 1024 as well, as in the GB units and the
+// sizes AWS reports.
+var sizeUnits = map[string]float64{
+	"":      1,
+	"b":     1,
+	"bytes": 1,
+	"k":     1 << 10,
+	"kb":    1 << 10,
+	"mb":    1 << 20,
+	"gb":    1 << 30,
+	"tb":    1 << 40,
+	"pb":    1 << 50,
+	"eb":    1 << 60,
+	"kib":   1 << 10,
+	"mib":   1 << 20,
+	"gib":   1 << 30,
+	"tib":   1 << 40,
+	"pib":   1 << 50,
+	"eib":   1 << 60,
+}
+
+// siSizeUnits are the units sizes are parsed in with the SI units, whose
+// decimal prefixes are powers of 1000.
+var siSizeUnits = map[string]float64{
+	"":      1,
+	"b":     1,
+	"bytes": 1,
+	"k":     1e3,
+	"kb":    1e3,
+	"mb":    1e6,
+	"gb":    1e9,
+	"tb":    1e12,
+	"pb":    1e15,
+	"eb":    1e18,
+	"kib":   1 << 10,
+	"mib":   1 << 20,
+	"gib":   1 << 30,
+	"tib":   1 << 40,
+	"pib":   1 << 50,
+	"eib":   1 << 60,
+}
+
+// ParseUnits validates a units name.
+func ParseUnits(s string) (Units, error) {
+	for _, units := range AllUnits {
+		if string(units) == s {
+			return units, nil
+		}
+	}
+	return "", fmt.Errorf("invalid units %q: must be binary, si, raw-bytes or gb", s)
+}
+
+// Bytes formats a size for people to read, with its unit.
+func Bytes(n int64, units Units) string {
+	switch units {
+	case SI:
+		return scale(n, 1000, siPrefixes)
+	case RawBytes:
+		return fmt.Sprintf("%d bytes", n)
+	case GB:
+		switch {
+		case abs(n) >= tib:
+			return fmt.Sprintf("%.2f TB", float64(n)/tib)
+		case abs(n) >= gib:
+			return fmt.Sprintf("%.0f GB", float64(n)/gib)
+		}
+	}
+	return scale(n, kib, binaryPrefixes)
+}
+
+// Value formats a size as a report column: a bare number of bytes or whole
+// gigabytes for RawBytes and GB, which spreadsheets and scripts can sum, or
+// the Bytes text otherwise.
+func Value(n int64, units Units) string {
+	switch units {
+	case RawBytes:
+		return strconv.FormatInt(n, 10)
+	case GB:
+		return fmt.Sprintf("%.0f", float64(n)/gib)
+	}
+	return Bytes(n, units)
+}
+
+// ParseValue reads back a column Value wrote in the same units. Values with
+// a unit are parsed as by ParseSize.
+func ParseValue(s string, units Units) (int64, error) {
+	s = strings.TrimSpace(s)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return ParseSize(s, units)
+	}
+	if units == RawBytes {
+		return n, nil
+	}
+	return n * gib, nil
+}
+
+// ParseSize parses a size such as "250GiB", "1.5 TB" or "1024" given in
+// units into bytes, reading the sizes Bytes writes back. KiB, MiB, GiB, TiB,
+// PiB and EiB are powers of 1024. kB, MB, GB, TB, PB and EB are powers of
+// 1000 with SI, as SI prints them, and of 1024 otherwise, as the GB units
+// print them. A bare number is bytes.
+func ParseSize(s string, units Units) (int64, error) {
+	if units == SI {
+		return parseBytes(s, siSizeUnits)
+	}
+	return parseBytes(s, sizeUnits)
+}
+
+// ParseBytes parses a size with the decimal prefixes as powers of 1024, as
+// AWS reports sizes such as "6 MB".
+func ParseBytes(s string) (int64, error) {
+	return ParseSize(s, Binary)
+}
+
+func parseBytes(s string, units map[string]float64) (int64, error) {
+	s = strings.TrimSpace(s)
+	number := strings.TrimRightFunc(s, func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+	})
+
+	unit, ok := units[strings.ToLower(strings.TrimSpace(s[len(number):]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	bytes := value * unit
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+
+	return int64(bytes), nil
+}
+
+// scale writes n in the largest prefix of base it reaches.
+func scale(n int64, base float64, prefixes []string) string {
+	if float64(abs(n)) < base {
+		return fmt.Sprintf("%d %s", n, prefixes[0])
+	}
+	value, exp := float64(n), 0
+	for math.Abs(value) >= base && exp < len(prefixes)-1 {
+		value /= base
+		exp++
+	}
+	return fmt.Sprintf("%.1f %s", value, prefixes[exp])
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package humanize_test
+
+import (
+	"testing"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+)
+
+const (
+	kib = int64(1) << 10
+	mib = int64(1) << 20
+	gib = int64(1) << 30
+	tib = int64(1) << 40
+	eib = int64(1) << 60
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in         string
+		binary, si int64 // Bytes in the other units and in SI; 0 for errors
+	}{
+		{"1024", 1024, 1024},
+		{"512 B", 512, 512},
+		{"3 bytes", 3, 3},
+		{"2k", 2 * kib, 2000},
+		{"2kB", 2 * kib, 2000},
+		{"100MB", 100 * mib, 100e6},
+		{"100GB", 100 * gib, 100e9},
+		{"100 gb", 100 * gib, 100e9},
+		{"1.5 TB", 3 * tib / 2, 15e11},
+		{"2PB", 2 << 50, 2e15},
+		{"1EB", eib, 1e18},
+		{"2KiB", 2 * kib, 2 * kib},
+		{"250GiB", 250 * gib, 250 * gib},
+		{"1.5TiB", 3 * tib / 2, 3 * tib / 2},
+		{"1EiB", eib, eib},
+		{"", 0, 0},
+		{"GB", 0, 0},
+		{"-1GB", 0, 0},
+		{"10 XB", 0, 0},
+		{"8EiB", 0, 0}, // Past MaxInt64
+	}
+
+	for _, tt := range tests {
+		for _, units := range humanize.AllUnits {
+			want := tt.binary
+			if units == humanize.SI {
+				want = tt.si
+			}
+			got, err := humanize.ParseSize(tt.in, units)
+			if want == 0 {
+				if err == nil {
+					t.Errorf("ParseSize(%q, %s) = %d, want an error", tt.in, units, got)
+				}
+				continue
+			}
+			if err != nil || got != want {
+				t.Errorf("ParseSize(%q, %s) = %d, %v, want %d", tt.in, units, got, err, want)
+			}
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	// AWS reports sizes such as ElastiCache's "6 MB" in powers of 1024
+	if got, err := humanize.ParseBytes("6 MB"); err != nil || got != 6*mib {
+		t.Errorf("ParseBytes(%q) = %d, %v, want %d", "6 MB", got, err, 6*mib)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		n     int64
+		units humanize.Units
+		want  string
+	}{
+		{512, humanize.Binary, "512 B"},
+		{3 * gib / 2, humanize.Binary, "1.5 GiB"},
+		{2 * tib, humanize.Binary, "2.0 TiB"},
+		{512, humanize.SI, "512 B"},
+		{15e8, humanize.SI, "1.5 GB"},
+		{2e12, humanize.SI, "2.0 TB"},
+		{123, humanize.RawBytes, "123 bytes"},
+		{100 * gib, humanize.GB, "100 GB"},
+		{3 * tib / 2, humanize.GB, "1.50 TB"},
+		{512 * mib, humanize.GB, "512.0 MiB"},
+		{-2 * gib, humanize.GB, "-2 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := humanize.Bytes(tt.n, tt.units); got != tt.want {
+			t.Errorf("Bytes(%d, %s) = %q, want %q", tt.n, tt.units, got, tt.want)
+		}
+	}
+}
+
+// TestRoundTrip formats sizes that every units write exactly and parses
+// them back in the same units, as a threshold copied from a report is.
+func TestRoundTrip(t *testing.T) {
+	sizes := map[humanize.Units][]int64{
+		humanize.Binary:   {512, 3 * kib / 2, 5 * gib, 3 * tib / 2},
+		humanize.SI:       {512, 1500, 5e9, 15e11},
+		humanize.RawBytes: {0, 1, 123456789},
+		humanize.GB:       {5 * gib, 100 * gib, 3 * tib / 2},
+	}
+
+	for units, values := range sizes {
+		for _, n := range values {
+			text := humanize.Bytes(n, units)
+			if got, err := humanize.ParseSize(text, units); err != nil || got != n {
+				t.Errorf("ParseSize(Bytes(%d, %s) = %q) = %d, %v", n, units, text, got, err)
+			}
+
+			value := humanize.Value(n, units)
+			if got, err := humanize.ParseValue(value, units); err != nil || got != n {
+				t.Errorf("ParseValue(Value(%d, %s) = %q) = %d, %v", n, units, value, got, err)
+			}
+		}
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	for _, units := range humanize.AllUnits {
+		if got, err := humanize.ParseUnits(string(units)); err != nil || got != units {
+			t.Errorf("ParseUnits(%q) = %q, %v", units, got, err)
+		}
+	}
+	if _, err := humanize.ParseUnits("GiB"); err == nil {
+		t.Error("ParseUnits accepted an unknown name")
+	}
+}
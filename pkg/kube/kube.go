@@ -0,0 +1,422 @@
+// Package kube lists the EBS volumes bound to Kubernetes PersistentVolumes,
+// with the claim and pods using each, through the API server of a
+// kubeconfig context. It reads the API directly rather than through
+// client-go, which would dwarf the rest of the dependencies.
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// EBSCSIDriver is the CSI driver of EBS-backed PersistentVolumes.
+const EBSCSIDriver = "ebs.csi.aws.com"
+
+// listLimit is the number of objects requested per page of a list.
+const listLimit = 500
+
+// VolumeClaim is an EBS volume bound to a PersistentVolume.
+type VolumeClaim struct {
+	VolumeID         string
+	PersistentVolume string
+	Namespace        string   // Namespace of the claim, empty for unclaimed volumes
+	Claim            string   // PersistentVolumeClaim bound to the volume
+	Pods             []string // Running or pending pods mounting the claim, sorted
+}
+
+// kubeconfig is the part of a kubeconfig file the client reads.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User userAuth `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+type userAuth struct {
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Exec                  *execConfig `yaml:"exec"`
+}
+
+// execConfig runs a credential plugin, such as aws eks get-token.
+type execConfig struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+// Client reads the API server of a kubeconfig context.
+type Client struct {
+	Context string
+
+	server string
+	http   *http.Client
+	auth   userAuth
+	dir    string // Relative paths of the kubeconfig are resolved against it
+
+	mu       sync.Mutex
+	token    string
+	tokenExp time.Time // Zero for tokens that do not expire
+}
+
+// NewClient connects to the API server of a context of the kubeconfig at
+// path, its current context when contextName is empty.
+func NewClient(path, contextName string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode kubeconfig: %w", err)
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	if contextName == "" {
+		return nil, errors.New("kubeconfig has no current context")
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+
+	client := &Client{Context: contextName, dir: filepath.Dir(path)}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	found = false
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		client.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		tlsConfig.ServerName = c.Cluster.TLSServerName
+
+		ca, err := client.readData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the certificate authority of cluster %s: %w", clusterName, err)
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid certificate authority of cluster %s", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if !found || client.server == "" {
+		return nil, fmt.Errorf("cluster %q of context %q not found in kubeconfig", clusterName, contextName)
+	}
+
+	for _, u := range config.Users {
+		if u.Name == userName {
+			client.auth = u.User
+		}
+	}
+	cert, err := client.readData(client.auth.ClientCertificateData, client.auth.ClientCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client certificate of user %s: %w", userName, err)
+	}
+	key, err := client.readData(client.auth.ClientKeyData, client.auth.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client key of user %s: %w", userName, err)
+	}
+	if cert != nil && key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate of user %s: %w", userName, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.http = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	return client, nil
+}
+
+// readData returns the base64 data of a kubeconfig field, or the content of
+// the file its path field names, nil when neither is set.
+func (c *Client) readData(data, path string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(c.resolve(path))
+}
+
+func (c *Client) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+// bearerToken returns the token requests are authenticated with, running
+// the credential plugin again once its token expired.
+func (c *Client) bearerToken(ctx context.Context) (string, error) {
+	switch {
+	case c.auth.Token != "":
+		return c.auth.Token, nil
+	case c.auth.TokenFile != "":
+		data, err := os.ReadFile(c.resolve(c.auth.TokenFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case c.auth.Exec == nil:
+		return "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && (c.tokenExp.IsZero() || time.Until(c.tokenExp) > time.Minute) {
+		return c.token, nil
+	}
+
+	plugin := c.auth.Exec
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range plugin.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	info, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": plugin.APIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]bool{"interactive": false},
+	})
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(info))
+	cmd.Stderr = io.Discard
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run credential plugin %s: %w", plugin.Command, err)
+	}
+	var credential struct {
+		Status struct {
+			Token               string    `json:"token"`
+			ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &credential); err != nil {
+		return "", fmt.Errorf("failed to decode the credential of plugin %s: %w", plugin.Command, err)
+	}
+	if credential.Status.Token == "" {
+		return "", fmt.Errorf("credential plugin %s returned no token", plugin.Command)
+	}
+	c.token, c.tokenExp = credential.Status.Token, credential.Status.ExpirationTimestamp
+	return c.token, nil
+}
+
+// list reads every page of a list endpoint, calling add with the items of
+// each page.
+func (c *Client) list(ctx context.Context, path string, add func(items json.RawMessage) error) error {
+	token, err := c.bearerToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	for next := ""; ; {
+		query := url.Values{"limit": {fmt.Sprint(listLimit)}}
+		if next != "" {
+			query.Set("continue", next)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items json.RawMessage `json:"items"`
+		}
+		if resp.StatusCode/100 != 2 {
+			resp.Body.Close()
+			return fmt.Errorf("GET %s returned %s", path, resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		if err := add(page.Items); err != nil {
+			return err
+		}
+		if next = page.Metadata.Continue; next == "" {
+			return nil
+		}
+	}
+}
+
+type persistentVolume struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		CSI *struct {
+			Driver       string `json:"driver"`
+			VolumeHandle string `json:"volumeHandle"`
+		} `json:"csi"`
+		AWSElasticBlockStore *struct {
+			VolumeID string `json:"volumeID"`
+		} `json:"awsElasticBlockStore"`
+		ClaimRef *struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"claimRef"`
+	} `json:"spec"`
+}
+
+type pod struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Volumes []struct {
+			PersistentVolumeClaim *struct {
+				ClaimName string `json:"claimName"`
+			} `json:"persistentVolumeClaim"`
+		} `json:"volumes"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// ebsVolumeID returns the EBS volume backing a PersistentVolume, provisioned
+// by the EBS CSI driver or the in-tree plugin, whose IDs may be prefixed
+// with aws://zone/.
+func (pv persistentVolume) ebsVolumeID() string {
+	switch {
+	case pv.Spec.CSI != nil && pv.Spec.CSI.Driver == EBSCSIDriver:
+		return pv.Spec.CSI.VolumeHandle
+	case pv.Spec.AWSElasticBlockStore != nil:
+		id := pv.Spec.AWSElasticBlockStore.VolumeID
+		return id[strings.LastIndex(id, "/")+1:]
+	}
+	return ""
+}
+
+// VolumeClaims returns the EBS-backed PersistentVolumes of the cluster with
+// their claims and the pods, not yet finished, mounting them.
+func (c *Client) VolumeClaims(ctx context.Context) ([]VolumeClaim, error) {
+	var claims []VolumeClaim
+	err := c.list(ctx, "/api/v1/persistentvolumes", func(items json.RawMessage) error {
+		var pvs []persistentVolume
+		if err := json.Unmarshal(items, &pvs); err != nil {
+			return fmt.Errorf("failed to decode persistent volumes: %w", err)
+		}
+		for _, pv := range pvs {
+			id := pv.ebsVolumeID()
+			if id == "" {
+				continue
+			}
+			claim := VolumeClaim{VolumeID: id, PersistentVolume: pv.Metadata.Name}
+			if ref := pv.Spec.ClaimRef; ref != nil {
+				claim.Namespace, claim.Claim = ref.Namespace, ref.Name
+			}
+			claims = append(claims, claim)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+
+	pods := map[string][]string{} // By namespace/claim
+	err = c.list(ctx, "/api/v1/pods", func(items json.RawMessage) error {
+		var page []pod
+		if err := json.Unmarshal(items, &page); err != nil {
+			return fmt.Errorf("failed to decode pods: %w", err)
+		}
+		for _, p := range page {
+			if p.Status.Phase == "Succeeded" || p.Status.Phase == "Failed" {
+				continue
+			}
+			for _, volume := range p.Spec.Volumes {
+				if pvc := volume.PersistentVolumeClaim; pvc != nil {
+					key := p.Metadata.Namespace + "/" + pvc.ClaimName
+					pods[key] = append(pods[key], p.Metadata.Name)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for i := range claims {
+		if claims[i].Claim == "" {
+			continue
+		}
+		claims[i].Pods = pods[claims[i].Namespace+"/"+claims[i].Claim]
+		sort.Strings(claims[i].Pods)
+	}
+	return claims, nil
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+)
+
+//go:embed templates/report.html.tmpl
+var templates embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").Funcs(template.FuncMap{
+	"cell":  cell,
+	"bytes": func(n int64) string { return humanize.Bytes(n, Units) },
+}).ParseFS(templates, "templates/report.html.tmpl"))
+
+// htmlBar is one bar of a chart.
+type htmlBar struct {
+	Label   string
+	Value   int64   // Bytes
+	Percent float64 // Of the largest bar
+}
+
+type htmlReport struct {
+	GeneratedAt string
+	Columns     []string
+	Rows        []Row
+	Total       int64 // Bytes
+	Charts      []htmlChart
+}
+
+type htmlChart struct {
+	Title string
+	Bars  []htmlBar
+}
+
+func init() {
+	formatters["html"] = FormatterFunc(formatHTML)
+}
+
+// formatHTML renders a standalone page with the rows as a sortable table,
+// the Link column as links, and bar charts of the StorageUsed column summed
+// per Region and per Type. It loads nothing from the network, so it can be
+// attached to an email.
+func formatHTML(w io.Writer, columns []string, rows []Row) error {
+	columns = usedColumns(columns, rows)
+
+	report := htmlReport{
+		GeneratedAt: time.Now().UTC().Format(time.RFC1123),
+		Columns:     columns,
+		Rows:        rows,
+	}
+	for _, row := range rows {
+		report.Total += storageUsed(row)
+	}
+	report.Charts = []htmlChart{
+		{Title: "Storage Used by Region", Bars: sumBy(rows, "Region")},
+		{Title: "Storage Used by Type", Bars: sumBy(rows, "Type")},
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+// storageUsed reads the StorageUsed column of a row in Units.
+func storageUsed(row Row) int64 {
+	value, err := humanize.ParseValue(cell(row, "StorageUsed"), Units)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// sumBy sums the StorageUsed of the rows per value of column, largest first.
+func sumBy(rows []Row, column string) []htmlBar {
+	totals := map[string]int64{}
+	for _, row := range rows {
+		totals[cell(row, column)] += storageUsed(row)
+	}
+
+	bars := make([]htmlBar, 0, len(totals))
+	for label, value := range totals {
+		if label == "" {
+			label = fmt.Sprintf("(no %s)", column)
+		}
+		bars = append(bars, htmlBar{Label: label, Value: value})
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].Value != bars[j].Value {
+			return bars[i].Value > bars[j].Value
+		}
+		return bars[i].Label < bars[j].Label
+	})
+
+	if len(bars) > 0 && bars[0].Value > 0 {
+		for i := range bars {
+			bars[i].Percent = 100 * float64(bars[i].Value) / float64(bars[0].Value)
+		}
+	}
+	return bars
+}
@@ -0,0 +1,180 @@
+// Package output renders report rows in the supported output formats.
+//
+// Formats are looked up by name; additional formats can be plugged in with
+// Register.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/taylormonacelli/crankymosquitos/pkg/humanize"
+	"go.yaml.in/yaml/v3"
+)
+
+// Row is one report entry keyed by column name. Columns that do not apply to
+// an entry are left out.
+type Row map[string]interface{}
+
+// Units are the units of the size columns of the rows, which formats that
+// total them read back. humanize.GB unless set before formatting.
+var Units = humanize.GB
+
+// Formatter writes rows to w. Columns lists every column in display order;
+// formats with a fixed layout use it, the others may ignore it.
+type Formatter interface {
+	Format(w io.Writer, columns []string, rows []Row) error
+}
+
+// FormatterFunc adapts a function to the Formatter interface.
+type FormatterFunc func(w io.Writer, columns []string, rows []Row) error
+
+func (f FormatterFunc) Format(w io.Writer, columns []string, rows []Row) error {
+	return f(w, columns, rows)
+}
+
+var (
+	mu         sync.RWMutex
+	formatters = map[string]Formatter{
+		"table": FormatterFunc(formatTable),
+		"csv":   FormatterFunc(formatCSV),
+		"json":  FormatterFunc(formatJSON),
+		"jsonl": FormatterFunc(formatJSONL),
+		"yaml":  FormatterFunc(formatYAML),
+	}
+)
+
+// Register makes a formatter available under name, replacing any existing
+// one.
+func Register(name string, f Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	formatters[name] = f
+}
+
+// Get returns the formatter registered under name.
+func Get(name string) (Formatter, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q: must be one of %s", name, strings.Join(namesLocked(), ", "))
+	}
+	return f, nil
+}
+
+// Names returns the registered format names, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usedColumns keeps the columns at least one row has a value for.
+func usedColumns(columns []string, rows []Row) []string {
+	var used []string
+	for _, column := range columns {
+		for _, row := range rows {
+			if _, ok := row[column]; ok {
+				used = append(used, column)
+				break
+			}
+		}
+	}
+	return used
+}
+
+func cell(row Row, column string) string {
+	value, ok := row[column]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func formatTable(w io.Writer, columns []string, rows []Row) error {
+	columns = usedColumns(columns, rows)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = cell(row, column)
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+func formatCSV(w io.Writer, columns []string, rows []Row) error {
+	columns = usedColumns(columns, rows)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = cell(row, column)
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatJSON(w io.Writer, columns []string, rows []Row) error {
+	if rows == nil {
+		rows = []Row{}
+	}
+
+	data, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+func formatJSONL(w io.Writer, columns []string, rows []Row) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatYAML(w io.Writer, columns []string, rows []Row) error {
+	if rows == nil {
+		rows = []Row{}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(rows); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
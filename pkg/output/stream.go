@@ -0,0 +1,115 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RowWriter writes rows one at a time as they are produced, without
+// holding the whole report in memory. Close finishes the output; rows
+// cannot be written after.
+type RowWriter interface {
+	WriteRow(row Row) error
+	Close() error
+}
+
+// StreamFormats are the formats NewRowWriter streams.
+var StreamFormats = []string{"csv", "json", "jsonl"}
+
+// NewRowWriter returns a RowWriter of a format of StreamFormats writing to
+// w. Unlike the formatter of the format, which only keeps the columns some
+// row uses, csv writes every column since later rows are not known yet.
+func NewRowWriter(format string, w io.Writer, columns []string) (RowWriter, error) {
+	switch format {
+	case "csv":
+		return NewCSVRowWriter(w, columns)
+	case "json":
+		return NewJSONRowWriter(w, ""), nil
+	case "jsonl":
+		return &jsonlRowWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("output format %q cannot be streamed: must be one of %s", format, strings.Join(StreamFormats, ", "))
+}
+
+// JSONRowWriter writes rows as the elements of an indented JSON array,
+// formatted like the json format. Prefix indents every line after the
+// opening bracket, to nest the array in an enclosing document.
+type JSONRowWriter struct {
+	w      io.Writer
+	prefix string
+	rows   int
+}
+
+// NewJSONRowWriter returns a JSONRowWriter writing to w.
+func NewJSONRowWriter(w io.Writer, prefix string) *JSONRowWriter {
+	return &JSONRowWriter{w: w, prefix: prefix}
+}
+
+func (j *JSONRowWriter) WriteRow(row Row) error {
+	data, err := json.MarshalIndent(row, j.prefix+"  ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if j.rows == 0 {
+		separator = "[\n"
+	}
+	j.rows++
+	_, err = fmt.Fprintf(j.w, "%s%s  %s", separator, j.prefix, data)
+	return err
+}
+
+// Close ends the array without a trailing newline, which the enclosing
+// document or the caller adds.
+func (j *JSONRowWriter) Close() error {
+	if j.rows == 0 {
+		_, err := io.WriteString(j.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintf(j.w, "\n%s]", j.prefix)
+	return err
+}
+
+type jsonlRowWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlRowWriter) WriteRow(row Row) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlRowWriter) Close() error {
+	return nil
+}
+
+// CSVRowWriter writes rows as CSV records under a header of every column.
+type CSVRowWriter struct {
+	cw      *csv.Writer
+	columns []string
+}
+
+// NewCSVRowWriter writes the header of columns to w and returns a
+// CSVRowWriter writing the rows after it.
+func NewCSVRowWriter(w io.Writer, columns []string) (*CSVRowWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+	return &CSVRowWriter{cw: cw, columns: columns}, nil
+}
+
+func (c *CSVRowWriter) WriteRow(row Row) error {
+	values := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		values[i] = cell(row, column)
+	}
+	return c.cw.Write(values)
+}
+
+func (c *CSVRowWriter) Close() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gcsMetadataToken is the GCE metadata server endpoint returning an access
+// token of the instance's service account.
+const gcsMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCS uploads the report to a Google Cloud Storage object, gs://bucket/name,
+// with the JSON API. The access token is read from GOOGLE_OAUTH_ACCESS_TOKEN,
+// or else from the metadata server of the GCE instance or GKE pod.
+// STORAGE_EMULATOR_HOST points it at an emulator.
+type GCS struct {
+	Bucket string
+	Object string
+	Client *http.Client
+}
+
+func openGCS(u *url.URL) (ReportSink, error) {
+	object := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || object == "" || strings.HasSuffix(object, "/") {
+		return nil, fmt.Errorf("invalid GCS URL %q: expected gs://bucket/object", u)
+	}
+	return &GCS{Bucket: u.Host, Object: object, Client: http.DefaultClient}, nil
+}
+
+func (g *GCS) Write(ctx context.Context, report []byte) error {
+	token, err := g.token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a GCS access token: %w", err)
+	}
+
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	query := url.Values{"uploadType": {"media"}, "name": {g.Object}}
+	target := endpoint + "/upload/storage/v1/b/" + url.PathEscape(g.Bucket) + "/o?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(report))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", g, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload %s: %s: %s", g, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (g *GCS) String() string {
+	return "gs://" + g.Bucket + "/" + g.Object
+}
+
+// token returns the access token of the upload, "" against an emulator
+// without GOOGLE_OAUTH_ACCESS_TOKEN.
+func (g *GCS) token(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		return "", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcsMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN and no metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode metadata server token: %w", err)
+	}
+	return token.AccessToken, nil
+}
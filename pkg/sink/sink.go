@@ -0,0 +1,136 @@
+// Package sink writes finished reports to their destination: a local file,
+// stdout or a cloud storage object.
+//
+// Destinations are URIs looked up by scheme; additional schemes can be
+// plugged in with Register.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ReportSink receives a formatted report.
+type ReportSink interface {
+	// Write stores the report, replacing any earlier one at the destination.
+	Write(ctx context.Context, report []byte) error
+	// String names the destination in messages.
+	String() string
+}
+
+// Opener returns the sink of a destination URI of its scheme.
+type Opener func(u *url.URL) (ReportSink, error)
+
+var (
+	mu      sync.RWMutex
+	openers = map[string]Opener{
+		"file":   openFile,
+		"stdout": openStdout,
+		"gs":     openGCS,
+	}
+)
+
+// Register makes an opener available for a URI scheme, replacing any
+// existing one.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[scheme] = open
+}
+
+// Open returns the sink of a destination. "-", "stdout:" and "" are stdout,
+// and a destination without a scheme is a local file path.
+func Open(dest string) (ReportSink, error) {
+	if dest == "" || dest == "-" {
+		return Stdout, nil
+	}
+	scheme, _, found := strings.Cut(dest, ":")
+	if !found || !validScheme(scheme) {
+		return File(dest), nil
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report destination %q: %w", dest, err)
+	}
+
+	mu.RLock()
+	open, ok := openers[strings.ToLower(u.Scheme)]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown report destination scheme %q: must be one of %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(u)
+}
+
+// Schemes returns the registered URI schemes, sorted.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// validScheme reports whether s can be a URI scheme. Single letters are
+// taken for Windows drive letters.
+func validScheme(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	for i, r := range s {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// File writes the report to a local file.
+type File string
+
+func openFile(u *url.URL) (ReportSink, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("invalid file URL %q: only local files are supported", u)
+	}
+	return File(filepath.FromSlash(u.Path)), nil
+}
+
+func (f File) Write(ctx context.Context, report []byte) error {
+	if err := os.WriteFile(string(f), report, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", string(f), err)
+	}
+	return nil
+}
+
+func (f File) String() string {
+	return string(f)
+}
+
+type stdout struct{}
+
+// Stdout writes the report to standard output.
+var Stdout ReportSink = stdout{}
+
+func openStdout(u *url.URL) (ReportSink, error) {
+	return Stdout, nil
+}
+
+func (stdout) Write(ctx context.Context, report []byte) error {
+	_, err := os.Stdout.Write(report)
+	return err
+}
+
+func (stdout) String() string {
+	return "stdout"
+}
@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Report is a decoded report migrated to LatestVersion.
+type Report struct {
+	// Version is the schema version the report was written with.
+	Version string
+	// GeneratedAt is when the report was scanned, zero for version 1
+	// reports, which do not record it.
+	GeneratedAt time.Time
+	// Units are the units of the entity sizes, empty for whole gigabytes.
+	Units string
+	// Entities are the report rows in the LatestVersion layout.
+	Entities []map[string]interface{}
+}
+
+// migration upgrades a decoded report document by one version.
+type migration struct {
+	to      string
+	migrate func(doc interface{}) (interface{}, error)
+}
+
+// migrations maps a version to the shim upgrading it to the next one. Every
+// version but LatestVersion needs an entry.
+var migrations = map[string]migration{
+	"1": {to: "2", migrate: wrapEntities},
+}
+
+// wrapEntities puts the bare entity array of a version 1 report into a
+// version 2 envelope. The run metadata was never recorded, so it stays
+// empty.
+func wrapEntities(doc interface{}) (interface{}, error) {
+	items, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("version 1 report is not an array")
+	}
+	return map[string]interface{}{
+		"schema_version": "2",
+		"entities":       items,
+	}, nil
+}
+
+// DetectVersion returns the schema version of a decoded report document.
+// Version 1 reports are bare arrays; later versions are objects carrying a
+// "schema_version" field.
+func DetectVersion(doc interface{}) (string, error) {
+	switch doc := doc.(type) {
+	case []interface{}:
+		return "1", nil
+	case map[string]interface{}:
+		if version, ok := doc["schema_version"].(string); ok {
+			return version, nil
+		}
+		return "", fmt.Errorf("report object has no schema_version")
+	}
+	return "", fmt.Errorf("report is neither an array nor an object")
+}
+
+// Read decodes a report of any known schema version, validates it against
+// that version and migrates it to LatestVersion, so older reports stay
+// usable after the format evolves.
+func Read(r io.Reader) (*Report, error) {
+	doc, err := jsonschema.UnmarshalJSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("report is not valid JSON: %w", err)
+	}
+
+	version, err := DetectVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := Compile(version)
+	if err != nil {
+		return nil, err
+	}
+	if err := sch.Validate(doc); err != nil {
+		return nil, fmt.Errorf("report does not match schema v%s: %w", version, err)
+	}
+
+	for current := version; current != LatestVersion; {
+		step, ok := migrations[current]
+		if !ok {
+			return nil, fmt.Errorf("no migration from report schema v%s", current)
+		}
+		if doc, err = step.migrate(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate report from v%s to v%s: %w", current, step.to, err)
+		}
+		current = step.to
+	}
+
+	envelope, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected v%s report layout", LatestVersion)
+	}
+	entities, err := latestEntities(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Version: version, Entities: entities}
+	report.Units, _ = envelope["units"].(string)
+	if generatedAt, ok := envelope["generated_at"].(string); ok {
+		if report.GeneratedAt, err = time.Parse(time.RFC3339, generatedAt); err != nil {
+			return nil, fmt.Errorf("invalid generated_at: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// latestEntities extracts the rows of a LatestVersion envelope.
+func latestEntities(envelope map[string]interface{}) ([]map[string]interface{}, error) {
+	items, ok := envelope["entities"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected v%s report layout", LatestVersion)
+	}
+
+	entities := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		entity, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected v%s report entry", LatestVersion)
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
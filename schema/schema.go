@@ -0,0 +1,70 @@
+// Package schema holds the JSON Schemas of the report formats.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+//go:embed report.*.json
+var files embed.FS
+
+// LatestVersion is the report schema version the tool writes.
+const LatestVersion = "2"
+
+// Versions lists every report schema version that can be validated against.
+var Versions = []string{"1", "2"}
+
+const baseURL = "https://github.com/taylormonacelli/crankymosquitos/schema/"
+
+func fileName(version string) string {
+	return fmt.Sprintf("report.v%s.json", version)
+}
+
+// Raw returns the schema document for a report version.
+func Raw(version string) ([]byte, error) {
+	data, err := files.ReadFile(fileName(version))
+	if err != nil {
+		return nil, fmt.Errorf("unknown report schema version %q", version)
+	}
+	return data, nil
+}
+
+// Compile returns the compiled schema for a report version.
+func Compile(version string) (*jsonschema.Schema, error) {
+	data, err := Raw(version)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(baseURL+fileName(version), doc); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(baseURL + fileName(version))
+}
+
+// Validate checks a report against the schema of the given version.
+func Validate(version string, report io.Reader) error {
+	sch, err := Compile(version)
+	if err != nil {
+		return err
+	}
+
+	inst, err := jsonschema.UnmarshalJSON(report)
+	if err != nil {
+		return fmt.Errorf("report is not valid JSON: %w", err)
+	}
+
+	return sch.Validate(inst)
+}